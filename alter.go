@@ -0,0 +1,562 @@
+package dbf
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AlterOptions contains the optional settings used by Alter
+type AlterOptions struct {
+	// Rename maps new field names (in upper case) to the names of the old fields they get their values from.
+	// New fields without a mapping get the values of the old field with the same name,
+	// or empty values when there is no such field. Old fields that are not used are dropped.
+	Rename map[string]string
+
+	// Convert contains custom conversions by new field name (in upper case), used instead of the default conversion.
+	// The function gets the old value, or nil for new fields and null values, and returns the new value.
+	Convert map[string]func(val interface{}) (interface{}, error)
+
+	// Strict stops at the first value that can not be converted and leaves the table unchanged,
+	// by default the field is left empty and the failure is reported in AlterReport.
+	Strict bool
+
+	// Pack skips deleted records, by default they are copied and stay marked as deleted
+	Pack bool
+
+	// Create contains the options for the new table, by default the file version, code page,
+	// table flags and memo block size of the old table are used
+	Create *CreateOptions
+}
+
+// AlterReport contains the result of Alter
+type AlterReport struct {
+	Records  uint32            // Number of records written to the new table
+	Failures []ConversionError // Values that could not be converted, these fields are left empty
+}
+
+// ConversionError describes an old value that could not be converted to the type of its new field
+type ConversionError struct {
+	RecNo uint32      // Zero based record number in the old table
+	Field string      // Name of the new field
+	Value interface{} // Old value
+	Err   error       // Underlying error
+}
+
+func (e *ConversionError) Error() string {
+	return fmt.Sprintf("record %d, field %s: can not convert %v: %s", e.RecNo, e.Field, e.Value, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *ConversionError) Unwrap() error {
+	return e.Err
+}
+
+// alterField is a field of the new table with the old field it gets its values from
+type alterField struct {
+	from    int // position of the old field or -1
+	convert func(val interface{}) (interface{}, error)
+}
+
+// Alter changes the structure of table filename (and its FPT file) to fields, see NewField to create fields.
+// Fields can be added, dropped, renamed, reordered and retyped. The records are copied to a new table in a
+// temporary file in the same directory, which replaces the old files when all records are copied.
+// The table is locked using LockFile until it is replaced, handles opened before keep using the old files and must
+// open the table again. The files to replace are recorded in a marker file next to the DBF file first, named like
+// the DBF file with -alter appended, so a replacement interrupted by a crash is completed when the table is opened.
+//
+// Values are converted to the type of their new field where possible: C values are parsed as numbers, dates
+// (YYYYMMDD or YYYY-MM-DD) and logicals, other values are formatted for C and M fields, the width of N fields
+// can change, D values become T values and the other way around. Values that can not be converted, including
+// values that do not fit their new field, are reported in AlterReport and the field is left empty.
+//
+// The _NullFlags system field is rebuilt when the new fields contain it: new nullable fields are null when their
+// old field is null, old null values are empty in fields that are not nullable. Deleted records stay deleted.
+// The database container backlink is kept.
+// Autoincrement fields keep their next value, or continue after the highest copied value.
+// The structural index flag is cleared, because the index no longer matches the table.
+func Alter(filename string, fields []FieldHeader, dec Decoder, enc Encoder, opts *AlterOptions) (*AlterReport, error) {
+	if opts == nil {
+		opts = new(AlterOptions)
+	}
+	filename = filepath.Clean(filename)
+	old, err := OpenFileRW(filename, dec, enc)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if old != nil {
+			old.Close()
+		}
+	}()
+	if err := old.LockFile(); err != nil {
+		return nil, err
+	}
+
+	createopts := opts.Create
+	if createopts == nil {
+		createopts = &CreateOptions{
+			FileVersion: old.header.FileVersion,
+			CodePage:    old.header.CodePage,
+			TableFlags:  old.header.TableFlags &^ 0x01,
+		}
+		if old.fptheader != nil {
+			createopts.BlockSize = old.fptheader.BlockSize
+		}
+	}
+	fields, mapping, err := old.alterFields(fields, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// the temporary files use the same extension, so the FPT filename matches
+	ext := filepath.Ext(filename)
+	tmp, err := ioutil.TempFile(filepath.Dir(filename), strings.TrimSuffix(filepath.Base(filename), ext)+"-alter-*"+ext)
+	if err != nil {
+		return nil, err
+	}
+	tmpname := tmp.Name()
+	tmp.Close()
+	removeTemp := func() {
+		os.Remove(tmpname)
+		os.Remove(fptFilename(tmpname))
+	}
+
+	dbf, err := CreateFile(tmpname, fields, dec, enc, createopts)
+	if err != nil {
+		removeTemp()
+		return nil, err
+	}
+	err = dbf.copyBacklink(old)
+	var report *AlterReport
+	if err == nil {
+		report, err = dbf.copyAltered(old, mapping, opts)
+	}
+	if err == nil {
+		err = dbf.f.Sync()
+	}
+	if err == nil && dbf.fptf != nil {
+		err = dbf.fptf.Sync()
+	}
+	if closeErr := dbf.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		removeTemp()
+		return nil, err
+	}
+
+	// the renames are recorded in a marker file first, so an interrupted swap is completed by recoverAlter
+	removeFPT := old.fptf != nil && dbf.header.TableFlags&0x02 == 0
+	marker, err := writeAlterMarker(filename, tmpname, removeFPT)
+	if err != nil {
+		removeTemp()
+		return nil, err
+	}
+	// the table stays locked until it is replaced, except where files can not be replaced while they are open
+	if runtime.GOOS == "windows" {
+		err = old.Close()
+		old = nil
+	}
+	if err == nil {
+		err = swapAltered(filename, tmpname, removeFPT)
+	}
+	if err != nil {
+		// the marker is kept, the swap is completed when the table is opened again
+		marker.Close()
+		setJournalActive(marker.Name(), false)
+		return nil, err
+	}
+	if err := closeJournal(marker); err != nil {
+		return report, err
+	}
+	return report, nil
+}
+
+// alterMagic starts every alter marker file
+const alterMagic = "DBFALTER1"
+
+// alterFilename returns the alter marker filename for DBF file filename
+func alterFilename(filename string) string {
+	return filename + "-alter"
+}
+
+// writeAlterMarker writes the marker file of Alter for table filename and returns it locked, like a journal.
+// It contains the name of the new table in the same directory and if the old FPT file must be removed.
+func writeAlterMarker(filename, tmpname string, removeFPT bool) (*os.File, error) {
+	name := alterFilename(filename)
+	if isJournalActive(name) {
+		return nil, ErrLocked
+	}
+	f, err := openJournal(name, os.O_RDWR|os.O_CREATE)
+	if err != nil {
+		return nil, err
+	}
+	setJournalActive(name, true)
+	data := fmt.Sprintf("%s\n%s\n%t\n", alterMagic, filepath.Base(tmpname), removeFPT)
+	err = f.Truncate(0)
+	if err == nil {
+		_, err = f.WriteAt([]byte(data), 0)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if err != nil {
+		closeJournal(f)
+		return nil, err
+	}
+	return f, nil
+}
+
+// swapAltered replaces table filename by the new table tmpname. The DBF file is renamed last, when the new
+// FPT file is in place, so the table is either complete or can be completed from the marker file.
+func swapAltered(filename, tmpname string, removeFPT bool) error {
+	if _, err := os.Stat(fptFilename(tmpname)); err == nil {
+		if err := os.Rename(fptFilename(tmpname), fptFilename(filename)); err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	if _, err := os.Stat(tmpname); err == nil {
+		if err := os.Rename(tmpname, filename); err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	if removeFPT {
+		if err := os.Remove(fptFilename(filename)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// recoverAlter completes the swap of table filename by an Alter that was interrupted, using its marker file.
+// The new table is complete when the marker is written, so the renames are done again.
+// Markers locked by another process belong to an Alter in progress and are skipped.
+func recoverAlter(filename string) error {
+	name := alterFilename(filename)
+	if isJournalActive(name) {
+		return nil
+	}
+	f, err := openJournal(name, os.O_RDWR)
+	if os.IsNotExist(err) || err == ErrLocked {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	// an incomplete marker was written before any file was renamed
+	if tmpbase, removeFPT, ok := parseAlterMarker(data); ok {
+		tmpname := filepath.Join(filepath.Dir(filename), tmpbase)
+		if err := swapAltered(filename, tmpname, removeFPT); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return closeJournal(f)
+}
+
+// parseAlterMarker returns the base name of the new table and if the FPT file is removed from the data of a
+// marker file, ok is false when the marker is incomplete
+func parseAlterMarker(data []byte) (tmpbase string, removeFPT bool, ok bool) {
+	lines := strings.Split(string(data), "\n")
+	if len(lines) != 4 || lines[0] != alterMagic || lines[1] != filepath.Base(lines[1]) || lines[1] == "" {
+		return "", false, false
+	}
+	return lines[1], lines[2] == "true", true
+}
+
+// alterFields returns the fields for the new table and the old field positions to copy values from.
+// Autoincrement fields copied from an autoincrement field get its next value and step.
+func (dbf *DBF) alterFields(fields []FieldHeader, opts *AlterOptions) ([]FieldHeader, []alterField, error) {
+	fields = append([]FieldHeader(nil), fields...)
+	mapping := make([]alterField, len(fields))
+	for i := range fields {
+		name := fields[i].FieldName()
+		oldname := name
+		if rename, ok := opts.Rename[name]; ok {
+			oldname = strings.ToUpper(rename)
+			if dbf.FieldPos(oldname) < 0 {
+				return nil, nil, fmt.Errorf("%w: field %s renamed from %s does not exist", ErrInvalidField, name, rename)
+			}
+		}
+		from := dbf.FieldPos(oldname)
+		mapping[i] = alterField{from: from, convert: opts.Convert[name]}
+		if from >= 0 && fields[i].IsAutoIncrement() && dbf.fields[from].IsAutoIncrement() && fields[i].Next == 0 {
+			fields[i].Next, fields[i].Step = dbf.fields[from].Next, dbf.fields[from].Step
+		}
+	}
+	return fields, mapping, nil
+}
+
+// copyBacklink copies the database container backlink of table old, tables in a database stay in the database
+func (dbf *DBF) copyBacklink(old *DBF) error {
+	if !hasBacklink(old.header.FileVersion) || !hasBacklink(dbf.header.FileVersion) {
+		return nil
+	}
+	backlink := make([]byte, backlinkSize)
+	if _, err := old.r.ReadAt(backlink, int64(old.header.FirstRec)-backlinkSize); err != nil {
+		return err
+	}
+	return dbf.writeDBF(backlink, int64(dbf.header.FirstRec)-backlinkSize)
+}
+
+// copyAltered appends the records of table old to dbf, converting the values using mapping
+func (dbf *DBF) copyAltered(old *DBF, mapping []alterField, opts *AlterOptions) (*AlterReport, error) {
+	report := new(AlterReport)
+	maxauto := make([]int64, len(dbf.fields))
+	values := make([]interface{}, len(dbf.fields))
+	scratch := make([]byte, math.MaxUint8)
+	var buf []byte
+	for recno := uint32(0); recno < old.header.NumRec; recno++ {
+		rec, err := old.ReadRecordInto(recno, buf)
+		if err != nil {
+			return nil, err
+		}
+		buf = rec.Data()
+		if opts.Pack && rec.IsDeleted() {
+			continue
+		}
+
+		for i, m := range mapping {
+			f := &dbf.fields[i]
+			var val interface{}
+			if f.Type == '0' && i == dbf.nullbits[len(dbf.fields)] {
+				// the null flags are set from the values of the old fields below
+				continue
+			}
+			null := m.from >= 0 && rec.IsNull(m.from)
+			if m.from >= 0 && !null {
+				if old.fields[m.from].Type == '0' {
+					// system fields are copied raw
+					val, err = rec.Bytes(m.from)
+					if err == nil {
+						val = append([]byte(nil), val.([]byte)...)
+					}
+				} else {
+					val, err = rec.Value(m.from)
+				}
+				if err != nil {
+					return nil, err
+				}
+			}
+			oldval := val
+			if m.convert != nil {
+				val, err = m.convert(val)
+			} else if m.from >= 0 && !null {
+				val, err = dbf.convertValue(val, &old.fields[m.from], i)
+			}
+			// values are checked before appending, memos are checked when writing them
+			if err == nil && val != nil && f.Type != 'M' {
+				err = dbf.valueToFieldData(val, i, scratch[:f.Len])
+			}
+			if err != nil {
+				convErr := ConversionError{RecNo: recno, Field: f.FieldName(), Value: oldval, Err: err}
+				if opts.Strict {
+					return nil, &convErr
+				}
+				report.Failures = append(report.Failures, convErr)
+				val = nil
+			}
+			if f.IsAutoIncrement() && val != nil {
+				if v, _ := asInt64(val); v > maxauto[i] {
+					maxauto[i] = v
+				}
+			}
+			values[i] = val
+		}
+		if nullpos := dbf.nullbits[len(dbf.fields)]; nullpos >= 0 {
+			values[nullpos] = dbf.alteredNullFlags(old, rec, mapping)
+		}
+
+		newrecno, err := dbf.Append(values)
+		if err != nil {
+			return nil, err
+		}
+		if rec.IsDeleted() {
+			if err := dbf.writeDBF([]byte{0x2A}, dbf.recordOffset(newrecno)); err != nil {
+				return nil, err
+			}
+		}
+		report.Records++
+	}
+
+	// continue autoincrement fields after the highest copied value
+	for i := range dbf.fields {
+		f := &dbf.fields[i]
+		if f.IsAutoIncrement() && maxauto[i] >= int64(int32(f.Next)) {
+			f.Next = uint32(maxauto[i] + int64(f.autoIncrementStep()))
+			if err := dbf.writeAutoIncrement(i); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return report, nil
+}
+
+// alteredNullFlags returns the _NullFlags data of the new table for record rec of table old. Null bits are set
+// for new fields when their old field is null, varchar and varbinary length bits are kept when the raw value is copied.
+func (dbf *DBF) alteredNullFlags(old *DBF, rec RawRecord, mapping []alterField) []byte {
+	flags := make([]byte, dbf.fields[dbf.nullbits[len(dbf.fields)]].Len)
+	set := func(bit int) {
+		if bit >= 0 && bit/8 < len(flags) {
+			flags[bit/8] |= 1 << uint(bit%8)
+		}
+	}
+	for i, m := range mapping {
+		if m.from < 0 {
+			continue
+		}
+		if rec.IsNull(m.from) {
+			set(dbf.nullbits[i])
+			continue
+		}
+		f, from := &dbf.fields[i], &old.fields[m.from]
+		if bit := old.varbits[m.from]; bit >= 0 && m.convert == nil && f.Type == from.Type && f.Len == from.Len {
+			if raw, err := rec.Bytes(old.nullbits[len(old.fields)]); err == nil && bit/8 < len(raw) && raw[bit/8]&(1<<uint(bit%8)) != 0 {
+				set(dbf.varbits[i])
+			}
+		}
+	}
+	return flags
+}
+
+// convertValue converts value val of old field from to a value for field fieldpos, see Alter
+func (dbf *DBF) convertValue(val interface{}, from *FieldHeader, fieldpos int) (interface{}, error) {
+	f := &dbf.fields[fieldpos]
+	if val == nil {
+		return nil, nil
+	}
+	if s, ok := val.(string); ok && from.Type == 'C' {
+		// C values are padded with spaces
+		val = strings.TrimRight(s, " ")
+	}
+
+	switch f.Type {
+	case 'C', 'M':
+		s, err := formatValue(val, from)
+		if err != nil {
+			return nil, unsupportedValue(val, *f)
+		}
+		if f.Type == 'C' {
+			enc, err := dbf.fromUTF8String(s)
+			if err != nil {
+				return nil, err
+			}
+			if len(enc) > int(f.Len) {
+				return nil, ErrFieldOverflow
+			}
+		}
+		if b, ok := val.([]byte); ok && f.Type == 'M' {
+			return b, nil
+		}
+		return s, nil
+	case 'N', 'F', 'B', 'Y', 'I':
+		if s, ok := val.(string); ok {
+			s = strings.TrimSpace(s)
+			if s == "" {
+				return nil, nil
+			}
+			fl, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %q", ErrInvalidNumeric, s)
+			}
+			val = fl
+		}
+		if f.Type == 'I' {
+			if fl, ok := val.(float64); ok {
+				if fl != math.Trunc(fl) {
+					return nil, fmt.Errorf("%w: %v is not a whole number", ErrInvalidNumeric, fl)
+				}
+				if fl < math.MinInt32 || fl > math.MaxInt32 {
+					return nil, ErrFieldOverflow
+				}
+				return int64(fl), nil
+			}
+		}
+		return val, nil
+	case 'D', 'T':
+		s, ok := val.(string)
+		if !ok {
+			return val, nil
+		}
+		s = strings.TrimSpace(s)
+		if s == "" {
+			return nil, nil
+		}
+		for _, layout := range []string{"20060102", "2006-01-02", "20060102150405", "2006-01-02 15:04:05", "2006-01-02T15:04:05"} {
+			if t, err := time.Parse(layout, s); err == nil {
+				return t, nil
+			}
+		}
+		return nil, fmt.Errorf("%w: %q", ErrInvalidDate, s)
+	case 'L':
+		s, ok := val.(string)
+		if !ok {
+			return val, nil
+		}
+		switch strings.ToUpper(strings.TrimSpace(s)) {
+		case "":
+			return nil, nil
+		case "T", ".T.", "Y", ".Y.", "TRUE":
+			return true, nil
+		case "F", ".F.", "N", ".N.", "FALSE":
+			return false, nil
+		}
+		return nil, fmt.Errorf("%w: %q", ErrInvalidLogical, s)
+	case 'V':
+		if s, ok := val.(string); ok {
+			return dbf.fromUTF8String(s)
+		}
+		return val, nil
+	}
+	return val, nil
+}
+
+// formatValue formats value val of field from as text for a C or M field.
+// Dates are formatted like DTOS, datetimes as YYYY-MM-DD hh:mm:ss and logicals as T or F.
+func formatValue(val interface{}, from *FieldHeader) (string, error) {
+	switch v := val.(type) {
+	case string:
+		return v, nil
+	case []byte:
+		return string(v), nil
+	case bool:
+		if v {
+			return "T", nil
+		}
+		return "F", nil
+	case time.Time:
+		if v.IsZero() {
+			return "", nil
+		}
+		if from.Type == 'D' {
+			return v.Format("20060102"), nil
+		}
+		return v.Format("2006-01-02 15:04:05"), nil
+	case float64:
+		prec := -1
+		if from.Type == 'N' || from.Type == 'F' {
+			prec = int(from.Decimals)
+		}
+		return strconv.FormatFloat(v, 'f', prec, 64), nil
+	}
+	if i, ok := asInt64(val); ok {
+		return strconv.FormatInt(i, 10), nil
+	}
+	return "", unsupportedValue(val, *from)
+}
@@ -0,0 +1,358 @@
+package dbf
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newFields returns fields created with NewField from name, type, length and decimals
+func newFields(t *testing.T, defs ...interface{}) []FieldHeader {
+	t.Helper()
+	var fields []FieldHeader
+	for i := 0; i+3 < len(defs); i += 4 {
+		f, err := NewField(defs[i].(string), defs[i+1].(byte), uint8(defs[i+2].(int)), uint8(defs[i+3].(int)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+func TestAlter(t *testing.T) {
+	dir := t.TempDir()
+	filename := copyTestFiles(t, dir, "TEST.DBF")
+	fields := newFields(t,
+		"ID", byte('I'), 0, 0,
+		"LEVEL", byte('N'), 3, 0,
+		"STAMP", byte('T'), 0, 0,
+		"TIJD", byte('N'), 5, 0,
+		"COMP_NAME", byte('C'), 60, 0,
+		"COMP_OS", byte('C'), 10, 0,
+		"MELDING", byte('M'), 0, 0,
+		"NUMBER", byte('C'), 20, 0,
+		"EXTRA", byte('L'), 0, 0,
+	)
+	report, err := Alter(filename, fields, new(Win1250Decoder), new(Win1250Encoder), &AlterOptions{
+		Rename: map[string]string{"LEVEL": "niveau", "STAMP": "DATUM"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Records != 4 {
+		t.Errorf("want 4 records, have %d", report.Records)
+	}
+	// TIJD contains times which are not numbers, COMP_OS values are too long
+	var tijd, compos int
+	for _, f := range report.Failures {
+		switch {
+		case f.Field == "TIJD" && errors.Is(&f, ErrInvalidNumeric):
+			tijd++
+		case f.Field == "COMP_OS" && errors.Is(&f, ErrFieldOverflow):
+			compos++
+		default:
+			t.Errorf("unexpected failure %s", &f)
+		}
+	}
+	if tijd != 3 || compos != 2 {
+		t.Errorf("want 3 TIJD and 2 COMP_OS failures, have %d and %d", tijd, compos)
+	}
+
+	dbf, err := OpenFile(filename, new(Win1250Decoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbf.Close()
+	if strings.Join(dbf.FieldNames(), ",") != "ID,LEVEL,STAMP,TIJD,COMP_NAME,COMP_OS,MELDING,NUMBER,EXTRA" {
+		t.Errorf("unexpected fields %v", dbf.FieldNames())
+	}
+	rec, err := dbf.RecordAt(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []interface{}{int32(2), int64(1), time.Date(2015, 2, 3, 0, 0, 0, 0, time.UTC), int64(0),
+		"TEST2" + strings.Repeat(" ", 55), "Windows XP", "Tësting wíth éncôdings!", "123456789.99" + strings.Repeat(" ", 8), false}
+	for i, w := range want {
+		if v, _ := rec.Field(i); v != w {
+			t.Errorf("field %s: want %#v, have %#v", dbf.fields[i].FieldName(), w, v)
+		}
+	}
+	if v, _ := dbf.RecordAt(2); v.data[5] != "          " {
+		t.Errorf("want empty COMP_OS for a value that does not fit, have %q", v.data[5])
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*"))
+	if len(files) != 2 {
+		t.Errorf("want only the DBF and FPT file, have %v", files)
+	}
+}
+
+func TestAlterRecover(t *testing.T) {
+	dir := t.TempDir()
+	filename := copyTestFiles(t, dir, "TEST.DBF")
+	tmpname := filepath.Join(dir, "TEST-alter-1.DBF")
+	dbf, err := CreateFile(tmpname, newFields(t, "NOTE", byte('M'), 0, 0), new(Win1250Decoder), new(Win1250Encoder), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dbf.Append([]interface{}{"new memo"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := dbf.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the marker of an Alter in progress is not used
+	marker, err := writeAlterMarker(filename, tmpname, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := recoverAlter(filename); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(tmpname); err != nil {
+		t.Errorf("want the new table not moved during Alter, have %v", err)
+	}
+
+	// the process crashed after renaming the FPT file, the DBF file is renamed when the table is opened
+	marker.Close()
+	setJournalActive(marker.Name(), false)
+	if err := os.Rename(fptFilename(tmpname), fptFilename(filename)); err != nil {
+		t.Fatal(err)
+	}
+	// opening the table read-only does not complete the swap
+	if _, err := OpenFile(filename, new(Win1250Decoder)); err != ErrRecoveryNeeded {
+		t.Errorf("want ErrRecoveryNeeded opening read-only, have %v", err)
+	}
+	if _, err := os.Stat(tmpname); err != nil {
+		t.Errorf("want the new table not moved by OpenFile, have %v", err)
+	}
+	dbf, err = OpenFileRW(filename, new(Win1250Decoder), new(Win1250Encoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbf.Close()
+	rec, err := dbf.RecordAt(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := rec.Field(0); v != "new memo" {
+		t.Errorf("want the new table, have %v", rec.FieldSlice())
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*"))
+	if len(files) != 2 {
+		t.Errorf("want only the DBF and FPT file, have %v", files)
+	}
+}
+
+func TestAlterStrict(t *testing.T) {
+	dir := t.TempDir()
+	filename := copyTestFiles(t, dir, "TEST.DBF")
+	dbfdata, fptdata := readTestFiles(t, filename)
+	fields := newFields(t, "ID", byte('I'), 0, 0, "TIJD", byte('N'), 5, 0)
+
+	_, err := Alter(filename, fields, new(Win1250Decoder), new(Win1250Encoder), &AlterOptions{Strict: true})
+	var convErr *ConversionError
+	if !errors.As(err, &convErr) || convErr.RecNo != 0 || convErr.Field != "TIJD" || convErr.Value != "15:00   " {
+		t.Fatalf("want *ConversionError for TIJD in record 0, have %v", err)
+	}
+	checkUnchanged(t, filename, dbfdata, fptdata)
+	if files, _ := filepath.Glob(filepath.Join(dir, "*")); len(files) != 2 {
+		t.Errorf("want temporary files to be removed, have %v", files)
+	}
+
+	_, err = Alter(filename, fields, new(Win1250Decoder), new(Win1250Encoder), &AlterOptions{Rename: map[string]string{"TIJD": "NOPE"}})
+	if !errors.Is(err, ErrInvalidField) {
+		t.Errorf("want ErrInvalidField for a rename of a missing field, have %v", err)
+	}
+
+	// custom conversion of the times to minutes, without memo fields the FPT file is removed
+	_, err = Alter(filename, fields, new(Win1250Decoder), new(Win1250Encoder), &AlterOptions{
+		Strict: true,
+		Convert: map[string]func(interface{}) (interface{}, error){
+			"TIJD": func(val interface{}) (interface{}, error) {
+				t, err := time.Parse("15:04", strings.TrimSpace(val.(string)))
+				if err != nil {
+					return nil, nil
+				}
+				return t.Hour()*60 + t.Minute(), nil
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(fptFilename(filename)); !os.IsNotExist(err) {
+		t.Errorf("want FPT file to be removed, have %v", err)
+	}
+	dbf, err := OpenFile(filename, new(Win1250Decoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbf.Close()
+	if rec, _ := dbf.RecordAt(0); rec.data[1] != int64(900) {
+		t.Errorf("want 900 minutes, have %v", rec.data[1])
+	}
+}
+
+func TestAlterAutoIncrement(t *testing.T) {
+	filename := copyTestFiles(t, t.TempDir(), "dbase_31.dbf")
+	old, err := OpenFile(filename, new(Win1250Decoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := append(old.Fields(), newFields(t, "EXTRA", byte('C'), 10, 0)...)
+	old.Close()
+
+	report, err := Alter(filename, fields, new(Win1250Decoder), new(Win1250Encoder), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Records != 77 || len(report.Failures) != 0 {
+		t.Fatalf("want 77 records without failures, have %d and %v", report.Records, report.Failures)
+	}
+	dbf, err := OpenFile(filename, new(Win1250Decoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbf.Close()
+	if next, err := dbf.NextAutoIncrement(0); err != nil || next != 78 {
+		t.Errorf("want next value 78, have %d, %v", next, err)
+	}
+	if id := productID(t, dbf, 76); id != 77 {
+		t.Errorf("want PRODUCTID 77, have %d", id)
+	}
+}
+
+func TestAlterPack(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "PACK.DBF")
+	fields := newFields(t, "ID", byte('I'), 0, 0)
+	fields[0].SetAutoIncrement(1, 1)
+	dbf, err := CreateFile(filename, fields, new(Win1250Decoder), new(Win1250Encoder), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := dbf.Append([]interface{}{nil}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := dbf.writeDBF([]byte{0x2A}, dbf.recordOffset(1)); err != nil {
+		t.Fatal(err)
+	}
+	dbf.Close()
+
+	// an I field becomes an autoincrement field, the next value continues after the highest value
+	fields = newFields(t, "ID", byte('I'), 0, 0, "NAME", byte('C'), 10, 0)
+	fields[0].SetAutoIncrement(0, 1)
+	if _, err := Alter(filename, fields, new(Win1250Decoder), new(Win1250Encoder), nil); err != nil {
+		t.Fatal(err)
+	}
+	if deleted := deletedRecords(t, filename); deleted != "-*-" {
+		t.Errorf("want record 1 to stay deleted, have %s", deleted)
+	}
+	if _, err := Alter(filename, fields, new(Win1250Decoder), new(Win1250Encoder), &AlterOptions{Pack: true}); err != nil {
+		t.Fatal(err)
+	}
+	if deleted := deletedRecords(t, filename); deleted != "--" {
+		t.Errorf("want deleted records to be removed, have %s", deleted)
+	}
+
+	dbf, err = OpenFileRW(filename, new(Win1250Decoder), new(Win1250Encoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbf.Close()
+	recno, err := dbf.Append([]interface{}{nil, "new"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec, _ := dbf.RecordAt(recno); rec.data[0] != int32(4) {
+		t.Errorf("want autoincrement value 4, have %v", rec.data[0])
+	}
+}
+
+// deletedRecords returns the deleted flags of all records in table filename, * for deleted records and - otherwise
+func deletedRecords(t *testing.T, filename string) string {
+	t.Helper()
+	dbf, err := OpenFile(filename, new(Win1250Decoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbf.Close()
+	var flags string
+	for recno := uint32(0); recno < dbf.NumRecords(); recno++ {
+		deleted, err := dbf.DeletedAt(recno)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if deleted {
+			flags += "*"
+		} else {
+			flags += "-"
+		}
+	}
+	return flags
+}
+
+func TestAlterNullFlags(t *testing.T) {
+	filename := copyTestFiles(t, t.TempDir(), "dbase_31.dbf")
+	old, err := OpenFileRW(filename, new(UTF8Decoder), new(UTF8Encoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// SUPPLIERID (bit 0) and QUANTITYPE (bit 2) of record 0 and CATEGORYID (bit 1) of record 1 are null
+	nullpos := old.FieldPos("_NullFlags")
+	for recno, flags := range []byte{0x05, 0x02} {
+		if err := old.writeDBF([]byte{flags}, old.recordOffset(uint32(recno))+int64(old.offsets[nullpos])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fields := old.Fields()
+	old.Close()
+
+	// CATEGORYID is dropped and QUANTITYPE moves before SUPPLIERID, which moves the null bits
+	extra, err := NewField("EXTRA", 'C', 5, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	extra.Flags |= 0x02
+	newfields := []FieldHeader{fields[0], fields[1], fields[4], fields[2], fields[5], fields[6], fields[7], fields[8], fields[9], extra, fields[10]}
+	if _, err := Alter(filename, newfields, new(UTF8Decoder), new(UTF8Encoder), &AlterOptions{Strict: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	dbf, err := OpenFile(filename, new(UTF8Decoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbf.Close()
+	for recno, want := range [][]string{{"QUANTITYPE", "SUPPLIERID"}, nil, nil} {
+		rec, err := dbf.ReadRecordInto(uint32(recno), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var have []string
+		for i, f := range dbf.Fields() {
+			if rec.IsNull(i) {
+				have = append(have, f.FieldName())
+			}
+		}
+		if !reflect.DeepEqual(have, want) {
+			t.Errorf("record %d: want null fields %v, have %v", recno, want, have)
+		}
+	}
+	// the null value of the dropped field is not used, the values of the other fields are copied
+	rec, err := dbf.ReadRecordInto(1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := rec.String(dbf.FieldPos("QUANTITYPE")); strings.TrimSpace(v) == "" {
+		t.Error("want QUANTITYPE of record 1 copied")
+	}
+}
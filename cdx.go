@@ -0,0 +1,551 @@
+package dbf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/SebastiaanKlippert/go-foxpro-dbf/expr"
+	"github.com/SebastiaanKlippert/go-foxpro-dbf/jd"
+)
+
+var (
+	// ErrNoIndex is returned when an index tag is used but the table has no index file
+	ErrNoIndex = errors.New("no index file")
+
+	// ErrUnknownTag is returned when an index tag does not exist in the index file
+	ErrUnknownTag = errors.New("unknown index tag")
+
+	// ErrInvalidIndex is returned when the index file is damaged or does not match the table
+	ErrInvalidIndex = errors.New("invalid index file")
+
+	// ErrIndexOutdated is returned when the structural index is used after records were written, see Reindex
+	ErrIndexOutdated = errors.New("index is outdated by writes, run Reindex")
+
+	// ErrNoOrder is returned by the cursor methods that need an index order when no order is set, see SetOrder
+	ErrNoOrder = errors.New("no index order set")
+)
+
+// CDX files consist of 512 byte pages, every tag has a header of 2 pages followed by the nodes of the tag.
+// The compound tag at offset 0 contains the tag names, with the offset of the tag header instead of a record number.
+// Info from https://docs.microsoft.com/en-us/previous-versions/visualstudio/foxpro/s8tb8f47(v=vs.80)
+const (
+	cdxPageSize   = 512
+	cdxHeaderSize = 1024
+	cdxNoPage     = 0xFFFFFFFF // sibling pointer of the first and last node on a level, free node list pointer without free nodes
+
+	cdxNodeRoot = 0x01 // node attribute of the root node
+	cdxNodeLeaf = 0x02 // node attribute of leaf (exterior) nodes
+
+	cdxUnique     = 0x01 // index option of unique tags
+	cdxHasFor     = 0x08 // index option of tags with a FOR expression
+	cdxCompact    = 0x20 // index option of compact indexes
+	cdxCompound   = 0x40 // index option of the compound tag
+	cdxMaxKeyLen  = 240
+	cdxTagNameLen = 10
+)
+
+// IndexTag describes a tag of a CDX index file
+type IndexTag struct {
+	Name       string // Tag name in upper case
+	Key        string // Key expression
+	For        string // FOR expression, empty if all records are indexed
+	KeyLen     int    // Length of the keys in bytes
+	Unique     bool   // Only the first record of every key is indexed
+	Descending bool   // Keys are stored in descending order
+}
+
+// cdxIndex is an opened CDX file
+type cdxIndex struct {
+	r    io.ReaderAt
+	f    *os.File // only used with disk files
+	tags []*cdxTag
+}
+
+// cdxTag is a tag of an opened CDX file
+type cdxTag struct {
+	IndexTag
+	r    io.ReaderAt
+	root uint32 // offset of the root node
+
+	typ   expr.Type  // type of the key expression, -1 if unknown
+	key   *expr.Expr // compiled key expression, nil if it is not supported
+	trail byte       // byte used to pad the keys
+}
+
+// cdxNode is a parsed node of a tag
+type cdxNode struct {
+	offset      uint32
+	leaf        bool
+	left, right uint32
+	keys        [][]byte
+	recnos      []uint32 // zero based record numbers, or the tag header offsets in the compound tag
+	children    []uint32 // child node offsets of interior nodes
+}
+
+// OpenIndex opens CDX index file filename for ordered navigation using the cursors of the table, replacing
+// the index that was opened before. The structural CDX index of the table is opened automatically when
+// HasStructuralCDX is set in the header, use OpenIndex to use another index file.
+// Other index files are not updated when records are written, use BuildIndex to rebuild them.
+func (dbf *DBF) OpenIndex(filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	idx, err := readCDX(f)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	idx.f = f
+	return dbf.setIndex(idx)
+}
+
+// OpenIndexStream uses the CDX index file read from r for ordered navigation, see OpenIndex
+func (dbf *DBF) OpenIndexStream(r io.ReaderAt) error {
+	idx, err := readCDX(r)
+	if err != nil {
+		return err
+	}
+	return dbf.setIndex(idx)
+}
+
+// setIndex replaces the index of the table by idx, the key expressions of the tags are compiled for this table.
+// Tags with key expressions that are not supported can still be used, but Seek needs a value of the right type.
+func (dbf *DBF) setIndex(idx *cdxIndex) error {
+	for _, tag := range idx.tags {
+		tag.compile(dbf)
+	}
+	dbf.cdxmu.Lock()
+	defer dbf.cdxmu.Unlock()
+	old := dbf.cdx
+	dbf.cdx, dbf.cdxopened = idx, true
+	return old.close()
+}
+
+// index returns the index of the table, the structural CDX file is opened on first use.
+// Returns ErrNoIndex if the table has no index, or ErrIndexOutdated if records were written after it was built.
+func (dbf *DBF) index() (*cdxIndex, error) {
+	dbf.cdxmu.Lock()
+	defer dbf.cdxmu.Unlock()
+	if !dbf.cdxopened {
+		dbf.cdxopened = true
+		if dbf.header.HasStructuralCDX() && dbf.f != nil {
+			f, err := os.Open(cdxFilename(dbf.f.Name()))
+			if os.IsNotExist(err) {
+				return nil, ErrNoIndex
+			}
+			if err != nil {
+				dbf.cdxopened = false
+				return nil, err
+			}
+			idx, err := readCDX(f)
+			if err != nil {
+				f.Close()
+				dbf.cdxopened = false
+				return nil, err
+			}
+			idx.f = f
+			for _, tag := range idx.tags {
+				tag.compile(dbf) // see setIndex
+			}
+			dbf.cdx = idx
+		}
+	}
+	if dbf.cdx == nil && dbf.reindex {
+		return nil, ErrIndexOutdated
+	}
+	if dbf.cdx == nil {
+		return nil, ErrNoIndex
+	}
+	return dbf.cdx, nil
+}
+
+// closeStructuralIndex closes the structural index when it is opened, it is opened again on first use.
+// The caller must hold cdxmu.
+func (dbf *DBF) closeStructuralIndex() error {
+	old := dbf.cdx
+	if old == nil || old.f != nil && old.f.Name() == cdxFilename(dbf.f.Name()) {
+		dbf.cdx, dbf.cdxopened = nil, false
+		return old.close()
+	}
+	return nil
+}
+
+// Tags returns the tags of the index of the table in tag name order, returns ErrNoIndex if the table has no index
+func (dbf *DBF) Tags() ([]IndexTag, error) {
+	idx, err := dbf.index()
+	if err != nil {
+		return nil, err
+	}
+	tags := make([]IndexTag, len(idx.tags))
+	for i, tag := range idx.tags {
+		tags[i] = tag.IndexTag
+	}
+	return tags, nil
+}
+
+// tag returns index tag name, case insensitive
+func (idx *cdxIndex) tag(name string) (*cdxTag, error) {
+	name = strings.ToUpper(name)
+	for _, tag := range idx.tags {
+		if tag.Name == name {
+			return tag, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnknownTag, name)
+}
+
+func (idx *cdxIndex) close() error {
+	if idx == nil || idx.f == nil {
+		return nil
+	}
+	return idx.f.Close()
+}
+
+// cdxFilename returns the structural CDX filename for DBF file filename, using the same case for the extension
+func cdxFilename(filename string) string {
+	ext := filepath.Ext(filename)
+	cdxext := ".cdx"
+	if strings.ToUpper(ext) == ext {
+		cdxext = ".CDX"
+	}
+	return strings.TrimSuffix(filename, ext) + cdxext
+}
+
+// readCDX reads the compound tag and the headers of all tags of CDX file r
+func readCDX(r io.ReaderAt) (*cdxIndex, error) {
+	compound, err := readCDXTag(r, 0)
+	if err != nil {
+		return nil, err
+	}
+	compound.trail = 0
+	idx := &cdxIndex{r: r}
+	err = compound.walk(func(key []byte, offset uint32) error {
+		tag, err := readCDXTag(r, offset)
+		if err != nil {
+			return err
+		}
+		tag.Name = strings.ToUpper(string(bytes.TrimRight(key, "\x00 ")))
+		idx.tags = append(idx.tags, tag)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(idx.tags, func(i, j int) bool { return idx.tags[i].Name < idx.tags[j].Name })
+	return idx, nil
+}
+
+// readCDXTag reads the tag header at offset
+func readCDXTag(r io.ReaderAt, offset uint32) (*cdxTag, error) {
+	b := make([]byte, cdxHeaderSize)
+	if _, err := r.ReadAt(b, int64(offset)); err != nil {
+		return nil, fmt.Errorf("%w: reading tag header at %d: %s", ErrInvalidIndex, offset, err)
+	}
+	tag := &cdxTag{r: r, root: binary.LittleEndian.Uint32(b), trail: ' ', typ: -1}
+	tag.KeyLen = int(binary.LittleEndian.Uint16(b[0x0C:]))
+	tag.Unique = b[0x0E]&cdxUnique != 0
+	tag.Descending = binary.LittleEndian.Uint16(b[0x1F6:]) != 0
+	if tag.KeyLen == 0 || tag.KeyLen > cdxMaxKeyLen || b[0x0E]&cdxCompact == 0 {
+		return nil, fmt.Errorf("%w: unsupported tag header at %d", ErrInvalidIndex, offset)
+	}
+	pool := b[cdxPageSize:]
+	tag.For = exprFromPool(pool, binary.LittleEndian.Uint16(b[0x1F8:]), binary.LittleEndian.Uint16(b[0x1FA:]))
+	tag.Key = exprFromPool(pool, binary.LittleEndian.Uint16(b[0x1FC:]), binary.LittleEndian.Uint16(b[0x1FE:]))
+	return tag, nil
+}
+
+// exprFromPool returns the expression of n bytes at pos in the expression pool of a tag header
+func exprFromPool(pool []byte, pos, n uint16) string {
+	if int(pos) >= len(pool) {
+		return ""
+	}
+	b := pool[pos:]
+	if int(n) < len(b) {
+		b = b[:n]
+	}
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
+
+// compile compiles the key expression of the tag for dbf, the key type stays unknown if it cannot be compiled
+func (t *cdxTag) compile(dbf *DBF) error {
+	key, err := dbf.CompileExpr(t.Key)
+	if err != nil {
+		return err
+	}
+	t.key = key
+	t.typ = t.key.Type()
+	if t.typ != expr.Character {
+		t.trail = 0
+	}
+	return nil
+}
+
+// node reads and parses the node at offset
+func (t *cdxTag) node(offset uint32) (*cdxNode, error) {
+	b := make([]byte, cdxPageSize)
+	if _, err := t.r.ReadAt(b, int64(offset)); err != nil {
+		return nil, fmt.Errorf("%w: reading node at %d: %s", ErrInvalidIndex, offset, err)
+	}
+	n := &cdxNode{
+		offset: offset,
+		leaf:   binary.LittleEndian.Uint16(b)&cdxNodeLeaf != 0,
+		left:   binary.LittleEndian.Uint32(b[4:]),
+		right:  binary.LittleEndian.Uint32(b[8:]),
+	}
+	numkeys := int(binary.LittleEndian.Uint16(b[2:]))
+	if n.leaf {
+		return n, t.parseLeaf(n, b, numkeys)
+	}
+
+	// interior node: key, record number and child pointer, the numbers are big endian
+	entry := t.KeyLen + 8
+	if 12+numkeys*entry > cdxPageSize {
+		return nil, fmt.Errorf("%w: node at %d has too many keys", ErrInvalidIndex, offset)
+	}
+	for i := 0; i < numkeys; i++ {
+		e := b[12+i*entry:]
+		n.keys = append(n.keys, e[:t.KeyLen])
+		n.recnos = append(n.recnos, binary.BigEndian.Uint32(e[t.KeyLen:])-1)
+		n.children = append(n.children, binary.BigEndian.Uint32(e[t.KeyLen+4:]))
+	}
+	return n, nil
+}
+
+// parseLeaf parses the keys of leaf node b. Every key has an entry with the record number, the number of
+// bytes it has in common with the previous key (duplicate count) and the number of trailing pad bytes
+// (trail count), packed in a few bytes. The remaining bytes of the keys are stored from the end of the node.
+func (t *cdxTag) parseLeaf(n *cdxNode, b []byte, numkeys int) error {
+	recMask := uint64(binary.LittleEndian.Uint32(b[0x0E:]))
+	dupMask, trailMask := uint64(b[0x12]), uint64(b[0x13])
+	recBits, dupBits := uint(b[0x14]), uint(b[0x15])
+	size := int(b[0x17])
+	if size < 1 || size > 8 || 24+numkeys*size > cdxPageSize {
+		return fmt.Errorf("%w: invalid leaf node at %d", ErrInvalidIndex, n.offset)
+	}
+
+	end := cdxPageSize
+	prev := make([]byte, t.KeyLen)
+	for i := 0; i < numkeys; i++ {
+		var v uint64
+		for j := size - 1; j >= 0; j-- {
+			v = v<<8 | uint64(b[24+i*size+j])
+		}
+		dup := int(v >> recBits & dupMask)
+		trail := int(v >> (recBits + dupBits) & trailMask)
+		if i == 0 {
+			dup = 0
+		}
+		l := t.KeyLen - dup - trail
+		if l < 0 || end-l < 24+numkeys*size {
+			return fmt.Errorf("%w: invalid key %d in leaf node at %d", ErrInvalidIndex, i, n.offset)
+		}
+		key := make([]byte, t.KeyLen)
+		copy(key, prev[:dup])
+		end -= l
+		copy(key[dup:], b[end:end+l])
+		for j := t.KeyLen - trail; j < t.KeyLen; j++ {
+			key[j] = t.trail
+		}
+		n.keys = append(n.keys, key)
+		n.recnos = append(n.recnos, uint32(v&recMask)-1)
+		prev = key
+	}
+	return nil
+}
+
+// walk calls fn for all keys of the tag in index order, with the record number as stored in the index
+func (t *cdxTag) walk(fn func(key []byte, recno uint32) error) error {
+	n, err := t.first()
+	for ; err == nil && n != nil; n, err = t.sibling(n, 1) {
+		for i, key := range n.keys {
+			if err := fn(key, n.recnos[i]+1); err != nil {
+				return err
+			}
+		}
+	}
+	return err
+}
+
+// first returns the first leaf node
+func (t *cdxTag) first() (*cdxNode, error) {
+	return t.descend(func(n *cdxNode) int { return 0 })
+}
+
+// last returns the last leaf node
+func (t *cdxTag) last() (*cdxNode, error) {
+	return t.descend(func(n *cdxNode) int { return len(n.children) - 1 })
+}
+
+// descend walks from the root to a leaf node, choose returns the child to follow in an interior node
+func (t *cdxTag) descend(choose func(n *cdxNode) int) (*cdxNode, error) {
+	offset := t.root
+	for depth := 0; depth < 64; depth++ {
+		n, err := t.node(offset)
+		if err != nil {
+			return nil, err
+		}
+		if n.leaf {
+			return n, nil
+		}
+		i := choose(n)
+		if i < 0 || i >= len(n.children) {
+			// no child contains the key, return the last leaf so the search continues past its end
+			if len(n.children) == 0 {
+				return nil, fmt.Errorf("%w: empty interior node at %d", ErrInvalidIndex, offset)
+			}
+			i = len(n.children) - 1
+		}
+		offset = n.children[i]
+	}
+	return nil, fmt.Errorf("%w: tag %s is too deep", ErrInvalidIndex, t.Name)
+}
+
+// sibling returns the next (dir 1) or previous (dir -1) leaf node of n, or nil if n is the last or first
+func (t *cdxTag) sibling(n *cdxNode, dir int) (*cdxNode, error) {
+	offset := n.right
+	if dir < 0 {
+		offset = n.left
+	}
+	if offset == cdxNoPage || offset == 0 {
+		return nil, nil
+	}
+	return t.node(offset)
+}
+
+// compare compares index key with search key s in index order, only the length of s is compared
+// so a shorter Character key matches all keys starting with it
+func (t *cdxTag) compare(key, s []byte) int {
+	if len(s) < len(key) {
+		key = key[:len(s)]
+	}
+	c := bytes.Compare(key, s)
+	if t.Descending {
+		return -c
+	}
+	return c
+}
+
+// search returns the first leaf node and position of the first key k for which compare(k, s) >= 0, or > 0 if after is true.
+// Returns a nil node if there is no such key.
+func (t *cdxTag) search(s []byte, after bool) (*cdxNode, int, error) {
+	match := func(key []byte) bool {
+		c := t.compare(key, s)
+		return c > 0 || c == 0 && !after
+	}
+	n, err := t.descend(func(n *cdxNode) int {
+		return sort.Search(len(n.keys), func(i int) bool { return match(n.keys[i]) })
+	})
+	for ; err == nil && n != nil; n, err = t.sibling(n, 1) {
+		if i := sort.Search(len(n.keys), func(i int) bool { return match(n.keys[i]) }); i < len(n.keys) {
+			return n, i, nil
+		}
+	}
+	return nil, 0, err
+}
+
+// encode converts value v to a key of the tag, Character keys are converted to the charset of the table.
+// Keys are padded to the key length if pad is true, else only Character keys can be shorter.
+func (t *cdxTag) encode(dbf *DBF, v interface{}, pad bool) ([]byte, error) {
+	var key []byte
+	switch val := v.(type) {
+	case string:
+		if t.typ >= 0 && t.typ != expr.Character {
+			return nil, fmt.Errorf("%w: %T key for tag %s of type %s", ErrFieldType, v, t.Name, t.typ)
+		}
+		b, err := dbf.keyEncoder().Encode([]byte(val))
+		if err != nil {
+			return nil, err
+		}
+		key = b
+	case bool:
+		if t.typ >= 0 && t.typ != expr.Logical {
+			return nil, fmt.Errorf("%w: %T key for tag %s of type %s", ErrFieldType, v, t.Name, t.typ)
+		}
+		key = []byte{'F'}
+		if val {
+			key[0] = 'T'
+		}
+	case time.Time:
+		if t.typ >= 0 && t.typ != expr.Date && t.typ != expr.DateTime {
+			return nil, fmt.Errorf("%w: %T key for tag %s of type %s", ErrFieldType, v, t.Name, t.typ)
+		}
+		key = numericKey(julianDay(val, t.typ == expr.DateTime), 8)
+	default:
+		f, ok := asFloat64(v)
+		if !ok || t.typ >= 0 && t.typ != expr.Numeric {
+			return nil, fmt.Errorf("%w: %T key for tag %s of type %s", ErrFieldType, v, t.Name, t.typ)
+		}
+		key = numericKey(f, t.KeyLen)
+	}
+	if len(key) > t.KeyLen {
+		key = key[:t.KeyLen]
+	}
+	if pad && len(key) < t.KeyLen {
+		key = append(key, bytes.Repeat([]byte{t.trail}, t.KeyLen-len(key))...)
+	}
+	return key, nil
+}
+
+// numericKey returns the key of number f. Keys of 4 bytes are integers with the sign bit flipped,
+// other keys are doubles with the sign bit flipped for positive numbers and all bits inverted for negative numbers,
+// so the keys sort like the numbers. All integers are big endian.
+func numericKey(f float64, keyLen int) []byte {
+	if keyLen == 4 {
+		b := make([]byte, 4)
+		binary.BigEndian.PutUint32(b, uint32(int32(f))^0x80000000)
+		return b
+	}
+	if f == 0 {
+		// also for -0
+		f = 0
+	}
+	bits := math.Float64bits(f)
+	if bits&(1<<63) != 0 {
+		bits = ^bits
+	} else {
+		bits |= 1 << 63
+	}
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, bits)
+	return b
+}
+
+// julianDay returns the Julian day number of d, with the time of day as fraction if withTime is true.
+// The zero time returns 0.
+func julianDay(d time.Time, withTime bool) float64 {
+	if d.IsZero() {
+		return 0
+	}
+	day := float64(jd.YMD2J(d.Year(), int(d.Month()), d.Day()))
+	if withTime {
+		secs := d.Hour()*3600 + d.Minute()*60 + d.Second()
+		day += (float64(secs) + float64(d.Nanosecond()/1e6)/1000) / 86400
+	}
+	return day
+}
+
+// keyEncoder returns the Encoder used to convert Character keys to the charset of the table.
+// For read-only tables the Encoder matching the Decoder of the table is used, without it keys are used as UTF-8.
+func (dbf *DBF) keyEncoder() Encoder {
+	if dbf.enc != nil {
+		return dbf.enc
+	}
+	switch dbf.dec.(type) {
+	case *Win1250Decoder:
+		return new(Win1250Encoder)
+	}
+	return new(UTF8Encoder)
+}
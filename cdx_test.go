@@ -0,0 +1,329 @@
+package dbf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/SebastiaanKlippert/go-foxpro-dbf/expr"
+)
+
+// testTag is a tag written by writeTestCDX
+type testTag struct {
+	name, key, forExpr string
+	keyLen             int
+	pad                byte
+	unique, descending bool
+	perLeaf            int // maximum number of keys per leaf node
+	keys               []testKey
+}
+
+// testKey is an index key with the record number as stored in the index, one based
+type testKey struct {
+	key   []byte
+	recno uint32
+}
+
+// writeTestCDX returns a CDX file with tags, every tag has a root interior node when it has more than one leaf
+func writeTestCDX(t *testing.T, tags []testTag) []byte {
+	t.Helper()
+	buf := make([]byte, cdxHeaderSize+cdxPageSize)
+	var names []testKey
+	for _, tag := range tags {
+		offset := uint32(len(buf))
+		name := make([]byte, 10)
+		copy(name, tag.name)
+		names = append(names, testKey{key: name, recno: offset})
+
+		header := make([]byte, cdxHeaderSize)
+		binary.LittleEndian.PutUint32(header[4:], cdxNoPage)
+		binary.LittleEndian.PutUint16(header[0x0C:], uint16(tag.keyLen))
+		header[0x0E] = cdxCompact
+		if tag.unique {
+			header[0x0E] |= cdxUnique
+		}
+		if tag.descending {
+			binary.LittleEndian.PutUint16(header[0x1F6:], 1)
+		}
+		binary.LittleEndian.PutUint16(header[0x1F8:], uint16(len(tag.key)+1))
+		binary.LittleEndian.PutUint16(header[0x1FA:], uint16(len(tag.forExpr)+1))
+		binary.LittleEndian.PutUint16(header[0x1FE:], uint16(len(tag.key)+1))
+		copy(header[cdxPageSize:], tag.key)
+		copy(header[cdxPageSize+len(tag.key)+1:], tag.forExpr)
+		buf = append(buf, header...)
+
+		var leaves [][]testKey
+		for keys := tag.keys; len(keys) > 0; {
+			n := tag.perLeaf
+			if n > len(keys) {
+				n = len(keys)
+			}
+			leaves = append(leaves, keys[:n])
+			keys = keys[n:]
+		}
+		if len(leaves) == 0 {
+			leaves = append(leaves, nil)
+		}
+		first := uint32(len(buf))
+		var root []byte
+		for i, keys := range leaves {
+			attr, left, right := uint16(cdxNodeLeaf), uint32(cdxNoPage), uint32(cdxNoPage)
+			if len(leaves) == 1 {
+				attr |= 1
+			}
+			if i > 0 {
+				left = first + uint32(i-1)*cdxPageSize
+			}
+			if i < len(leaves)-1 {
+				right = first + uint32(i+1)*cdxPageSize
+			}
+			buf = append(buf, testLeaf(t, keys, tag.keyLen, tag.pad, attr, left, right)...)
+			if len(keys) > 0 {
+				last := keys[len(keys)-1]
+				entry := make([]byte, tag.keyLen+8)
+				copy(entry, last.key)
+				binary.BigEndian.PutUint32(entry[tag.keyLen:], last.recno)
+				binary.BigEndian.PutUint32(entry[tag.keyLen+4:], first+uint32(i)*cdxPageSize)
+				root = append(root, entry...)
+			}
+		}
+		rootOffset := first
+		if len(leaves) > 1 {
+			rootOffset = uint32(len(buf))
+			node := make([]byte, cdxPageSize)
+			binary.LittleEndian.PutUint16(node, 1)
+			binary.LittleEndian.PutUint16(node[2:], uint16(len(leaves)))
+			binary.LittleEndian.PutUint32(node[4:], cdxNoPage)
+			binary.LittleEndian.PutUint32(node[8:], cdxNoPage)
+			if 12+len(root) > cdxPageSize {
+				t.Fatalf("too many leaves in tag %s", tag.name)
+			}
+			copy(node[12:], root)
+			buf = append(buf, node...)
+		}
+		binary.LittleEndian.PutUint32(buf[offset:], rootOffset)
+	}
+
+	sort.Slice(names, func(i, j int) bool { return bytes.Compare(names[i].key, names[j].key) < 0 })
+	binary.LittleEndian.PutUint32(buf, cdxHeaderSize)
+	binary.LittleEndian.PutUint32(buf[4:], cdxNoPage)
+	binary.LittleEndian.PutUint16(buf[0x0C:], 10)
+	buf[0x0E] = cdxCompact | 0x40
+	copy(buf[cdxHeaderSize:], testLeaf(t, names, 10, 0, cdxNodeLeaf|1, cdxNoPage, cdxNoPage))
+	return buf
+}
+
+// testLeaf returns a compact leaf node with keys, compressed using the duplicate and trail counts
+func testLeaf(t *testing.T, keys []testKey, keyLen int, pad byte, attr uint16, left, right uint32) []byte {
+	t.Helper()
+	countBits := bits.Len(uint(keyLen))
+	var maxRecno uint32
+	for _, k := range keys {
+		if k.recno > maxRecno {
+			maxRecno = k.recno
+		}
+	}
+	size := (2*countBits + bits.Len32(maxRecno) + 7) / 8
+	if size < 3 {
+		size = 3
+	}
+	recBits := size*8 - 2*countBits
+
+	node := make([]byte, cdxPageSize)
+	binary.LittleEndian.PutUint16(node, attr)
+	binary.LittleEndian.PutUint16(node[2:], uint16(len(keys)))
+	binary.LittleEndian.PutUint32(node[4:], left)
+	binary.LittleEndian.PutUint32(node[8:], right)
+	binary.LittleEndian.PutUint32(node[0x0E:], 1<<uint(recBits)-1)
+	node[0x12] = byte(1<<uint(countBits) - 1)
+	node[0x13] = byte(1<<uint(countBits) - 1)
+	node[0x14] = byte(recBits)
+	node[0x15] = byte(countBits)
+	node[0x16] = byte(countBits)
+	node[0x17] = byte(size)
+
+	end := cdxPageSize
+	var prev []byte
+	for i, k := range keys {
+		trail := 0
+		for trail < keyLen && k.key[keyLen-1-trail] == pad {
+			trail++
+		}
+		dup := 0
+		for prev != nil && dup < keyLen-trail && k.key[dup] == prev[dup] {
+			dup++
+		}
+		data := k.key[dup : keyLen-trail]
+		end -= len(data)
+		if end < 24+(i+1)*size {
+			t.Fatalf("too many keys in leaf node")
+		}
+		copy(node[end:], data)
+		v := uint64(k.recno) | uint64(dup)<<uint(recBits) | uint64(trail)<<uint(recBits+countBits)
+		for j := 0; j < size; j++ {
+			node[24+i*size+j] = byte(v >> uint(8*j))
+		}
+		prev = k.key
+	}
+	binary.LittleEndian.PutUint16(node[0x0C:], uint16(end-24-len(keys)*size))
+	return node
+}
+
+// testIndexKeys returns the keys of expression key for all records of dbf matching forExpr, sorted in index order
+func testIndexKeys(t *testing.T, dbf *DBF, key, forExpr string, keyLen int, descending bool) []testKey {
+	t.Helper()
+	e, err := dbf.CompileExpr(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag := &cdxTag{IndexTag: IndexTag{Name: "TEST", KeyLen: keyLen}, typ: e.Type(), trail: 0}
+	if tag.typ == expr.Character {
+		tag.trail = ' '
+	}
+	var keys []testKey
+	for recno := uint32(0); recno < dbf.NumRecords(); recno++ {
+		rec, err := dbf.ReadRecordInto(recno, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if forExpr != "" {
+			f, err := dbf.CompileExpr(forExpr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok, err := f.EvalBool(rec.Expr()); err != nil || !ok {
+				continue
+			}
+		}
+		v, err := e.Eval(rec.Expr())
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := tag.encode(dbf, v, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, testKey{key: b, recno: recno + 1})
+	}
+	sort.SliceStable(keys, func(i, j int) bool {
+		c := bytes.Compare(keys[i].key, keys[j].key)
+		if descending {
+			return c > 0
+		}
+		return c < 0
+	})
+	return keys
+}
+
+// writeDbase30CDX writes dbase_30.cdx with tags on ACCESSNO (C15), CATDATE (D), ACCESSNO descending
+// and ACQVALUE for records with ACQVALUE > 0 next to the copy of dbase_30.dbf in dir, which has the structural index flag
+func writeDbase30CDX(t *testing.T, dir string) (string, []byte) {
+	t.Helper()
+	filename := copyTestFiles(t, dir, "dbase_30.dbf")
+	dbf, err := OpenFile(filename, new(Win1250Decoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbf.Close()
+	cdx := writeTestCDX(t, []testTag{
+		{name: "ACCESSNO", key: "ACCESSNO", keyLen: 15, pad: ' ', perLeaf: 4, keys: testIndexKeys(t, dbf, "ACCESSNO", "", 15, false)},
+		{name: "ACQ", key: "ACQVALUE", forExpr: "ACQVALUE > 0", keyLen: 8, perLeaf: 3, keys: testIndexKeys(t, dbf, "ACQVALUE", "ACQVALUE > 0", 8, false)},
+		{name: "CATDATE", key: "CATDATE", keyLen: 8, perLeaf: 5, keys: testIndexKeys(t, dbf, "CATDATE", "", 8, false)},
+		{name: "DESCNO", key: "ACCESSNO", keyLen: 15, pad: ' ', descending: true, unique: true, perLeaf: 6, keys: testIndexKeys(t, dbf, "ACCESSNO", "", 15, true)},
+	})
+	if err := ioutil.WriteFile(cdxFilename(filename), cdx, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return filename, cdx
+}
+
+func TestTags(t *testing.T) {
+	filename, _ := writeDbase30CDX(t, t.TempDir())
+	dbf, err := OpenFile(filename, new(Win1250Decoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbf.Close()
+
+	tags, err := dbf.Tags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []IndexTag{
+		{Name: "ACCESSNO", Key: "ACCESSNO", KeyLen: 15},
+		{Name: "ACQ", Key: "ACQVALUE", For: "ACQVALUE > 0", KeyLen: 8},
+		{Name: "CATDATE", Key: "CATDATE", KeyLen: 8},
+		{Name: "DESCNO", Key: "ACCESSNO", KeyLen: 15, Unique: true, Descending: true},
+	}
+	if len(tags) != len(want) {
+		t.Fatalf("want %d tags, have %v", len(want), tags)
+	}
+	for i := range want {
+		if tags[i] != want[i] {
+			t.Errorf("want tag %+v, have %+v", want[i], tags[i])
+		}
+	}
+}
+
+func TestIndexErrors(t *testing.T) {
+	// TEST.DBF has no structural index
+	if err := testDbf.NewCursor().SetOrder("ID"); err != ErrNoIndex {
+		t.Errorf("want ErrNoIndex, have %v", err)
+	}
+	if _, err := testDbf.NewCursor().Seek(1); err != ErrNoOrder {
+		t.Errorf("want ErrNoOrder, have %v", err)
+	}
+
+	// dbase_30.dbf has the structural index flag but no CDX file
+	dir := t.TempDir()
+	filename := copyTestFiles(t, dir, "dbase_30.dbf")
+	dbf, err := OpenFile(filename, new(Win1250Decoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbf.Close()
+	if _, err := dbf.Tags(); err != ErrNoIndex {
+		t.Errorf("want ErrNoIndex, have %v", err)
+	}
+
+	_, cdx := writeDbase30CDX(t, t.TempDir())
+	if err := dbf.OpenIndexStream(bytes.NewReader(cdx)); err != nil {
+		t.Fatal(err)
+	}
+	c := dbf.NewCursor()
+	if err := c.SetOrder("MISSING"); !errors.Is(err, ErrUnknownTag) {
+		t.Errorf("want ErrUnknownTag, have %v", err)
+	}
+	if err := c.SetOrder("accessno"); err != nil || c.Order() != "ACCESSNO" {
+		t.Errorf("want order ACCESSNO, have %q (%v)", c.Order(), err)
+	}
+	if _, err := c.Seek(1999); !errors.Is(err, ErrFieldType) {
+		t.Errorf("want ErrFieldType for a numeric key, have %v", err)
+	}
+
+	if err := dbf.OpenIndexStream(bytes.NewReader(cdx[:100])); !errors.Is(err, ErrInvalidIndex) {
+		t.Errorf("want ErrInvalidIndex for a truncated file, have %v", err)
+	}
+	if err := dbf.OpenIndex(filepath.Join(dir, "missing.cdx")); !os.IsNotExist(err) {
+		t.Errorf("want not exist error, have %v", err)
+	}
+}
+
+func TestNumericKey(t *testing.T) {
+	numbers := []float64{-1e10, -5.5, -1, 0, 0.25, 1, 2.5, 1e10}
+	for i := 1; i < len(numbers); i++ {
+		if bytes.Compare(numericKey(numbers[i-1], 8), numericKey(numbers[i], 8)) >= 0 {
+			t.Errorf("key of %v does not sort before %v", numbers[i-1], numbers[i])
+		}
+		if numbers[i-1] == float64(int32(numbers[i-1])) && numbers[i] == float64(int32(numbers[i])) &&
+			bytes.Compare(numericKey(numbers[i-1], 4), numericKey(numbers[i], 4)) >= 0 {
+			t.Errorf("integer key of %v does not sort before %v", numbers[i-1], numbers[i])
+		}
+	}
+}
@@ -0,0 +1,366 @@
+package dbf
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+)
+
+// IssueType is the kind of problem found when checking a table
+type IssueType int
+
+const (
+	// IssueHeader is an inconsistent value in the DBF or FPT header
+	IssueHeader IssueType = iota
+	// IssueField is an invalid field definition
+	IssueField
+	// IssueRecordCount is a record count in the header that does not match the file size
+	IssueRecordCount
+	// IssueTruncatedRecord is an incomplete record at the end of the file
+	IssueTruncatedRecord
+	// IssueEOFMarker is a missing 0x1A end of file marker
+	IssueEOFMarker
+	// IssueDeleteFlag is a record that does not start with a valid delete flag
+	IssueDeleteFlag
+	// IssueMemoPointer is a memo pointer that points outside the FPT file
+	IssueMemoPointer
+	// IssueFPTNextFree is a NextFree value in the FPT header that does not match the FPT file
+	IssueFPTNextFree
+)
+
+func (t IssueType) String() string {
+	switch t {
+	case IssueHeader:
+		return "header"
+	case IssueField:
+		return "field"
+	case IssueRecordCount:
+		return "record count"
+	case IssueTruncatedRecord:
+		return "truncated record"
+	case IssueEOFMarker:
+		return "EOF marker"
+	case IssueDeleteFlag:
+		return "delete flag"
+	case IssueMemoPointer:
+		return "memo pointer"
+	case IssueFPTNextFree:
+		return "FPT next free"
+	default:
+		return fmt.Sprintf("IssueType(%d)", int(t))
+	}
+}
+
+// CheckIssue is a single problem found by Check
+type CheckIssue struct {
+	Type     IssueType
+	RecNo    int64  // Zero based record number, -1 if the issue is not related to a record
+	FieldPos int    // Zero based field position, -1 if the issue is not related to a field
+	Offset   int64  // Byte offset of the problem in the DBF file, or in the FPT file for IssueFPTNextFree
+	Message  string // Description of the problem
+	Repaired bool   // Set by RepairFile when the issue has been repaired
+}
+
+func (i CheckIssue) String() string {
+	s := fmt.Sprintf("%s at offset %d", i.Type, i.Offset)
+	if i.RecNo >= 0 {
+		s += fmt.Sprintf(", record %d", i.RecNo)
+	}
+	if i.FieldPos >= 0 {
+		s += fmt.Sprintf(", field %d", i.FieldPos)
+	}
+	s += ": " + i.Message
+	if i.Repaired {
+		s += " (repaired)"
+	}
+	return s
+}
+
+// CheckReport is the result of checking the structure of a table
+type CheckReport struct {
+	FileSize     int64  // Actual size of the DBF file
+	ExpectedSize int64  // Size of the DBF file calculated from the header, including the EOF marker
+	HeaderNumRec uint32 // Number of records according to the header
+	NumRec       uint32 // Number of complete records in the file
+	EOFMarker    bool   // If the file ends with the 0x1A end of file marker
+	FPTSize      int64  // Actual size of the FPT file, 0 if there is no FPT file
+	FPTNextFree  uint32 // Expected NextFree value for the FPT file, calculated from the FPT file size
+	Issues       []CheckIssue
+}
+
+// OK returns true if no issues were found
+func (r *CheckReport) OK() bool {
+	return len(r.Issues) == 0
+}
+
+func (r *CheckReport) add(t IssueType, recno int64, fieldpos int, offset int64, format string, args ...interface{}) {
+	r.Issues = append(r.Issues, CheckIssue{
+		Type:     t,
+		RecNo:    recno,
+		FieldPos: fieldpos,
+		Offset:   offset,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// knownFieldTypes are all field types used by FoxPro and dBase, not all of these can be read by this package
+const knownFieldTypes = "CYNFDTBILMGPVWQ0"
+
+// Check walks the header, field definitions, records and memo pointers and returns a report of all
+// structural problems found. Check does not decode any field values and does not move the record pointer.
+// An error is only returned when the files could not be read at all.
+func (dbf *DBF) Check() (*CheckReport, error) {
+	h := dbf.header
+	report := &CheckReport{
+		HeaderNumRec: h.NumRec,
+		ExpectedSize: h.FileSize(),
+	}
+
+	size, err := streamSize(dbf.r)
+	if err != nil {
+		return nil, err
+	}
+	report.FileSize = size
+
+	// header and field definitions
+	headerEnd := dbf.HeaderTerminator() + 1
+	if int64(h.FirstRec) < headerEnd {
+		report.add(IssueHeader, -1, -1, 8, "first record position %d is inside the field definitions ending at %d", h.FirstRec, headerEnd)
+	} else if hasBacklink(h.FileVersion) && int64(h.FirstRec) < headerEnd+backlinkSize {
+		report.add(IssueHeader, -1, -1, 8, "first record position %d leaves no room for the %d byte backlink after %d", h.FirstRec, backlinkSize, headerEnd)
+	}
+	offset := uint32(1)
+	for i, f := range dbf.fields {
+		fieldOffset := int64(32 + 32*i)
+		if strings.IndexByte(knownFieldTypes, f.Type) < 0 {
+			report.add(IssueField, -1, i, fieldOffset, "field %s has unknown type %q", f.FieldName(), f.Type)
+		}
+		if f.Len == 0 {
+			report.add(IssueField, -1, i, fieldOffset, "field %s has length 0", f.FieldName())
+		}
+		// dBase III files do not always store the field displacement, only check it when it is set
+		if f.Pos != 0 && f.Pos != offset {
+			report.add(IssueField, -1, i, fieldOffset, "field %s has displacement %d, expected %d", f.FieldName(), f.Pos, offset)
+		}
+		offset += uint32(f.Len)
+	}
+	if offset != uint32(h.RecLen) {
+		report.add(IssueHeader, -1, -1, 10, "record length %d does not match the field lengths (%d)", h.RecLen, offset)
+	}
+	if dbf.hasMemoFields() && !h.HasMemo() {
+		report.add(IssueHeader, -1, -1, 28, "table has memo fields but the memo flag is not set")
+	} else if dbf.hasMemoFields() && dbf.fptr == nil {
+		report.add(IssueHeader, -1, -1, 28, "table has memo fields but no FPT file")
+	}
+	if h.RecLen == 0 || size < int64(h.FirstRec) {
+		report.add(IssueHeader, -1, -1, 8, "file size %d is too small for the header (%d bytes) and records", size, h.FirstRec)
+		return report, nil
+	}
+
+	// record count, partial records and EOF marker
+	avail := size - int64(h.FirstRec)
+	complete := avail / int64(h.RecLen)
+	rest := avail % int64(h.RecLen)
+	dataEnd := int64(h.FirstRec) + complete*int64(h.RecLen)
+	if rest > 0 {
+		last := make([]byte, 1)
+		if _, err := dbf.r.ReadAt(last, size-1); err != nil {
+			return nil, err
+		}
+		report.EOFMarker = last[0] == 0x1A
+		if rest > 1 || !report.EOFMarker {
+			report.add(IssueTruncatedRecord, complete, -1, dataEnd, "last record is incomplete, %d of %d bytes", rest, h.RecLen)
+		}
+	}
+	if !report.EOFMarker {
+		report.add(IssueEOFMarker, -1, -1, dataEnd, "end of file marker 0x1A is missing")
+	}
+	if complete > math.MaxUint32 {
+		complete = math.MaxUint32
+	}
+	report.NumRec = uint32(complete)
+	if report.NumRec != h.NumRec {
+		report.add(IssueRecordCount, -1, -1, 4, "header has %d records, file contains %d complete records", h.NumRec, report.NumRec)
+	}
+
+	// FPT header
+	var firstBlock, maxEnd int64
+	if dbf.fptr != nil {
+		report.FPTSize, err = streamSize(dbf.fptr)
+		if err != nil {
+			return nil, err
+		}
+		bs := int64(dbf.fptheader.BlockSize)
+		if bs == 0 {
+			report.add(IssueHeader, -1, -1, 6, "FPT block size is 0")
+		} else {
+			firstBlock = (512 + bs - 1) / bs
+			report.FPTNextFree = uint32((report.FPTSize + bs - 1) / bs)
+		}
+	}
+
+	// delete flags and memo pointers of all complete records
+	numrec := report.NumRec
+	if h.NumRec < numrec {
+		numrec = h.NumRec
+	}
+	buf := make([]byte, h.RecLen)
+	blockHeader := make([]byte, 8)
+	for recno := uint32(0); recno < numrec; recno++ {
+		recOffset := dbf.recordOffset(recno)
+		if _, err := dbf.r.ReadAt(buf, recOffset); err != nil && err != io.EOF {
+			return nil, err
+		}
+		if buf[0] != 0x20 && buf[0] != 0x2A {
+			report.add(IssueDeleteFlag, int64(recno), -1, recOffset, "invalid delete flag 0x%02X", buf[0])
+		}
+		if firstBlock == 0 {
+			continue
+		}
+		pos := 1
+		for i, f := range dbf.fields {
+			pos += int(f.Len)
+			if !isMemoType(f.Type) || f.Len != 4 || pos > len(buf) {
+				continue
+			}
+			block := int64(binary.LittleEndian.Uint32(buf[pos-4:]))
+			if block == 0 {
+				continue
+			}
+			ptrOffset := recOffset + int64(pos-4)
+			blockOffset := block * int64(dbf.fptheader.BlockSize)
+			if block < firstBlock || blockOffset+8 > report.FPTSize {
+				report.add(IssueMemoPointer, int64(recno), i, ptrOffset, "memo block %d is outside the FPT file", block)
+				continue
+			}
+			if _, err := dbf.fptr.ReadAt(blockHeader, blockOffset); err != nil && err != io.EOF {
+				return nil, err
+			}
+			end := blockOffset + 8 + int64(binary.BigEndian.Uint32(blockHeader[4:]))
+			if end > report.FPTSize {
+				report.add(IssueMemoPointer, int64(recno), i, ptrOffset, "memo block %d ends at %d, beyond the end of the FPT file", block, end)
+				continue
+			}
+			if end > maxEnd {
+				maxEnd = end
+			}
+		}
+	}
+
+	// FPT next free block
+	if firstBlock > 0 {
+		next := int64(dbf.fptheader.NextFree) * int64(dbf.fptheader.BlockSize)
+		switch {
+		case next < maxEnd:
+			report.add(IssueFPTNextFree, -1, -1, 0, "next free block %d is inside memo data ending at %d", dbf.fptheader.NextFree, maxEnd)
+		case dbf.fptheader.NextFree != report.FPTNextFree:
+			report.add(IssueFPTNextFree, -1, -1, 0, "next free block is %d, expected %d from the FPT file size", dbf.fptheader.NextFree, report.FPTNextFree)
+		}
+	}
+
+	return report, nil
+}
+
+// RepairFile checks DBF file filename (and its FPT file) and repairs the issues that can be repaired:
+//   - a partial trailing record is truncated and a missing EOF marker is added
+//   - the record count in the header is set to the number of complete records
+//   - memo pointers pointing outside the FPT file are cleared (empty memo)
+//   - NextFree in the FPT header is rebuilt from the FPT file size
+//
+// The returned report contains all issues found, repaired issues have Repaired set to true.
+// Make a backup before calling RepairFile, the files are modified in place.
+func RepairFile(filename string) (*CheckReport, error) {
+	dbf, err := OpenFile(filename, new(UTF8Decoder))
+	if err != nil {
+		return nil, err
+	}
+	report, err := dbf.Check()
+	hasFPT := dbf.fptr != nil
+	firstRec, recLen := int64(dbf.header.FirstRec), int64(dbf.header.RecLen)
+	if cerr := dbf.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil || report.OK() {
+		return report, err
+	}
+
+	f, err := os.OpenFile(filename, os.O_RDWR, 0)
+	if err != nil {
+		return report, err
+	}
+	defer f.Close()
+
+	dataEnd := firstRec + int64(report.NumRec)*recLen
+	for i := range report.Issues {
+		issue := &report.Issues[i]
+		switch issue.Type {
+		case IssueTruncatedRecord, IssueEOFMarker:
+			if err := f.Truncate(dataEnd); err != nil {
+				return report, err
+			}
+			if _, err := f.WriteAt([]byte{0x1A}, dataEnd); err != nil {
+				return report, err
+			}
+		case IssueRecordCount:
+			b := make([]byte, 4)
+			binary.LittleEndian.PutUint32(b, report.NumRec)
+			if _, err := f.WriteAt(b, 4); err != nil {
+				return report, err
+			}
+		case IssueMemoPointer:
+			if _, err := f.WriteAt(make([]byte, 4), issue.Offset); err != nil {
+				return report, err
+			}
+		case IssueFPTNextFree:
+			if !hasFPT {
+				continue
+			}
+			if err := repairFPTNextFree(fptFilename(filename), report.FPTNextFree); err != nil {
+				return report, err
+			}
+		default:
+			continue
+		}
+		issue.Repaired = true
+	}
+
+	return report, f.Sync()
+}
+
+func repairFPTNextFree(filename string, next uint32) error {
+	f, err := os.OpenFile(filename, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	b := make([]byte, 4)
+	// Integers in memo files are stored with the most significant byte first
+	binary.BigEndian.PutUint32(b, next)
+	if _, err := f.WriteAt(b, 0); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// streamSize returns the size of a stream by seeking to its end
+func streamSize(r io.Seeker) (int64, error) {
+	return r.Seek(0, io.SeekEnd)
+}
+
+// hasMemoFields returns true if any of the fields is stored in the FPT file
+func (dbf *DBF) hasMemoFields() bool {
+	for _, f := range dbf.fields {
+		if isMemoType(f.Type) {
+			return true
+		}
+	}
+	return false
+}
+
+// isMemoType returns true for field types which are stored in the FPT file
+func isMemoType(t byte) bool {
+	return t == 'M' || t == 'G' || t == 'P'
+}
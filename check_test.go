@@ -0,0 +1,190 @@
+package dbf
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// copyTestFiles copies DBF file name (and its FPT file if it exists) from testdata to dir
+func copyTestFiles(t *testing.T, dir, name string) string {
+	t.Helper()
+	for _, fn := range []string{name, fptFilename(name)} {
+		data, err := ioutil.ReadFile(filepath.Join("testdata", fn))
+		if os.IsNotExist(err) && fn != name {
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, fn), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return filepath.Join(dir, name)
+}
+
+func TestCheck(t *testing.T) {
+	dbf, err := OpenFile(filepath.Join("testdata", "dbase_30.dbf"), new(Win1250Decoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbf.Close()
+
+	report, err := dbf.Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() {
+		t.Errorf("want no issues in dbase_30.dbf, have %v", report.Issues)
+	}
+	if report.NumRec != 34 || !report.EOFMarker || report.FileSize != report.ExpectedSize {
+		t.Errorf("unexpected report: %+v", report)
+	}
+
+	// TEST.DBF was written without an EOF marker
+	dbf, err = OpenFile(filepath.Join("testdata", "TEST.DBF"), new(Win1250Decoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbf.Close()
+
+	report, err = dbf.Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Issues) != 1 || report.Issues[0].Type != IssueEOFMarker {
+		t.Errorf("want only an EOF marker issue in TEST.DBF, have %v", report.Issues)
+	}
+}
+
+func TestCheckMemoFlag(t *testing.T) {
+	filename := copyTestFiles(t, t.TempDir(), "TEST.DBF")
+
+	// clear the memo flag, the FPT file is no longer opened
+	f, err := os.OpenFile(filename, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt([]byte{0x00}, 28); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	dbf, err := OpenFile(filename, new(Win1250Decoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbf.Close()
+
+	report, err := dbf.Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found bool
+	for _, issue := range report.Issues {
+		switch issue.Type {
+		case IssueHeader:
+			if issue.Message != "table has memo fields but the memo flag is not set" {
+				t.Errorf("unexpected header issue %s", issue)
+			}
+			found = true
+		case IssueEOFMarker:
+		default:
+			t.Errorf("unexpected issue %s", issue)
+		}
+	}
+	if !found {
+		t.Errorf("want a memo flag issue, have %v", report.Issues)
+	}
+}
+
+func TestRepairFile(t *testing.T) {
+	filename := copyTestFiles(t, t.TempDir(), "TEST.DBF")
+
+	dbf, err := OpenFile(filename, new(Win1250Decoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	memoPos := int64(dbf.fields[dbf.FieldPos("MELDING")].Pos)
+	memoOffset := dbf.recordOffset(1) + memoPos
+	truncateAt := dbf.recordOffset(3) + 50
+	dbf.Close()
+
+	// damage the files: a dangling memo pointer, a truncated last record and a wrong NextFree
+	f, err := os.OpenFile(filename, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, 5000)
+	if _, err := f.WriteAt(b, memoOffset); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Truncate(truncateAt); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	fpt, err := os.OpenFile(fptFilename(filename), os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	binary.BigEndian.PutUint32(b, 3)
+	if _, err := fpt.WriteAt(b, 0); err != nil {
+		t.Fatal(err)
+	}
+	fpt.Close()
+
+	report, err := RepairFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[IssueType]bool{
+		IssueTruncatedRecord: true,
+		IssueEOFMarker:       true,
+		IssueRecordCount:     true,
+		IssueMemoPointer:     true,
+		IssueFPTNextFree:     true,
+	}
+	for _, issue := range report.Issues {
+		if !want[issue.Type] {
+			t.Errorf("unexpected issue %s", issue)
+			continue
+		}
+		if !issue.Repaired {
+			t.Errorf("issue not repaired: %s", issue)
+		}
+		delete(want, issue.Type)
+	}
+	for typ := range want {
+		t.Errorf("missing issue of type %s", typ)
+	}
+
+	// check the repaired file
+	dbf, err = OpenFile(filename, new(Win1250Decoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbf.Close()
+
+	report, err = dbf.Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() {
+		t.Errorf("want no issues after repair, have %v", report.Issues)
+	}
+	if dbf.NumRecords() != 3 {
+		t.Errorf("want 3 records after repair, have %d", dbf.NumRecords())
+	}
+	raw, err := dbf.readField(1, dbf.FieldPos("MELDING"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block := binary.LittleEndian.Uint32(raw); block != 0 {
+		t.Errorf("want memo block 0 after repair, have %d", block)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+
+	dbf "github.com/SebastiaanKlippert/go-foxpro-dbf"
+)
+
+func checkFlags(e *env) {
+	e.flags.BoolVar(&e.repair, "repair", false, "repair the issues found, the files are modified in place")
+}
+
+// checkAccess does not open the table with -repair, RepairFile opens the files itself for writing
+func checkAccess(e *env) access {
+	if e.repair {
+		return external
+	}
+	return readOnly
+}
+
+func runCheck(e *env, table *dbf.DBF, args []string) error {
+	var report *dbf.CheckReport
+	var err error
+	if e.repair {
+		report, err = dbf.RepairFile(e.filename)
+	} else {
+		report, err = table.Check()
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(e.stdout, "Records in header: %d, complete records in file: %d\n", report.HeaderNumRec, report.NumRec)
+	fmt.Fprintf(e.stdout, "File size: %d, expected size: %d\n", report.FileSize, report.ExpectedSize)
+	if report.FPTSize > 0 {
+		fmt.Fprintf(e.stdout, "FPT size: %d\n", report.FPTSize)
+	}
+	if report.OK() {
+		fmt.Fprintln(e.stdout, "No issues found")
+		return nil
+	}
+	repaired := 0
+	for _, issue := range report.Issues {
+		fmt.Fprintln(e.stdout, issue)
+		if issue.Repaired {
+			repaired++
+		}
+	}
+	fmt.Fprintf(e.stdout, "%d issues found", len(report.Issues))
+	if e.repair {
+		fmt.Fprintf(e.stdout, ", %d repaired", repaired)
+	}
+	fmt.Fprintln(e.stdout)
+	if repaired == len(report.Issues) {
+		return nil
+	}
+	return errIssues
+}
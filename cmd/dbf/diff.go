@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	dbf "github.com/SebastiaanKlippert/go-foxpro-dbf"
+)
+
+// errDifferences is returned by runDiff when the tables differ, for an exit code 1 without an error message
+var errDifferences = errors.New("tables differ")
+
+func diffFlags(e *env) {
+	e.flags.StringVar(&e.keys, "key", "", "comma separated list of key fields to pair the records by, defaults to the record number")
+	e.flags.StringVar(&e.format, "format", "text", "output format: text or json")
+}
+
+func runDiff(e *env, table *dbf.DBF, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: dbf diff <file> <file>")
+	}
+	if e.format != "text" && e.format != "json" {
+		return fmt.Errorf("unknown diff format %q", e.format)
+	}
+	other, err := e.open(args[0], false)
+	if err != nil {
+		return err
+	}
+	defer other.Close()
+
+	var keys []string
+	for _, name := range strings.Split(e.keys, ",") {
+		if name = strings.ToUpper(strings.TrimSpace(name)); name != "" {
+			keys = append(keys, name)
+		}
+	}
+	diff, err := dbf.Diff(table, other, keys)
+	if err != nil {
+		return err
+	}
+	if e.format == "json" {
+		err = writeDiffJSON(e, diff, keys)
+	} else {
+		err = writeDiffText(e, diff, keys)
+	}
+	if err != nil {
+		return err
+	}
+	if !diff.Equal() {
+		return errDifferences
+	}
+	return nil
+}
+
+// writeDiffText prints the differences, one line per field definition and record, followed by the changed fields.
+// Removed records start with -, added records with + and changed records with ~.
+func writeDiffText(e *env, diff *dbf.TableDiff, keys []string) error {
+	w := bufio.NewWriter(e.stdout)
+	for _, d := range diff.Schema {
+		fmt.Fprintln(w, d)
+	}
+	var added, removed, changed int
+	for _, d := range diff.Records {
+		switch d.Type {
+		case dbf.DiffAdded:
+			added++
+			fmt.Fprintf(w, "+ record %d", d.NewRecNo)
+		case dbf.DiffRemoved:
+			removed++
+			fmt.Fprintf(w, "- record %d", d.OldRecNo)
+		default:
+			changed++
+			fmt.Fprintf(w, "~ record %d", d.OldRecNo)
+			if d.NewRecNo != d.OldRecNo {
+				fmt.Fprintf(w, " -> %d", d.NewRecNo)
+			}
+		}
+		if len(d.Key) > 0 {
+			var key []string
+			for i, v := range d.Key {
+				key = append(key, fmt.Sprintf("%s=%s", keys[i], formatValue(dbf.FieldHeader{}, v)))
+			}
+			fmt.Fprintf(w, " (%s)", strings.Join(key, ", "))
+		}
+		fmt.Fprintln(w)
+		if d.Type == dbf.DiffChanged {
+			for _, c := range d.Changes {
+				fmt.Fprintf(w, "    %s: %q -> %q\n", c.Field, formatValue(dbf.FieldHeader{}, c.Old), formatValue(dbf.FieldHeader{}, c.New))
+			}
+		}
+	}
+	if diff.Equal() {
+		fmt.Fprintln(w, "No differences")
+	} else {
+		fmt.Fprintf(w, "%d field differences, %d records added, %d removed, %d changed\n", len(diff.Schema), added, removed, changed)
+	}
+	return w.Flush()
+}
+
+type jsonDiff struct {
+	Schema  []jsonSchemaDiff `json:"schema"`
+	Records []jsonRecordDiff `json:"records"`
+}
+
+type jsonSchemaDiff struct {
+	Type  string     `json:"type"`
+	Field string     `json:"field"`
+	Old   *jsonField `json:"old"`
+	New   *jsonField `json:"new"`
+}
+
+type jsonField struct {
+	Type     string `json:"type"`
+	Length   uint8  `json:"length"`
+	Decimals uint8  `json:"decimals"`
+}
+
+type jsonRecordDiff struct {
+	Type     string                 `json:"type"`
+	Key      map[string]interface{} `json:"key,omitempty"`
+	OldRecNo *int64                 `json:"old_recno"`
+	NewRecNo *int64                 `json:"new_recno"`
+	Changes  []jsonFieldChange      `json:"changes"`
+}
+
+type jsonFieldChange struct {
+	Field string      `json:"field"`
+	Old   interface{} `json:"old"`
+	New   interface{} `json:"new"`
+}
+
+// writeDiffJSON writes the differences as a JSON object with the schema and record differences
+func writeDiffJSON(e *env, diff *dbf.TableDiff, keys []string) error {
+	out := jsonDiff{Schema: []jsonSchemaDiff{}, Records: []jsonRecordDiff{}}
+	for _, d := range diff.Schema {
+		out.Schema = append(out.Schema, jsonSchemaDiff{Type: d.Type.String(), Field: d.Field, Old: newJSONField(d.Old), New: newJSONField(d.New)})
+	}
+	for _, d := range diff.Records {
+		rd := jsonRecordDiff{Type: d.Type.String(), OldRecNo: recNo(d.OldRecNo), NewRecNo: recNo(d.NewRecNo), Changes: []jsonFieldChange{}}
+		if len(d.Key) > 0 {
+			rd.Key = make(map[string]interface{}, len(d.Key))
+			for i, v := range d.Key {
+				rd.Key[keys[i]] = jsonValue(v)
+			}
+		}
+		for _, c := range d.Changes {
+			rd.Changes = append(rd.Changes, jsonFieldChange{Field: c.Field, Old: jsonValue(c.Old), New: jsonValue(c.New)})
+		}
+		out.Records = append(out.Records, rd)
+	}
+	enc := json.NewEncoder(e.stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+func newJSONField(f *dbf.FieldHeader) *jsonField {
+	if f == nil {
+		return nil
+	}
+	return &jsonField{Type: f.FieldType(), Length: f.Len, Decimals: f.Decimals}
+}
+
+// recNo returns nil for record number -1
+func recNo(recno int64) *int64 {
+	if recno < 0 {
+		return nil
+	}
+	return &recno
+}
+
+// jsonValue returns a field value for JSON output, strings are trimmed and empty dates are null
+func jsonValue(val interface{}) interface{} {
+	switch v := val.(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case time.Time:
+		if v.IsZero() {
+			return nil
+		}
+		return v.Format("2006-01-02T15:04:05")
+	}
+	return val
+}
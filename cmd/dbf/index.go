@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	dbf "github.com/SebastiaanKlippert/go-foxpro-dbf"
+)
+
+func indexFlags(e *env) {
+	e.flags.StringVar(&e.tag, "tag", "", "tag to create or replace, all tags are rebuilt when empty")
+	e.flags.StringVar(&e.key, "key", "", "key expression of the tag")
+	e.flags.StringVar(&e.forExpr, "for", "", "FOR expression of the tag, only matching records are indexed")
+	e.flags.BoolVar(&e.unique, "unique", false, "only index the first record of every key")
+	e.flags.BoolVar(&e.descending, "descending", false, "store the keys in descending order")
+}
+
+// runIndex runs on a table opened for writing, Character keys are encoded matching the decoder
+func runIndex(e *env, table *dbf.DBF, args []string) error {
+	if e.tag != "" && e.key == "" {
+		return fmt.Errorf("-key is required with -tag")
+	}
+	var err error
+	if e.tag != "" {
+		err = table.BuildIndex(e.tag, e.key, e.forExpr, &dbf.IndexOptions{Unique: e.unique, Descending: e.descending})
+	} else {
+		err = table.Reindex(nil)
+	}
+	if err != nil {
+		return err
+	}
+	tags, err := table.Tags()
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(e.stdout, 0, 4, 1, ' ', 0)
+	for _, tag := range tags {
+		var forExpr string
+		if tag.For != "" {
+			forExpr = "FOR " + tag.For
+		}
+		var options []string
+		if tag.Unique {
+			options = append(options, "UNIQUE")
+		}
+		if tag.Descending {
+			options = append(options, "DESCENDING")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", tag.Name, tag.Key, forExpr, strings.Join(options, " "))
+	}
+	return w.Flush()
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	dbf "github.com/SebastiaanKlippert/go-foxpro-dbf"
+)
+
+// fileVersions are descriptions of the known file type flags
+var fileVersions = map[byte]string{
+	0x02: "FoxBASE",
+	0x03: "FoxBASE+/dBase III PLUS, no memo",
+	0x30: "Visual FoxPro",
+	0x31: "Visual FoxPro, autoincrement enabled",
+	0x32: "Visual FoxPro, Varchar, Varbinary, or Blob-enabled",
+	0x43: "dBASE IV SQL table files, no memo",
+	0x63: "dBASE IV SQL system files, no memo",
+	0x83: "FoxBASE+/dBase III PLUS, with memo",
+	0x8B: "dBASE IV with memo",
+	0xCB: "dBASE IV SQL table files, with memo",
+	0xF5: "FoxPro 2.x (or earlier) with memo",
+	0xFB: "FoxBASE",
+}
+
+// codePages are the code pages for the known code page marks
+var codePages = map[byte]string{
+	0x01: "437 U.S. MS-DOS",
+	0x02: "850 International MS-DOS",
+	0x03: "1252 Windows ANSI",
+	0x04: "10000 Standard Macintosh",
+	0x64: "852 Eastern European MS-DOS",
+	0x65: "866 Russian MS-DOS",
+	0x66: "865 Nordic MS-DOS",
+	0x67: "861 Icelandic MS-DOS",
+	0x6A: "737 Greek MS-DOS (437G)",
+	0x6B: "857 Turkish MS-DOS",
+	0x78: "950 Chinese (Hong Kong SAR, Taiwan) Windows",
+	0x79: "949 Korean Windows",
+	0x7A: "936 Chinese (PRC, Singapore) Windows",
+	0x7B: "932 Japanese Windows",
+	0x7C: "874 Thai Windows",
+	0x7D: "1255 Hebrew Windows",
+	0x7E: "1256 Arabic Windows",
+	0x96: "10007 Russian Macintosh",
+	0x97: "10029 Macintosh EE",
+	0x98: "10006 Greek Macintosh",
+	0xC8: "1250 Windows EE",
+	0xC9: "1251 Russian Windows",
+	0xCA: "1254 Turkish Windows",
+	0xCB: "1253 Greek Windows",
+}
+
+func runInfo(e *env, table *dbf.DBF, args []string) error {
+	h := table.Header()
+	w := tabwriter.NewWriter(e.stdout, 0, 4, 1, ' ', 0)
+
+	fmt.Fprintf(w, "File version:\t0x%02X %s\n", h.FileVersion, fileVersions[h.FileVersion])
+	fmt.Fprintf(w, "Code page:\t0x%02X %s\n", h.CodePage, codePages[h.CodePage])
+	fmt.Fprintf(w, "Table flags:\t0x%02X %s\n", h.TableFlags, describeFlags(h.TableFlags, tableFlagNames))
+	if table.Backlink() != "" {
+		fmt.Fprintf(w, "Database:\t%s\n", table.Backlink())
+	}
+	fmt.Fprintf(w, "Modified:\t%s\n", h.Modified().Format("2006-01-02"))
+	fmt.Fprintf(w, "Records:\t%d\n", h.NumRec)
+	fmt.Fprintf(w, "Fields:\t%d\n", table.NumFields())
+	fmt.Fprintf(w, "Terminator:\t%d\n", table.HeaderTerminator())
+	fmt.Fprintf(w, "First record:\t%d\n", h.FirstRec)
+	fmt.Fprintf(w, "Record length:\t%d\n", h.RecLen)
+	fmt.Fprintf(w, "Calculated size:\t%d\n", h.FileSize())
+
+	if stat, err := table.Stat(); err == nil {
+		fmt.Fprintf(w, "File:\t%s\n", stat.Name())
+		fmt.Fprintf(w, "File size:\t%d\n", stat.Size())
+		fmt.Fprintf(w, "File modified:\t%s\n", stat.ModTime().Format("2006-01-02 15:04:05"))
+	}
+	if stat, err := table.StatFPT(); err == nil {
+		fmt.Fprintf(w, "FPT file:\t%s\n", stat.Name())
+		fmt.Fprintf(w, "FPT file size:\t%d\n", stat.Size())
+	}
+
+	return w.Flush()
+}
+
+func runSchema(e *env, table *dbf.DBF, args []string) error {
+	w := tabwriter.NewWriter(e.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "#\tName\tType\tLen\tDec\tFlags\tAutoinc")
+	for i, f := range table.Fields() {
+		autoinc, flags := "", f.Flags
+		if flags&0x0C == 0x0C {
+			// the autoincrement flag includes the binary flag bit
+			autoinc = fmt.Sprintf("next %d step %d", f.Next, f.Step)
+			flags &^= 0x0C
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%d\t%d\t%s\t%s\n", i, f.FieldName(), f.FieldType(), f.Len, f.Decimals, describeFlags(flags, fieldFlagNames), autoinc)
+	}
+	return w.Flush()
+}
+
+type flagName struct {
+	bit  byte
+	name string
+}
+
+var tableFlagNames = []flagName{
+	{0x01, "structural CDX"},
+	{0x02, "memo"},
+	{0x04, "database container"},
+}
+
+var fieldFlagNames = []flagName{
+	{0x01, "system"},
+	{0x02, "null"},
+	{0x04, "binary"},
+}
+
+// describeFlags returns the names of all bits set in flags
+func describeFlags(flags byte, names []flagName) string {
+	var set []string
+	for _, n := range names {
+		if flags&n.bit != 0 {
+			set = append(set, n.name)
+		}
+	}
+	return strings.Join(set, ", ")
+}
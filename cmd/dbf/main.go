@@ -0,0 +1,230 @@
+// Command dbf inspects and exports FoxPro DBF/FPT files.
+//
+// Usage:
+//
+//	dbf <command> [flags] <file.dbf | ->
+//
+// The commands are:
+//
+//	info     print the header info, version, code page, flags, record count and file info
+//	schema   print the fields with their type, length, decimals, flags and autoincrement values
+//	head     print the first records (-n, default 10)
+//	tail     print the last records (-n, default 10)
+//	get      print a single record by its zero based record number: dbf get file.dbf 12
+//	export   export all records as csv, json or ndjson (-format)
+//	check    check the structure of the table and optionally repair it (-repair)
+//	sqlite   import all records into a SQLite database: dbf sqlite file.dbf file.db
+//	diff     compare two tables by key fields (-key) or record number: dbf diff old.dbf new.dbf
+//	index    create a tag of the structural CDX index (-tag, -key, -for) or rebuild all tags
+//
+// Use - as filename to read the DBF from stdin, the FPT file can be passed using -fpt.
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	dbf "github.com/SebastiaanKlippert/go-foxpro-dbf"
+)
+
+type command struct {
+	name   string
+	usage  string
+	run    func(e *env, table *dbf.DBF, args []string) error
+	flags  func(e *env)
+	access func(e *env) access // how the table is opened for the parsed flags, read-only when nil
+}
+
+// access is how run opens the table of a command
+type access int
+
+const (
+	readOnly  access = iota
+	readWrite        // opened using OpenFileRW, files read from stdin can not be written
+	external         // the command opens the files itself, run passes a nil table
+)
+
+var commands = []*command{
+	{name: "info", usage: "info [flags] <file>", run: runInfo},
+	{name: "schema", usage: "schema [flags] <file>", run: runSchema},
+	{name: "head", usage: "head [-n count] [flags] <file>", run: runHead, flags: countFlag},
+	{name: "tail", usage: "tail [-n count] [flags] <file>", run: runTail, flags: countFlag},
+	{name: "get", usage: "get [flags] <file> <recno>", run: runGet},
+	{name: "export", usage: "export [-format csv|json|ndjson] [-deleted] [flags] <file>", run: runExport, flags: exportFlags},
+	{name: "check", usage: "check [-repair] [flags] <file>", run: runCheck, flags: checkFlags, access: checkAccess},
+	{name: "sqlite", usage: "sqlite [-table name] [-replace] [-deleted] [-index fields] [flags] <file> <database>", run: runSQLite, flags: sqliteFlags},
+	{name: "diff", usage: "diff [-key fields] [-format text|json] [flags] <file> <file>", run: runDiff, flags: diffFlags},
+	{name: "index", usage: "index [-tag name -key expr [-for expr] [-unique] [-descending]] [flags] <file>", run: runIndex, flags: indexFlags, access: writeAccess},
+}
+
+// env contains the in- and outputs and the parsed flags of a single run
+type env struct {
+	stdin          io.Reader
+	stdout, stderr io.Writer
+
+	filename string
+	flags    *flag.FlagSet
+
+	decoder string
+	fpt     string
+	force   bool
+	count   int
+	format  string
+	deleted bool
+	repair  bool
+	table   string
+	replace bool
+	indexes indexFlag
+	keys    string
+
+	tag, key, forExpr  string
+	unique, descending bool
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run runs the command in args and returns the exit code
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		usage(stderr)
+		return 2
+	}
+	var cmd *command
+	for _, c := range commands {
+		if c.name == args[0] {
+			cmd = c
+		}
+	}
+	if cmd == nil {
+		fmt.Fprintf(stderr, "dbf: unknown command %q\n", args[0])
+		usage(stderr)
+		return 2
+	}
+
+	e := &env{stdin: stdin, stdout: stdout, stderr: stderr}
+	e.flags = flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	e.flags.SetOutput(stderr)
+	e.flags.StringVar(&e.decoder, "decoder", "win1250", "charset decoder: win1250, utf8 or utf8validate")
+	e.flags.StringVar(&e.fpt, "fpt", "", "FPT file to use when reading the DBF from stdin")
+	e.flags.BoolVar(&e.force, "force", false, "open files with an untested file version")
+	if cmd.flags != nil {
+		cmd.flags(e)
+	}
+	e.flags.Usage = func() {
+		fmt.Fprintf(stderr, "usage: dbf %s\n", cmd.usage)
+		e.flags.PrintDefaults()
+	}
+	if err := e.flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+	if e.flags.NArg() < 1 {
+		e.flags.Usage()
+		return 2
+	}
+	e.filename = e.flags.Arg(0)
+
+	mode := readOnly
+	if cmd.access != nil {
+		mode = cmd.access(e)
+	}
+	if mode != readOnly && e.filename == "-" {
+		fmt.Fprintf(stderr, "dbf: %s cannot write to a file read from stdin\n", cmd.name)
+		return 1
+	}
+	var table *dbf.DBF
+	if mode != external {
+		var err error
+		if table, err = e.open(e.filename, mode == readWrite); err != nil {
+			fmt.Fprintf(stderr, "dbf: %s\n", err)
+			return 1
+		}
+	}
+
+	err := cmd.run(e, table, e.flags.Args()[1:])
+	// closing a table opened for writing can rebuild its index, so the error is reported
+	if table != nil {
+		if cerr := table.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		if err != errIssues && err != errDifferences {
+			fmt.Fprintf(stderr, "dbf: %s\n", err)
+		}
+		return 1
+	}
+	return 0
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: dbf <command> [flags] <file.dbf | ->")
+	fmt.Fprintln(w, "commands:")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  dbf %s\n", c.usage)
+	}
+}
+
+func countFlag(e *env) {
+	e.flags.IntVar(&e.count, "n", 10, "number of records")
+}
+
+func writeAccess(e *env) access {
+	return readWrite
+}
+
+// open opens DBF file filename from disk or from stdin when the filename is -.
+// With write the file is opened for writing, Character values are written without charset conversion.
+func (e *env) open(filename string, write bool) (*dbf.DBF, error) {
+	dec, err := decoder(e.decoder)
+	if err != nil {
+		return nil, err
+	}
+	if e.force {
+		orig := dbf.ValidFileVersionFunc
+		dbf.SetValidFileVersionFunc(func(version byte) error { return nil })
+		defer dbf.SetValidFileVersionFunc(orig)
+	}
+	if write {
+		return dbf.OpenFileRW(filename, dec, nil)
+	}
+	if filename != "-" {
+		return dbf.OpenFile(filename, dec)
+	}
+
+	data, err := ioutil.ReadAll(e.stdin)
+	if err != nil {
+		return nil, err
+	}
+	var fptreader dbf.ReaderAtSeeker
+	if e.fpt != "" {
+		fptdata, err := ioutil.ReadFile(e.fpt)
+		if err != nil {
+			return nil, err
+		}
+		fptreader = bytes.NewReader(fptdata)
+	}
+	return dbf.OpenStream(bytes.NewReader(data), fptreader, dec)
+}
+
+func decoder(name string) (dbf.Decoder, error) {
+	switch strings.ToLower(name) {
+	case "win1250":
+		return new(dbf.Win1250Decoder), nil
+	case "utf8":
+		return new(dbf.UTF8Decoder), nil
+	case "utf8validate":
+		return new(dbf.UTF8Validator), nil
+	default:
+		return nil, fmt.Errorf("unknown decoder %q", name)
+	}
+}
+
+var errIssues = errors.New("issues found")
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	dbf "github.com/SebastiaanKlippert/go-foxpro-dbf"
+)
+
+var testfile = filepath.Join("..", "..", "testdata", "TEST.DBF")
+
+// runTest runs the dbf command with args and returns stdout and the exit code
+func runTest(t *testing.T, stdin []byte, args ...string) (string, int) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	code := run(args, bytes.NewReader(stdin), &stdout, &stderr)
+	if stderr.Len() > 0 {
+		t.Logf("stderr: %s", stderr.String())
+	}
+	return stdout.String(), code
+}
+
+func TestInfo(t *testing.T) {
+	out, code := runTest(t, nil, "info", testfile)
+	if code != 0 {
+		t.Fatalf("want exit code 0, have %d", code)
+	}
+	for _, want := range []string{"0x30 Visual FoxPro", "0x03 1252 Windows ANSI", "0x02 memo", "Records:         4", "FPT file size:   671"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("want %q in output:\n%s", want, out)
+		}
+	}
+}
+
+func TestInfoBacklink(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "BACKLINK.DBF")
+	id, err := dbf.NewField("ID", 'I', 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	table, err := dbf.CreateFile(filename, []dbf.FieldHeader{id}, new(dbf.UTF8Decoder), new(dbf.UTF8Encoder), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	table.Close()
+	f, err := os.OpenFile(filename, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the backlink follows the field definition and the header terminator
+	if _, err := f.WriteAt([]byte("sales.dbc"), 32+32+1); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	out, code := runTest(t, nil, "info", filename)
+	if code != 0 {
+		t.Fatalf("want exit code 0, have %d", code)
+	}
+	if !strings.Contains(out, "Database:        sales.dbc") {
+		t.Errorf("want the database in output:\n%s", out)
+	}
+}
+
+func TestSchema(t *testing.T) {
+	out, code := runTest(t, nil, "schema", "-force", filepath.Join("..", "..", "testdata", "dbase_31.dbf"))
+	if code != 0 {
+		t.Fatalf("want exit code 0, have %d", code)
+	}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 12 {
+		t.Fatalf("want 12 lines, have %d:\n%s", len(lines), out)
+	}
+	if f := strings.Fields(lines[1]); strings.Join(f, " ") != "0 PRODUCTID I 4 0 next 78 step 1" {
+		t.Errorf("unexpected autoincrement field line %q", lines[1])
+	}
+	if !strings.Contains(lines[3], "null, binary") {
+		t.Errorf("want nullable binary flags in %q", lines[3])
+	}
+}
+
+func TestHeadTailGet(t *testing.T) {
+	out, code := runTest(t, nil, "head", "-n", "2", testfile)
+	if code != 0 || strings.Count(out, "Record ") != 2 || !strings.Contains(out, "Record 1 (deleted)") {
+		t.Errorf("unexpected head output (exit code %d):\n%s", code, out)
+	}
+	if !strings.Contains(out, "             Message line 2") {
+		t.Errorf("want indented second memo line:\n%s", out)
+	}
+
+	out, code = runTest(t, nil, "tail", "-n", "1", testfile)
+	if code != 0 || strings.Count(out, "Record ") != 1 || !strings.HasPrefix(out, "Record 3\n") {
+		t.Errorf("unexpected tail output (exit code %d):\n%s", code, out)
+	}
+
+	out, code = runTest(t, nil, "get", testfile, "1")
+	if code != 0 || !strings.Contains(out, "COMP_NAME  TEST2\n") || !strings.Contains(out, "NUMBER     123456789.99\n") {
+		t.Errorf("unexpected get output (exit code %d):\n%s", code, out)
+	}
+
+	_, code = runTest(t, nil, "get", testfile, "4")
+	if code != 1 {
+		t.Errorf("want exit code 1 for a record that does not exist, have %d", code)
+	}
+}
+
+func TestExport(t *testing.T) {
+	out, code := runTest(t, nil, "export", testfile)
+	if code != 0 {
+		t.Fatalf("want exit code 0, have %d", code)
+	}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if lines[0] != "ID,NIVEAU,DATUM,TIJD,SOORT,ID_NR,USERNR,COMP_NAME,COMP_OS,MELDING,NUMBER,FLOAT,BOOL" {
+		t.Errorf("unexpected CSV header %q", lines[0])
+	}
+	// 3 records that are not deleted, one with a memo spanning 2 lines
+	if len(lines) != 5 {
+		t.Errorf("want 5 CSV lines, have %d:\n%s", len(lines), out)
+	}
+
+	out, code = runTest(t, nil, "export", "-format", "json", "-deleted", testfile)
+	if code != 0 {
+		t.Fatalf("want exit code 0, have %d", code)
+	}
+	var records []map[string]interface{}
+	if err := json.Unmarshal([]byte(out), &records); err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 4 || records[1]["COMP_NAME"] != "TEST2" || records[1]["DATUM"] != "2015-02-03" {
+		t.Errorf("unexpected JSON export: %v", records)
+	}
+	if !strings.HasPrefix(out, `[{"ID":1,"NIVEAU":0,"DATUM":"2015-01-03",`) {
+		t.Errorf("want fields in header order, have %s", out)
+	}
+
+	out, code = runTest(t, nil, "export", "-format", "ndjson", testfile)
+	if code != 0 || strings.Count(out, "\n") != 3 {
+		t.Errorf("want 3 NDJSON lines (exit code %d), have:\n%s", code, out)
+	}
+}
+
+func TestStdin(t *testing.T) {
+	data, err := ioutil.ReadFile(testfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fpt := filepath.Join("..", "..", "testdata", "TEST.FPT")
+	out, code := runTest(t, data, "get", "-decoder", "utf8", "-fpt", fpt, "-", "0")
+	if code != 0 || !strings.Contains(out, "COMP_NAME  TEST\n") {
+		t.Errorf("unexpected output reading from stdin (exit code %d):\n%s", code, out)
+	}
+
+	// the FPT file is required for TEST.DBF
+	_, code = runTest(t, data, "info", "-")
+	if code != 1 {
+		t.Errorf("want exit code 1 without FPT file, have %d", code)
+	}
+
+	// commands writing to the table can not be used with stdin
+	for _, args := range [][]string{{"index", "-fpt", fpt, "-"}, {"check", "-repair", "-fpt", fpt, "-"}} {
+		if _, code := runTest(t, data, args...); code != 1 {
+			t.Errorf("%s: want exit code 1 writing to stdin, have %d", args[0], code)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	dir := t.TempDir()
+	for _, fn := range []string{"TEST.DBF", "TEST.FPT"} {
+		data, err := ioutil.ReadFile(filepath.Join("..", "..", "testdata", fn))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, fn), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	filename := filepath.Join(dir, "TEST.DBF")
+
+	out, code := runTest(t, nil, "check", filename)
+	if code != 1 || !strings.Contains(out, "end of file marker 0x1A is missing") {
+		t.Errorf("want missing EOF marker (exit code %d), have:\n%s", code, out)
+	}
+
+	out, code = runTest(t, nil, "check", "-repair", filename)
+	if code != 0 || !strings.Contains(out, "1 issues found, 1 repaired") {
+		t.Errorf("want repaired EOF marker (exit code %d), have:\n%s", code, out)
+	}
+	stat, err := os.Stat(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stat.Size() != 1221 {
+		t.Errorf("want file size 1221 after repair, have %d", stat.Size())
+	}
+
+	out, code = runTest(t, nil, "check", filename)
+	if code != 0 || !strings.Contains(out, "No issues found") {
+		t.Errorf("want no issues after repair (exit code %d), have:\n%s", code, out)
+	}
+}
+
+func TestUsage(t *testing.T) {
+	if _, code := runTest(t, nil); code != 2 {
+		t.Errorf("want exit code 2 without command, have %d", code)
+	}
+	if _, code := runTest(t, nil, "unknown", testfile); code != 2 {
+		t.Errorf("want exit code 2 for unknown command, have %d", code)
+	}
+	if _, code := runTest(t, nil, "info", "-decoder", "latin1", testfile); code != 1 {
+		t.Errorf("want exit code 1 for unknown decoder, have %d", code)
+	}
+}
+
+func TestSQLite(t *testing.T) {
+	dbfile := filepath.Join(t.TempDir(), "test.db")
+	out, code := runTest(t, nil, "sqlite", "-index", "COMP_NAME", "-index", "ID,DATUM", testfile, dbfile)
+	if code != 0 || out != "Imported 3 records into table TEST\n" {
+		t.Errorf("unexpected sqlite output (exit code %d):\n%s", code, out)
+	}
+
+	// the table exists now
+	if _, code = runTest(t, nil, "sqlite", testfile, dbfile); code != 1 {
+		t.Errorf("want exit code 1 for an existing table, have %d", code)
+	}
+	out, code = runTest(t, nil, "sqlite", "-replace", "-deleted", "-table", "meldingen", testfile, dbfile)
+	if code != 0 || out != "Imported 4 records into table meldingen\n" {
+		t.Errorf("unexpected sqlite output (exit code %d):\n%s", code, out)
+	}
+	if _, code = runTest(t, nil, "sqlite", "-index", ",", testfile, dbfile); code != 2 {
+		t.Errorf("want exit code 2 for an empty index, have %d", code)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	out, code := runTest(t, nil, "diff", testfile, testfile)
+	if code != 0 || out != "No differences\n" {
+		t.Errorf("unexpected diff output (exit code %d):\n%s", code, out)
+	}
+
+	table, err := dbf.OpenFile(testfile, new(dbf.Win1250Decoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer table.Close()
+	other := filepath.Join(t.TempDir(), "OTHER.DBF")
+	if _, err := table.CopyTo(other, &dbf.CopyOptions{Fields: []string{"ID", "COMP_NAME", "MELDING"}, Filter: dbf.Where("ID <> 3")}); err != nil {
+		t.Fatal(err)
+	}
+
+	out, code = runTest(t, nil, "diff", "-key", "id", testfile, other)
+	if code != 1 || !strings.Contains(out, "field FLOAT removed: F(10)\n") || !strings.Contains(out, "- record 2 (ID=3)\n") ||
+		!strings.HasSuffix(out, "10 field differences, 0 records added, 1 removed, 0 changed\n") {
+		t.Errorf("unexpected diff output (exit code %d):\n%s", code, out)
+	}
+
+	// by record number deleted record 1 is not compared and the records after it are shifted
+	out, code = runTest(t, nil, "diff", "-format", "json", testfile, other)
+	if code != 1 {
+		t.Fatalf("want exit code 1, have %d", code)
+	}
+	var diff struct {
+		Schema  []map[string]interface{}
+		Records []struct {
+			Type     string
+			OldRecNo *int64 `json:"old_recno"`
+			NewRecNo *int64 `json:"new_recno"`
+			Changes  []struct{ Field, Old, New interface{} }
+		}
+	}
+	if err := json.Unmarshal([]byte(out), &diff); err != nil {
+		t.Fatal(err)
+	}
+	if len(diff.Schema) != 10 || len(diff.Records) != 3 {
+		t.Fatalf("want 10 field and 3 record differences, have:\n%s", out)
+	}
+	if r := diff.Records[0]; r.Type != "added" || r.OldRecNo != nil || *r.NewRecNo != 1 || len(r.Changes) != 3 {
+		t.Errorf("unexpected added record %+v", r)
+	} else if c := r.Changes[0]; c.Field != "ID" || c.Old != nil || c.New != 4.0 {
+		t.Errorf("unexpected added field %+v", c)
+	}
+	if r := diff.Records[2]; r.Type != "removed" || *r.OldRecNo != 3 || r.NewRecNo != nil || len(r.Changes) != 13 {
+		t.Errorf("unexpected removed record %+v", r)
+	}
+
+	if _, code = runTest(t, nil, "diff", "-key", "NOPE", testfile, other); code != 1 {
+		t.Errorf("want exit code 1 for an unknown key field, have %d", code)
+	}
+}
+
+func TestIndex(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "TEST.DBF")
+	for _, name := range []string{"TEST.DBF", "TEST.FPT"} {
+		data, err := ioutil.ReadFile(filepath.Join("..", "..", "testdata", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(filepath.Dir(filename), name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, code := runTest(t, nil, "index", filename); code != 1 {
+		t.Errorf("want exit code 1 without index, have %d", code)
+	}
+	if _, code := runTest(t, nil, "index", "-tag", "NAME", filename); code != 1 {
+		t.Errorf("want exit code 1 without key, have %d", code)
+	}
+	out, code := runTest(t, nil, "index", "-tag", "name", "-key", "UPPER(COMP_NAME)", "-for", "!DELETED()", "-unique", filename)
+	if code != 0 || out != "NAME UPPER(COMP_NAME) FOR !DELETED() UNIQUE\n" {
+		t.Errorf("unexpected index output (exit code %d):\n%s", code, out)
+	}
+	if _, code := runTest(t, nil, "index", "-tag", "ID", "-key", "ID", "-descending", filename); code != 0 {
+		t.Errorf("want exit code 0, have %d", code)
+	}
+	out, code = runTest(t, nil, "index", filename)
+	if code != 0 || out != "ID   ID                              DESCENDING\nNAME UPPER(COMP_NAME) FOR !DELETED() UNIQUE\n" {
+		t.Errorf("unexpected reindex output (exit code %d):\n%q", code, out)
+	}
+}
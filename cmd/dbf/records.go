@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	dbf "github.com/SebastiaanKlippert/go-foxpro-dbf"
+)
+
+func runHead(e *env, table *dbf.DBF, args []string) error {
+	to := table.NumRecords()
+	if e.count >= 0 && uint32(e.count) < to {
+		to = uint32(e.count)
+	}
+	return printRecords(e, table, 0, to)
+}
+
+func runTail(e *env, table *dbf.DBF, args []string) error {
+	from := uint32(0)
+	if e.count >= 0 && uint32(e.count) < table.NumRecords() {
+		from = table.NumRecords() - uint32(e.count)
+	}
+	return printRecords(e, table, from, table.NumRecords())
+}
+
+func runGet(e *env, table *dbf.DBF, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: dbf get <file> <recno>")
+	}
+	recno, err := strconv.ParseUint(args[0], 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid record number %q", args[0])
+	}
+	if recno >= uint64(table.NumRecords()) {
+		return fmt.Errorf("record %d does not exist, the table has %d records", recno, table.NumRecords())
+	}
+	return printRecords(e, table, uint32(recno), uint32(recno)+1)
+}
+
+// printRecords prints records from up to (but not including) to, one field per line
+func printRecords(e *env, table *dbf.DBF, from, to uint32) error {
+	w := bufio.NewWriter(e.stdout)
+	fields := table.Fields()
+	width := 0
+	for _, f := range fields {
+		if len(f.FieldName()) > width {
+			width = len(f.FieldName())
+		}
+	}
+	// multiline memos are indented to line up with the first line
+	pad := "\n" + strings.Repeat(" ", width+4)
+	indent := strings.NewReplacer("\r\n", pad, "\n", pad)
+	for recno := from; recno < to; recno++ {
+		rec, err := table.RecordAt(recno)
+		if err != nil {
+			return err
+		}
+		if recno > from {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "Record %d", recno)
+		if rec.Deleted {
+			fmt.Fprint(w, " (deleted)")
+		}
+		fmt.Fprintln(w)
+		for i, val := range rec.FieldSlice() {
+			fmt.Fprintf(w, "  %-*s  %s\n", width, fields[i].FieldName(), indent.Replace(formatValue(fields[i], val)))
+		}
+	}
+	return w.Flush()
+}
+
+// formatValue formats a field value as text, strings are trimmed, dates are formatted
+// as ISO 8601 and binary data is base64 encoded
+func formatValue(f dbf.FieldHeader, val interface{}) string {
+	switch v := val.(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case []byte:
+		return base64.StdEncoding.EncodeToString(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case time.Time:
+		switch {
+		case v.IsZero():
+			return ""
+		case f.Type == 'D':
+			return v.Format("2006-01-02")
+		default:
+			return v.Format("2006-01-02T15:04:05")
+		}
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func exportFlags(e *env) {
+	e.flags.StringVar(&e.format, "format", "csv", "export format: csv, json or ndjson")
+	e.flags.BoolVar(&e.deleted, "deleted", false, "include deleted records")
+}
+
+func runExport(e *env, table *dbf.DBF, args []string) error {
+	switch e.format {
+	case "csv":
+		return exportCSV(e, table)
+	case "json", "ndjson":
+		return exportJSON(e, table, e.format == "ndjson")
+	default:
+		return fmt.Errorf("unknown export format %q", e.format)
+	}
+}
+
+func exportCSV(e *env, table *dbf.DBF) error {
+	w := bufio.NewWriter(e.stdout)
+	opts := new(dbf.CSVOptions)
+	if e.deleted {
+		opts.Deleted = dbf.IncludeDeleted
+	}
+	if err := table.WriteCSV(w, opts); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+func exportJSON(e *env, table *dbf.DBF, ndjson bool) error {
+	opts := &dbf.JSONOptions{
+		NDJSON:           ndjson,
+		TrimSpaces:       true,
+		DateFormat:       "2006-01-02",
+		DateTimeFormat:   "2006-01-02T15:04:05",
+		EmptyDatesAsNull: true,
+	}
+	if e.deleted {
+		opts.Deleted = dbf.IncludeDeleted
+	}
+	return table.WriteJSON(e.stdout, opts)
+}
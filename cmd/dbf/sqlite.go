@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	dbf "github.com/SebastiaanKlippert/go-foxpro-dbf"
+	"github.com/SebastiaanKlippert/go-foxpro-dbf/dbfsqlite"
+)
+
+// indexFlag collects the -index flags, every flag is a comma separated list of field names
+type indexFlag []dbfsqlite.Index
+
+func (f *indexFlag) String() string {
+	return ""
+}
+
+func (f *indexFlag) Set(s string) error {
+	var fields []string
+	for _, name := range strings.Split(s, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			fields = append(fields, name)
+		}
+	}
+	if len(fields) == 0 {
+		return fmt.Errorf("no fields in index %q", s)
+	}
+	*f = append(*f, dbfsqlite.Index{Fields: fields})
+	return nil
+}
+
+func sqliteFlags(e *env) {
+	e.flags.StringVar(&e.table, "table", "", "SQLite table name, defaults to the DBF file name without extension")
+	e.flags.BoolVar(&e.replace, "replace", false, "replace the SQLite table if it exists")
+	e.flags.BoolVar(&e.deleted, "deleted", false, "include deleted records")
+	e.flags.Var(&e.indexes, "index", "create an index on a comma separated list of fields, can be repeated")
+}
+
+func runSQLite(e *env, table *dbf.DBF, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: dbf sqlite <file> <database>")
+	}
+	name := e.table
+	if name == "" {
+		if e.filename == "-" {
+			return fmt.Errorf("use -table to set the table name when reading from stdin")
+		}
+		name = strings.TrimSuffix(filepath.Base(e.filename), filepath.Ext(e.filename))
+	}
+	opts := &dbfsqlite.Options{Replace: e.replace, Indexes: e.indexes}
+	if e.deleted {
+		opts.Deleted = dbf.IncludeDeleted
+	}
+	n, err := dbfsqlite.ImportFile(args[0], table, name, opts)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(e.stdout, "Imported %d records into table %s\n", n, name)
+	return nil
+}
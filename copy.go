@@ -0,0 +1,217 @@
+package dbf
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+)
+
+// CopyOptions contains the optional settings used by CopyTo, the zero value copies all fields of all records
+// that are not deleted
+type CopyOptions struct {
+	Fields      []string    // Names of the fields to copy in this order, defaults to all fields
+	Filter      Filter      // Only records matching the filter are copied
+	Deleted     DeletedMode // Handling of deleted records, defaults to SkipDeleted, copied deleted records stay deleted
+	FileVersion byte        // File type flag of the new table, defaults to the version of the table
+	CodePage    byte        // Code page mark of the new table, defaults to the code page of the table
+
+	// Encoder converts C fields and text memos to the charset of the new table after they are decoded
+	// using the Decoder of the table. Without Encoder the data is copied as is.
+	Encoder Encoder
+}
+
+// CopyTo writes the records of the table to a new table filename (and an FPT file when there are memo fields),
+// like COPY TO in FoxPro. Existing files are truncated. Returns the number of copied records.
+// The new table has the same field definitions, table flags (except the structural index flag) and memo block size.
+// The _NullFlags system field is only copied with all fields to a Visual FoxPro table, otherwise the fields
+// are no longer nullable. Other file versions only support C, N, F, D and L fields, the memo format of
+// FoxPro 2 tables (0xF5) is not supported.
+// The record pointer is not moved.
+func (dbf *DBF) CopyTo(filename string, opts *CopyOptions) (uint32, error) {
+	if opts == nil {
+		opts = new(CopyOptions)
+	}
+	c, err := dbf.Select(opts.Fields...)
+	if err != nil {
+		return 0, err
+	}
+	var filter Filter
+	if opts.Filter != nil {
+		if filter, err = bindFilter(opts.Filter, dbf); err != nil {
+			return 0, err
+		}
+	}
+	createopts := dbf.createOptions()
+	if opts.FileVersion != 0 {
+		createopts.FileVersion = opts.FileVersion
+	}
+	if opts.CodePage != 0 {
+		createopts.CodePage = opts.CodePage
+	}
+
+	// the positions of the fields to copy, system fields are dropped when they no longer match the fields
+	keepNull := len(opts.Fields) == 0 && hasBacklink(createopts.FileVersion)
+	var fieldpos []int
+	var fields []FieldHeader
+	for _, pos := range c.fieldpos {
+		f := dbf.fields[pos]
+		if f.Type == '0' && !keepNull {
+			continue
+		}
+		if !keepNull {
+			f.Flags &^= 0x02
+		}
+		if err := checkVersionFieldType(createopts.FileVersion, f); err != nil {
+			return 0, err
+		}
+		fieldpos = append(fieldpos, pos)
+		fields = append(fields, f)
+	}
+
+	dst, err := CreateFile(filename, fields, dbf.dec, opts.Encoder, createopts)
+	if err != nil {
+		return 0, err
+	}
+	n, err := dst.copyRecords(dbf, fieldpos, filter, opts)
+	if err == nil {
+		err = dst.writeEOF()
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(filename)
+		os.Remove(fptFilename(filename))
+		return 0, err
+	}
+	return n, nil
+}
+
+// CopyStructure creates a new empty table filename (and an FPT file when there are memo fields) with the same
+// field definitions, table flags and memo block size, like COPY STRUCTURE in FoxPro.
+// The structural index flag is cleared because no index file is created.
+func (dbf *DBF) CopyStructure(filename string) error {
+	dst, err := CreateFile(filename, dbf.fields, dbf.dec, dbf.enc, dbf.createOptions())
+	if err != nil {
+		return err
+	}
+	return dst.Close()
+}
+
+// createOptions returns the CreateOptions to create a table like this table
+func (dbf *DBF) createOptions() *CreateOptions {
+	opts := &CreateOptions{
+		FileVersion: dbf.header.FileVersion,
+		CodePage:    dbf.header.CodePage,
+		TableFlags:  dbf.header.TableFlags &^ 0x01,
+	}
+	if dbf.fptheader != nil {
+		opts.BlockSize = dbf.fptheader.BlockSize
+	}
+	return opts
+}
+
+// checkVersionFieldType returns an error if file version does not support the type of field f
+func checkVersionFieldType(version byte, f FieldHeader) error {
+	if hasBacklink(version) {
+		return nil
+	}
+	switch f.Type {
+	case 'C', 'N', 'F', 'D', 'L':
+		return nil
+	case 'M':
+		// FoxPro 2 stores the memo block as 10 ASCII digits instead of a 4 byte integer
+		return fmt.Errorf("%w: memo field %s is only supported by Visual FoxPro file versions", ErrInvalidField, f.FieldName())
+	}
+	return fmt.Errorf("%w: field %s of type %s is not supported by file version 0x%02X", ErrInvalidField, f.FieldName(), f.FieldType(), version)
+}
+
+// copyRecords writes the records of table src matching filter to dbf, which must be a new empty table.
+// The data of fields fieldpos is copied as is, except memos which are written to the FPT file of dbf,
+// and C fields and text memos when opts contains an Encoder.
+func (dbf *DBF) copyRecords(src *DBF, fieldpos []int, filter Filter, opts *CopyOptions) (uint32, error) {
+	data := make([]byte, dbf.header.RecLen)
+	var buf []byte
+	for recno := uint32(0); recno < src.header.NumRec; recno++ {
+		rec, err := src.ReadRecordInto(recno, buf)
+		if err != nil {
+			return dbf.header.NumRec, err
+		}
+		buf = rec.Data()
+		if !opts.Deleted.Include(rec.IsDeleted()) {
+			continue
+		}
+		if filter != nil {
+			ok, err := filter.Match(rec)
+			if err != nil {
+				return dbf.header.NumRec, err
+			}
+			if !ok {
+				continue
+			}
+		}
+
+		data[0] = rec.Data()[0]
+		for i, pos := range fieldpos {
+			f := &dbf.fields[i]
+			raw := data[dbf.offsets[i] : dbf.offsets[i]+int(f.Len)]
+			srcraw, err := rec.Bytes(pos)
+			if err != nil {
+				return dbf.header.NumRec, err
+			}
+			switch {
+			case isMemoType(f.Type):
+				err = dbf.copyMemo(src, srcraw, raw, opts.Encoder != nil)
+			case f.Type == 'C' && opts.Encoder != nil:
+				var s string
+				if s, err = src.toUTF8String(srcraw); err == nil {
+					err = dbf.valueToFieldData(s, i, raw)
+				}
+			default:
+				copy(raw, srcraw)
+			}
+			if err != nil {
+				return dbf.header.NumRec, src.newFieldError(recno, pos, src.recordOffset(recno)+int64(src.offsets[pos]), srcraw, err)
+			}
+		}
+		if err := dbf.writeDBF(data, dbf.recordOffset(dbf.header.NumRec)); err != nil {
+			return dbf.header.NumRec, err
+		}
+		dbf.header.NumRec++
+	}
+	return dbf.header.NumRec, nil
+}
+
+// copyMemo copies the memo of table src referenced by srcraw to the FPT file of dbf and writes the block to raw.
+// Text memos are converted to the charset of dbf if convert is true.
+func (dbf *DBF) copyMemo(src *DBF, srcraw, raw []byte, convert bool) error {
+	memo, text, err := src.readFPT(srcraw)
+	if err != nil {
+		return err
+	}
+	if len(memo) == 0 {
+		return dbf.emptyFieldData('M', raw)
+	}
+	if text && convert {
+		if memo, err = src.dec.Decode(memo); err != nil {
+			return err
+		}
+		if memo, err = dbf.fromUTF8String(string(memo)); err != nil {
+			return err
+		}
+	}
+	block, err := dbf.writeMemo(memo, text)
+	if err != nil {
+		return err
+	}
+	binary.LittleEndian.PutUint32(raw, block)
+	return nil
+}
+
+// writeEOF writes the EOF marker after the last record and the header with the record count
+func (dbf *DBF) writeEOF() error {
+	if err := dbf.writeDBF([]byte{0x1A}, dbf.recordOffset(dbf.header.NumRec)); err != nil {
+		return err
+	}
+	return dbf.writeHeader()
+}
@@ -0,0 +1,145 @@
+package dbf
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCopyTo(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "COPY.DBF")
+	n, err := testDbf.CopyTo(filename, &CopyOptions{
+		Fields: []string{"COMP_NAME", "MELDING", "ID"},
+		Filter: Where("ID > 1"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// record 1 is deleted
+	if n != 2 {
+		t.Fatalf("want 2 copied records, have %d", n)
+	}
+
+	dbf, err := OpenFile(filename, new(Win1250Decoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbf.Close()
+	if dbf.NumRecords() != 2 || strings.Join(dbf.FieldNames(), ",") != "COMP_NAME,MELDING,ID" {
+		t.Fatalf("want 2 records with fields COMP_NAME, MELDING and ID, have %d with %v", dbf.NumRecords(), dbf.FieldNames())
+	}
+	if dbf.Header().CodePage != testDbf.Header().CodePage || dbf.fptheader.BlockSize != testDbf.fptheader.BlockSize {
+		t.Error("want the code page and memo block size of the table")
+	}
+	rec, err := dbf.RecordAt(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := rec.Field(1); v != "Tësting wíth éncôdings!" {
+		t.Errorf("unexpected MELDING %q", v)
+	}
+	if v, _ := rec.Field(2); v != int32(3) {
+		t.Errorf("want ID 3, have %v", v)
+	}
+	if rec, _ := dbf.RecordAt(1); rec.data[1] != "" {
+		t.Errorf("want empty memo, have %q", rec.data[1])
+	}
+}
+
+func TestCopyToAllFields(t *testing.T) {
+	src, err := OpenFile(filepath.Join("testdata", "dbase_31.dbf"), new(Win1250Decoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	filename := filepath.Join(t.TempDir(), "COPY.DBF")
+	if _, err := src.CopyTo(filename, &CopyOptions{Deleted: IncludeDeleted}); err != nil {
+		t.Fatal(err)
+	}
+
+	dbf, err := OpenFile(filename, new(Win1250Decoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbf.Close()
+	if dbf.NumRecords() != src.NumRecords() || dbf.Header().RecLen != src.Header().RecLen {
+		t.Fatalf("want %d records of length %d, have %d of %d", src.NumRecords(), src.Header().RecLen, dbf.NumRecords(), dbf.Header().RecLen)
+	}
+	// including the _NullFlags field the records are identical
+	for recno := uint32(0); recno < src.NumRecords(); recno++ {
+		want, err := src.ReadRecordInto(recno, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		have, err := dbf.ReadRecordInto(recno, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(have.Data(), want.Data()) {
+			t.Fatalf("record %d differs", recno)
+		}
+	}
+	if next, _ := dbf.NextAutoIncrement(0); next != 78 {
+		t.Errorf("want next autoincrement value 78, have %d", next)
+	}
+}
+
+func TestCopyToConvert(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "UTF8.DBF")
+	if _, err := testDbf.CopyTo(filename, &CopyOptions{Fields: []string{"ID", "MELDING"}, Encoder: new(UTF8Encoder)}); err != nil {
+		t.Fatal(err)
+	}
+	dbf, err := OpenFile(filename, new(UTF8Decoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbf.Close()
+	if dbf.NumRecords() != 3 {
+		t.Fatalf("want 3 records, have %d", dbf.NumRecords())
+	}
+	rec, err := dbf.RecordAt(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := rec.Field(1); v != "Tësting wíth éncôdings!" {
+		t.Errorf("unexpected MELDING %q", v)
+	}
+
+	_, err = testDbf.CopyTo(filepath.Join(t.TempDir(), "OLD.DBF"), &CopyOptions{FileVersion: 0x03})
+	if !errors.Is(err, ErrInvalidField) {
+		t.Errorf("want ErrInvalidField for an I field in a dBase III table, have %v", err)
+	}
+	_, err = testDbf.CopyTo(filepath.Join(t.TempDir(), "OLD.DBF"), &CopyOptions{Fields: []string{"COMP_NAME", "MELDING"}, FileVersion: 0xF5})
+	if !errors.Is(err, ErrInvalidField) {
+		t.Errorf("want ErrInvalidField for an M field in a FoxPro 2 table, have %v", err)
+	}
+}
+
+func TestCopyStructure(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "EMPTY.DBF")
+	if err := testDbf.CopyStructure(filename); err != nil {
+		t.Fatal(err)
+	}
+	dbf, err := OpenFile(filename, new(Win1250Decoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbf.Close()
+	if dbf.NumRecords() != 0 {
+		t.Errorf("want no records, have %d", dbf.NumRecords())
+	}
+	have, want := dbf.Header(), testDbf.Header()
+	if have.FileVersion != want.FileVersion || have.TableFlags != want.TableFlags&^0x01 || have.RecLen != want.RecLen || have.FirstRec != want.FirstRec {
+		t.Errorf("want header %+v, have %+v", want, have)
+	}
+	for i, f := range testDbf.Fields() {
+		if dbf.fields[i] != f {
+			t.Errorf("want field %+v, have %+v", f, dbf.fields[i])
+		}
+	}
+	if dbf.fptheader.BlockSize != testDbf.fptheader.BlockSize {
+		t.Errorf("want block size %d, have %d", testDbf.fptheader.BlockSize, dbf.fptheader.BlockSize)
+	}
+}
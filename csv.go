@@ -0,0 +1,406 @@
+package dbf
+
+import (
+	"encoding/base64"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// CSVOptions contains the options for WriteCSV, the zero value is a valid configuration
+type CSVOptions struct {
+	Comma            rune        // Field delimiter, defaults to ','
+	UseCRLF          bool        // Use \r\n as the line terminator
+	DateFormat       string      // Time layout for D fields, defaults to "2006-01-02"
+	DateTimeFormat   string      // Time layout for T fields, defaults to "2006-01-02T15:04:05"
+	DecimalSeparator rune        // Decimal separator for numbers, defaults to '.'
+	Deleted          DeletedMode // Handling of deleted records, defaults to SkipDeleted
+	DeletedColumn    bool        // Add a column _DELETED containing true or false as the first column
+	SkipMemos        bool        // Do not export memo fields, this avoids reading the FPT file
+	KeepSpaces       bool        // Do not trim leading and trailing spaces from C and M fields
+}
+
+func (o *CSVOptions) dateFormat() string {
+	if o.DateFormat == "" {
+		return "2006-01-02"
+	}
+	return o.DateFormat
+}
+
+func (o *CSVOptions) dateTimeFormat() string {
+	if o.DateTimeFormat == "" {
+		return "2006-01-02T15:04:05"
+	}
+	return o.DateTimeFormat
+}
+
+// WriteCSV writes all records to w as CSV, starting with a header row containing the field names.
+// Records are read one at a time so the table is never loaded completely into memory.
+// Empty dates are written as empty values, binary memos are base64 encoded.
+// The record pointer is not moved.
+func (dbf *DBF) WriteCSV(w io.Writer, opts *CSVOptions) error {
+	if opts == nil {
+		opts = new(CSVOptions)
+	}
+	cw := csv.NewWriter(w)
+	if opts.Comma != 0 {
+		cw.Comma = opts.Comma
+	}
+	cw.UseCRLF = opts.UseCRLF
+
+	// determine the exported fields and write the header row
+	var fieldpos []int
+	var row []string
+	if opts.DeletedColumn {
+		row = append(row, "_DELETED")
+	}
+	for i, f := range dbf.fields {
+		if opts.SkipMemos && isMemoType(f.Type) {
+			continue
+		}
+		fieldpos = append(fieldpos, i)
+		row = append(row, f.FieldName())
+	}
+	if err := cw.Write(row); err != nil {
+		return err
+	}
+
+	offsets := dbf.offsets
+	var data []byte // reused for every record
+	for recno := uint32(0); recno < dbf.header.NumRec; recno++ {
+		var err error
+		data, err = dbf.readRecordInto(recno, data)
+		if err != nil {
+			return err
+		}
+		deleted := data[0] == 0x2A
+		if !opts.Deleted.Include(deleted) {
+			continue
+		}
+		row = row[:0]
+		if opts.DeletedColumn {
+			row = append(row, strconv.FormatBool(deleted))
+		}
+		for _, i := range fieldpos {
+			raw := data[offsets[i] : offsets[i]+int(dbf.fields[i].Len)]
+			val, err := dbf.fieldDataToValue(raw, i)
+			if err != nil {
+				return dbf.newFieldError(recno, i, dbf.recordOffset(recno)+int64(offsets[i]), raw, err)
+			}
+			row = append(row, dbf.formatCSVValue(&dbf.fields[i], val, opts))
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// formatCSVValue formats a field value as CSV text
+func (dbf *DBF) formatCSVValue(f *FieldHeader, val interface{}, opts *CSVOptions) string {
+	switch v := val.(type) {
+	case string:
+		if opts.KeepSpaces {
+			return v
+		}
+		return strings.TrimSpace(v)
+	case []byte:
+		return base64.StdEncoding.EncodeToString(v)
+	case bool:
+		return strconv.FormatBool(v)
+	case time.Time:
+		switch {
+		case v.IsZero():
+			return ""
+		case f.Type == 'D':
+			return v.Format(opts.dateFormat())
+		default:
+			return v.Format(opts.dateTimeFormat())
+		}
+	case int32, int64, float64:
+		return formatNumber(f, v, opts.DecimalSeparator)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// CSVImportOptions contains the options for ImportCSV, the zero value is a valid configuration
+type CSVImportOptions struct {
+	Comma            rune           // Field delimiter, defaults to ','
+	Fields           []FieldHeader  // Fields in CSV column order, when nil the fields are inferred from the data
+	DateFormat       string         // Time layout for D fields, defaults to "2006-01-02"
+	DateTimeFormat   string         // Time layout for T fields, defaults to "2006-01-02T15:04:05"
+	DecimalSeparator rune           // Decimal separator for numbers, defaults to '.'
+	Create           *CreateOptions // Options used to create the table
+}
+
+// ImportCSV creates table filename from the CSV data read from r and returns it opened for reading and writing.
+// The first CSV row must contain the column names.
+// When opts.Fields is nil the fields are inferred from the data, which requires reading all CSV data
+// into memory first:
+//   - columns containing only whole numbers become N fields without decimals
+//   - columns containing only numbers become N fields with the maximum number of decimals found
+//   - columns containing only dates or datetimes in DateFormat or DateTimeFormat become D or T fields
+//   - all other columns become C fields with the maximum length found, or M fields when longer than 254 bytes
+//
+// Field names are derived from the column names, converted to valid (unique) field names of at most 10 characters.
+// Empty CSV values are written as empty fields.
+// On error the partially written table is closed and left on disk.
+func ImportCSV(filename string, r io.Reader, dec Decoder, enc Encoder, opts *CSVImportOptions) (*DBF, error) {
+	if opts == nil {
+		opts = new(CSVImportOptions)
+	}
+	csvopts := &CSVOptions{DateFormat: opts.DateFormat, DateTimeFormat: opts.DateTimeFormat, DecimalSeparator: opts.DecimalSeparator}
+
+	cr := csv.NewReader(r)
+	if opts.Comma != 0 {
+		cr.Comma = opts.Comma
+	}
+	cr.ReuseRecord = opts.Fields != nil
+	columns, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("error reading CSV header: %s", err)
+	}
+	columns = append([]string(nil), columns...)
+
+	fields := opts.Fields
+	var rows [][]string
+	if fields == nil {
+		rows, err = cr.ReadAll()
+		if err != nil {
+			return nil, err
+		}
+		fields, err = inferCSVFields(columns, rows, enc, csvopts)
+		if err != nil {
+			return nil, err
+		}
+	} else if len(fields) != len(columns) {
+		return nil, fmt.Errorf("CSV has %d columns, have %d fields", len(columns), len(fields))
+	}
+
+	dbf, err := CreateFile(filename, fields, dec, enc, opts.Create)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]interface{}, len(fields))
+	for line := 0; ; line++ {
+		var row []string
+		if rows != nil || opts.Fields == nil {
+			if line >= len(rows) {
+				break
+			}
+			row = rows[line]
+		} else {
+			row, err = cr.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				dbf.Close()
+				return nil, err
+			}
+		}
+		for i := range fields {
+			values[i], err = parseCSVValue(row[i], &dbf.fields[i], csvopts)
+			if err != nil {
+				dbf.Close()
+				return nil, fmt.Errorf("CSV row %d, column %s: %s", line+1, columns[i], err)
+			}
+		}
+		if _, err := dbf.Append(values); err != nil {
+			dbf.Close()
+			return nil, err
+		}
+	}
+
+	return dbf, nil
+}
+
+// parseCSVValue converts CSV text to the Go value for field f, empty text returns nil
+func parseCSVValue(s string, f *FieldHeader, opts *CSVOptions) (interface{}, error) {
+	if f.Type != 'C' && f.Type != 'M' {
+		s = strings.TrimSpace(s)
+	}
+	if s == "" {
+		return nil, nil
+	}
+	if opts.DecimalSeparator != 0 && opts.DecimalSeparator != '.' {
+		switch f.Type {
+		case 'N', 'F', 'B', 'Y':
+			s = strings.Replace(s, string(opts.DecimalSeparator), ".", 1)
+		}
+	}
+	switch f.Type {
+	case 'C', 'M':
+		return s, nil
+	case 'N':
+		if f.Decimals == 0 {
+			if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+				return i, nil
+			}
+		}
+		return strconv.ParseFloat(s, 64)
+	case 'F', 'B', 'Y':
+		return strconv.ParseFloat(s, 64)
+	case 'I':
+		return strconv.ParseInt(s, 10, 32)
+	case 'D':
+		return time.Parse(opts.dateFormat(), s)
+	case 'T':
+		return time.Parse(opts.dateTimeFormat(), s)
+	case 'L':
+		switch strings.ToUpper(s) {
+		case "T", "Y", "TRUE", "1":
+			return true, nil
+		case "F", "N", "FALSE", "0":
+			return false, nil
+		}
+		return nil, fmt.Errorf("invalid logical value %q", s)
+	default:
+		return nil, fmt.Errorf("unsupported fieldtype: %s", f.FieldType())
+	}
+}
+
+// inferCSVFields determines the fields for the CSV columns from the data in rows
+func inferCSVFields(columns []string, rows [][]string, enc Encoder, opts *CSVOptions) ([]FieldHeader, error) {
+	names := csvFieldNames(columns)
+	fields := make([]FieldHeader, len(columns))
+	for col := range columns {
+		isInt, isNum, isDate, isDateTime := true, true, true, true
+		intDigits, decimals, maxLen, values := 1, 0, 1, 0
+
+		for line, row := range rows {
+			if len(row) != len(columns) {
+				return nil, fmt.Errorf("CSV row %d has %d columns, want %d", line+1, len(row), len(columns))
+			}
+			s := row[col]
+			if l := encodedLen(s, enc); l > maxLen {
+				maxLen = l
+			}
+			s = strings.TrimSpace(s)
+			if s == "" {
+				continue
+			}
+			values++
+
+			if isNum {
+				num := s
+				if opts.DecimalSeparator != 0 && opts.DecimalSeparator != '.' {
+					num = strings.Replace(num, string(opts.DecimalSeparator), ".", 1)
+				}
+				if validNumeric([]byte(num)) {
+					intPart, decPart := num, ""
+					if i := strings.IndexByte(num, '.'); i >= 0 {
+						intPart, decPart = num[:i], num[i+1:]
+						isInt = false
+					}
+					if len(intPart) == 0 || intPart == "-" || intPart == "+" {
+						intPart += "0"
+					}
+					if len(intPart) > intDigits {
+						intDigits = len(intPart)
+					}
+					if len(decPart) > decimals {
+						decimals = len(decPart)
+					}
+				} else {
+					isNum, isInt = false, false
+				}
+			}
+			if isDate {
+				if _, err := time.Parse(opts.dateFormat(), s); err != nil {
+					isDate = false
+				}
+			}
+			if isDateTime {
+				if _, err := time.Parse(opts.dateTimeFormat(), s); err != nil {
+					isDateTime = false
+				}
+			}
+		}
+
+		var err error
+		width := intDigits
+		if decimals > 0 {
+			width += decimals + 1
+		}
+		switch {
+		case values == 0:
+			fields[col], err = NewField(names[col], 'C', uint8(maxLen), 0)
+		case isInt && width <= 20:
+			fields[col], err = NewField(names[col], 'N', uint8(width), 0)
+		case isNum && width <= 20:
+			fields[col], err = NewField(names[col], 'N', uint8(width), uint8(decimals))
+		case isDate:
+			fields[col], err = NewField(names[col], 'D', 0, 0)
+		case isDateTime:
+			fields[col], err = NewField(names[col], 'T', 0, 0)
+		case maxLen <= 254:
+			fields[col], err = NewField(names[col], 'C', uint8(maxLen), 0)
+		default:
+			fields[col], err = NewField(names[col], 'M', 0, 0)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return fields, nil
+}
+
+// encodedLen returns the length of s in the charset of enc
+func encodedLen(s string, enc Encoder) int {
+	if enc != nil {
+		if b, err := enc.Encode([]byte(s)); err == nil {
+			return len(b)
+		}
+	}
+	return len(s)
+}
+
+// csvFieldNames converts CSV column names to unique valid field names
+func csvFieldNames(columns []string) []string {
+	names := make([]string, len(columns))
+	used := make(map[string]bool, len(columns))
+	for i, col := range columns {
+		var b strings.Builder
+		for _, c := range strings.ToUpper(strings.TrimSpace(col)) {
+			switch {
+			case c >= 'A' && c <= 'Z', c == '_', c >= '0' && c <= '9' && b.Len() > 0:
+				b.WriteRune(c)
+			case c >= '0' && c <= '9':
+				b.WriteString("_")
+				b.WriteRune(c)
+			case c < utf8.RuneSelf:
+				b.WriteByte('_')
+			}
+		}
+		name := b.String()
+		if name == "" {
+			name = fmt.Sprintf("FIELD%d", i+1)
+		}
+		if len(name) > 10 {
+			name = name[:10]
+		}
+		// make the name unique by replacing the last characters with a number
+		for n := 2; used[name]; n++ {
+			suffix := strconv.Itoa(n)
+			base := name
+			if len(base)+len(suffix) > 10 {
+				base = base[:10-len(suffix)]
+			}
+			name = strings.TrimRight(base, "0123456789") + suffix
+			if len(name) > 10 {
+				name = name[:10]
+			}
+		}
+		used[name] = true
+		names[i] = name
+	}
+	return names
+}
@@ -0,0 +1,136 @@
+package dbf
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteCSV(t *testing.T) {
+	buf := new(bytes.Buffer)
+	if err := testDbf.WriteCSV(buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	want := "ID,NIVEAU,DATUM,TIJD,SOORT,ID_NR,USERNR,COMP_NAME,COMP_OS,MELDING,NUMBER,FLOAT,BOOL\n" +
+		"1,0,2015-01-03,15:00,3,100,1,TEST,Windows 8.1 Pro,\"Message line 1\r\nMessage line 2\",1.66,1,false\n"
+	if !strings.HasPrefix(buf.String(), want) {
+		t.Errorf("want CSV starting with\n%s\nhave\n%s", want, buf.String())
+	}
+	// 3 records that are not deleted, one with a memo spanning 2 lines
+	if n := strings.Count(buf.String(), "\n"); n != 5 {
+		t.Errorf("want 5 lines, have %d", n)
+	}
+
+	buf.Reset()
+	opts := &CSVOptions{
+		Comma:            ';',
+		DateFormat:       "02-01-2006",
+		DecimalSeparator: ',',
+		Deleted:          OnlyDeleted,
+		DeletedColumn:    true,
+		SkipMemos:        true,
+	}
+	if err := testDbf.WriteCSV(buf, opts); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("want header and 1 deleted record, have:\n%s", buf.String())
+	}
+	if lines[0] != "_DELETED;ID;NIVEAU;DATUM;TIJD;SOORT;ID_NR;USERNR;COMP_NAME;COMP_OS;NUMBER;FLOAT;BOOL" {
+		t.Errorf("unexpected header %q", lines[0])
+	}
+	if !strings.HasPrefix(lines[1], "true;2;1;03-02-2015;12:00;") || !strings.Contains(lines[1], ";123456789,99;") {
+		t.Errorf("unexpected deleted record %q", lines[1])
+	}
+}
+
+func TestImportCSV(t *testing.T) {
+	data := "id,Name,amount,Day,Stamp,long description,name\n" +
+		"1,Jan,12.5,2021-03-04,2021-03-04T13:14:15,short,x\n" +
+		"2,Piet,-3,,2021-03-05T00:00:00,\"" + strings.Repeat("a", 300) + "\",y\n" +
+		"3,,0.125,2021-03-06,,,\n"
+	filename := filepath.Join(t.TempDir(), "IMPORT.DBF")
+	dbf, err := ImportCSV(filename, strings.NewReader(data), new(UTF8Decoder), new(UTF8Encoder), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbf.Close()
+
+	var schema []string
+	for _, f := range dbf.Fields() {
+		schema = append(schema, fmt.Sprintf("%s %s %d %d", f.FieldName(), f.FieldType(), f.Len, f.Decimals))
+	}
+	want := "ID N 1 0,NAME C 4 0,AMOUNT N 6 3,DAY D 8 0,STAMP T 8 0,LONG_DESCR M 4 0,NAME2 C 1 0"
+	if strings.Join(schema, ",") != want {
+		t.Errorf("want schema %s, have %s", want, strings.Join(schema, ","))
+	}
+	if dbf.NumRecords() != 3 {
+		t.Fatalf("want 3 records, have %d", dbf.NumRecords())
+	}
+
+	rec, err := dbf.RecordAt(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := rec.Field(2); v != float64(-3) {
+		t.Errorf("want AMOUNT -3, have %v", v)
+	}
+	if v, _ := rec.Field(3); !v.(time.Time).IsZero() {
+		t.Errorf("want empty DAY, have %v", v)
+	}
+	if v, _ := rec.Field(5); v != strings.Repeat("a", 300) {
+		t.Errorf("unexpected memo %q", v)
+	}
+
+	// exporting the imported table should return the original data
+	buf := new(bytes.Buffer)
+	if err := dbf.WriteCSV(buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(buf.String(), "\n")
+	if lines[1] != "1,Jan,12.500,2021-03-04,2021-03-04T13:14:15,short,x" {
+		t.Errorf("unexpected exported record %q", lines[1])
+	}
+}
+
+func TestImportCSVFields(t *testing.T) {
+	id, _ := NewField("ID", 'I', 0, 0)
+	ok, _ := NewField("OK", 'L', 0, 0)
+	price, _ := NewField("PRICE", 'N', 8, 2)
+	opts := &CSVImportOptions{Comma: ';', DecimalSeparator: ',', Fields: []FieldHeader{id, ok, price}}
+
+	filename := filepath.Join(t.TempDir(), "FIELDS.DBF")
+	dbf, err := ImportCSV(filename, strings.NewReader("a;b;c\n1;Y;2,50\n2;F;\n"), new(UTF8Decoder), nil, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbf.Close()
+
+	rec, err := dbf.RecordAt(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []interface{}{int32(1), true, 2.5}
+	for i, val := range rec.FieldSlice() {
+		if val != want[i] {
+			t.Errorf("field %d: want %v, have %v", i, want[i], val)
+		}
+	}
+
+	_, err = ImportCSV(filepath.Join(t.TempDir(), "BAD.DBF"), strings.NewReader("a;b;c\nx;Y;1\n"), new(UTF8Decoder), nil, opts)
+	if err == nil || !strings.Contains(err.Error(), "CSV row 1, column a") {
+		t.Errorf("want error for invalid integer, have %v", err)
+	}
+}
+
+func TestCSVFieldNames(t *testing.T) {
+	have := csvFieldNames([]string{"Name", "name", "1st value", "", "very long column", "very long column", "été"})
+	want := []string{"NAME", "NAME2", "_1ST_VALUE", "FIELD4", "VERY_LONG_", "VERY_LONG2", "T"}
+	if strings.Join(have, ",") != strings.Join(want, ",") {
+		t.Errorf("want %v, have %v", want, have)
+	}
+}
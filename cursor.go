@@ -0,0 +1,315 @@
+package dbf
+
+import "fmt"
+
+// Cursor reads the records of a table with its own record pointer, filter, index order and projection of the fields.
+// A table can be read by multiple cursors at the same time without them moving each others record pointer,
+// GoTo, Skip and Record of the DBF use a default cursor.
+// Records read through a cursor only contain the selected fields, other fields are not decoded
+// and memos of other fields are not read from the FPT file.
+// A Cursor is not safe for concurrent use, use a cursor per goroutine.
+type Cursor struct {
+	dbf *DBF
+
+	fieldpos []int          // positions of the selected fields in the table
+	names    map[string]int // positions of the selected fields in the projection by field name
+
+	filter Filter // only records matching the filter are visited by Skip and Scan, see SetFilter
+
+	recpointer uint32 // record pointer of the cursor, moved using Skip() and GoTo()
+	buf        []byte // record buffer, reused for every record read
+
+	order       *cdxTag  // index order, see SetOrder
+	leaf        *cdxNode // leaf node with the key of the current record in index order, nil if not located yet
+	leafpos     int      // position of the key in leaf
+	top, bottom []byte   // scope of the index order, see SetScope
+	found       bool     // result of the last Seek
+}
+
+// NewCursor returns a cursor on all fields of the table with its own record pointer, starting at the first record.
+// Use Select for a cursor on some of the fields.
+func (dbf *DBF) NewCursor() *Cursor {
+	fieldpos := make([]int, len(dbf.fields))
+	for i := range dbf.fields {
+		fieldpos[i] = i
+	}
+	return newCursor(dbf, fieldpos)
+}
+
+// Select returns a cursor that only reads fields fieldnames, in the given order.
+// Without field names all fields are selected.
+// The field names are resolved once, unknown names return ErrInvalidField.
+// The cursor starts at the first record, the record pointer of the table is not moved.
+func (dbf *DBF) Select(fieldnames ...string) (*Cursor, error) {
+	if len(fieldnames) == 0 {
+		return dbf.NewCursor(), nil
+	}
+	fieldpos := make([]int, 0, len(fieldnames))
+	for _, name := range fieldnames {
+		pos := dbf.FieldPos(name)
+		if pos < 0 {
+			return nil, fmt.Errorf("%w: unknown field %s", ErrInvalidField, name)
+		}
+		fieldpos = append(fieldpos, pos)
+	}
+	return newCursor(dbf, fieldpos), nil
+}
+
+// newCursor returns a cursor on the fields at fieldpos
+func newCursor(dbf *DBF, fieldpos []int) *Cursor {
+	c := &Cursor{dbf: dbf, fieldpos: fieldpos}
+	c.names = make(map[string]int, len(c.fieldpos))
+	for i, pos := range c.fieldpos {
+		c.names[dbf.fields[pos].FieldName()] = i
+	}
+	return c
+}
+
+// Fields returns the FieldHeaders of the selected fields
+func (c *Cursor) Fields() []FieldHeader {
+	fields := make([]FieldHeader, len(c.fieldpos))
+	for i, pos := range c.fieldpos {
+		fields[i] = c.dbf.fields[pos]
+	}
+	return fields
+}
+
+// FieldNames returns the names of the selected fields
+func (c *Cursor) FieldNames() []string {
+	names := make([]string, len(c.fieldpos))
+	for i, pos := range c.fieldpos {
+		names[i] = c.dbf.fields[pos].FieldName()
+	}
+	return names
+}
+
+// FieldPos returns the zero-based position of fieldname in the selected fields, or -1 if it is not selected
+func (c *Cursor) FieldPos(fieldname string) int {
+	if pos, ok := c.names[fieldname]; ok {
+		return pos
+	}
+	return -1
+}
+
+// TableFieldPos returns the position in the table of the selected field at pos, or -1 if pos is invalid.
+// Use this to read a selected field from a RawRecord.
+func (c *Cursor) TableFieldPos(pos int) int {
+	if pos < 0 || pos >= len(c.fieldpos) {
+		return -1
+	}
+	return c.fieldpos[pos]
+}
+
+// RecNo returns the record number the cursor is pointing to
+func (c *Cursor) RecNo() uint32 {
+	return c.recpointer
+}
+
+// GoTo sets the record pointer of the cursor to record recno (zero based), the index order is kept.
+// Returns ErrEOF if at EOF and positions the pointer at lastRec+1.
+func (c *Cursor) GoTo(recno uint32) error {
+	c.leaf = nil
+	if recno >= c.dbf.header.NumRec {
+		c.recpointer = c.dbf.header.NumRec
+		return ErrEOF
+	}
+	c.recpointer = recno
+	return nil
+}
+
+// SetFilter sets the filter of the cursor, Skip and Scan only visit records matching f.
+// GoTo and Record ignore the filter. Use nil to remove the filter.
+// The field names used in the filter are resolved once, unknown names return ErrInvalidField.
+func (c *Cursor) SetFilter(f Filter) error {
+	if f == nil {
+		c.filter = nil
+		return nil
+	}
+	bound, err := bindFilter(f, c.dbf)
+	if err != nil {
+		return err
+	}
+	c.filter = bound
+	return nil
+}
+
+// Skip adds offset to the record pointer of the cursor.
+// Returns ErrEOF if at EOF and positions the pointer at lastRec+1.
+// Returns ErrBOF is the pointer would be become negative and positions the pointer at 0.
+// Does not skip deleted records, unless the filter of the cursor does.
+// When the cursor has a filter, only records matching the filter are counted.
+// With an index order the records are skipped in index order within the scope, see SetOrder.
+func (c *Cursor) Skip(offset int64) error {
+	if c.order != nil {
+		return c.skipOrdered(offset)
+	}
+	if c.filter != nil {
+		return c.skipFiltered(offset)
+	}
+	newval := int64(c.recpointer) + offset
+	if newval >= int64(c.dbf.header.NumRec) {
+		c.recpointer = c.dbf.header.NumRec
+		return ErrEOF
+	}
+	if newval < 0 {
+		c.recpointer = 0
+		return ErrBOF
+	}
+	c.recpointer = uint32(newval)
+	return nil
+}
+
+// skipFiltered moves the record pointer offset records matching the filter
+func (c *Cursor) skipFiltered(offset int64) error {
+	step := int64(1)
+	if offset < 0 {
+		step, offset = -1, -offset
+	}
+	for ; offset > 0; offset-- {
+		for {
+			newval := int64(c.recpointer) + step
+			if newval >= int64(c.dbf.header.NumRec) {
+				c.recpointer = c.dbf.header.NumRec
+				return ErrEOF
+			}
+			if newval < 0 {
+				c.recpointer = 0
+				return ErrBOF
+			}
+			c.recpointer = uint32(newval)
+			ok, err := c.match()
+			if err != nil {
+				return err
+			}
+			if ok {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// match returns if the record the cursor is pointing to matches the filter
+func (c *Cursor) match() (bool, error) {
+	if c.filter == nil {
+		return true, nil
+	}
+	rec, err := c.Raw()
+	if err != nil {
+		return false, err
+	}
+	return c.filter.Match(rec)
+}
+
+// Scan calls fn for every record matching the filter of the cursor, from the record pointer up to EOF.
+// With an index order the records are visited in index order up to the end of the scope.
+// The records only contain the selected fields, records that do not match the filter are not decoded.
+// The record pointer points to the record passed to fn, so RecNo can be used in fn.
+// Scanning stops at the first error, which is returned, or when fn returns ErrStopScan, in which case nil is returned.
+func (c *Cursor) Scan(fn func(rec *Record) error) error {
+	if c.order != nil {
+		if err := c.locate(); err != nil {
+			return err
+		}
+		if !c.EOF() && !c.inScope() {
+			c.setEOF()
+		}
+	}
+	for !c.EOF() {
+		raw, err := c.Raw()
+		if err != nil {
+			return err
+		}
+		ok := true
+		if c.filter != nil {
+			if ok, err = c.filter.Match(raw); err != nil {
+				return err
+			}
+		}
+		if ok {
+			rec, err := c.dbf.rawToRecord(raw, c.fieldpos)
+			if err != nil {
+				return err
+			}
+			if err := fn(rec); err != nil {
+				if err == ErrStopScan {
+					return nil
+				}
+				return err
+			}
+		}
+		if err := c.advance(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// advance moves the record pointer to the next record in record or index order, used by Scan.
+// Errors reading the index position the cursor at EOF.
+func (c *Cursor) advance() error {
+	if c.order == nil {
+		c.recpointer++
+		return nil
+	}
+	if err := c.locate(); err != nil {
+		return err
+	}
+	return c.next()
+}
+
+// EOF returns if the record pointer of the cursor is at EoF
+func (c *Cursor) EOF() bool {
+	return c.recpointer >= c.dbf.header.NumRec
+}
+
+// BOF returns if the record pointer of the cursor is at BoF (first record).
+// With an index order this is the first record in index order within the scope.
+func (c *Cursor) BOF() bool {
+	if c.order == nil || c.EOF() {
+		return c.recpointer == 0
+	}
+	if c.locate() != nil {
+		return false
+	}
+	leaf, leafpos, recno := c.leaf, c.leafpos, c.recpointer
+	ok, err := c.move(-1)
+	bof := err == nil && (!ok || !c.inScope())
+	c.leaf, c.leafpos, c.recpointer = leaf, leafpos, recno
+	return bof
+}
+
+// Raw reads the raw data of the record the cursor is pointing to.
+// The RawRecord is valid until the next record is read through the cursor.
+func (c *Cursor) Raw() (RawRecord, error) {
+	rec, err := c.dbf.ReadRecordInto(c.recpointer, c.buf)
+	if err != nil {
+		return rec, err
+	}
+	if !c.dbf.IsMapped() {
+		c.buf = rec.Data()
+	}
+	return rec, nil
+}
+
+// Record reads the record the cursor is pointing to, the record only contains the selected fields
+func (c *Cursor) Record() (*Record, error) {
+	raw, err := c.Raw()
+	if err != nil {
+		return nil, err
+	}
+	return c.dbf.rawToRecord(raw, c.fieldpos)
+}
+
+// RecordToMap returns the record the cursor is pointing to as a map of the selected field names and values
+func (c *Cursor) RecordToMap() (map[string]interface{}, error) {
+	rec, err := c.Record()
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]interface{}, len(c.fieldpos))
+	for i, pos := range c.fieldpos {
+		out[c.dbf.fields[pos].FieldName()] = rec.data[i]
+	}
+	return out, nil
+}
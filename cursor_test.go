@@ -0,0 +1,199 @@
+package dbf
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func TestSelect(t *testing.T) {
+	testDbf.GoTo(2)
+	defer testDbf.GoTo(0)
+	c, err := testDbf.Select("COMP_NAME", "ID", "DATUM")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.RecNo() != 0 || testDbf.cursor.recpointer != 2 {
+		t.Errorf("want cursor at 0 and table at 2, have %d and %d", c.RecNo(), testDbf.cursor.recpointer)
+	}
+	if names := c.FieldNames(); len(names) != 3 || names[0] != "COMP_NAME" || c.Fields()[1].FieldName() != "ID" {
+		t.Errorf("unexpected selected fields %v", names)
+	}
+	if c.FieldPos("ID") != 1 || c.FieldPos("NIVEAU") != -1 || c.TableFieldPos(0) != 7 || c.TableFieldPos(3) != -1 {
+		t.Error("unexpected field positions")
+	}
+
+	if err := c.GoTo(1); err != nil {
+		t.Fatal(err)
+	}
+	rec, err := c.Record()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vals := rec.FieldSlice(); len(vals) != 3 || vals[1] != int32(2) || !rec.Deleted {
+		t.Errorf("unexpected deleted record 1: %v", vals)
+	}
+	m, err := c.RecordToMap()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m) != 3 || m["ID"] != int32(2) {
+		t.Errorf("unexpected record map %v", m)
+	}
+
+	// navigation
+	if err := c.Skip(5); err != ErrEOF || !c.EOF() {
+		t.Errorf("want ErrEOF and EOF, have %v", err)
+	}
+	if err := c.Skip(-10); err != ErrBOF || !c.BOF() {
+		t.Errorf("want ErrBOF and BOF, have %v", err)
+	}
+	if testDbf.cursor.recpointer != 2 {
+		t.Errorf("want table record pointer not moved, have %d", testDbf.cursor.recpointer)
+	}
+
+	// all fields
+	c, err = testDbf.Select()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec, err = c.Record()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := testDbf.RecordAt(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.FieldSlice()) != 13 || rec.FieldSlice()[9] != want.FieldSlice()[9] {
+		t.Errorf("want all fields, have %v", rec.FieldSlice())
+	}
+
+	if _, err := testDbf.Select("ID", "MISSING"); !errors.Is(err, ErrInvalidField) {
+		t.Errorf("want ErrInvalidField for unknown field, have %v", err)
+	}
+}
+
+func TestNewCursor(t *testing.T) {
+	testDbf.GoTo(3)
+	defer testDbf.GoTo(0)
+
+	a, b := testDbf.NewCursor(), testDbf.NewCursor()
+	if len(a.Fields()) != 13 || a.RecNo() != 0 {
+		t.Fatalf("want a cursor on 13 fields at record 0, have %d fields at %d", len(a.Fields()), a.RecNo())
+	}
+	// nested loops over the same table do not interfere
+	var pairs int
+	for ; !a.EOF(); a.Skip(1) {
+		for b.GoTo(0); !b.EOF(); b.Skip(1) {
+			pairs++
+		}
+	}
+	if pairs != 16 {
+		t.Errorf("want 16 pairs of records, have %d", pairs)
+	}
+	if testDbf.cursor.recpointer != 3 {
+		t.Errorf("want table record pointer not moved, have %d", testDbf.cursor.recpointer)
+	}
+
+	// RecordToMap does not move the record pointer
+	m, err := testDbf.RecordToMap(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m["ID"] != int32(3) || testDbf.cursor.recpointer != 3 {
+		t.Errorf("want record 2 and record pointer 3, have %v and %d", m["ID"], testDbf.cursor.recpointer)
+	}
+}
+
+func TestCursorsConcurrent(t *testing.T) {
+	want := make([]interface{}, testDbf.NumRecords())
+	for i := range want {
+		rec, err := testDbf.RecordAt(uint32(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want[i] = rec.FieldSlice()[9]
+	}
+
+	// every goroutine reads the memos with its own cursor
+	errs := make(chan error)
+	for n := 0; n < 4; n++ {
+		go func() {
+			c, err := testDbf.Select("MELDING")
+			if err != nil {
+				errs <- err
+				return
+			}
+			for i := 0; i < 50; i++ {
+				for c.GoTo(0); !c.EOF(); c.Skip(1) {
+					rec, err := c.Record()
+					if err != nil {
+						errs <- err
+						return
+					}
+					if rec.FieldSlice()[0] != want[c.RecNo()] {
+						errs <- fmt.Errorf("record %d: want %v, have %v", c.RecNo(), want[c.RecNo()], rec.FieldSlice()[0])
+						return
+					}
+				}
+			}
+			errs <- nil
+		}()
+	}
+	for n := 0; n < 4; n++ {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestSelectSkipsMemos(t *testing.T) {
+	// point the MELDING memo of the first record to a block beyond the end of the FPT file
+	dbf := openModifiedTestDBF(t, func(data []byte, dbf *DBF) {
+		pos := dbf.recordOffset(0) + int64(dbf.fields[dbf.FieldPos("MELDING")].Pos)
+		binary.LittleEndian.PutUint32(data[pos:], 100000)
+	})
+	if _, err := dbf.RecordAt(0); err == nil {
+		t.Fatal("want error reading the invalid memo")
+	}
+	c, err := dbf.Select("ID", "COMP_NAME")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec, err := c.Record()
+	if err != nil {
+		t.Fatalf("want memo not read, have %s", err)
+	}
+	if rec.FieldSlice()[0] != int32(1) {
+		t.Errorf("want ID 1, have %v", rec.FieldSlice()[0])
+	}
+}
+
+// Reading 3 fields of every record using Select, compare with BenchmarkReadRecords
+func BenchmarkSelect(b *testing.B) {
+	for n := 0; n < b.N; n++ {
+		err := func() error {
+			dbf, err := OpenFile(filepath.Join("testdata", "dbase_30.dbf"), new(Win1250Decoder))
+			if err != nil {
+				return err
+			}
+			defer dbf.Close()
+			c, err := dbf.Select("ACCESSNO", "ACQVALUE", "CATDATE")
+			if err != nil {
+				return err
+			}
+			for ; !c.EOF(); c.Skip(1) {
+				if _, err := c.Record(); err != nil {
+					return err
+				}
+			}
+			return nil
+		}()
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
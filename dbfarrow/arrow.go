@@ -0,0 +1,453 @@
+// Package dbfarrow converts FoxPro DBF tables to Apache Arrow record batches.
+//
+// The Arrow schema is derived from the DBF field headers:
+//
+//	C          utf8 (string)
+//	N          int64 without decimals, float64 with decimals, or decimal128 with Options.DecimalNumeric
+//	F, B       float64
+//	I          int32
+//	Y          decimal128(19, 4)
+//	D          date32
+//	T          timestamp[ms]
+//	L          bool
+//	M          large_utf8, or large_binary when the field has the binary flag
+//	G, P, W    large_binary
+//	V, Q       binary
+//
+// Empty dates and empty numeric fields are null, as are null values of nullable fields in Visual FoxPro tables.
+// Only these fields are nullable in the schema. System fields, like the _NullFlags field, are not exported.
+// The main package does not import Arrow, so programs that do not use this package are built without it.
+package dbfarrow
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	dbf "github.com/SebastiaanKlippert/go-foxpro-dbf"
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/decimal128"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+)
+
+// DefaultBatchSize is the number of records per batch when Options.BatchSize is 0
+const DefaultBatchSize = 8192
+
+// Options contains the options for Schema and NewReader, the zero value is a valid configuration
+type Options struct {
+	BatchSize      int              // Number of records per batch, defaults to DefaultBatchSize
+	Allocator      memory.Allocator // Allocator for the Arrow arrays, defaults to memory.DefaultAllocator
+	Deleted        dbf.DeletedMode  // Handling of deleted records, defaults to dbf.SkipDeleted
+	DecimalNumeric bool             // Map N fields to decimal128 instead of int64 or float64
+	TrimSpaces     bool             // Trim trailing spaces from C fields
+}
+
+// Metadata keys with the DBF field definition which are added to every Arrow field
+const (
+	MetadataFieldType     = "dbf.type"
+	MetadataFieldLength   = "dbf.length"
+	MetadataFieldDecimals = "dbf.decimals"
+)
+
+// Schema returns the Arrow schema for table.
+// The fields have the same names as the DBF fields, the DBF field definition is added as field metadata.
+func Schema(table *dbf.DBF, opts *Options) *arrow.Schema {
+	if opts == nil {
+		opts = new(Options)
+	}
+	var fields []arrow.Field
+	for _, f := range table.Fields() {
+		if f.Flags&0x01 != 0 {
+			continue
+		}
+		fields = append(fields, arrowField(f, opts))
+	}
+	return arrow.NewSchema(fields, nil)
+}
+
+// arrowField returns the Arrow field for DBF field f
+func arrowField(f dbf.FieldHeader, opts *Options) arrow.Field {
+	meta := arrow.NewMetadata(
+		[]string{MetadataFieldType, MetadataFieldLength, MetadataFieldDecimals},
+		[]string{f.FieldType(), strconv.Itoa(int(f.Len)), strconv.Itoa(int(f.Decimals))},
+	)
+	return arrow.Field{Name: f.FieldName(), Type: dataType(f, opts), Nullable: nullable(f), Metadata: meta}
+}
+
+// nullable returns if field f can contain null values, which are empty N, F, D and T fields and null values
+// of nullable fields
+func nullable(f dbf.FieldHeader) bool {
+	switch f.Type {
+	case 'N', 'F', 'D', 'T':
+		return true
+	}
+	return f.IsNullable()
+}
+
+// dataType returns the Arrow data type for DBF field f
+func dataType(f dbf.FieldHeader, opts *Options) arrow.DataType {
+	switch f.Type {
+	case 'C':
+		return arrow.BinaryTypes.String
+	case 'N':
+		switch {
+		case opts.DecimalNumeric:
+			return &arrow.Decimal128Type{Precision: numericPrecision(f), Scale: int32(f.Decimals)}
+		case f.Decimals == 0:
+			return arrow.PrimitiveTypes.Int64
+		default:
+			return arrow.PrimitiveTypes.Float64
+		}
+	case 'F', 'B':
+		return arrow.PrimitiveTypes.Float64
+	case 'I':
+		return arrow.PrimitiveTypes.Int32
+	case 'Y':
+		return &arrow.Decimal128Type{Precision: 19, Scale: 4}
+	case 'D':
+		return arrow.FixedWidthTypes.Date32
+	case 'T':
+		return &arrow.TimestampType{Unit: arrow.Millisecond}
+	case 'L':
+		return arrow.FixedWidthTypes.Boolean
+	case 'M':
+		if f.Flags&0x04 != 0 {
+			return arrow.BinaryTypes.LargeBinary
+		}
+		return arrow.BinaryTypes.LargeString
+	case 'G', 'P', 'W':
+		return arrow.BinaryTypes.LargeBinary
+	default:
+		return arrow.BinaryTypes.Binary
+	}
+}
+
+// numericPrecision returns the decimal precision of N field f, the field length without the decimal point
+func numericPrecision(f dbf.FieldHeader) int32 {
+	p := int32(f.Len)
+	if f.Decimals > 0 {
+		p--
+	}
+	if p < int32(f.Decimals) {
+		p = int32(f.Decimals)
+	}
+	if p > 38 {
+		p = 38
+	}
+	return p
+}
+
+// Reader reads a DBF table as Arrow record batches, it implements array.RecordReader.
+// Records are read in batches of raw record data which are then decoded column by column.
+type Reader struct {
+	refCount int64
+
+	table  *dbf.DBF
+	opts   Options
+	schema *arrow.Schema
+
+	columns []column
+	builder *array.RecordBuilder
+	buf     []byte
+	rows    []dbf.RawRecord
+
+	recno uint32
+	cur   arrow.RecordBatch
+	err   error
+}
+
+// column decodes field fieldpos of a batch of raw records into an Arrow builder
+type column struct {
+	fieldpos int
+	field    dbf.FieldHeader
+	offset   int // offset of the field in the record data
+	nullable bool
+	decode   func(rec dbf.RawRecord, raw []byte, b array.Builder) error
+}
+
+// NewReader returns a Reader for all records of table.
+// The table should not be used by other code while the Reader is used.
+// The caller should call Release when done.
+func NewReader(table *dbf.DBF, opts *Options) (*Reader, error) {
+	r := &Reader{refCount: 1, table: table}
+	if opts != nil {
+		r.opts = *opts
+	}
+	if r.opts.BatchSize <= 0 {
+		r.opts.BatchSize = DefaultBatchSize
+	}
+	if r.opts.Allocator == nil {
+		r.opts.Allocator = memory.DefaultAllocator
+	}
+	r.schema = Schema(table, &r.opts)
+
+	offset := 1 // deleted flag
+	for i, f := range table.Fields() {
+		offset += int(f.Len)
+		if f.Flags&0x01 != 0 {
+			continue
+		}
+		decode, err := r.decoder(f)
+		if err != nil {
+			return nil, err
+		}
+		r.columns = append(r.columns, column{fieldpos: i, field: f, offset: offset - int(f.Len), nullable: f.IsNullable(), decode: decode})
+	}
+	r.builder = array.NewRecordBuilder(r.opts.Allocator, r.schema)
+	r.rows = make([]dbf.RawRecord, 0, r.opts.BatchSize)
+	return r, nil
+}
+
+// Schema returns the Arrow schema of the record batches
+func (r *Reader) Schema() *arrow.Schema {
+	return r.schema
+}
+
+// Next reads the next batch of records and returns false when there are no more records or an error occurred
+func (r *Reader) Next() bool {
+	if r.cur != nil {
+		r.cur.Release()
+		r.cur = nil
+	}
+	if r.err != nil {
+		return false
+	}
+	if err := r.readBatch(); err != nil {
+		r.err = err
+		return false
+	}
+	if len(r.rows) == 0 {
+		return false
+	}
+	if err := r.decodeBatch(); err != nil {
+		r.err = err
+		// discard the partially decoded batch, the columns have different lengths
+		for _, b := range r.builder.Fields() {
+			b.NewArray().Release()
+		}
+		return false
+	}
+	r.cur = r.builder.NewRecordBatch()
+	return true
+}
+
+// RecordBatch returns the current batch, it is valid until the next call to Next
+func (r *Reader) RecordBatch() arrow.RecordBatch {
+	return r.cur
+}
+
+// Record returns the current batch, it is valid until the next call to Next.
+//
+// Deprecated: Use RecordBatch instead.
+func (r *Reader) Record() arrow.Record {
+	return r.cur
+}
+
+// Err returns the error that stopped Next
+func (r *Reader) Err() error {
+	return r.err
+}
+
+// Retain increases the reference count by 1
+func (r *Reader) Retain() {
+	atomic.AddInt64(&r.refCount, 1)
+}
+
+// Release decreases the reference count by 1, when it reaches 0 all memory is released
+func (r *Reader) Release() {
+	if atomic.AddInt64(&r.refCount, -1) == 0 {
+		if r.cur != nil {
+			r.cur.Release()
+			r.cur = nil
+		}
+		r.builder.Release()
+	}
+}
+
+// readBatch reads the raw data of up to BatchSize records which are not skipped by the Deleted option
+func (r *Reader) readBatch() error {
+	reclen := int(r.table.Header().RecLen)
+	if r.buf == nil {
+		r.buf = make([]byte, reclen*r.opts.BatchSize)
+	}
+	r.rows = r.rows[:0]
+	for len(r.rows) < r.opts.BatchSize && r.recno < r.table.NumRecords() {
+		n := len(r.rows)
+		rec, err := r.table.ReadRecordInto(r.recno, r.buf[n*reclen:(n+1)*reclen])
+		if err != nil {
+			return err
+		}
+		r.recno++
+		if !r.opts.Deleted.Include(rec.IsDeleted()) {
+			continue
+		}
+		r.rows = append(r.rows, rec)
+	}
+	return nil
+}
+
+// decodeBatch decodes the current batch column by column
+func (r *Reader) decodeBatch() error {
+	r.builder.Reserve(len(r.rows))
+	for c, col := range r.columns {
+		b := r.builder.Field(c)
+		for _, rec := range r.rows {
+			if col.nullable && rec.IsNull(col.fieldpos) {
+				b.AppendNull()
+				continue
+			}
+			raw, err := rec.Bytes(col.fieldpos)
+			if err != nil {
+				return err
+			}
+			if err := col.decode(rec, raw, b); err != nil {
+				return r.fieldError(rec, col, raw, err)
+			}
+		}
+	}
+	return nil
+}
+
+// fieldError returns err as *dbf.FieldError, errors from RawRecord.Value already are
+func (r *Reader) fieldError(rec dbf.RawRecord, col column, raw []byte, err error) error {
+	var fieldErr *dbf.FieldError
+	if errors.As(err, &fieldErr) {
+		return err
+	}
+	h := r.table.Header()
+	offset := int64(h.FirstRec) + int64(rec.RecNo())*int64(h.RecLen) + int64(col.offset)
+	return &dbf.FieldError{RecNo: rec.RecNo(), FieldPos: col.fieldpos, Name: col.field.FieldName(), Offset: offset, Raw: raw, Err: err}
+}
+
+// decoder returns the function which decodes the raw data of field f into its Arrow builder
+func (r *Reader) decoder(f dbf.FieldHeader) (func(rec dbf.RawRecord, raw []byte, b array.Builder) error, error) {
+	fieldpos := r.table.FieldPos(f.FieldName())
+	switch f.Type {
+	case 'C':
+		trim := r.opts.TrimSpaces
+		return func(rec dbf.RawRecord, raw []byte, b array.Builder) error {
+			val, err := rec.Value(fieldpos)
+			if err != nil {
+				return err
+			}
+			s := val.(string)
+			if trim {
+				s = strings.TrimRight(s, " ")
+			}
+			b.(*array.StringBuilder).Append(s)
+			return nil
+		}, nil
+	case 'N':
+		switch {
+		case f.Decimals == 0 && !r.opts.DecimalNumeric:
+			return func(rec dbf.RawRecord, raw []byte, b array.Builder) error {
+				s := strings.TrimSpace(string(raw))
+				if s == "" {
+					b.AppendNull()
+					return nil
+				}
+				v, err := strconv.ParseInt(s, 10, 64)
+				if err != nil {
+					return dbf.ErrInvalidNumeric
+				}
+				b.(*array.Int64Builder).Append(v)
+				return nil
+			}, nil
+		case r.opts.DecimalNumeric:
+			prec, scale := numericPrecision(f), int32(f.Decimals)
+			return func(rec dbf.RawRecord, raw []byte, b array.Builder) error {
+				s := strings.TrimSpace(string(raw))
+				if s == "" {
+					b.AppendNull()
+					return nil
+				}
+				v, err := decimal128.FromString(s, prec, scale)
+				if err != nil {
+					return dbf.ErrInvalidNumeric
+				}
+				b.(*array.Decimal128Builder).Append(v)
+				return nil
+			}, nil
+		}
+		fallthrough
+	case 'F':
+		return func(rec dbf.RawRecord, raw []byte, b array.Builder) error {
+			s := strings.TrimSpace(string(raw))
+			if s == "" {
+				b.AppendNull()
+				return nil
+			}
+			v, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return dbf.ErrInvalidNumeric
+			}
+			b.(*array.Float64Builder).Append(v)
+			return nil
+		}, nil
+	case 'B':
+		return func(rec dbf.RawRecord, raw []byte, b array.Builder) error {
+			b.(*array.Float64Builder).Append(math.Float64frombits(binary.LittleEndian.Uint64(raw)))
+			return nil
+		}, nil
+	case 'I':
+		return func(rec dbf.RawRecord, raw []byte, b array.Builder) error {
+			b.(*array.Int32Builder).Append(int32(binary.LittleEndian.Uint32(raw)))
+			return nil
+		}, nil
+	case 'Y':
+		return func(rec dbf.RawRecord, raw []byte, b array.Builder) error {
+			b.(*array.Decimal128Builder).Append(decimal128.FromI64(int64(binary.LittleEndian.Uint64(raw))))
+			return nil
+		}, nil
+	case 'L':
+		return func(rec dbf.RawRecord, raw []byte, b array.Builder) error {
+			b.(*array.BooleanBuilder).Append(raw[0] == 'T')
+			return nil
+		}, nil
+	case 'D', 'T':
+		return func(rec dbf.RawRecord, raw []byte, b array.Builder) error {
+			val, err := rec.Value(fieldpos)
+			if err != nil {
+				return err
+			}
+			t := val.(time.Time)
+			switch {
+			case t.IsZero():
+				b.AppendNull()
+			case f.Type == 'D':
+				b.(*array.Date32Builder).Append(arrow.Date32FromTime(t))
+			default:
+				b.(*array.TimestampBuilder).Append(arrow.Timestamp(t.UnixMilli()))
+			}
+			return nil
+		}, nil
+	case 'M', 'G', 'P', 'W':
+		// the column type follows the binary flag of the field, not the type of the memo block
+		return func(rec dbf.RawRecord, raw []byte, b array.Builder) error {
+			memo, err := rec.Memo(fieldpos)
+			if err != nil {
+				return err
+			}
+			switch builder := b.(type) {
+			case *array.LargeStringBuilder:
+				builder.Append(string(memo))
+			case *array.BinaryBuilder:
+				builder.Append(memo)
+			}
+			return nil
+		}, nil
+	case 'V', 'Q', '0':
+		return func(rec dbf.RawRecord, raw []byte, b array.Builder) error {
+			b.(*array.BinaryBuilder).Append(raw)
+			return nil
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported field type %s for field %s", f.FieldType(), f.FieldName())
+	}
+}
@@ -0,0 +1,278 @@
+package dbfarrow
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	dbf "github.com/SebastiaanKlippert/go-foxpro-dbf"
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+)
+
+func openTestDBF(t *testing.T, name string) *dbf.DBF {
+	t.Helper()
+	table, err := dbf.OpenFile(filepath.Join("..", "testdata", name), new(dbf.Win1250Decoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { table.Close() })
+	return table
+}
+
+func TestSchema(t *testing.T) {
+	table := openTestDBF(t, "TEST.DBF")
+
+	schema := Schema(table, nil)
+	want := map[string]arrow.DataType{
+		"ID":        arrow.PrimitiveTypes.Int32,
+		"NIVEAU":    arrow.PrimitiveTypes.Int64,
+		"DATUM":     arrow.FixedWidthTypes.Date32,
+		"TIJD":      arrow.BinaryTypes.String,
+		"MELDING":   arrow.BinaryTypes.LargeString,
+		"NUMBER":    arrow.PrimitiveTypes.Float64,
+		"FLOAT":     arrow.PrimitiveTypes.Float64,
+		"BOOL":      arrow.FixedWidthTypes.Boolean,
+		"COMP_NAME": arrow.BinaryTypes.String,
+	}
+	if schema.NumFields() != 13 {
+		t.Fatalf("want 13 fields, have %d", schema.NumFields())
+	}
+	for name, typ := range want {
+		fields, ok := schema.FieldsByName(name)
+		if !ok || !arrow.TypeEqual(fields[0].Type, typ) {
+			t.Errorf("field %s: want type %s, have %v", name, typ, fields)
+		}
+	}
+	f, _ := schema.FieldsByName("NUMBER")
+	if typ, _ := f[0].Metadata.GetValue(MetadataFieldType); typ != "N" {
+		t.Errorf("want DBF field type N in metadata, have %q", typ)
+	}
+
+	if f, _ = schema.FieldsByName("COMP_NAME"); f[0].Nullable {
+		t.Error("want C field COMP_NAME not nullable")
+	}
+	if f, _ = schema.FieldsByName("DATUM"); !f[0].Nullable {
+		t.Error("want D field DATUM nullable")
+	}
+
+	schema = Schema(table, &Options{DecimalNumeric: true})
+	f, _ = schema.FieldsByName("NUMBER")
+	if typ, ok := f[0].Type.(*arrow.Decimal128Type); !ok || typ.Precision != 11 || typ.Scale != 2 {
+		t.Errorf("want decimal128(11, 2), have %s", f[0].Type)
+	}
+	f, _ = schema.FieldsByName("NIVEAU")
+	if typ, ok := f[0].Type.(*arrow.Decimal128Type); !ok || typ.Precision != 1 || typ.Scale != 0 {
+		t.Errorf("want decimal128(1, 0), have %s", f[0].Type)
+	}
+
+	// the _NullFlags system field is not exported
+	table = openTestDBF(t, "dbase_31.dbf")
+	if schema = Schema(table, nil); schema.HasField("_NullFlags") || schema.NumFields() != len(table.Fields())-1 {
+		t.Errorf("want all fields but _NullFlags, have %s", schema)
+	}
+	if f, _ = schema.FieldsByName("SUPPLIERID"); !f[0].Nullable {
+		t.Error("want nullable I field SUPPLIERID nullable")
+	}
+}
+
+func TestReader(t *testing.T) {
+	mem := memory.NewCheckedAllocator(memory.NewGoAllocator())
+	defer mem.AssertSize(t, 0)
+
+	table := openTestDBF(t, "TEST.DBF")
+	r, err := NewReader(table, &Options{BatchSize: 2, Allocator: mem, Deleted: dbf.IncludeDeleted, DecimalNumeric: true, TrimSpaces: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Release()
+
+	var batches, rows int64
+	for r.Next() {
+		rec := r.RecordBatch()
+		if batches == 0 {
+			ids := rec.Column(0).(*array.Int32)
+			names := rec.Column(7).(*array.String)
+			dates := rec.Column(2).(*array.Date32)
+			memos := rec.Column(9).(*array.LargeString)
+			numbers := rec.Column(10).(*array.Decimal128)
+			if ids.Value(0) != 1 || names.Value(0) != "TEST" || names.Value(1) != "TEST2" {
+				t.Errorf("unexpected values in first batch: %v %v", ids, names)
+			}
+			if have := dates.Value(0).ToTime(); !have.Equal(time.Date(2015, 1, 3, 0, 0, 0, 0, time.UTC)) {
+				t.Errorf("unexpected date %s", have)
+			}
+			if memos.Value(0) != "Message line 1\r\nMessage line 2" {
+				t.Errorf("unexpected memo %q", memos.Value(0))
+			}
+			if have := numbers.Value(1).ToString(2); have != "123456789.99" {
+				t.Errorf("want decimal 123456789.99, have %s", have)
+			}
+		}
+		batches++
+		rows += rec.NumRows()
+	}
+	if err := r.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if batches != 2 || rows != 4 {
+		t.Errorf("want 4 rows in 2 batches, have %d rows in %d batches", rows, batches)
+	}
+}
+
+func TestReaderNulls(t *testing.T) {
+	table := openTestDBF(t, "TEST.DBF")
+	r, err := NewReader(table, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Release()
+
+	if !r.Next() {
+		t.Fatal(r.Err())
+	}
+	rec := r.RecordBatch()
+	// deleted records are skipped by default, the last record has an empty date
+	if rec.NumRows() != 3 {
+		t.Fatalf("want 3 rows, have %d", rec.NumRows())
+	}
+	if !rec.Column(2).IsNull(2) {
+		t.Error("want empty date as null")
+	}
+	if r.Next() {
+		t.Error("want a single batch")
+	}
+}
+
+func TestReaderError(t *testing.T) {
+	data, err := ioutil.ReadFile(filepath.Join("..", "testdata", "TEST.DBF"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fpt, err := ioutil.ReadFile(filepath.Join("..", "testdata", "TEST.FPT"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	table, err := dbf.OpenStream(bytes.NewReader(data), bytes.NewReader(fpt), new(dbf.Win1250Decoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// make the N field NIVEAU of the first record invalid
+	h := table.Header()
+	data[int(h.FirstRec)+int(table.Fields()[1].Pos)] = 'x'
+
+	r, err := NewReader(table, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Release()
+	if r.Next() {
+		t.Fatal("want no batch for invalid data")
+	}
+	var fieldErr *dbf.FieldError
+	if !errors.As(r.Err(), &fieldErr) || fieldErr.Name != "NIVEAU" || fieldErr.RecNo != 0 || !errors.Is(r.Err(), dbf.ErrInvalidNumeric) {
+		t.Errorf("want FieldError for NIVEAU, have %v", r.Err())
+	}
+}
+
+func TestReaderNullFlags(t *testing.T) {
+	data, err := ioutil.ReadFile(filepath.Join("..", "testdata", "dbase_31.dbf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	table, err := dbf.OpenStream(bytes.NewReader(data), nil, new(dbf.Win1250Decoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// set the null flag of SUPPLIERID (bit 0) of the first record
+	nullpos := table.FieldPos("_NullFlags")
+	data[int(table.Header().FirstRec)+int(table.Fields()[nullpos].Pos)] = 0x01
+
+	r, err := NewReader(table, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Release()
+	if !r.Next() {
+		t.Fatal(r.Err())
+	}
+	col := r.RecordBatch().Column(2)
+	if !col.IsNull(0) || col.IsNull(1) || col.NullN() != 1 {
+		t.Errorf("want only the first SUPPLIERID null, have %s", col)
+	}
+}
+
+func TestReaderBinaryFields(t *testing.T) {
+	var fields []dbf.FieldHeader
+	for _, def := range []struct {
+		name  string
+		typ   byte
+		len   uint8
+		flags byte
+	}{{"TEXT", 'M', 0, 0}, {"BIN", 'M', 0, 0x04}, {"PIC", 'M', 0, 0}, {"BLOB", 'M', 0, 0}, {"VB", 'V', 4, 0}, {"TS", 'T', 0, 0}} {
+		f, err := dbf.NewField(def.name, def.typ, def.len, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Flags = def.flags
+		fields = append(fields, f)
+	}
+	filename := filepath.Join(t.TempDir(), "BINARY.DBF")
+	table, err := dbf.CreateFile(filename, fields, new(dbf.Win1250Decoder), new(dbf.Win1250Encoder), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a binary memo block in a text field, beyond the range of UnixNano
+	ts := time.Date(2500, 1, 2, 3, 4, 5, 0, time.UTC)
+	if _, err := table.Append([]interface{}{[]byte("caf\xe9"), []byte{0xff, 0x00}, []byte{1}, []byte{2}, []byte("ab\xff"), ts}); err != nil {
+		t.Fatal(err)
+	}
+	if err := table.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// the writer has no G, W and Q fields, change the type in the field descriptors
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, typ := range map[int]byte{2: 'G', 3: 'W', 4: 'Q'} {
+		data[32+32*i+11] = typ
+	}
+	if err := ioutil.WriteFile(filename, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	table, err = dbf.OpenFile(filename, new(dbf.Win1250Decoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer table.Close()
+	r, err := NewReader(table, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Release()
+	if !r.Next() {
+		t.Fatal(r.Err())
+	}
+	rec := r.RecordBatch()
+	if have := rec.Column(0).(*array.LargeString).Value(0); have != "café" {
+		t.Errorf("want TEXT café, have %q", have)
+	}
+	for i, want := range [][]byte{{0xff, 0x00}, {1}, {2}} {
+		col, ok := rec.Column(i + 1).(*array.LargeBinary)
+		if !ok || !bytes.Equal(col.Value(0), want) {
+			t.Errorf("column %s: want large_binary %v, have %s", rec.ColumnName(i+1), want, rec.Column(i+1))
+		}
+	}
+	if col, ok := rec.Column(4).(*array.Binary); !ok || !bytes.HasPrefix(col.Value(0), []byte("ab\xff")) {
+		t.Errorf("want binary VB, have %s", rec.Column(4))
+	}
+	if have := rec.Column(5).(*array.Timestamp).Value(0).ToTime(arrow.Millisecond); !have.Equal(ts) {
+		t.Errorf("want TS %s, have %s", ts, have)
+	}
+}
@@ -0,0 +1,127 @@
+// Package dbfparquet writes FoxPro DBF tables to Parquet files.
+//
+// The table is read in row groups using the dbfarrow package and the columns are mapped to Parquet logical types:
+// N and Y fields become DECIMAL, D fields DATE, T fields TIMESTAMP(MILLIS), C and M fields STRING,
+// I fields INT32, F and B fields DOUBLE, L fields BOOLEAN and binary fields BYTE_ARRAY.
+// Columns are OPTIONAL when the field is nullable in a Visual FoxPro table, or when empty values are written
+// as null, which is the case for N, F, D and T fields. All other columns are REQUIRED.
+//
+// The file version, code page, table flags and modified date of the DBF header are written to the
+// Parquet key-value metadata.
+// The main package does not import Arrow and Parquet, so programs that do not use this package are built without them.
+package dbfparquet
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	dbf "github.com/SebastiaanKlippert/go-foxpro-dbf"
+	"github.com/SebastiaanKlippert/go-foxpro-dbf/dbfarrow"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/apache/arrow-go/v18/parquet"
+	"github.com/apache/arrow-go/v18/parquet/compress"
+	"github.com/apache/arrow-go/v18/parquet/pqarrow"
+)
+
+// DefaultRowGroupSize is the number of records per row group when Options.RowGroupSize is 0
+const DefaultRowGroupSize = 64 * 1024
+
+// Key-value metadata keys with DBF header information
+const (
+	MetadataFileVersion = "dbf.file_version"
+	MetadataCodePage    = "dbf.code_page"
+	MetadataTableFlags  = "dbf.table_flags"
+	MetadataModified    = "dbf.modified"
+)
+
+// Options contains the options for Write and WriteFile, the zero value is a valid configuration
+type Options struct {
+	RowGroupSize int                  // Number of records per row group, defaults to DefaultRowGroupSize
+	Compression  compress.Compression // Compression codec, for example compress.Codecs.Snappy, defaults to uncompressed
+	Deleted      dbf.DeletedMode      // Handling of deleted records, defaults to dbf.SkipDeleted
+	TrimSpaces   bool                 // Trim trailing spaces from C fields
+	Allocator    memory.Allocator     // Allocator for the Arrow arrays, defaults to memory.DefaultAllocator
+}
+
+// WriteFile writes all records of table to a new Parquet file filename.
+// On error the partially written file is removed.
+func WriteFile(filename string, table *dbf.DBF, opts *Options) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := Write(f, table, opts); err != nil {
+		f.Close()
+		os.Remove(filename)
+		return err
+	}
+	return f.Close()
+}
+
+// Write writes all records of table to w in Parquet format, w is not closed.
+// Only one row group is kept in memory at a time.
+func Write(w io.Writer, table *dbf.DBF, opts *Options) error {
+	if opts == nil {
+		opts = new(Options)
+	}
+	rowGroupSize := opts.RowGroupSize
+	if rowGroupSize <= 0 {
+		rowGroupSize = DefaultRowGroupSize
+	}
+	mem := opts.Allocator
+	if mem == nil {
+		mem = memory.DefaultAllocator
+	}
+
+	r, err := dbfarrow.NewReader(table, &dbfarrow.Options{
+		BatchSize:      rowGroupSize,
+		Allocator:      mem,
+		Deleted:        opts.Deleted,
+		DecimalNumeric: true,
+		TrimSpaces:     opts.TrimSpaces,
+	})
+	if err != nil {
+		return err
+	}
+	defer r.Release()
+
+	props := parquet.NewWriterProperties(
+		parquet.WithAllocator(mem),
+		parquet.WithCompression(opts.Compression),
+		parquet.WithMaxRowGroupLength(int64(rowGroupSize)),
+	)
+	// the Parquet writer closes w if it is an io.Closer, which is left to the caller
+	w = struct{ io.Writer }{w}
+	fw, err := pqarrow.NewFileWriter(r.Schema(), w, props, pqarrow.NewArrowWriterProperties(pqarrow.WithStoreSchema()))
+	if err != nil {
+		return err
+	}
+
+	h := table.Header()
+	metadata := [][2]string{
+		{MetadataFileVersion, fmt.Sprintf("0x%02X", h.FileVersion)},
+		{MetadataCodePage, fmt.Sprintf("0x%02X", h.CodePage)},
+		{MetadataTableFlags, fmt.Sprintf("0x%02X", h.TableFlags)},
+		{MetadataModified, h.Modified().Format("2006-01-02")},
+	}
+	for _, kv := range metadata {
+		if err := fw.AppendKeyValueMetadata(kv[0], kv[1]); err != nil {
+			fw.Close()
+			return err
+		}
+	}
+
+	// every batch is written as a row group
+	for r.Next() {
+		if err := fw.Write(r.RecordBatch()); err != nil {
+			fw.Close()
+			return err
+		}
+	}
+	if err := r.Err(); err != nil {
+		fw.Close()
+		return err
+	}
+	return fw.Close()
+}
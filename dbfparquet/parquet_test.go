@@ -0,0 +1,140 @@
+package dbfparquet
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"testing"
+
+	dbf "github.com/SebastiaanKlippert/go-foxpro-dbf"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/apache/arrow-go/v18/parquet"
+	"github.com/apache/arrow-go/v18/parquet/compress"
+	"github.com/apache/arrow-go/v18/parquet/file"
+	"github.com/apache/arrow-go/v18/parquet/pqarrow"
+	"github.com/apache/arrow-go/v18/parquet/schema"
+)
+
+func openTestDBF(t *testing.T, name string) *dbf.DBF {
+	t.Helper()
+	table, err := dbf.OpenFile(filepath.Join("..", "testdata", name), new(dbf.Win1250Decoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { table.Close() })
+	return table
+}
+
+func TestWriteFile(t *testing.T) {
+	table := openTestDBF(t, "TEST.DBF")
+	filename := filepath.Join(t.TempDir(), "test.parquet")
+	if err := WriteFile(filename, table, &Options{RowGroupSize: 2, Deleted: dbf.IncludeDeleted, TrimSpaces: true, Compression: compress.Codecs.Snappy}); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := file.OpenParquetFile(filename, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	meta := r.MetaData()
+	if meta.NumRows != 4 || meta.NumRowGroups() != 2 {
+		t.Errorf("want 4 rows in 2 row groups, have %d rows in %d row groups", meta.NumRows, meta.NumRowGroups())
+	}
+	kv := meta.KeyValueMetadata()
+	for key, want := range map[string]string{
+		MetadataFileVersion: "0x30",
+		MetadataCodePage:    "0x03",
+		MetadataTableFlags:  "0x02",
+		MetadataModified:    table.Header().Modified().Format("2006-01-02"),
+	} {
+		if have := kv.FindValue(key); have == nil || *have != want {
+			t.Errorf("metadata %s: want %s, have %v", key, want, have)
+		}
+	}
+
+	sc := meta.Schema
+	for name, want := range map[string]schema.LogicalType{
+		"NIVEAU":    schema.NewDecimalLogicalType(1, 0),
+		"NUMBER":    schema.NewDecimalLogicalType(11, 2),
+		"DATUM":     schema.DateLogicalType{},
+		"COMP_NAME": schema.StringLogicalType{},
+		"MELDING":   schema.StringLogicalType{},
+	} {
+		col := sc.Column(sc.ColumnIndexByName(name))
+		if !col.LogicalType().Equals(want) {
+			t.Errorf("column %s: want logical type %s, have %s", name, want, col.LogicalType())
+		}
+	}
+	// C fields are required, empty dates are null
+	if sc.Column(sc.ColumnIndexByName("COMP_NAME")).MaxDefinitionLevel() != 0 {
+		t.Error("want COMP_NAME required")
+	}
+	if sc.Column(sc.ColumnIndexByName("DATUM")).MaxDefinitionLevel() != 1 {
+		t.Error("want DATUM optional")
+	}
+}
+
+func TestWriteRoundTrip(t *testing.T) {
+	table := openTestDBF(t, "dbase_30.dbf")
+	buf := new(bytes.Buffer)
+	if err := Write(buf, table, &Options{TrimSpaces: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	tbl, err := pqarrow.ReadTable(context.Background(), bytes.NewReader(buf.Bytes()), parquet.NewReaderProperties(nil), pqarrow.ArrowReadProperties{}, memory.DefaultAllocator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tbl.Release()
+	if tbl.NumRows() != int64(table.NumRecords()) {
+		t.Errorf("want %d rows, have %d", table.NumRecords(), tbl.NumRows())
+	}
+
+	// compare the first record with the values read from the DBF
+	column := func(name string) interface{} {
+		idx := tbl.Schema().FieldIndices(name)[0]
+		return tbl.Column(idx).Data().Chunk(0)
+	}
+	if have := column("ACCESSNO").(*array.String).Value(0); have != "1999.1" {
+		t.Errorf("want ACCESSNO 1999.1, have %q", have)
+	}
+	if have := column("CAPTION").(*array.String).Value(0); have != "Ear & Ernie Wedding 1942" {
+		t.Errorf("unexpected CAPTION %q", have)
+	}
+	if have := column("CLASSES").(*array.LargeString).Value(0); have != "Domestic Life\r\nWeddings\r\n" {
+		t.Errorf("unexpected CLASSES memo %q", have)
+	}
+	if have := column("ACQVALUE").(*array.Decimal128).Value(0).ToString(2); have != "0.00" {
+		t.Errorf("want ACQVALUE 0.00, have %s", have)
+	}
+	if have := column("CATDATE").(*array.Date32).Value(0).FormattedString(); have != "1999-03-05" {
+		t.Errorf("want CATDATE 1999-03-05, have %s", have)
+	}
+}
+
+func TestWriteTimestampCurrency(t *testing.T) {
+	defer dbf.SetValidFileVersionFunc(dbf.ValidFileVersionFunc)
+	dbf.SetValidFileVersionFunc(func(byte) error { return nil })
+	table := openTestDBF(t, "dkeza.dbf")
+
+	buf := new(bytes.Buffer)
+	if err := Write(buf, table, nil); err != nil {
+		t.Fatal(err)
+	}
+	r, err := file.NewParquetReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	sc := r.MetaData().Schema
+	if lt := sc.Column(0).LogicalType(); !lt.Equals(schema.NewTimestampLogicalType(false, schema.TimeUnitMillis)) {
+		t.Errorf("want DTIME TIMESTAMP(MILLIS), have %s", lt)
+	}
+	if lt := sc.Column(2).LogicalType(); !lt.Equals(schema.NewDecimalLogicalType(19, 4)) {
+		t.Errorf("want CURR DECIMAL(19, 4), have %s", lt)
+	}
+}
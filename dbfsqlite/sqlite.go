@@ -0,0 +1,278 @@
+// Package dbfsqlite imports FoxPro DBF tables into SQLite databases.
+//
+// A SQLite table is created with a column for every DBF field, system fields like _NullFlags are skipped.
+// The column types are mapped from the field headers:
+// C fields become TEXT, N fields INTEGER or REAL when the field has decimals, I fields INTEGER,
+// F, B and Y fields REAL, L fields INTEGER (0 or 1), D fields TEXT (YYYY-MM-DD), T fields TEXT (YYYY-MM-DD HH:MM:SS.SSS),
+// M fields TEXT or BLOB for binary memos and all other fields BLOB.
+// The date formats are understood by the SQLite date and time functions.
+// Empty N, F, D and T fields and null values of nullable fields are inserted as NULL.
+//
+// ImportFile uses the pure Go SQLite driver modernc.org/sqlite, which does not require cgo.
+// Import works with any *sql.DB connected to a SQLite database.
+// The main package does not import a SQLite driver, so programs that do not use this package are built without it.
+package dbfsqlite
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	dbf "github.com/SebastiaanKlippert/go-foxpro-dbf"
+	_ "modernc.org/sqlite" // registers the sqlite driver
+)
+
+// DefaultBatchSize is the number of records inserted per transaction when Options.BatchSize is 0
+const DefaultBatchSize = 10000
+
+// Index describes an index that is created after all records are inserted
+type Index struct {
+	Name   string   // Index name, defaults to the table name and the field names joined by underscores
+	Fields []string // Indexed field names
+	Unique bool     // Create a unique index
+}
+
+// Options contains the options for Import and ImportFile, the zero value is a valid configuration
+type Options struct {
+	BatchSize  int             // Number of records inserted per transaction, defaults to DefaultBatchSize
+	Deleted    dbf.DeletedMode // Handling of deleted records, defaults to dbf.SkipDeleted
+	KeepSpaces bool            // Do not trim trailing spaces from C and M fields
+	Replace    bool            // Drop the table and its indexes first if it exists, otherwise an existing table is an error
+	// Indexes are created after all records are inserted, which is faster than maintaining them during the import.
+	// CDX files are not read by this package, pass the tags of the CDX file here to recreate them in SQLite.
+	Indexes []Index
+}
+
+// ImportFile imports all records of table into SQLite database file dbfile, which is created if it does not exist.
+// Returns the number of imported records.
+func ImportFile(dbfile string, table *dbf.DBF, name string, opts *Options) (int, error) {
+	db, err := sql.Open("sqlite", dbfile)
+	if err != nil {
+		return 0, err
+	}
+	n, err := Import(db, table, name, opts)
+	if cerr := db.Close(); err == nil {
+		err = cerr
+	}
+	return n, err
+}
+
+// Import creates SQLite table name in db and inserts all records of table.
+// The records are inserted in transactions of opts.BatchSize records, when an error occurs the records
+// of the current transaction are rolled back but records committed earlier stay in the table.
+// Returns the number of imported records.
+// The record pointer is not moved.
+func Import(db *sql.DB, table *dbf.DBF, name string, opts *Options) (int, error) {
+	if opts == nil {
+		opts = new(Options)
+	}
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+
+	var fieldpos []int
+	for i, f := range table.Fields() {
+		if f.Flags&0x01 == 0 {
+			fieldpos = append(fieldpos, i)
+		}
+	}
+	if len(fieldpos) == 0 {
+		return 0, fmt.Errorf("table has no fields to import")
+	}
+
+	if opts.Replace {
+		if _, err := db.Exec("DROP TABLE IF EXISTS " + quote(name)); err != nil {
+			return 0, err
+		}
+	}
+	if _, err := db.Exec(CreateTableSQL(table, name)); err != nil {
+		return 0, err
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(fieldpos)), ",")
+	insert := fmt.Sprintf("INSERT INTO %s VALUES (%s)", quote(name), placeholders)
+
+	var tx *sql.Tx
+	var stmt *sql.Stmt
+	rollback := func() {
+		if tx != nil {
+			stmt.Close()
+			tx.Rollback()
+		}
+	}
+
+	fields := table.Fields()
+	args := make([]interface{}, len(fieldpos))
+	var buf []byte
+	n, inTx := 0, 0
+	for recno := uint32(0); recno < table.NumRecords(); recno++ {
+		rec, err := table.ReadRecordInto(recno, buf)
+		if err != nil {
+			rollback()
+			return n - inTx, err
+		}
+		buf = rec.Data()
+		if !opts.Deleted.Include(rec.IsDeleted()) {
+			continue
+		}
+		for a, i := range fieldpos {
+			if args[a], err = value(rec, &fields[i], i, opts); err != nil {
+				rollback()
+				return n - inTx, err
+			}
+		}
+
+		if tx == nil {
+			if tx, err = db.Begin(); err != nil {
+				return n, err
+			}
+			if stmt, err = tx.Prepare(insert); err != nil {
+				tx.Rollback()
+				return n, err
+			}
+		}
+		if _, err := stmt.Exec(args...); err != nil {
+			rollback()
+			return n - inTx, err
+		}
+		n++
+		inTx++
+		if inTx == batchSize {
+			stmt.Close()
+			if err := tx.Commit(); err != nil {
+				return n - inTx, err
+			}
+			tx, inTx = nil, 0
+		}
+	}
+	if tx != nil {
+		stmt.Close()
+		if err := tx.Commit(); err != nil {
+			return n - inTx, err
+		}
+	}
+
+	for _, idx := range opts.Indexes {
+		if _, err := db.Exec(createIndexSQL(name, idx)); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// CreateTableSQL returns the CREATE TABLE statement used by Import for table name
+func CreateTableSQL(table *dbf.DBF, name string) string {
+	var b strings.Builder
+	b.WriteString("CREATE TABLE ")
+	b.WriteString(quote(name))
+	b.WriteString(" (")
+	first := true
+	for _, f := range table.Fields() {
+		if f.Flags&0x01 != 0 {
+			continue
+		}
+		if !first {
+			b.WriteString(", ")
+		}
+		first = false
+		b.WriteString(quote(f.FieldName()))
+		b.WriteByte(' ')
+		b.WriteString(columnType(f))
+	}
+	b.WriteByte(')')
+	return b.String()
+}
+
+// columnType returns the SQLite column type for field f
+func columnType(f dbf.FieldHeader) string {
+	switch f.Type {
+	case 'C', 'D', 'T':
+		return "TEXT"
+	case 'N':
+		if f.Decimals == 0 {
+			return "INTEGER"
+		}
+		return "REAL"
+	case 'I', 'L':
+		return "INTEGER"
+	case 'F', 'B', 'Y':
+		return "REAL"
+	case 'M':
+		if f.Flags&0x04 != 0 {
+			return "BLOB"
+		}
+		return "TEXT"
+	default:
+		return "BLOB"
+	}
+}
+
+// createIndexSQL returns the CREATE INDEX statement for idx on table name
+func createIndexSQL(name string, idx Index) string {
+	indexName := idx.Name
+	if indexName == "" {
+		indexName = name + "_" + strings.Join(idx.Fields, "_")
+	}
+	columns := make([]string, len(idx.Fields))
+	for i, f := range idx.Fields {
+		columns[i] = quote(f)
+	}
+	unique := ""
+	if idx.Unique {
+		unique = "UNIQUE "
+	}
+	return fmt.Sprintf("CREATE %sINDEX %s ON %s (%s)", unique, quote(indexName), quote(name), strings.Join(columns, ", "))
+}
+
+// value returns the value of field fieldpos of rec as a value for the SQLite driver
+func value(rec dbf.RawRecord, f *dbf.FieldHeader, fieldpos int, opts *Options) (interface{}, error) {
+	if rec.IsNull(fieldpos) {
+		return nil, nil
+	}
+	if f.Type == 'N' || f.Type == 'F' {
+		raw, err := rec.Bytes(fieldpos)
+		if err != nil {
+			return nil, err
+		}
+		if len(bytes.TrimSpace(raw)) == 0 {
+			return nil, nil
+		}
+	}
+	val, err := rec.Value(fieldpos)
+	if err != nil {
+		return nil, err
+	}
+	switch v := val.(type) {
+	case string:
+		if !opts.KeepSpaces {
+			v = strings.TrimRight(v, " ")
+		}
+		return v, nil
+	case bool:
+		if v {
+			return int64(1), nil
+		}
+		return int64(0), nil
+	case int32:
+		return int64(v), nil
+	case time.Time:
+		switch {
+		case v.IsZero():
+			return nil, nil
+		case f.Type == 'D':
+			return v.Format("2006-01-02"), nil
+		default:
+			return v.Format("2006-01-02 15:04:05.000"), nil
+		}
+	default:
+		return v, nil
+	}
+}
+
+// quote returns name as a quoted SQLite identifier
+func quote(name string) string {
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
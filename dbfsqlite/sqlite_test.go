@@ -0,0 +1,157 @@
+package dbfsqlite
+
+import (
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	dbf "github.com/SebastiaanKlippert/go-foxpro-dbf"
+)
+
+func openTestDBF(t *testing.T, name string) *dbf.DBF {
+	t.Helper()
+	table, err := dbf.OpenFile(filepath.Join("..", "testdata", name), new(dbf.Win1250Decoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { table.Close() })
+	return table
+}
+
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestCreateTableSQL(t *testing.T) {
+	table := openTestDBF(t, "TEST.DBF")
+	want := `CREATE TABLE "test" ("ID" INTEGER, "NIVEAU" INTEGER, "DATUM" TEXT, "TIJD" TEXT, "SOORT" INTEGER, ` +
+		`"ID_NR" INTEGER, "USERNR" INTEGER, "COMP_NAME" TEXT, "COMP_OS" TEXT, "MELDING" TEXT, "NUMBER" REAL, ` +
+		`"FLOAT" REAL, "BOOL" INTEGER)`
+	if have := CreateTableSQL(table, "test"); have != want {
+		t.Errorf("want %s\nhave %s", want, have)
+	}
+}
+
+func TestImport(t *testing.T) {
+	table := openTestDBF(t, "TEST.DBF")
+	db := openTestDB(t)
+
+	opts := &Options{BatchSize: 2, Deleted: dbf.IncludeDeleted, Indexes: []Index{{Fields: []string{"COMP_NAME", "ID"}}}}
+	n, err := Import(db, table, "test", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 4 {
+		t.Errorf("want 4 imported records, have %d", n)
+	}
+
+	var (
+		id       int64
+		datum    sql.NullString
+		compName string
+		melding  string
+		number   float64
+		boolean  int64
+	)
+	row := db.QueryRow(`SELECT ID, DATUM, COMP_NAME, MELDING, NUMBER, BOOL FROM test WHERE COMP_NAME = 'TEST2'`)
+	if err := row.Scan(&id, &datum, &compName, &melding, &number, &boolean); err != nil {
+		t.Fatal(err)
+	}
+	if id != 2 || datum.String != "2015-02-03" || number != 123456789.99 {
+		t.Errorf("unexpected record: %d %v %s %f", id, datum, compName, number)
+	}
+
+	// empty dates are NULL
+	var nulls int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM test WHERE DATUM IS NULL`).Scan(&nulls); err != nil {
+		t.Fatal(err)
+	}
+	if nulls != 1 {
+		t.Errorf("want 1 NULL date, have %d", nulls)
+	}
+
+	var memo string
+	if err := db.QueryRow(`SELECT MELDING FROM test WHERE ID = 1`).Scan(&memo); err != nil {
+		t.Fatal(err)
+	}
+	if memo != "Message line 1\r\nMessage line 2" {
+		t.Errorf("unexpected memo %q", memo)
+	}
+
+	var index string
+	if err := db.QueryRow(`SELECT sql FROM sqlite_master WHERE type = 'index' AND name = 'test_COMP_NAME_ID'`).Scan(&index); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(index, `("COMP_NAME", "ID")`) {
+		t.Errorf("unexpected index %s", index)
+	}
+
+	// the table exists now
+	if _, err := Import(db, table, "test", nil); err == nil {
+		t.Error("want error importing into an existing table")
+	}
+	n, err = Import(db, table, "test", &Options{Replace: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Errorf("want 3 records without the deleted record, have %d", n)
+	}
+}
+
+func TestImportFile(t *testing.T) {
+	table := openTestDBF(t, "dbase_30.dbf")
+	dbfile := filepath.Join(t.TempDir(), "test.db")
+	n, err := ImportFile(dbfile, table, "dbase_30", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int(table.NumRecords()) {
+		t.Errorf("want %d records, have %d", table.NumRecords(), n)
+	}
+
+	db, err := sql.Open("sqlite", dbfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var accessno, classes string
+	if err := db.QueryRow(`SELECT ACCESSNO, CLASSES FROM dbase_30 LIMIT 1`).Scan(&accessno, &classes); err != nil {
+		t.Fatal(err)
+	}
+	if accessno != "1999.1" || classes != "Domestic Life\r\nWeddings\r\n" {
+		t.Errorf("unexpected first record: %q %q", accessno, classes)
+	}
+}
+
+func TestImportNullFlags(t *testing.T) {
+	defer dbf.SetValidFileVersionFunc(dbf.ValidFileVersionFunc)
+	dbf.SetValidFileVersionFunc(func(byte) error { return nil })
+	table := openTestDBF(t, "dbase_31.dbf")
+	db := openTestDB(t)
+
+	if _, err := Import(db, table, "products", nil); err != nil {
+		t.Fatal(err)
+	}
+	var typ string
+	if err := db.QueryRow(`SELECT type FROM pragma_table_info('products') WHERE name = 'SUPPLIERID'`).Scan(&typ); err != nil {
+		t.Fatal(err)
+	}
+	if typ != "INTEGER" {
+		t.Errorf("want INTEGER column SUPPLIERID, have %s", typ)
+	}
+	var cols int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info('products') WHERE name = '_NullFlags'`).Scan(&cols); err != nil {
+		t.Fatal(err)
+	}
+	if cols != 0 {
+		t.Error("want no _NullFlags column")
+	}
+}
@@ -53,3 +53,31 @@ func (d *UTF8Validator) Decode(in []byte) ([]byte, error) {
 	}
 	return nil, ErrInvalidUTF8
 }
+
+// Encoder is the interface used when writing files, it translates UTF8 to the charset of the DBF
+type Encoder interface {
+	Encode(in []byte) ([]byte, error)
+}
+
+// Win1250Encoder translates UTF8 to Windows-1250
+type Win1250Encoder struct{}
+
+// Encode encodes a UTF8 byte slice to a Windows1250 byte slice.
+// An error is returned for characters that do not exist in Windows-1250.
+func (e *Win1250Encoder) Encode(in []byte) ([]byte, error) {
+	for _, b := range in {
+		if b >= utf8.RuneSelf {
+			return charmap.Windows1250.NewEncoder().Bytes(in)
+		}
+	}
+	// plain ASCII is the same in Windows-1250
+	return in, nil
+}
+
+// UTF8Encoder writes the DBF in UTF8 so it does nothing
+type UTF8Encoder struct{}
+
+// Encode encodes a UTF8 byte slice to a UTF8 byte slice
+func (e *UTF8Encoder) Encode(in []byte) ([]byte, error) {
+	return in, nil
+}
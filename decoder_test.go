@@ -55,4 +55,21 @@ func TestUTF8UTF8Validator_Decode(t *testing.T) {
 
 
 
-}
\ No newline at end of file
+}
+
+func TestWin1250Encoder_Encode(t *testing.T) {
+	enc := new(Win1250Encoder)
+	b, err := enc.Encode([]byte("Äő"))
+	if err != nil {
+		t.Fatalf("error in encode: %s", err)
+	}
+	if bytes.Equal(b, []byte{0xC4, 0xF5}) == false {
+		t.Errorf("Want % X, have % X", []byte{0xC4, 0xF5}, b)
+	}
+
+	// characters which do not exist in Windows-1250
+	_, err = enc.Encode([]byte("ㇹ"))
+	if err == nil {
+		t.Error("wanted an error in Encode, but have no error")
+	}
+}
@@ -0,0 +1,333 @@
+package dbf
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DiffType is the kind of difference found by Diff
+type DiffType int
+
+const (
+	// DiffAdded is a field or record that only exists in the second table
+	DiffAdded DiffType = iota
+	// DiffRemoved is a field or record that only exists in the first table
+	DiffRemoved
+	// DiffChanged is a field with a different definition or a record with different values
+	DiffChanged
+)
+
+func (t DiffType) String() string {
+	switch t {
+	case DiffAdded:
+		return "added"
+	case DiffRemoved:
+		return "removed"
+	case DiffChanged:
+		return "changed"
+	default:
+		return fmt.Sprintf("DiffType(%d)", int(t))
+	}
+}
+
+// TableDiff contains the differences between two tables found by Diff
+type TableDiff struct {
+	Schema  []SchemaDiff // Fields that were added, removed or changed, in field order
+	Records []RecordDiff // Records that were removed or changed in record order, followed by the added records
+}
+
+// Equal returns true if no differences were found
+func (d *TableDiff) Equal() bool {
+	return len(d.Schema) == 0 && len(d.Records) == 0
+}
+
+// SchemaDiff is a field that was added, removed or has a different type, length, decimals or flags
+type SchemaDiff struct {
+	Type  DiffType
+	Field string       // Field name
+	Old   *FieldHeader // Field in the first table, nil for DiffAdded
+	New   *FieldHeader // Field in the second table, nil for DiffRemoved
+}
+
+func (d SchemaDiff) String() string {
+	switch d.Type {
+	case DiffAdded:
+		return fmt.Sprintf("field %s added: %s", d.Field, fieldDefinition(d.New))
+	case DiffRemoved:
+		return fmt.Sprintf("field %s removed: %s", d.Field, fieldDefinition(d.Old))
+	default:
+		return fmt.Sprintf("field %s changed: %s -> %s", d.Field, fieldDefinition(d.Old), fieldDefinition(d.New))
+	}
+}
+
+// fieldDefinition returns the type, length and decimals of f like C(10) or N(12,2)
+func fieldDefinition(f *FieldHeader) string {
+	if f.Decimals > 0 {
+		return fmt.Sprintf("%s(%d,%d)", f.FieldType(), f.Len, f.Decimals)
+	}
+	return fmt.Sprintf("%s(%d)", f.FieldType(), f.Len)
+}
+
+// RecordDiff is a record that was added, removed or changed
+type RecordDiff struct {
+	Type     DiffType
+	Key      []interface{} // Values of the key fields, nil when records are paired by record number
+	OldRecNo int64         // Zero based record number in the first table, -1 for DiffAdded
+	NewRecNo int64         // Zero based record number in the second table, -1 for DiffRemoved
+	Changes  []FieldChange // Changed fields, or all fields of added and removed records
+}
+
+// FieldChange is the old and new value of a field, Old is nil for added records and New is nil for removed records
+type FieldChange struct {
+	Field string
+	Old   interface{}
+	New   interface{}
+}
+
+// diffTable is one of the tables compared by Diff, with a cursor reading the compared fields
+type diffTable struct {
+	c      *Cursor
+	fields []FieldHeader // fields of the cursor
+	keys   []int         // positions of the key fields in the cursor
+}
+
+// Diff compares table a with table b. Records are paired by the values of keyFields, or by record number
+// without key fields. Records that only exist in b are added, records that only exist in a are removed.
+// Only fields that exist in both tables are compared, differences between the fields are reported
+// in TableDiff.Schema. Trailing spaces in C and M fields are ignored, so changing the length of a C field
+// does not change every record, numbers are compared by value.
+// Deleted records are skipped and the _NullFlags system field is not compared.
+// The key fields must exist in both tables and must be unique, else an error is returned.
+// The record pointers are not moved.
+func Diff(a, b *DBF, keyFields []string) (*TableDiff, error) {
+	diff := new(TableDiff)
+	ta, err := newDiffTable(a, keyFields)
+	if err != nil {
+		return nil, err
+	}
+	tb, err := newDiffTable(b, keyFields)
+	if err != nil {
+		return nil, err
+	}
+
+	// common fields as pairs of positions in the cursors
+	var common [][2]int
+	for i, f := range ta.fields {
+		f := f
+		pos := tb.c.FieldPos(f.FieldName())
+		if pos < 0 {
+			diff.Schema = append(diff.Schema, SchemaDiff{Type: DiffRemoved, Field: f.FieldName(), Old: &f})
+			continue
+		}
+		common = append(common, [2]int{i, pos})
+		nf := tb.fields[pos]
+		if f.Type != nf.Type || f.Len != nf.Len || f.Decimals != nf.Decimals || f.Flags != nf.Flags {
+			diff.Schema = append(diff.Schema, SchemaDiff{Type: DiffChanged, Field: f.FieldName(), Old: &f, New: &nf})
+		}
+	}
+	for _, f := range tb.fields {
+		f := f
+		if ta.c.FieldPos(f.FieldName()) < 0 {
+			diff.Schema = append(diff.Schema, SchemaDiff{Type: DiffAdded, Field: f.FieldName(), New: &f})
+		}
+	}
+
+	if len(keyFields) == 0 {
+		err = diff.diffRecNo(ta, tb, common)
+	} else {
+		err = diff.diffKeys(ta, tb, common)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return diff, nil
+}
+
+// newDiffTable returns the table with a cursor on all fields except the _NullFlags system field
+func newDiffTable(dbf *DBF, keyFields []string) (*diffTable, error) {
+	var names []string
+	for _, f := range dbf.fields {
+		if f.Type != '0' {
+			names = append(names, f.FieldName())
+		}
+	}
+	c, err := dbf.Select(names...)
+	if err != nil {
+		return nil, err
+	}
+	t := &diffTable{c: c, fields: c.Fields()}
+	for _, name := range keyFields {
+		pos := c.FieldPos(strings.ToUpper(name))
+		if pos < 0 {
+			return nil, fmt.Errorf("%w: unknown key field %s", ErrInvalidField, name)
+		}
+		t.keys = append(t.keys, pos)
+	}
+	return t, nil
+}
+
+// record returns record recno, or nil if it is deleted
+func (t *diffTable) record(recno uint32) (*Record, error) {
+	if err := t.c.GoTo(recno); err != nil {
+		return nil, err
+	}
+	rec, err := t.c.Record()
+	if err != nil || rec.Deleted {
+		return nil, err
+	}
+	return rec, nil
+}
+
+// key returns the values of the key fields of rec and the key as a string to use in a map
+func (t *diffTable) key(rec *Record) ([]interface{}, string) {
+	values := make([]interface{}, len(t.keys))
+	var s strings.Builder
+	for i, pos := range t.keys {
+		values[i] = rec.data[pos]
+		fmt.Fprintf(&s, "%v\x00", diffValue(rec.data[pos]))
+	}
+	return values, s.String()
+}
+
+// diffRecNo compares the records with the same record number
+func (d *TableDiff) diffRecNo(ta, tb *diffTable, common [][2]int) error {
+	na, nb := ta.c.dbf.NumRecords(), tb.c.dbf.NumRecords()
+	for recno := uint32(0); recno < na || recno < nb; recno++ {
+		var reca, recb *Record
+		var err error
+		if recno < na {
+			if reca, err = ta.record(recno); err != nil {
+				return err
+			}
+		}
+		if recno < nb {
+			if recb, err = tb.record(recno); err != nil {
+				return err
+			}
+		}
+		d.compare(nil, reca, recb, int64(recno), int64(recno), ta, tb, common)
+	}
+	return nil
+}
+
+// diffKeys compares the records with the same key
+func (d *TableDiff) diffKeys(ta, tb *diffTable, common [][2]int) error {
+	// the record numbers in b by key
+	keys := make(map[string]uint32)
+	for recno := uint32(0); recno < tb.c.dbf.NumRecords(); recno++ {
+		rec, err := tb.record(recno)
+		if err != nil {
+			return err
+		}
+		if rec == nil {
+			continue
+		}
+		values, key := tb.key(rec)
+		if other, ok := keys[key]; ok {
+			return fmt.Errorf("duplicate key %v in records %d and %d of the second table", values, other, recno)
+		}
+		keys[key] = recno
+	}
+
+	seen := make(map[string]uint32)
+	for recno := uint32(0); recno < ta.c.dbf.NumRecords(); recno++ {
+		reca, err := ta.record(recno)
+		if err != nil {
+			return err
+		}
+		if reca == nil {
+			continue
+		}
+		values, key := ta.key(reca)
+		if other, ok := seen[key]; ok {
+			return fmt.Errorf("duplicate key %v in records %d and %d of the first table", values, other, recno)
+		}
+		seen[key] = recno
+		var recb *Record
+		recnob, ok := keys[key]
+		if ok {
+			if recb, err = tb.record(recnob); err != nil {
+				return err
+			}
+			delete(keys, key)
+		}
+		d.compare(values, reca, recb, int64(recno), int64(recnob), ta, tb, common)
+	}
+
+	// the remaining keys in b are added, in record order
+	for recno := uint32(0); recno < tb.c.dbf.NumRecords() && len(keys) > 0; recno++ {
+		recb, err := tb.record(recno)
+		if err != nil {
+			return err
+		}
+		if recb == nil {
+			continue
+		}
+		values, key := tb.key(recb)
+		if _, ok := keys[key]; ok {
+			d.compare(values, nil, recb, -1, int64(recno), ta, tb, common)
+			delete(keys, key)
+		}
+	}
+	return nil
+}
+
+// compare adds the difference between record reca of table a and record recb of table b, which can be nil
+func (d *TableDiff) compare(key []interface{}, reca, recb *Record, recnoa, recnob int64, ta, tb *diffTable, common [][2]int) {
+	switch {
+	case reca == nil && recb == nil:
+	case reca == nil:
+		diff := RecordDiff{Type: DiffAdded, Key: key, OldRecNo: -1, NewRecNo: recnob}
+		for i, f := range tb.fields {
+			diff.Changes = append(diff.Changes, FieldChange{Field: f.FieldName(), New: recb.data[i]})
+		}
+		d.Records = append(d.Records, diff)
+	case recb == nil:
+		diff := RecordDiff{Type: DiffRemoved, Key: key, OldRecNo: recnoa, NewRecNo: -1}
+		for i, f := range ta.fields {
+			diff.Changes = append(diff.Changes, FieldChange{Field: f.FieldName(), Old: reca.data[i]})
+		}
+		d.Records = append(d.Records, diff)
+	default:
+		diff := RecordDiff{Type: DiffChanged, Key: key, OldRecNo: recnoa, NewRecNo: recnob}
+		for _, pos := range common {
+			olda, newb := reca.data[pos[0]], recb.data[pos[1]]
+			if !equalValues(olda, newb) {
+				diff.Changes = append(diff.Changes, FieldChange{Field: ta.fields[pos[0]].FieldName(), Old: olda, New: newb})
+			}
+		}
+		if len(diff.Changes) > 0 {
+			d.Records = append(d.Records, diff)
+		}
+	}
+}
+
+// diffValue returns value v for comparing, strings without trailing spaces and numbers as float64
+func diffValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case string:
+		return strings.TrimRight(val, " ")
+	case bool, []byte, time.Time:
+		return v
+	}
+	if f, ok := asFloat64(v); ok {
+		return f
+	}
+	return v
+}
+
+// equalValues returns if field values a and b are the same, see diffValue
+func equalValues(a, b interface{}) bool {
+	a, b = diffValue(a), diffValue(b)
+	switch va := a.(type) {
+	case []byte:
+		vb, ok := b.([]byte)
+		return ok && bytes.Equal(va, vb)
+	case time.Time:
+		vb, ok := b.(time.Time)
+		return ok && va.Equal(vb)
+	}
+	return a == b
+}
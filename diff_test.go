@@ -0,0 +1,103 @@
+package dbf
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "DIFF.DBF")
+	if _, err := testDbf.CopyTo(filename, &CopyOptions{Fields: []string{"ID", "COMP_NAME", "COMP_OS", "MELDING"}}); err != nil {
+		t.Fatal(err)
+	}
+	fields := newFields(t,
+		"ID", byte('I'), 0, 0,
+		"COMP_NAME", byte('C'), 60, 0,
+		"COMP_OS", byte('C'), 20, 0,
+		"MELDING", byte('M'), 0, 0,
+	)
+	upper := func(val interface{}) (interface{}, error) {
+		return strings.ToUpper(val.(string)), nil
+	}
+	_, err := Alter(filename, fields, new(Win1250Decoder), new(Win1250Encoder), &AlterOptions{
+		Convert: map[string]func(interface{}) (interface{}, error){"COMP_OS": upper},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := OpenFileRW(filename, new(Win1250Decoder), new(Win1250Encoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	if _, err := b.Append([]interface{}{10, "NEW", "Linux", "new memo"}); err != nil {
+		t.Fatal(err)
+	}
+
+	diff, err := Diff(testDbf, b, []string{"ID"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var schema []string
+	for _, d := range diff.Schema {
+		schema = append(schema, d.String())
+	}
+	want := "field NIVEAU removed: N(1)|field DATUM removed: D(8)|field TIJD removed: C(8)|field SOORT removed: N(10)|" +
+		"field ID_NR removed: I(4)|field USERNR removed: I(4)|field COMP_NAME changed: C(40) -> C(60)|" +
+		"field NUMBER removed: N(12,2)|field FLOAT removed: F(10)|field BOOL removed: L(1)"
+	if strings.Join(schema, "|") != want {
+		t.Errorf("unexpected schema differences %v", schema)
+	}
+
+	// record 1 is deleted, record 3 has an empty COMP_OS
+	if len(diff.Records) != 3 {
+		t.Fatalf("want 3 record differences, have %+v", diff.Records)
+	}
+	changed := diff.Records[0]
+	if changed.Type != DiffChanged || changed.Key[0] != int32(1) || changed.OldRecNo != 0 || changed.NewRecNo != 0 || len(changed.Changes) != 1 {
+		t.Errorf("unexpected change %+v", changed)
+	} else if c := changed.Changes[0]; c.Field != "COMP_OS" || c.Old != "Windows 8.1 Pro     " || c.New != "WINDOWS 8.1 PRO     " {
+		t.Errorf("unexpected field change %+v", c)
+	}
+	if d := diff.Records[1]; d.Type != DiffChanged || d.Key[0] != int32(3) || d.OldRecNo != 2 || d.NewRecNo != 1 {
+		t.Errorf("unexpected change %+v", d)
+	}
+	added := diff.Records[2]
+	if added.Type != DiffAdded || added.Key[0] != int32(10) || added.OldRecNo != -1 || added.NewRecNo != 3 || len(added.Changes) != 4 {
+		t.Errorf("unexpected added record %+v", added)
+	} else if c := added.Changes[3]; c.Field != "MELDING" || c.Old != nil || c.New != "new memo" {
+		t.Errorf("unexpected added field %+v", c)
+	}
+
+	// compared by record number the records after the deleted record 1 are paired with the next record
+	diff, err = Diff(testDbf, b, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var types []string
+	for _, d := range diff.Records {
+		types = append(types, d.Type.String())
+	}
+	if strings.Join(types, ",") != "changed,added,changed,changed" {
+		t.Errorf("unexpected record differences %v", types)
+	}
+}
+
+func TestDiffErrors(t *testing.T) {
+	diff, err := Diff(testDbf, testDbf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !diff.Equal() {
+		t.Errorf("want no differences, have %+v", diff)
+	}
+	if _, err := Diff(testDbf, testDbf, []string{"NIVEAU"}); err == nil || !strings.Contains(err.Error(), "duplicate key") {
+		t.Errorf("want duplicate key error, have %v", err)
+	}
+	if _, err := Diff(testDbf, testDbf, []string{"NOPE"}); !errors.Is(err, ErrInvalidField) {
+		t.Errorf("want ErrInvalidField, have %v", err)
+	}
+}
@@ -0,0 +1,128 @@
+package dbf
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrNoDeleteFlag is returned when a record does not start with a valid delete flag (0x20 or 0x2A)
+	ErrNoDeleteFlag = errors.New("invalid record data, no delete flag found at beginning of record")
+
+	// ErrInvalidNumeric is returned in strict mode when N or F field data is not a valid number
+	ErrInvalidNumeric = errors.New("invalid numeric value")
+
+	// ErrInvalidDate is returned in strict mode when D or T field data is not a valid date
+	ErrInvalidDate = errors.New("invalid date value")
+
+	// ErrInvalidLogical is returned in strict mode when L field data is not a valid logical value
+	ErrInvalidLogical = errors.New("invalid logical value")
+
+	// ErrFieldType is returned by the typed RawRecord accessors when the field type cannot be converted to the requested type
+	ErrFieldType = errors.New("field type cannot be converted to the requested type")
+)
+
+// RecordError is returned when a complete record could not be read or parsed.
+// It contains the position of the record and the underlying error, use errors.As to inspect it.
+type RecordError struct {
+	RecNo  uint32 // Zero based record number
+	Offset int64  // Byte offset of the record in the DBF file
+	Raw    []byte // Raw record data, can be incomplete or nil
+	Err    error  // Underlying error
+}
+
+func (e *RecordError) Error() string {
+	return fmt.Sprintf("record %d at offset %d: %s", e.RecNo, e.Offset, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *RecordError) Unwrap() error {
+	return e.Err
+}
+
+// FieldError is returned when the data of a field could not be read or converted to its Go value.
+// It contains the position of the field and the underlying error, use errors.As to inspect it.
+type FieldError struct {
+	RecNo    uint32 // Zero based record number
+	FieldPos int    // Zero based field position
+	Name     string // Field name
+	Offset   int64  // Byte offset of the field data in the DBF file
+	Raw      []byte // Raw field data, can be incomplete or nil
+	Err      error  // Underlying error
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("record %d, field %s (column %d) at offset %d: %s", e.RecNo, e.Name, e.FieldPos, e.Offset, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// SetStrict enables or disables strict mode.
+// In strict mode malformed numerics, impossible dates, out of range Julian days and invalid logical values
+// are returned as errors instead of being coerced to a (zero) value.
+func (dbf *DBF) SetStrict(strict bool) {
+	dbf.strict = strict
+}
+
+// Strict returns if strict mode is enabled
+func (dbf *DBF) Strict() bool {
+	return dbf.strict
+}
+
+// recordOffset returns the byte offset of record recno in the DBF file
+func (dbf *DBF) recordOffset(recno uint32) int64 {
+	return int64(dbf.header.FirstRec) + (int64(recno) * int64(dbf.header.RecLen))
+}
+
+// newFieldError wraps err in a FieldError for field fieldpos in record recno
+func (dbf *DBF) newFieldError(recno uint32, fieldpos int, offset int64, raw []byte, err error) *FieldError {
+	return &FieldError{
+		RecNo:    recno,
+		FieldPos: fieldpos,
+		Name:     dbf.fields[fieldpos].FieldName(),
+		Offset:   offset,
+		Raw:      append([]byte(nil), raw...), // raw may be a slice of a reused buffer or a mapped file
+		Err:      err,
+	}
+}
+
+// validNumeric checks if raw N or F data is a plain decimal number, optionally signed and padded with spaces
+func validNumeric(raw []byte) bool {
+	digits, point := 0, false
+	i, n := 0, len(raw)
+	for i < n && raw[i] == ' ' {
+		i++
+	}
+	for n > i && raw[n-1] == ' ' {
+		n--
+	}
+	if i < n && (raw[i] == '-' || raw[i] == '+') {
+		i++
+	}
+	for ; i < n; i++ {
+		switch {
+		case raw[i] >= '0' && raw[i] <= '9':
+			digits++
+		case raw[i] == '.' && !point:
+			point = true
+		default:
+			return false
+		}
+	}
+	return digits > 0
+}
+
+// validLogical checks if raw L data is one of the values FoxPro and dBase write
+func validLogical(raw []byte) bool {
+	if len(raw) != 1 {
+		return false
+	}
+	switch raw[0] {
+	case 'T', 't', 'Y', 'y', 'F', 'f', 'N', 'n', '?', ' ':
+		return true
+	}
+	return false
+}
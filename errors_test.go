@@ -0,0 +1,221 @@
+package dbf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// openModifiedTestDBF opens TEST.DBF from memory after applying modify to the raw DBF bytes
+func openModifiedTestDBF(t *testing.T, modify func(data []byte, dbf *DBF)) *DBF {
+	t.Helper()
+	dbfbytes, err := ioutil.ReadFile(filepath.Join("testdata", "TEST.DBF"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fptbytes, err := ioutil.ReadFile(filepath.Join("testdata", "TEST.FPT"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// open once to determine field offsets, then modify and open again
+	orig, err := OpenStream(bytes.NewReader(dbfbytes), bytes.NewReader(fptbytes), new(Win1250Decoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	modify(dbfbytes, orig)
+	dbf, err := OpenStream(bytes.NewReader(dbfbytes), bytes.NewReader(fptbytes), new(Win1250Decoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dbf
+}
+
+func TestRecordErrorNoDeleteFlag(t *testing.T) {
+	dbf := openModifiedTestDBF(t, func(data []byte, dbf *DBF) {
+		data[dbf.recordOffset(2)] = 'X'
+	})
+
+	_, err := dbf.RecordAt(2)
+	if err == nil {
+		t.Fatal("expected an error for record without delete flag")
+	}
+	var recErr *RecordError
+	if !errors.As(err, &recErr) {
+		t.Fatalf("want *RecordError, have %T: %s", err, err)
+	}
+	if recErr.RecNo != 2 {
+		t.Errorf("want RecNo 2, have %d", recErr.RecNo)
+	}
+	if recErr.Offset != dbf.recordOffset(2) {
+		t.Errorf("want Offset %d, have %d", dbf.recordOffset(2), recErr.Offset)
+	}
+	if !errors.Is(err, ErrNoDeleteFlag) {
+		t.Errorf("want error to wrap ErrNoDeleteFlag, have %s", err)
+	}
+}
+
+func TestRecordErrorIncomplete(t *testing.T) {
+	dbfbytes, err := ioutil.ReadFile(filepath.Join("testdata", "TEST.DBF"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fptbytes, err := ioutil.ReadFile(filepath.Join("testdata", "TEST.FPT"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// cut the last record in half
+	dbfbytes = dbfbytes[:len(dbfbytes)-60]
+	dbf, err := OpenStream(bytes.NewReader(dbfbytes), bytes.NewReader(fptbytes), new(Win1250Decoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = dbf.RecordAt(3)
+	var recErr *RecordError
+	if !errors.As(err, &recErr) {
+		t.Fatalf("want *RecordError, have %T: %v", err, err)
+	}
+	if recErr.RecNo != 3 || !errors.Is(err, ErrIncomplete) {
+		t.Errorf("want incomplete read of record 3, have %s", err)
+	}
+	if len(recErr.Raw) != int(dbf.header.RecLen)-60 {
+		t.Errorf("want %d raw bytes, have %d", int(dbf.header.RecLen)-60, len(recErr.Raw))
+	}
+}
+
+func TestFieldErrorStrict(t *testing.T) {
+	var numberPos, boolPos int
+	dbf := openModifiedTestDBF(t, func(data []byte, dbf *DBF) {
+		numberPos = dbf.FieldPos("NUMBER")
+		boolPos = dbf.FieldPos("BOOL")
+		rec := dbf.recordOffset(0)
+		copy(data[rec+int64(dbf.fields[numberPos].Pos):], "        1e10")
+		copy(data[rec+int64(dbf.fields[boolPos].Pos):], "X")
+	})
+
+	// without strict mode the values are coerced
+	rec, err := dbf.RecordAt(0)
+	if err != nil {
+		t.Fatalf("expected no error in non-strict mode, have %s", err)
+	}
+	if v, _ := rec.Field(boolPos); v != false {
+		t.Errorf("want false for invalid logical, have %v", v)
+	}
+
+	dbf.SetStrict(true)
+	if !dbf.Strict() {
+		t.Fatal("expected strict mode to be enabled")
+	}
+
+	tests := []struct {
+		fieldpos int
+		want     error
+	}{
+		{numberPos, ErrInvalidNumeric},
+		{boolPos, ErrInvalidLogical},
+	}
+	if err := dbf.GoTo(0); err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range tests {
+		_, err := dbf.Field(test.fieldpos)
+		var fieldErr *FieldError
+		if !errors.As(err, &fieldErr) {
+			t.Errorf("field %d: want *FieldError, have %T: %v", test.fieldpos, err, err)
+			continue
+		}
+		if !errors.Is(err, test.want) {
+			t.Errorf("field %d: want %s, have %s", test.fieldpos, test.want, fieldErr.Err)
+		}
+		if fieldErr.RecNo != 0 || fieldErr.FieldPos != test.fieldpos || fieldErr.Name != dbf.fields[test.fieldpos].FieldName() {
+			t.Errorf("field %d: unexpected position in error: %s", test.fieldpos, err)
+		}
+		wantOffset := dbf.recordOffset(0) + int64(dbf.fields[test.fieldpos].Pos)
+		if fieldErr.Offset != wantOffset {
+			t.Errorf("field %d: want offset %d, have %d", test.fieldpos, wantOffset, fieldErr.Offset)
+		}
+		if len(fieldErr.Raw) != int(dbf.fields[test.fieldpos].Len) {
+			t.Errorf("field %d: want %d raw bytes, have %d", test.fieldpos, dbf.fields[test.fieldpos].Len, len(fieldErr.Raw))
+		}
+	}
+
+	// the first invalid field is reported when reading the complete record
+	_, err = dbf.RecordAt(0)
+	var fieldErr *FieldError
+	if !errors.As(err, &fieldErr) {
+		t.Fatalf("want *FieldError, have %T: %v", err, err)
+	}
+	if fieldErr.FieldPos != numberPos {
+		t.Errorf("want first error on field %d, have %d", numberPos, fieldErr.FieldPos)
+	}
+}
+
+func TestParseDateStrict(t *testing.T) {
+	dbf := &DBF{}
+
+	// datetime with an impossible Julian day
+	raw := make([]byte, 8)
+	binary.LittleEndian.PutUint32(raw, 0xFFFFFFF)
+	val, err := dbf.parseDateTime(raw)
+	if err != nil || !val.IsZero() {
+		t.Errorf("non-strict: want zero time and no error, have %s, %v", val, err)
+	}
+	dbf.SetStrict(true)
+	if _, err = dbf.parseDateTime(raw); err != ErrInvalidDate {
+		t.Errorf("strict: want %s, have %v", ErrInvalidDate, err)
+	}
+
+	// a time of a day or more is normalized into the next day, unless in strict mode
+	binary.LittleEndian.PutUint32(raw, 2457024)           // 2015-01-01
+	binary.LittleEndian.PutUint32(raw[4:], 86400000+1500) // 24:00:01.5
+	want := time.Date(2015, 1, 2, 0, 0, 1, 500*int(time.Millisecond), time.UTC)
+	dbf.SetStrict(false)
+	if val, err = dbf.parseDateTime(raw); err != nil || !val.Equal(want) {
+		t.Errorf("non-strict: want %s, have %s, %v", want, val, err)
+	}
+	dbf.SetStrict(true)
+	if _, err = dbf.parseDateTime(raw); err != ErrInvalidDate {
+		t.Errorf("strict: want %s, have %v", ErrInvalidDate, err)
+	}
+
+	// an empty datetime is valid in strict mode
+	val, err = dbf.parseDateTime(make([]byte, 8))
+	if err != nil || !val.IsZero() {
+		t.Errorf("strict: want zero time and no error for empty datetime, have %s, %v", val, err)
+	}
+
+	// impossible date
+	if _, err = dbf.parseDate([]byte("20150231")); err != ErrInvalidDate {
+		t.Errorf("strict: want %s, have %v", ErrInvalidDate, err)
+	}
+	if _, err = dbf.parseDate([]byte("        ")); err != nil {
+		t.Errorf("strict: want no error for empty date, have %s", err)
+	}
+}
+
+func TestValidNumeric(t *testing.T) {
+	tests := []struct {
+		in   string
+		want bool
+	}{
+		{"  123", true},
+		{"-12.50", true},
+		{"+1 ", true},
+		{".5", true},
+		{"1e10", false},
+		{"NaN", false},
+		{"1.2.3", false},
+		{"1 2", false},
+		{"*****", false},
+		{"-", false},
+	}
+	for _, test := range tests {
+		if have := validNumeric([]byte(test.in)); have != test.want {
+			t.Errorf("validNumeric(%q): want %t, have %t", test.in, test.want, have)
+		}
+	}
+}
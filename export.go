@@ -0,0 +1,55 @@
+package dbf
+
+import (
+	"strconv"
+	"strings"
+)
+
+// DeletedMode determines how deleted records are handled when exporting a table
+type DeletedMode int
+
+const (
+	// SkipDeleted skips deleted records, this is the default
+	SkipDeleted DeletedMode = iota
+	// IncludeDeleted exports deleted records as well
+	IncludeDeleted
+	// OnlyDeleted only exports deleted records
+	OnlyDeleted
+)
+
+// Include returns if a record with the deleted flag set to deleted should be exported
+func (m DeletedMode) Include(deleted bool) bool {
+	switch m {
+	case IncludeDeleted:
+		return true
+	case OnlyDeleted:
+		return deleted
+	default:
+		return !deleted
+	}
+}
+
+// formatNumber formats a numeric value of field f as text.
+// N fields with decimals use the number of decimals of the field, other floats use the smallest
+// number of digits necessary. The decimal separator is replaced if sep is not 0 or '.'.
+func formatNumber(f *FieldHeader, val interface{}, sep rune) string {
+	var s string
+	switch v := val.(type) {
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case int32:
+		return strconv.FormatInt(int64(v), 10)
+	case float64:
+		prec := -1
+		if f.Type == 'N' && f.Decimals > 0 {
+			prec = int(f.Decimals)
+		}
+		s = strconv.FormatFloat(v, 'f', prec, 64)
+	default:
+		return ""
+	}
+	if sep != 0 && sep != '.' {
+		s = strings.Replace(s, ".", string(sep), 1)
+	}
+	return s
+}
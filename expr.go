@@ -0,0 +1,64 @@
+package dbf
+
+import (
+	"fmt"
+
+	"github.com/SebastiaanKlippert/go-foxpro-dbf/expr"
+)
+
+// CompileExpr compiles FoxPro expression src, like the key expression of an index tag, for the fields of this table.
+// The expression can be evaluated for a *Record or a RawRecord read from this table, see package expr for the supported syntax.
+// Records read through a Cursor with a projection of the fields can not be used.
+func (dbf *DBF) CompileExpr(src string) (*expr.Expr, error) {
+	fields := make([]expr.Field, len(dbf.fields))
+	for i := range dbf.fields {
+		fields[i] = expr.Field{Name: dbf.fields[i].FieldName(), Type: dbf.fields[i].Type}
+	}
+	return expr.Compile(src, fields)
+}
+
+// Expr implements expr.Record for a RawRecord, fields are only decoded when the expression uses them
+func (r RawRecord) Expr() expr.Record {
+	return rawExprRecord{r}
+}
+
+type rawExprRecord struct {
+	RawRecord
+}
+
+func (r rawExprRecord) Field(pos int) (interface{}, error) {
+	return r.Value(pos)
+}
+
+// Where returns a filter matching records for which the logical FoxPro expression src is true,
+// like Where("UPPER(COMP_NAME) = 'TEST' .AND. !DELETED()").
+// The expression is compiled when the filter is set on a cursor, compile errors are returned as *expr.SyntaxError.
+func Where(src string) Filter {
+	return &exprFilter{src: src}
+}
+
+type exprFilter struct {
+	src string
+}
+
+// Match compiles the expression for every call, filters set on a cursor are compiled once
+func (f *exprFilter) Match(rec RawRecord) (bool, error) {
+	bound, err := f.bind(rec.dbf)
+	if err != nil {
+		return false, err
+	}
+	return bound.Match(rec)
+}
+
+func (f *exprFilter) bind(dbf *DBF) (Filter, error) {
+	e, err := dbf.CompileExpr(f.src)
+	if err != nil {
+		return nil, err
+	}
+	if e.Type() != expr.Logical {
+		return nil, fmt.Errorf("%w: filter expression %q is not logical", ErrFieldType, f.src)
+	}
+	return FilterFunc(func(rec RawRecord) (bool, error) {
+		return e.EvalBool(rec.Expr())
+	}), nil
+}
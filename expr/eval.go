@@ -0,0 +1,374 @@
+package expr
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// ErrDivisionByZero is returned by Eval when a number is divided by zero
+var ErrDivisionByZero = errors.New("expr: division by zero")
+
+// node is a node of the expression tree, eval returns a value of the type returned by typ
+type node interface {
+	typ() Type
+	eval(rec Record) (interface{}, error)
+}
+
+// constNode is a literal value
+type constNode struct {
+	t Type
+	v interface{}
+}
+
+func (n constNode) typ() Type                        { return n.t }
+func (n constNode) eval(Record) (interface{}, error) { return n.v, nil }
+
+// fieldNode is a reference to a field
+type fieldNode struct {
+	pos int
+	t   Type
+}
+
+func (n fieldNode) typ() Type { return n.t }
+
+func (n fieldNode) eval(rec Record) (interface{}, error) {
+	if rec == nil {
+		return nil, errors.New("expr: no record to read fields from")
+	}
+	v, err := rec.Field(n.pos)
+	if err != nil {
+		return nil, err
+	}
+	return fieldValue(n.t, v)
+}
+
+// fieldValue converts field value v to a value of type t, null values are converted to empty values
+func fieldValue(t Type, v interface{}) (interface{}, error) {
+	switch t {
+	case Character:
+		switch s := v.(type) {
+		case string:
+			return s, nil
+		case []byte:
+			return string(s), nil
+		case nil:
+			return "", nil
+		}
+	case Numeric:
+		switch n := v.(type) {
+		case float64:
+			return n, nil
+		case int64:
+			return float64(n), nil
+		case int32:
+			return float64(n), nil
+		case int:
+			return float64(n), nil
+		case float32:
+			return float64(n), nil
+		case nil:
+			return float64(0), nil
+		}
+	case Date, DateTime:
+		switch d := v.(type) {
+		case time.Time:
+			return d, nil
+		case nil:
+			return time.Time{}, nil
+		}
+	case Logical:
+		switch b := v.(type) {
+		case bool:
+			return b, nil
+		case nil:
+			return false, nil
+		}
+	}
+	return nil, fmt.Errorf("expr: cannot use field value %v (%T) as type %s", v, v, t)
+}
+
+// evalArgs evaluates all nodes
+func evalArgs(rec Record, args []node) ([]interface{}, error) {
+	vals := make([]interface{}, len(args))
+	for i, arg := range args {
+		v, err := arg.eval(rec)
+		if err != nil {
+			return nil, err
+		}
+		vals[i] = v
+	}
+	return vals, nil
+}
+
+// funcNode evaluates all arguments and calls fn, used for operators and functions
+type funcNode struct {
+	t    Type
+	args []node
+	fn   func(vals []interface{}) (interface{}, error)
+}
+
+func (n funcNode) typ() Type { return n.t }
+
+func (n funcNode) eval(rec Record) (interface{}, error) {
+	vals, err := evalArgs(rec, n.args)
+	if err != nil {
+		return nil, err
+	}
+	return n.fn(vals)
+}
+
+type notNode struct {
+	x node
+}
+
+func (n notNode) typ() Type { return Logical }
+
+func (n notNode) eval(rec Record) (interface{}, error) {
+	v, err := n.x.eval(rec)
+	if err != nil {
+		return nil, err
+	}
+	return !v.(bool), nil
+}
+
+type negNode struct {
+	x node
+}
+
+func (n negNode) typ() Type { return Numeric }
+
+func (n negNode) eval(rec Record) (interface{}, error) {
+	v, err := n.x.eval(rec)
+	if err != nil {
+		return nil, err
+	}
+	return -v.(float64), nil
+}
+
+// logicNode implements .AND. and .OR., the right operand is only evaluated when needed
+type logicNode struct {
+	and         bool
+	left, right node
+}
+
+func (n logicNode) typ() Type { return Logical }
+
+func (n logicNode) eval(rec Record) (interface{}, error) {
+	v, err := n.left.eval(rec)
+	if err != nil {
+		return nil, err
+	}
+	if v.(bool) != n.and {
+		return v, nil
+	}
+	return n.right.eval(rec)
+}
+
+// binary returns the node for binary operator op, the operand types are checked
+func (p *parser) binary(op token, left, right node) (node, error) {
+	lt, rt := left.typ(), right.typ()
+	mismatch := func() error {
+		return p.errorf(op.pos, "operator %s not defined for %s and %s", op.text, lt, rt)
+	}
+	fn := func(t Type, f func(a, b interface{}) (interface{}, error)) node {
+		return funcNode{t: t, args: []node{left, right}, fn: func(vals []interface{}) (interface{}, error) {
+			return f(vals[0], vals[1])
+		}}
+	}
+
+	switch op.text {
+	case "AND", "OR":
+		if lt != Logical || rt != Logical {
+			return nil, mismatch()
+		}
+		return logicNode{and: op.text == "AND", left: left, right: right}, nil
+	case "+":
+		switch {
+		case lt == Character && rt == Character:
+			return fn(Character, func(a, b interface{}) (interface{}, error) {
+				return a.(string) + b.(string), nil
+			}), nil
+		case lt == Numeric && rt == Numeric:
+			return fn(Numeric, func(a, b interface{}) (interface{}, error) {
+				return a.(float64) + b.(float64), nil
+			}), nil
+		case (lt == Date || lt == DateTime) && rt == Numeric:
+			return fn(lt, func(a, b interface{}) (interface{}, error) {
+				return addTime(lt, a.(time.Time), b.(float64)), nil
+			}), nil
+		case lt == Numeric && (rt == Date || rt == DateTime):
+			return fn(rt, func(a, b interface{}) (interface{}, error) {
+				return addTime(rt, b.(time.Time), a.(float64)), nil
+			}), nil
+		}
+	case "-":
+		switch {
+		case lt == Character && rt == Character:
+			// trailing spaces of the left operand are moved to the end of the result
+			return fn(Character, func(a, b interface{}) (interface{}, error) {
+				as := a.(string)
+				trimmed := strings.TrimRight(as, " ")
+				return trimmed + b.(string) + strings.Repeat(" ", len(as)-len(trimmed)), nil
+			}), nil
+		case lt == Numeric && rt == Numeric:
+			return fn(Numeric, func(a, b interface{}) (interface{}, error) {
+				return a.(float64) - b.(float64), nil
+			}), nil
+		case (lt == Date || lt == DateTime) && rt == Numeric:
+			return fn(lt, func(a, b interface{}) (interface{}, error) {
+				return addTime(lt, a.(time.Time), -b.(float64)), nil
+			}), nil
+		case lt == rt && (lt == Date || lt == DateTime):
+			// the difference is in days for dates and in seconds for datetimes
+			return fn(Numeric, func(a, b interface{}) (interface{}, error) {
+				at, bt := a.(time.Time), b.(time.Time)
+				if at.IsZero() || bt.IsZero() {
+					return float64(0), nil
+				}
+				d := at.Sub(bt)
+				if lt == Date {
+					return math.Round(d.Hours() / 24), nil
+				}
+				return d.Seconds(), nil
+			}), nil
+		}
+	case "*", "/", "%", "^", "**":
+		if lt != Numeric || rt != Numeric {
+			return nil, mismatch()
+		}
+		return fn(Numeric, func(a, b interface{}) (interface{}, error) {
+			return arith(op.text, a.(float64), b.(float64))
+		}), nil
+	case "$":
+		if lt != Character || rt != Character {
+			return nil, mismatch()
+		}
+		return fn(Logical, func(a, b interface{}) (interface{}, error) {
+			return strings.Contains(b.(string), a.(string)), nil
+		}), nil
+	default:
+		// comparisons, dates and datetimes can be compared with each other
+		if lt != rt && !(isTime(lt) && isTime(rt)) {
+			return nil, mismatch()
+		}
+		if lt == Logical && op.text != "=" && op.text != "==" && op.text != "<>" && op.text != "!=" && op.text != "#" {
+			return nil, mismatch()
+		}
+		cmp := op.text
+		return fn(Logical, func(a, b interface{}) (interface{}, error) {
+			return compare(cmp, a, b), nil
+		}), nil
+	}
+	return nil, mismatch()
+}
+
+func isTime(t Type) bool {
+	return t == Date || t == DateTime
+}
+
+// addTime adds n days to a date or n seconds to a datetime, empty values stay empty
+func addTime(t Type, d time.Time, n float64) time.Time {
+	if d.IsZero() {
+		return d
+	}
+	if t == Date {
+		return d.AddDate(0, 0, int(n))
+	}
+	return d.Add(time.Duration(n * float64(time.Second)))
+}
+
+func arith(op string, a, b float64) (interface{}, error) {
+	switch op {
+	case "*":
+		return a * b, nil
+	case "/":
+		if b == 0 {
+			return nil, ErrDivisionByZero
+		}
+		return a / b, nil
+	case "%":
+		return mod(a, b)
+	default:
+		return math.Pow(a, b), nil
+	}
+}
+
+// mod returns the modulus of a and b, with the sign of b like FoxPro
+func mod(a, b float64) (interface{}, error) {
+	if b == 0 {
+		return nil, ErrDivisionByZero
+	}
+	m := math.Mod(a, b)
+	if m != 0 && (m < 0) != (b < 0) {
+		m += b
+	}
+	return m, nil
+}
+
+// compare compares a and b, which are of the same type, using comparison operator op
+func compare(op string, a, b interface{}) bool {
+	var c int
+	switch av := a.(type) {
+	case string:
+		bs := b.(string)
+		switch op {
+		case "==":
+			return av == bs
+		case "=", "<>", "!=", "#":
+			// SET EXACT OFF: a is compared up to the length of b, shorter values are padded with spaces
+			eq := padRight(av, len(bs))[:len(bs)] == bs
+			return eq == (op == "=")
+		}
+		c = strings.Compare(padRight(av, len(bs)), padRight(bs, len(av)))
+	case float64:
+		c = compareFloat(av, b.(float64))
+	case time.Time:
+		bt := b.(time.Time)
+		switch {
+		case av.Before(bt):
+			c = -1
+		case av.After(bt):
+			c = 1
+		}
+	case bool:
+		eq := av == b.(bool)
+		return eq == (op == "=" || op == "==")
+	}
+
+	switch op {
+	case "=", "==":
+		return c == 0
+	case "<>", "!=", "#":
+		return c != 0
+	case "<":
+		return c < 0
+	case ">":
+		return c > 0
+	case "<=":
+		return c <= 0
+	default:
+		return c >= 0
+	}
+}
+
+func compareFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// padRight pads s with spaces to length n
+func padRight(s string, n int) string {
+	if len(s) >= n {
+		return s
+	}
+	return s + strings.Repeat(" ", n-len(s))
+}
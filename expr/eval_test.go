@@ -0,0 +1,89 @@
+package expr
+
+import (
+	"testing"
+	"time"
+)
+
+// evalTests evaluates every expression in tests without a record
+func evalTests(t *testing.T, tests []struct {
+	src  string
+	want interface{}
+}) {
+	t.Helper()
+	for _, test := range tests {
+		e, err := Compile(test.src, nil)
+		if err != nil {
+			t.Errorf("Compile(%q): %s", test.src, err)
+			continue
+		}
+		v, err := e.Eval(nil)
+		if err != nil {
+			t.Errorf("Eval(%q): %s", test.src, err)
+			continue
+		}
+		if v != test.want {
+			t.Errorf("%q: want %#v, have %#v", test.src, test.want, v)
+		}
+	}
+}
+
+func TestOperators(t *testing.T) {
+	evalTests(t, []struct {
+		src  string
+		want interface{}
+	}{
+		{"'ab' + 'cd'", "abcd"},
+		{"'ab  ' - 'cd'", "abcd  "},
+		{"7 - 2.5", 4.5},
+		{"7 / 2", 3.5},
+		{"-7 % 3", float64(2)},
+		{"7 % -3", float64(-2)},
+		{"{^2015-02-03} + 30", time.Date(2015, 3, 5, 0, 0, 0, 0, time.UTC)},
+		{"1 + {^2015-02-03}", time.Date(2015, 2, 4, 0, 0, 0, 0, time.UTC)},
+		{"{^2015-02-03} - 3", time.Date(2015, 1, 31, 0, 0, 0, 0, time.UTC)},
+		{"{^2015-03-01} - {^2015-02-01}", float64(28)},
+		{"{^2015-02-03 12:00:00} + 90", time.Date(2015, 2, 3, 12, 1, 30, 0, time.UTC)},
+		{"{^2015-02-03 12:00:00} - {^2015-02-03 11:00:00}", float64(3600)},
+		{"{} + 1", time.Time{}},
+		{"{} - {^2015-02-03}", float64(0)},
+		{"'ab' $ 'cabd'", true},
+		{"'x' $ 'cabd'", false},
+	})
+}
+
+func TestComparisons(t *testing.T) {
+	evalTests(t, []struct {
+		src  string
+		want interface{}
+	}{
+		// SET EXACT OFF
+		{"'abc' = 'ab'", true},
+		{"'ab' = 'abc'", false},
+		{"'ab' = 'ab  '", true},
+		{"'abc' = ''", true},
+		{"'abc' <> 'ab'", false},
+		{"'abc' # 'abd'", true},
+		{"'abc' != 'abc'", false},
+		{"'abc' == 'ab'", false},
+		{"'ab' == 'ab'", true},
+		{"'ab' < 'ab '", false},
+		{"'ab' <= 'ab '", true},
+		{"'ab' < 'abc'", true},
+		{"'b' > 'abc'", true},
+		{"'a' >= 'b'", false},
+		{"1 < 2", true},
+		{"2 <= 2", true},
+		{"3 > 2", true},
+		{"2 >= 3", false},
+		{"1 = 1.0", true},
+		{"1 <> 2", true},
+		{"{^2015-02-03} < {^2015-02-04}", true},
+		{"{^2015-02-03} = {^2015-02-03 00:00:00}", true},
+		{"{} < {^2015-02-03}", true},
+		{".T. = .T.", true},
+		{".T. == .F.", false},
+		{".T. <> .F.", true},
+		{".T. # .T.", false},
+	})
+}
@@ -0,0 +1,165 @@
+// Package expr parses and evaluates FoxPro expressions, like the key and FOR expressions of CDX index tags.
+//
+// A useful subset of the FoxPro expression language is supported:
+//
+//	literals     123, 1.5, 'text', "text", [text], .T., .F., {^2015-02-03}, {^2015-02-03 12:00:00} and {} (empty date)
+//	operators    + - * / % ^ **, = == <> != # < > <= >= $, .AND. .OR. .NOT. !
+//	functions    UPPER, LOWER, TRIM, RTRIM, LTRIM, ALLTRIM, LEFT, RIGHT, SUBSTR, PADL, PADR, PADC, LEN, AT,
+//	             STRTRAN, SPACE, REPLICATE, CHR, ASC, STR, VAL, BINTOC, DTOS, DTOC, TTOC, TTOD, DTOT, DATE,
+//	             YEAR, MONTH, DAY, ABS, INT, ROUND, MOD, CEILING, FLOOR, MAX, MIN, IIF, EMPTY, BETWEEN,
+//	             INLIST and DELETED
+//	fields       NAAM, alias.NAAM or alias->NAAM
+//
+// Names of fields and functions are case insensitive and functions can be abbreviated to 4 characters, like FoxPro allows.
+// String comparisons with = follow SET EXACT OFF: the left operand is compared up to the length of the right operand.
+// Use == for an exact comparison.
+//
+// Expressions are typed when they are compiled, Eval returns a string for Character expressions, a float64 for
+// Numeric expressions, a time.Time for Date and DateTime expressions and a bool for Logical expressions.
+// This package does not depend on the dbf package, use DBF.CompileExpr to compile an expression for a table.
+package expr
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Type is the type of an expression
+type Type int
+
+// Expression types
+const (
+	Character Type = iota
+	Numeric
+	Date
+	DateTime
+	Logical
+)
+
+// String returns the FoxPro type letter
+func (t Type) String() string {
+	switch t {
+	case Character:
+		return "C"
+	case Numeric:
+		return "N"
+	case Date:
+		return "D"
+	case DateTime:
+		return "T"
+	case Logical:
+		return "L"
+	default:
+		return "?"
+	}
+}
+
+// Field describes a field that can be referenced in an expression
+type Field struct {
+	Name string // Field name
+	Type byte   // DBF field type, like 'C' or 'N'
+}
+
+// Record is the record an expression is evaluated against, it is implemented by *dbf.Record
+type Record interface {
+	// Field returns the value of the field at position pos in the fields passed to Compile
+	Field(pos int) (interface{}, error)
+	// IsDeleted returns if the record is deleted, used by DELETED()
+	IsDeleted() bool
+}
+
+// SyntaxError is returned by Compile when the expression cannot be parsed or is not typed correctly
+type SyntaxError struct {
+	Expr string // The expression
+	Pos  int    // Byte offset of the error in the expression
+	Msg  string // Description of the error
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("expr: %s at position %d in %q", e.Msg, e.Pos, e.Expr)
+}
+
+// Expr is a compiled expression, it can be evaluated concurrently
+type Expr struct {
+	src  string
+	root node
+}
+
+// Compile parses expression src, field references are resolved using fields.
+// Errors are returned as *SyntaxError.
+func Compile(src string, fields []Field) (*Expr, error) {
+	p := &parser{src: src, fields: fields}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	root, err := p.parseExpr(0)
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokEOF {
+		return nil, p.errorf(p.tok.pos, "unexpected %s", p.tok)
+	}
+	return &Expr{src: src, root: root}, nil
+}
+
+// MustCompile is like Compile but panics if the expression cannot be compiled
+func MustCompile(src string, fields []Field) *Expr {
+	e, err := Compile(src, fields)
+	if err != nil {
+		panic(err)
+	}
+	return e
+}
+
+// String returns the source of the expression
+func (e *Expr) String() string {
+	return e.src
+}
+
+// Type returns the type of the expression result
+func (e *Expr) Type() Type {
+	return e.root.typ()
+}
+
+// Eval evaluates the expression for rec, rec can be nil if the expression does not reference fields
+func (e *Expr) Eval(rec Record) (interface{}, error) {
+	return e.root.eval(rec)
+}
+
+// EvalBool evaluates a Logical expression, like a FOR or filter expression
+func (e *Expr) EvalBool(rec Record) (bool, error) {
+	if e.root.typ() != Logical {
+		return false, fmt.Errorf("expr: %q is not a logical expression", e.src)
+	}
+	v, err := e.root.eval(rec)
+	if err != nil {
+		return false, err
+	}
+	return v.(bool), nil
+}
+
+// fieldType returns the expression type of DBF field type t
+func fieldType(t byte) Type {
+	switch t {
+	case 'N', 'F', 'B', 'Y', 'I':
+		return Numeric
+	case 'D':
+		return Date
+	case 'T':
+		return DateTime
+	case 'L':
+		return Logical
+	default:
+		return Character
+	}
+}
+
+// fieldPos returns the position of field name in fields, case insensitive, or -1
+func fieldPos(fields []Field, name string) int {
+	for i, f := range fields {
+		if strings.EqualFold(f.Name, name) {
+			return i
+		}
+	}
+	return -1
+}
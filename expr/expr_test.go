@@ -0,0 +1,204 @@
+package expr
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// testRecord implements Record for the fields in testFields
+type testRecord struct {
+	vals    []interface{}
+	deleted bool
+}
+
+func (r *testRecord) Field(pos int) (interface{}, error) {
+	if pos < 0 || pos >= len(r.vals) {
+		return nil, errors.New("invalid field")
+	}
+	return r.vals[pos], nil
+}
+
+func (r *testRecord) IsDeleted() bool {
+	return r.deleted
+}
+
+var testFields = []Field{
+	{Name: "NAAM", Type: 'C'},
+	{Name: "NR", Type: 'N'},
+	{Name: "DATUM", Type: 'D'},
+	{Name: "TIJD", Type: 'T'},
+	{Name: "ACTIEF", Type: 'L'},
+	{Name: "ID", Type: 'I'},
+	{Name: "MEMO", Type: 'M'},
+	{Name: "BEDRAG", Type: 'Y'},
+}
+
+func testRec() *testRecord {
+	return &testRecord{vals: []interface{}{
+		"Jansen    ",
+		int64(42),
+		time.Date(2015, 2, 3, 0, 0, 0, 0, time.UTC),
+		time.Date(2015, 2, 3, 14, 5, 6, 0, time.UTC),
+		true,
+		int32(-7),
+		[]byte("memo text"),
+		12.5,
+	}}
+}
+
+func TestCompileEval(t *testing.T) {
+	tests := []struct {
+		src  string
+		typ  Type
+		want interface{}
+	}{
+		{"UPPER(NAAM)+DTOS(DATUM)", Character, "JANSEN    20150203"},
+		{"STR(NR,6)", Character, "    42"},
+		{"naam", Character, "Jansen    "},
+		{"t.NAAM", Character, "Jansen    "},
+		{"t->nr + 1", Numeric, float64(43)},
+		{"ID", Numeric, float64(-7)},
+		{"MEMO", Character, "memo text"},
+		{"BEDRAG * 2", Numeric, float64(25)},
+		{"ACTIEF .AND. NR > 40", Logical, true},
+		{"DATUM = {^2015-02-03}", Logical, true},
+		{"TIJD > DATUM", Logical, true},
+		{"TTOD(TIJD) = DATUM", Logical, true},
+		{"DELETED()", Logical, false},
+		{"IIF(ACTIEF, 'ja', 'nee')", Character, "ja"},
+	}
+	rec := testRec()
+	for _, test := range tests {
+		e, err := Compile(test.src, testFields)
+		if err != nil {
+			t.Errorf("Compile(%q): %s", test.src, err)
+			continue
+		}
+		if e.Type() != test.typ {
+			t.Errorf("%q: want type %s, have %s", test.src, test.typ, e.Type())
+		}
+		if e.String() != test.src {
+			t.Errorf("%q: String() returned %q", test.src, e.String())
+		}
+		v, err := e.Eval(rec)
+		if err != nil {
+			t.Errorf("Eval(%q): %s", test.src, err)
+			continue
+		}
+		if v != test.want {
+			t.Errorf("%q: want %#v, have %#v", test.src, test.want, v)
+		}
+	}
+}
+
+func TestEvalNull(t *testing.T) {
+	rec := &testRecord{vals: make([]interface{}, len(testFields))}
+	e := MustCompile("EMPTY(NAAM) .AND. EMPTY(NR) .AND. EMPTY(DATUM) .AND. EMPTY(TIJD) .AND. !ACTIEF", testFields)
+	ok, err := e.EvalBool(rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Error("want null values to be empty")
+	}
+}
+
+func TestEvalBool(t *testing.T) {
+	rec := testRec()
+	ok, err := MustCompile("NR = 42", testFields).EvalBool(rec)
+	if err != nil || !ok {
+		t.Errorf("want true, have %v, %v", ok, err)
+	}
+	if _, err := MustCompile("NR", testFields).EvalBool(rec); err == nil {
+		t.Error("want error for numeric expression")
+	}
+
+	rec.deleted = true
+	ok, err = MustCompile("DELE()", testFields).EvalBool(rec)
+	if err != nil || !ok {
+		t.Errorf("want DELETED() to be true, have %v, %v", ok, err)
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	if _, err := MustCompile("NR / 0", testFields).Eval(testRec()); err != ErrDivisionByZero {
+		t.Errorf("want ErrDivisionByZero, have %v", err)
+	}
+	if _, err := MustCompile("NAAM", testFields).Eval(nil); err == nil {
+		t.Error("want error evaluating field without record")
+	}
+	if _, err := MustCompile("NAAM", testFields).Eval(&testRecord{vals: []interface{}{42}}); err == nil {
+		t.Error("want error for field value of wrong type")
+	}
+	v, err := MustCompile("1 + 2", nil).Eval(nil)
+	if err != nil || v != float64(3) {
+		t.Errorf("want 3, have %v, %v", v, err)
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		src string
+		pos int
+	}{
+		{"", 0},
+		{"NAAM +", 6},
+		{"ONBEKEND", 0},
+		{"NAAM + NR", 5},
+		{"NR .AND. .T.", 3},
+		{"UPPER(NR)", 0},
+		{"UPPER(NAAM", 10},
+		{"NOFUNC(1)", 0},
+		{"'open", 0},
+		{"{2015-02-03}", 0},
+		{"{^2015-13-03}", 0},
+		{"NR 1", 3},
+		{"IIF(ACTIEF, 1, 'a')", 0},
+		{"MAX(1, 'a')", 0},
+		{"LEFT('a')", 0},
+		{"-NAAM", 0},
+		{".NOT. NR", 0},
+		{"NR @ 1", 3},
+		{".T. < .F.", 4},
+	}
+	for _, test := range tests {
+		_, err := Compile(test.src, testFields)
+		var serr *SyntaxError
+		if !errors.As(err, &serr) {
+			t.Errorf("Compile(%q): want *SyntaxError, have %v", test.src, err)
+			continue
+		}
+		if serr.Pos != test.pos {
+			t.Errorf("Compile(%q): want position %d, have %d (%s)", test.src, test.pos, serr.Pos, serr)
+		}
+	}
+}
+
+func TestMustCompilePanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("want panic")
+		}
+	}()
+	MustCompile("(", nil)
+}
+
+func TestTypeString(t *testing.T) {
+	for typ, want := range map[Type]string{Character: "C", Numeric: "N", Date: "D", DateTime: "T", Logical: "L", Type(99): "?"} {
+		if typ.String() != want {
+			t.Errorf("want %s, have %s", want, typ.String())
+		}
+	}
+}
+
+func BenchmarkEval(b *testing.B) {
+	e := MustCompile("UPPER(NAAM)+DTOS(DATUM)+STR(NR,6)", testFields)
+	rec := testRec()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := e.Eval(rec); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,548 @@
+package expr
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// kinds is a set of types accepted for a function argument
+type kinds uint8
+
+const (
+	kC    kinds = 1 << Character
+	kN    kinds = 1 << Numeric
+	kD    kinds = 1 << Date
+	kT    kinds = 1 << DateTime
+	kL    kinds = 1 << Logical
+	kTime       = kD | kT
+	kAny        = kC | kN | kD | kT | kL
+)
+
+// sameType is used as result type for functions returning the type of their arguments, like MAX
+const sameType Type = -1
+
+// funcDef defines a function, calls are type checked using args
+type funcDef struct {
+	args     []kinds // accepted types per argument
+	min      int     // minimum number of arguments, len(args) is the maximum unless variadic is set
+	variadic bool    // the last argument can be repeated
+	same     int     // if set, the arguments from position same (one based) must be of the same type
+	ret      Type    // result type, or sameType
+	fn       func(vals []interface{}) (interface{}, error)
+}
+
+var funcs map[string]*funcDef
+
+// funcNames contains the sorted names of all functions, used to resolve abbreviations
+var funcNames []string
+
+func init() {
+	trim := func(vals []interface{}) (interface{}, error) {
+		return strings.TrimRight(vals[0].(string), " "), nil
+	}
+	funcs = map[string]*funcDef{
+		"UPPER": {args: []kinds{kC}, min: 1, ret: Character, fn: func(vals []interface{}) (interface{}, error) {
+			return strings.ToUpper(vals[0].(string)), nil
+		}},
+		"LOWER": {args: []kinds{kC}, min: 1, ret: Character, fn: func(vals []interface{}) (interface{}, error) {
+			return strings.ToLower(vals[0].(string)), nil
+		}},
+		"TRIM":  {args: []kinds{kC}, min: 1, ret: Character, fn: trim},
+		"RTRIM": {args: []kinds{kC}, min: 1, ret: Character, fn: trim},
+		"LTRIM": {args: []kinds{kC}, min: 1, ret: Character, fn: func(vals []interface{}) (interface{}, error) {
+			return strings.TrimLeft(vals[0].(string), " "), nil
+		}},
+		"ALLTRIM": {args: []kinds{kC}, min: 1, ret: Character, fn: func(vals []interface{}) (interface{}, error) {
+			return strings.Trim(vals[0].(string), " "), nil
+		}},
+		"LEFT": {args: []kinds{kC, kN}, min: 2, ret: Character, fn: func(vals []interface{}) (interface{}, error) {
+			return substr(vals[0].(string), 1, intArg(vals[1])), nil
+		}},
+		"RIGHT": {args: []kinds{kC, kN}, min: 2, ret: Character, fn: func(vals []interface{}) (interface{}, error) {
+			s, n := vals[0].(string), intArg(vals[1])
+			l := utf8.RuneCountInString(s)
+			if n > l {
+				n = l
+			}
+			return substr(s, l-n+1, n), nil
+		}},
+		"SUBSTR": {args: []kinds{kC, kN, kN}, min: 2, ret: Character, fn: func(vals []interface{}) (interface{}, error) {
+			s := vals[0].(string)
+			n := utf8.RuneCountInString(s)
+			if len(vals) > 2 {
+				n = intArg(vals[2])
+			}
+			return substr(s, intArg(vals[1]), n), nil
+		}},
+		"PADL": {args: []kinds{kC, kN, kC}, min: 2, ret: Character, fn: func(vals []interface{}) (interface{}, error) {
+			return pad(vals, 'L'), nil
+		}},
+		"PADR": {args: []kinds{kC, kN, kC}, min: 2, ret: Character, fn: func(vals []interface{}) (interface{}, error) {
+			return pad(vals, 'R'), nil
+		}},
+		"PADC": {args: []kinds{kC, kN, kC}, min: 2, ret: Character, fn: func(vals []interface{}) (interface{}, error) {
+			return pad(vals, 'C'), nil
+		}},
+		"LEN": {args: []kinds{kC}, min: 1, ret: Numeric, fn: func(vals []interface{}) (interface{}, error) {
+			return float64(utf8.RuneCountInString(vals[0].(string))), nil
+		}},
+		"SPACE": {args: []kinds{kN}, min: 1, ret: Character, fn: func(vals []interface{}) (interface{}, error) {
+			return strings.Repeat(" ", nonNegative(intArg(vals[0]))), nil
+		}},
+		"REPLICATE": {args: []kinds{kC, kN}, min: 2, ret: Character, fn: func(vals []interface{}) (interface{}, error) {
+			return strings.Repeat(vals[0].(string), nonNegative(intArg(vals[1]))), nil
+		}},
+		"AT": {args: []kinds{kC, kC, kN}, min: 2, ret: Numeric, fn: func(vals []interface{}) (interface{}, error) {
+			occurrence := 1
+			if len(vals) > 2 {
+				occurrence = intArg(vals[2])
+			}
+			return float64(at(vals[0].(string), vals[1].(string), occurrence)), nil
+		}},
+		"STRTRAN": {args: []kinds{kC, kC, kC}, min: 2, ret: Character, fn: func(vals []interface{}) (interface{}, error) {
+			s, old := vals[0].(string), vals[1].(string)
+			if old == "" {
+				return s, nil
+			}
+			repl := ""
+			if len(vals) > 2 {
+				repl = vals[2].(string)
+			}
+			return strings.Replace(s, old, repl, -1), nil
+		}},
+		"CHR": {args: []kinds{kN}, min: 1, ret: Character, fn: func(vals []interface{}) (interface{}, error) {
+			n := intArg(vals[0])
+			if n < 0 || n > 255 {
+				return nil, fmt.Errorf("expr: CHR(%d) out of range", n)
+			}
+			return string(rune(n)), nil
+		}},
+		"ASC": {args: []kinds{kC}, min: 1, ret: Numeric, fn: func(vals []interface{}) (interface{}, error) {
+			r, _ := utf8.DecodeRuneInString(vals[0].(string))
+			if r == utf8.RuneError {
+				return float64(0), nil
+			}
+			return float64(r), nil
+		}},
+		"STR": {args: []kinds{kN, kN, kN}, min: 1, ret: Character, fn: func(vals []interface{}) (interface{}, error) {
+			length, dec := 10, 0
+			if len(vals) > 1 {
+				length = intArg(vals[1])
+			}
+			if len(vals) > 2 {
+				dec = intArg(vals[2])
+			}
+			return str(vals[0].(float64), length, dec), nil
+		}},
+		"VAL": {args: []kinds{kC}, min: 1, ret: Numeric, fn: func(vals []interface{}) (interface{}, error) {
+			return val(vals[0].(string)), nil
+		}},
+		"BINTOC": {args: []kinds{kN, kN}, min: 1, ret: Character, fn: func(vals []interface{}) (interface{}, error) {
+			size := 4
+			if len(vals) > 1 {
+				size = intArg(vals[1])
+			}
+			return bintoc(vals[0].(float64), size)
+		}},
+		"DTOS": {args: []kinds{kTime}, min: 1, ret: Character, fn: func(vals []interface{}) (interface{}, error) {
+			return dtos(vals[0].(time.Time)), nil
+		}},
+		"DTOC": {args: []kinds{kTime, kN}, min: 1, ret: Character, fn: func(vals []interface{}) (interface{}, error) {
+			t := vals[0].(time.Time)
+			if len(vals) > 1 && intArg(vals[1]) == 1 {
+				return dtos(t), nil
+			}
+			if t.IsZero() {
+				return "  /  /    ", nil
+			}
+			return t.Format("01/02/2006"), nil
+		}},
+		"TTOC": {args: []kinds{kTime, kN}, min: 1, ret: Character, fn: func(vals []interface{}) (interface{}, error) {
+			t := vals[0].(time.Time)
+			format := 0
+			if len(vals) > 1 {
+				format = intArg(vals[1])
+			}
+			switch {
+			case format == 1 && t.IsZero():
+				return strings.Repeat(" ", 14), nil
+			case format == 1:
+				return t.Format("20060102150405"), nil
+			case t.IsZero():
+				return "", nil
+			case format == 2:
+				return t.Format("03:04:05 PM"), nil
+			default:
+				return t.Format("01/02/2006 03:04:05 PM"), nil
+			}
+		}},
+		"TTOD": {args: []kinds{kTime}, min: 1, ret: Date, fn: func(vals []interface{}) (interface{}, error) {
+			t := vals[0].(time.Time)
+			if t.IsZero() {
+				return t, nil
+			}
+			return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location()), nil
+		}},
+		"DTOT": {args: []kinds{kTime}, min: 1, ret: DateTime, fn: func(vals []interface{}) (interface{}, error) {
+			return vals[0], nil
+		}},
+		"DATE": {args: []kinds{kN, kN, kN}, min: 0, ret: Date, fn: date},
+		"YEAR": {args: []kinds{kTime}, min: 1, ret: Numeric, fn: func(vals []interface{}) (interface{}, error) {
+			return datePart(vals[0].(time.Time), 'Y'), nil
+		}},
+		"MONTH": {args: []kinds{kTime}, min: 1, ret: Numeric, fn: func(vals []interface{}) (interface{}, error) {
+			return datePart(vals[0].(time.Time), 'M'), nil
+		}},
+		"DAY": {args: []kinds{kTime}, min: 1, ret: Numeric, fn: func(vals []interface{}) (interface{}, error) {
+			return datePart(vals[0].(time.Time), 'D'), nil
+		}},
+		"ABS": {args: []kinds{kN}, min: 1, ret: Numeric, fn: func(vals []interface{}) (interface{}, error) {
+			return math.Abs(vals[0].(float64)), nil
+		}},
+		"INT": {args: []kinds{kN}, min: 1, ret: Numeric, fn: func(vals []interface{}) (interface{}, error) {
+			return math.Trunc(vals[0].(float64)), nil
+		}},
+		"ROUND": {args: []kinds{kN, kN}, min: 2, ret: Numeric, fn: func(vals []interface{}) (interface{}, error) {
+			return round(vals[0].(float64), intArg(vals[1])), nil
+		}},
+		"MOD": {args: []kinds{kN, kN}, min: 2, ret: Numeric, fn: func(vals []interface{}) (interface{}, error) {
+			return mod(vals[0].(float64), vals[1].(float64))
+		}},
+		"CEILING": {args: []kinds{kN}, min: 1, ret: Numeric, fn: func(vals []interface{}) (interface{}, error) {
+			return math.Ceil(vals[0].(float64)), nil
+		}},
+		"FLOOR": {args: []kinds{kN}, min: 1, ret: Numeric, fn: func(vals []interface{}) (interface{}, error) {
+			return math.Floor(vals[0].(float64)), nil
+		}},
+		"MAX": {args: []kinds{kC | kN | kTime}, min: 2, variadic: true, same: 1, ret: sameType, fn: func(vals []interface{}) (interface{}, error) {
+			return extreme(">", vals), nil
+		}},
+		"MIN": {args: []kinds{kC | kN | kTime}, min: 2, variadic: true, same: 1, ret: sameType, fn: func(vals []interface{}) (interface{}, error) {
+			return extreme("<", vals), nil
+		}},
+		"EMPTY": {args: []kinds{kAny}, min: 1, ret: Logical, fn: func(vals []interface{}) (interface{}, error) {
+			return empty(vals[0]), nil
+		}},
+		"BETWEEN": {args: []kinds{kC | kN | kTime, kC | kN | kTime, kC | kN | kTime}, min: 3, same: 1, ret: Logical, fn: func(vals []interface{}) (interface{}, error) {
+			return compare(">=", vals[0], vals[1]) && compare("<=", vals[0], vals[2]), nil
+		}},
+		"INLIST": {args: []kinds{kAny}, min: 2, variadic: true, same: 1, ret: Logical, fn: func(vals []interface{}) (interface{}, error) {
+			for _, v := range vals[1:] {
+				if compare("=", vals[0], v) {
+					return true, nil
+				}
+			}
+			return false, nil
+		}},
+	}
+	// functions handled by call
+	funcs["IIF"] = nil
+	funcs["DELETED"] = nil
+
+	for name := range funcs {
+		funcNames = append(funcNames, name)
+	}
+	sort.Strings(funcNames)
+}
+
+// lookupFunc returns the function name, names can be abbreviated to at least 4 characters
+func lookupFunc(name string) (string, bool) {
+	if _, ok := funcs[name]; ok {
+		return name, true
+	}
+	if len(name) < 4 {
+		return "", false
+	}
+	for _, fn := range funcNames {
+		if strings.HasPrefix(fn, name) {
+			return fn, true
+		}
+	}
+	return "", false
+}
+
+// call returns the node for a call of function name with args, the argument types are checked
+func (p *parser) call(name token, args []node) (node, error) {
+	fname, ok := lookupFunc(name.text)
+	if !ok {
+		return nil, p.errorf(name.pos, "unknown function %s", name.text)
+	}
+
+	switch fname {
+	case "DELETED":
+		if len(args) != 0 {
+			return nil, p.errorf(name.pos, "function DELETED expects no arguments")
+		}
+		return deletedNode{}, nil
+	case "IIF":
+		if len(args) != 3 {
+			return nil, p.errorf(name.pos, "function IIF expects 3 arguments, got %d", len(args))
+		}
+		if args[0].typ() != Logical {
+			return nil, p.errorf(name.pos, "function IIF expects a logical condition, got %s", args[0].typ())
+		}
+		if args[1].typ() != args[2].typ() {
+			return nil, p.errorf(name.pos, "function IIF expects values of the same type, got %s and %s", args[1].typ(), args[2].typ())
+		}
+		return iifNode{cond: args[0], a: args[1], b: args[2]}, nil
+	}
+
+	def := funcs[fname]
+	if len(args) < def.min || len(args) > len(def.args) && !def.variadic {
+		return nil, p.errorf(name.pos, "function %s called with %d arguments", fname, len(args))
+	}
+	for i, arg := range args {
+		k := def.args[len(def.args)-1]
+		if i < len(def.args) {
+			k = def.args[i]
+		}
+		if k&(1<<uint(arg.typ())) == 0 {
+			return nil, p.errorf(name.pos, "function %s does not accept type %s for argument %d", fname, arg.typ(), i+1)
+		}
+		if def.same > 0 && i >= def.same && arg.typ() != args[def.same-1].typ() {
+			return nil, p.errorf(name.pos, "function %s expects arguments of the same type, got %s and %s", fname, args[def.same-1].typ(), arg.typ())
+		}
+	}
+	ret := def.ret
+	if ret == sameType {
+		ret = args[def.same-1].typ()
+	}
+	return funcNode{t: ret, args: args, fn: def.fn}, nil
+}
+
+// iifNode implements IIF, only the selected value is evaluated
+type iifNode struct {
+	cond, a, b node
+}
+
+func (n iifNode) typ() Type { return n.a.typ() }
+
+func (n iifNode) eval(rec Record) (interface{}, error) {
+	c, err := n.cond.eval(rec)
+	if err != nil {
+		return nil, err
+	}
+	if c.(bool) {
+		return n.a.eval(rec)
+	}
+	return n.b.eval(rec)
+}
+
+// deletedNode implements DELETED()
+type deletedNode struct{}
+
+func (deletedNode) typ() Type { return Logical }
+
+func (deletedNode) eval(rec Record) (interface{}, error) {
+	if rec == nil {
+		return false, nil
+	}
+	return rec.IsDeleted(), nil
+}
+
+// intArg converts a numeric argument to int, the fraction is discarded
+func intArg(v interface{}) int {
+	return int(v.(float64))
+}
+
+func nonNegative(n int) int {
+	if n < 0 {
+		return 0
+	}
+	return n
+}
+
+// substr returns n characters of s starting at character start (one based)
+func substr(s string, start, n int) string {
+	r := []rune(s)
+	if start < 1 || start > len(r) || n <= 0 {
+		return ""
+	}
+	end := start - 1 + n
+	if end > len(r) {
+		end = len(r)
+	}
+	return string(r[start-1 : end])
+}
+
+// pad implements PADL, PADR and PADC, values longer than the length are truncated
+func pad(vals []interface{}, side byte) string {
+	r, n := []rune(vals[0].(string)), nonNegative(intArg(vals[1]))
+	fill := " "
+	if len(vals) > 2 && vals[2].(string) != "" {
+		fill = string([]rune(vals[2].(string))[:1])
+	}
+	if len(r) >= n {
+		return string(r[:n])
+	}
+	missing := n - len(r)
+	switch side {
+	case 'L':
+		return strings.Repeat(fill, missing) + string(r)
+	case 'R':
+		return string(r) + strings.Repeat(fill, missing)
+	default:
+		left := missing / 2
+		return strings.Repeat(fill, left) + string(r) + strings.Repeat(fill, missing-left)
+	}
+}
+
+// at returns the character position (one based) of the occurrence of search in s, or 0
+func at(search, s string, occurrence int) int {
+	if search == "" || occurrence < 1 {
+		return 0
+	}
+	offset := 0
+	for {
+		i := strings.Index(s[offset:], search)
+		if i < 0 {
+			return 0
+		}
+		occurrence--
+		if occurrence == 0 {
+			return utf8.RuneCountInString(s[:offset+i]) + 1
+		}
+		offset += i + len(search)
+	}
+}
+
+// round rounds n to dec decimals, halves are rounded away from zero
+func round(n float64, dec int) float64 {
+	p := math.Pow(10, float64(dec))
+	r := math.Round(n*p) / p
+	if r == 0 {
+		// no negative zero
+		return 0
+	}
+	return r
+}
+
+// str implements STR, numbers are right aligned and decimals are dropped when the number does not fit.
+// If the integer part does not fit the result is filled with asterisks.
+func str(n float64, length, dec int) string {
+	if length <= 0 {
+		return ""
+	}
+	if dec < 0 {
+		dec = 0
+	}
+	for d := dec; d >= 0; d-- {
+		s := strconv.FormatFloat(round(n, d), 'f', d, 64)
+		if len(s) <= length {
+			return strings.Repeat(" ", length-len(s)) + s
+		}
+	}
+	return strings.Repeat("*", length)
+}
+
+// val implements VAL, the leading number in s is returned or 0 if s does not start with a number
+func val(s string) float64 {
+	s = strings.TrimLeft(s, " ")
+	end := 0
+	if end < len(s) && (s[end] == '-' || s[end] == '+') {
+		end++
+	}
+	for end < len(s) && isDigit(s[end]) {
+		end++
+	}
+	if end < len(s) && s[end] == '.' {
+		end++
+		for end < len(s) && isDigit(s[end]) {
+			end++
+		}
+	}
+	v, err := strconv.ParseFloat(strings.TrimSuffix(s[:end], "."), 64)
+	if err != nil {
+		return 0
+	}
+	return v
+}
+
+// bintoc implements BINTOC, the integer is stored big endian with the sign bit flipped so the keys sort correctly
+func bintoc(n float64, size int) (interface{}, error) {
+	if size != 1 && size != 2 && size != 4 && size != 8 {
+		return nil, fmt.Errorf("expr: BINTOC size %d is not 1, 2, 4 or 8", size)
+	}
+	bits := uint(size * 8)
+	v := int64(n)
+	if size < 8 && (v < -(1<<(bits-1)) || v >= 1<<(bits-1)) {
+		return nil, fmt.Errorf("expr: BINTOC value %v does not fit in %d bytes", n, size)
+	}
+	u := uint64(v) ^ 1<<(bits-1)
+	b := make([]byte, size)
+	for i := range b {
+		b[i] = byte(u >> (uint(size-1-i) * 8))
+	}
+	return string(b), nil
+}
+
+// dtos implements DTOS, empty dates return 8 spaces
+func dtos(t time.Time) string {
+	if t.IsZero() {
+		return "        "
+	}
+	return t.Format("20060102")
+}
+
+// date implements DATE() for the current date and DATE(year, month, day)
+func date(vals []interface{}) (interface{}, error) {
+	if len(vals) == 0 {
+		now := time.Now()
+		return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC), nil
+	}
+	if len(vals) != 3 {
+		return nil, fmt.Errorf("expr: DATE expects 0 or 3 arguments, got %d", len(vals))
+	}
+	y, m, d := intArg(vals[0]), intArg(vals[1]), intArg(vals[2])
+	t := time.Date(y, time.Month(m), d, 0, 0, 0, 0, time.UTC)
+	if t.Year() != y || int(t.Month()) != m || t.Day() != d {
+		return nil, fmt.Errorf("expr: invalid date %04d-%02d-%02d", y, m, d)
+	}
+	return t, nil
+}
+
+// datePart implements YEAR, MONTH and DAY, empty dates return 0
+func datePart(t time.Time, part byte) float64 {
+	if t.IsZero() {
+		return 0
+	}
+	switch part {
+	case 'Y':
+		return float64(t.Year())
+	case 'M':
+		return float64(t.Month())
+	default:
+		return float64(t.Day())
+	}
+}
+
+// extreme returns the largest value for op > or the smallest value for op <
+func extreme(op string, vals []interface{}) interface{} {
+	v := vals[0]
+	for _, w := range vals[1:] {
+		if compare(op, w, v) {
+			v = w
+		}
+	}
+	return v
+}
+
+// empty implements EMPTY
+func empty(v interface{}) bool {
+	switch x := v.(type) {
+	case string:
+		return strings.TrimLeft(x, " \t\r\n") == ""
+	case float64:
+		return x == 0
+	case time.Time:
+		return x.IsZero()
+	case bool:
+		return !x
+	}
+	return true
+}
@@ -0,0 +1,138 @@
+package expr
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFuncs(t *testing.T) {
+	evalTests(t, []struct {
+		src  string
+		want interface{}
+	}{
+		{"UPPER('aBc')", "ABC"},
+		{"lower('aBc')", "abc"},
+		{"TRIM(' ab  ')", " ab"},
+		{"RTRIM(' ab  ')", " ab"},
+		{"LTRIM(' ab  ')", "ab  "},
+		{"ALLTRIM(' ab  ')", "ab"},
+		{"ALLT(' ab  ')", "ab"},
+		{"LEFT('abcdef', 2)", "ab"},
+		{"LEFT('ab', 5)", "ab"},
+		{"LEFT('ab', -1)", ""},
+		{"RIGHT('abcdef', 2)", "ef"},
+		{"RIGHT('ab', 5)", "ab"},
+		{"SUBSTR('abcdef', 2, 3)", "bcd"},
+		{"SUBS('abcdef', 4)", "def"},
+		{"SUBSTR('abcdef', 10)", ""},
+		{"SUBSTR('Tësting', 2, 2)", "ës"},
+		{"PADL('ab', 4)", "  ab"},
+		{"PADR('ab', 4, '*')", "ab**"},
+		{"PADC('ab', 5, '-')", "-ab--"},
+		{"PADL('abcdef', 3)", "abc"},
+		{"LEN('Tësting')", float64(7)},
+		{"SPACE(3)", "   "},
+		{"REPLICATE('ab', 3)", "ababab"},
+		{"REPL('ab', -1)", ""},
+		{"AT('b', 'abcabc')", float64(2)},
+		{"AT('b', 'abcabc', 2)", float64(5)},
+		{"AT('b', 'abcabc', 3)", float64(0)},
+		{"AT('x', 'abc')", float64(0)},
+		{"AT('', 'abc')", float64(0)},
+		{"STRTRAN('abcabc', 'b', 'xx')", "axxcaxxc"},
+		{"STRTRAN('abcabc', 'b')", "acac"},
+		{"STRTRAN('abc', '', 'x')", "abc"},
+		{"CHR(65)", "A"},
+		{"ASC('A')", float64(65)},
+		{"ASC('')", float64(0)},
+		{"STR(42)", "        42"},
+		{"STR(42, 6)", "    42"},
+		{"STR(1.5, 3)", "  2"},
+		{"STR(-1.5, 3)", " -2"},
+		{"STR(-0.4, 3)", "  0"},
+		{"STR(123.456, 8, 2)", "  123.46"},
+		{"STR(123.456, 5, 2)", "123.5"},
+		{"STR(123456, 3)", "***"},
+		{"STR(1, 0)", ""},
+		{"VAL('  12.5abc')", 12.5},
+		{"VAL('-3')", float64(-3)},
+		{"VAL('12.')", float64(12)},
+		{"VAL('abc')", float64(0)},
+		{"BINTOC(1)", "\x80\x00\x00\x01"},
+		{"BINTOC(-1)", "\x7f\xff\xff\xff"},
+		{"BINTOC(1, 2)", "\x80\x01"},
+		{"BINTOC(-128, 1)", "\x00"},
+		{"BINTOC(0, 8)", "\x80\x00\x00\x00\x00\x00\x00\x00"},
+		{"DTOS({^2015-02-03})", "20150203"},
+		{"DTOS({})", "        "},
+		{"DTOS({^2015-02-03 12:00:00})", "20150203"},
+		{"DTOC({^2015-02-03})", "02/03/2015"},
+		{"DTOC({^2015-02-03}, 1)", "20150203"},
+		{"DTOC({})", "  /  /    "},
+		{"TTOC({^2015-02-03 14:05:06})", "02/03/2015 02:05:06 PM"},
+		{"TTOC({^2015-02-03 14:05:06}, 1)", "20150203140506"},
+		{"TTOC({^2015-02-03 14:05:06}, 2)", "02:05:06 PM"},
+		{"TTOC({}, 1)", "              "},
+		{"TTOC({})", ""},
+		{"TTOD({^2015-02-03 14:05:06})", time.Date(2015, 2, 3, 0, 0, 0, 0, time.UTC)},
+		{"TTOD({})", time.Time{}},
+		{"DTOT({^2015-02-03})", time.Date(2015, 2, 3, 0, 0, 0, 0, time.UTC)},
+		{"DATE(2015, 2, 3)", time.Date(2015, 2, 3, 0, 0, 0, 0, time.UTC)},
+		{"YEAR({^2015-02-03})", float64(2015)},
+		{"MONTH({^2015-02-03})", float64(2)},
+		{"DAY({^2015-02-03})", float64(3)},
+		{"YEAR({})", float64(0)},
+		{"ABS(-2.5)", 2.5},
+		{"INT(-2.5)", float64(-2)},
+		{"ROUND(2.345, 2)", 2.35},
+		{"ROUND(-2.5, 0)", float64(-3)},
+		{"ROUND(1234, -2)", float64(1200)},
+		{"MOD(-7, 3)", float64(2)},
+		{"CEILING(2.1)", float64(3)},
+		{"CEIL(-2.1)", float64(-2)},
+		{"FLOOR(-2.1)", float64(-3)},
+		{"MAX(1, 3, 2)", float64(3)},
+		{"MIN(1, 3, 2)", float64(1)},
+		{"MAX('b', 'a')", "b"},
+		{"MIN({^2015-02-03}, {^2015-01-01})", time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"IIF(1 > 2, 'yes', 'no')", "no"},
+		{"IIF(.T., 1, 1 / 0)", float64(1)},
+		{"EMPTY('  ')", true},
+		{"EMPTY(' a')", false},
+		{"EMPTY(0)", true},
+		{"EMPTY({})", true},
+		{"EMPTY(.F.)", true},
+		{"EMPTY(.T.)", false},
+		{"BETWEEN(2, 1, 3)", true},
+		{"BETWEEN('b', 'a', 'c')", true},
+		{"BETWEEN(4, 1, 3)", false},
+		{"BETWEEN({^2015-02-03}, {^2015-02-01}, {^2015-02-03})", true},
+		{"INLIST(2, 1, 2, 3)", true},
+		{"INLIST('x', 'a', 'b')", false},
+		{"DELETED()", false},
+	})
+}
+
+func TestFuncDate(t *testing.T) {
+	v, err := MustCompile("DATE()", nil).Eval(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	if d := v.(time.Time); d.Year() != now.Year() || d.YearDay() != now.YearDay() && d.YearDay() != now.YearDay()-1 {
+		t.Errorf("DATE() returned %s", d)
+	}
+}
+
+func TestFuncErrors(t *testing.T) {
+	for _, src := range []string{"CHR(256)", "BINTOC(1, 3)", "BINTOC(128, 1)", "DATE(2015, 2, 30)", "DATE(2015, 2)", "MOD(1, 0)"} {
+		if _, err := MustCompile(src, nil).Eval(nil); err == nil {
+			t.Errorf("%s: want error", src)
+		}
+	}
+	for _, src := range []string{"DELETED(1)", "IIF(.T., 1)", "IIF(1, 1, 2)", "UPP('a')", "TRIM('a', 'b')", "BETWEEN(1, 2)", "INLIST(1, 'a')", "MAX(.T., .F.)", "BETWEEN(.T., .F., .T.)"} {
+		if _, err := Compile(src, nil); err == nil {
+			t.Errorf("%s: want compile error", src)
+		}
+	}
+}
@@ -0,0 +1,382 @@
+package expr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// token kinds
+const (
+	tokEOF = iota
+	tokNumber
+	tokString
+	tokDate
+	tokLogical
+	tokIdent
+	tokOp
+	tokLParen
+	tokRParen
+	tokComma
+)
+
+type token struct {
+	kind int
+	pos  int
+	text string      // operator, identifier (upper case) or the source of the token
+	val  interface{} // value of literals
+	typ  Type        // type of literals
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of expression"
+	case tokString:
+		return fmt.Sprintf("string %q", t.val)
+	default:
+		return fmt.Sprintf("%q", t.text)
+	}
+}
+
+// dotted are the words that can be written between dots, like .AND. and .T.
+var dotted = []string{"AND", "OR", "NOT", "T", "F", "Y", "N"}
+
+// parser is a recursive descent parser with a one token lookahead
+type parser struct {
+	src    string
+	fields []Field
+	off    int   // offset of the next token in src
+	tok    token // current token
+}
+
+func (p *parser) errorf(pos int, format string, args ...interface{}) error {
+	return &SyntaxError{Expr: p.src, Pos: pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+// dottedWord returns the word between dots at offset i, like AND for .AND., or an empty string
+func (p *parser) dottedWord(i int) string {
+	for _, w := range dotted {
+		end := i + len(w) + 2
+		if end <= len(p.src) && p.src[i] == '.' && p.src[end-1] == '.' && strings.EqualFold(p.src[i+1:end-1], w) {
+			return w
+		}
+	}
+	return ""
+}
+
+// next reads the next token into p.tok
+func (p *parser) next() error {
+	for p.off < len(p.src) && (p.src[p.off] == ' ' || p.src[p.off] == '\t') {
+		p.off++
+	}
+	start := p.off
+	if start >= len(p.src) {
+		p.tok = token{kind: tokEOF, pos: start}
+		return nil
+	}
+
+	c := p.src[start]
+	switch {
+	case c == '.' && p.dottedWord(start) != "":
+		w := p.dottedWord(start)
+		p.off += len(w) + 2
+		switch w {
+		case "T", "Y":
+			p.tok = token{kind: tokLogical, pos: start, text: p.src[start:p.off], val: true, typ: Logical}
+		case "F", "N":
+			p.tok = token{kind: tokLogical, pos: start, text: p.src[start:p.off], val: false, typ: Logical}
+		default:
+			p.tok = token{kind: tokOp, pos: start, text: w}
+		}
+		return nil
+	case isDigit(c) || c == '.' && start+1 < len(p.src) && isDigit(p.src[start+1]):
+		return p.lexNumber()
+	case c == '\'' || c == '"' || c == '[':
+		end := byte(c)
+		if c == '[' {
+			end = ']'
+		}
+		i := strings.IndexByte(p.src[start+1:], end)
+		if i < 0 {
+			return p.errorf(start, "unterminated string")
+		}
+		p.off = start + i + 2
+		s := p.src[start+1 : start+1+i]
+		p.tok = token{kind: tokString, pos: start, text: p.src[start:p.off], val: s, typ: Character}
+		return nil
+	case c == '{':
+		return p.lexDate()
+	case isIdentStart(c):
+		return p.lexIdent()
+	case c == '(':
+		p.off++
+		p.tok = token{kind: tokLParen, pos: start, text: "("}
+		return nil
+	case c == ')':
+		p.off++
+		p.tok = token{kind: tokRParen, pos: start, text: ")"}
+		return nil
+	case c == ',':
+		p.off++
+		p.tok = token{kind: tokComma, pos: start, text: ","}
+		return nil
+	}
+
+	// operators, the longest match wins
+	for _, op := range []string{"**", "==", "<>", "!=", "<=", ">=", "+", "-", "*", "/", "%", "^", "=", "#", "<", ">", "$", "!"} {
+		if strings.HasPrefix(p.src[start:], op) {
+			p.off += len(op)
+			p.tok = token{kind: tokOp, pos: start, text: op}
+			return nil
+		}
+	}
+	return p.errorf(start, "unexpected character %q", c)
+}
+
+func (p *parser) lexNumber() error {
+	start := p.off
+	for p.off < len(p.src) && isDigit(p.src[p.off]) {
+		p.off++
+	}
+	// a dot is part of the number, unless it starts an operator like .AND.
+	if p.off < len(p.src) && p.src[p.off] == '.' && p.dottedWord(p.off) == "" {
+		p.off++
+		for p.off < len(p.src) && isDigit(p.src[p.off]) {
+			p.off++
+		}
+	}
+	text := p.src[start:p.off]
+	v, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return p.errorf(start, "invalid number %s", text)
+	}
+	p.tok = token{kind: tokNumber, pos: start, text: text, val: v, typ: Numeric}
+	return nil
+}
+
+// lexDate reads date and datetime literals in strict format, {^2015-02-03} or {^2015-02-03 12:00:00}, or {} or {/ /} for an empty date
+func (p *parser) lexDate() error {
+	start := p.off
+	i := strings.IndexByte(p.src[start:], '}')
+	if i < 0 {
+		return p.errorf(start, "unterminated date")
+	}
+	p.off = start + i + 1
+	text := p.src[start:p.off]
+	lit := strings.TrimSpace(text[1 : len(text)-1])
+	if strings.Trim(lit, " ^/:") == "" {
+		p.tok = token{kind: tokDate, pos: start, text: text, val: time.Time{}, typ: Date}
+		return nil
+	}
+	if lit[0] != '^' {
+		return p.errorf(start, "date %s is not in strict format {^yyyy-mm-dd}", text)
+	}
+	lit = strings.TrimSpace(lit[1:])
+	if t, err := time.Parse("2006-01-02", lit); err == nil {
+		p.tok = token{kind: tokDate, pos: start, text: text, val: t, typ: Date}
+		return nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02T15:04:05"} {
+		if t, err := time.Parse(layout, lit); err == nil {
+			p.tok = token{kind: tokDate, pos: start, text: text, val: t, typ: DateTime}
+			return nil
+		}
+	}
+	return p.errorf(start, "invalid date %s", text)
+}
+
+// lexIdent reads an identifier, an alias prefix like alias. or alias-> is skipped
+func (p *parser) lexIdent() error {
+	start := p.off
+	for {
+		identStart := p.off
+		for p.off < len(p.src) && isIdentChar(p.src[p.off]) {
+			p.off++
+		}
+		name := p.src[identStart:p.off]
+		switch {
+		case p.off+1 < len(p.src) && p.src[p.off] == '.' && isIdentStart(p.src[p.off+1]) && p.dottedWord(p.off) == "":
+			p.off++
+		case p.off+2 < len(p.src) && p.src[p.off] == '-' && p.src[p.off+1] == '>' && isIdentStart(p.src[p.off+2]):
+			p.off += 2
+		default:
+			p.tok = token{kind: tokIdent, pos: start, text: strings.ToUpper(name)}
+			return nil
+		}
+	}
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isIdentChar(c byte) bool {
+	return isIdentStart(c) || isDigit(c)
+}
+
+// binary operator precedence, higher binds stronger
+const (
+	precOr = iota + 1
+	precAnd
+	precNot
+	precCompare
+	precAdd
+	precMul
+	precPow
+)
+
+func precedence(t token) int {
+	if t.kind != tokOp {
+		return 0
+	}
+	switch t.text {
+	case "OR":
+		return precOr
+	case "AND":
+		return precAnd
+	case "=", "==", "<>", "!=", "#", "<", ">", "<=", ">=", "$":
+		return precCompare
+	case "+", "-":
+		return precAdd
+	case "*", "/", "%":
+		return precMul
+	case "^", "**":
+		return precPow
+	}
+	return 0
+}
+
+// parseExpr parses binary operators with at least precedence minPrec
+func (p *parser) parseExpr(minPrec int) (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.tok
+		prec := precedence(op)
+		if prec == 0 || prec < minPrec {
+			return left, nil
+		}
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		// powers are right associative, all other operators left associative
+		next := prec + 1
+		if prec == precPow {
+			next = prec
+		}
+		right, err := p.parseExpr(next)
+		if err != nil {
+			return nil, err
+		}
+		if left, err = p.binary(op, left, right); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *parser) parseUnary() (node, error) {
+	op := p.tok
+	if op.kind == tokOp {
+		switch op.text {
+		case "NOT", "!":
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+			x, err := p.parseExpr(precCompare)
+			if err != nil {
+				return nil, err
+			}
+			if x.typ() != Logical {
+				return nil, p.errorf(op.pos, "operator %s expects a logical operand, got %s", op.text, x.typ())
+			}
+			return notNode{x}, nil
+		case "-", "+":
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+			x, err := p.parseExpr(precPow)
+			if err != nil {
+				return nil, err
+			}
+			if x.typ() != Numeric {
+				return nil, p.errorf(op.pos, "operator %s expects a numeric operand, got %s", op.text, x.typ())
+			}
+			if op.text == "+" {
+				return x, nil
+			}
+			return negNode{x}, nil
+		}
+	}
+	return p.parseOperand()
+}
+
+func (p *parser) parseOperand() (node, error) {
+	t := p.tok
+	switch t.kind {
+	case tokNumber, tokString, tokDate, tokLogical:
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		return constNode{t: t.typ, v: t.val}, nil
+	case tokLParen:
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		x, err := p.parseExpr(precOr)
+		if err != nil {
+			return nil, err
+		}
+		if p.tok.kind != tokRParen {
+			return nil, p.errorf(p.tok.pos, "expected ), got %s", p.tok)
+		}
+		return x, p.next()
+	case tokIdent:
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		if p.tok.kind == tokLParen {
+			return p.parseCall(t)
+		}
+		pos := fieldPos(p.fields, t.text)
+		if pos < 0 {
+			return nil, p.errorf(t.pos, "unknown field %s", t.text)
+		}
+		return fieldNode{pos: pos, t: fieldType(p.fields[pos].Type)}, nil
+	}
+	return nil, p.errorf(t.pos, "unexpected %s", t)
+}
+
+// parseCall parses the arguments of function name, the current token is the opening parenthesis
+func (p *parser) parseCall(name token) (node, error) {
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	var args []node
+	for p.tok.kind != tokRParen {
+		if len(args) > 0 {
+			if p.tok.kind != tokComma {
+				return nil, p.errorf(p.tok.pos, "expected , or ), got %s", p.tok)
+			}
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+		}
+		arg, err := p.parseExpr(precOr)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	return p.call(name, args)
+}
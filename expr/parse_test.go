@@ -0,0 +1,105 @@
+package expr
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseLiterals(t *testing.T) {
+	tests := []struct {
+		src  string
+		want interface{}
+	}{
+		{"123", float64(123)},
+		{"1.5", 1.5},
+		{".5", 0.5},
+		{"'single'", "single"},
+		{`"double"`, "double"},
+		{"[brackets]", "brackets"},
+		{".T.", true},
+		{".f.", false},
+		{".Y.", true},
+		{".N.", false},
+		{"{^2015-02-03}", time.Date(2015, 2, 3, 0, 0, 0, 0, time.UTC)},
+		{"{^2015-02-03 12:30:15}", time.Date(2015, 2, 3, 12, 30, 15, 0, time.UTC)},
+		{"{}", time.Time{}},
+		{"{ / / }", time.Time{}},
+	}
+	for _, test := range tests {
+		e, err := Compile(test.src, nil)
+		if err != nil {
+			t.Errorf("Compile(%q): %s", test.src, err)
+			continue
+		}
+		v, err := e.Eval(nil)
+		if err != nil {
+			t.Errorf("Eval(%q): %s", test.src, err)
+			continue
+		}
+		if v != test.want {
+			t.Errorf("%q: want %#v, have %#v", test.src, test.want, v)
+		}
+	}
+}
+
+func TestParseDotted(t *testing.T) {
+	fields := []Field{{Name: "A", Type: 'L'}, {Name: "B", Type: 'L'}, {Name: "N", Type: 'N'}}
+	rec := &testRecord{vals: []interface{}{true, false, 5.0}}
+	tests := []struct {
+		src  string
+		want bool
+	}{
+		// identifiers directly followed by a dotted operator are not aliases
+		{"A.AND.B", false},
+		{"A.OR.B", true},
+		{"a.and..not.b", true},
+		{"x.A.AND.x.B", false},
+		{"N=5.AND.A", true},
+		{"N>1.OR.B", true},
+		{".NOT.A.OR.B", false},
+		{"!(A .AND. B)", true},
+	}
+	for _, test := range tests {
+		e, err := Compile(test.src, fields)
+		if err != nil {
+			t.Errorf("Compile(%q): %s", test.src, err)
+			continue
+		}
+		ok, err := e.EvalBool(rec)
+		if err != nil {
+			t.Errorf("Eval(%q): %s", test.src, err)
+			continue
+		}
+		if ok != test.want {
+			t.Errorf("%q: want %v, have %v", test.src, test.want, ok)
+		}
+	}
+}
+
+func TestParsePrecedence(t *testing.T) {
+	tests := []struct {
+		src  string
+		want float64
+	}{
+		{"1 + 2 * 3", 7},
+		{"(1 + 2) * 3", 9},
+		{"10 - 4 - 3", 3},
+		{"2 ^ 3 ^ 2", 512},
+		{"2 ** 3", 8},
+		{"-2 ^ 2", -4},
+		{"- -3", 3},
+		{"+3", 3},
+		{"7 % 3 * 2", 2},
+		{"12 / 4 / 3", 1},
+	}
+	for _, test := range tests {
+		v, err := MustCompile(test.src, nil).Eval(nil)
+		if err != nil {
+			t.Errorf("Eval(%q): %s", test.src, err)
+			continue
+		}
+		if v != test.want {
+			t.Errorf("%q: want %v, have %v", test.src, test.want, v)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package dbf
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/SebastiaanKlippert/go-foxpro-dbf/expr"
+)
+
+func TestCompileExpr(t *testing.T) {
+	e, err := testDbf.CompileExpr("UPPER(COMP_NAME)+DTOS(DATUM)+STR(USERNR,6)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"TEST                                    20150103     1",
+		"TEST2                                   20150203  -600",
+		"TEST2                                   20150203     2",
+		"                                                     0",
+	}
+	for i, w := range want {
+		rec, err := testDbf.RecordAt(uint32(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		v, err := e.Eval(rec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v != w {
+			t.Errorf("record %d: want %q, have %q", i, w, v)
+		}
+
+		raw, err := testDbf.ReadRecordInto(uint32(i), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v, err = e.Eval(raw.Expr()); err != nil || v != w {
+			t.Errorf("raw record %d: want %q, have %q, %v", i, w, v, err)
+		}
+	}
+
+	_, err = testDbf.CompileExpr("UPPER(NOFIELD)")
+	var serr *expr.SyntaxError
+	if !errors.As(err, &serr) {
+		t.Errorf("want *expr.SyntaxError, have %v", err)
+	}
+}
+
+func TestWhere(t *testing.T) {
+	tests := []struct {
+		src  string
+		want []int32
+	}{
+		{"!DELETED()", []int32{1, 3, 4}},
+		{"comp_name = 'TEST2' .AND. .NOT. DELETED()", []int32{3}},
+		{"'8.1' $ COMP_OS", []int32{1}},
+		{"YEAR(DATUM) = 2015 .AND. MONTH(DATUM) = 2", []int32{2, 3}},
+		{"EMPTY(DATUM)", []int32{4}},
+		{"NUMBER > 1 .AND. BOOL", []int32{2}},
+		{"ID % 2 = 0 .OR. 'Windows 7' $ COMP_OS", []int32{2, 3, 4}},
+	}
+	for _, tt := range tests {
+		have := scanIDs(t, Where(tt.src))
+		if len(have) != len(tt.want) {
+			t.Errorf("%s: want IDs %v, have %v", tt.src, tt.want, have)
+			continue
+		}
+		for i := range have {
+			if have[i] != tt.want[i] {
+				t.Errorf("%s: want IDs %v, have %v", tt.src, tt.want, have)
+				break
+			}
+		}
+	}
+
+	c, err := testDbf.Select()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetFilter(Where("ID +")); err == nil {
+		t.Error("want error for invalid expression")
+	}
+	if err := c.SetFilter(Where("ID + 1")); !errors.Is(err, ErrFieldType) {
+		t.Errorf("want ErrFieldType for numeric expression, have %v", err)
+	}
+
+	raw, err := testDbf.ReadRecordInto(0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := Where("ID = 1").Match(raw); !ok || err != nil {
+		t.Errorf("want match, have %v, %v", ok, err)
+	}
+}
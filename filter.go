@@ -0,0 +1,363 @@
+package dbf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Filter selects records while scanning a table, see Cursor.SetFilter and Scan.
+// Filters run against the raw record data so only matching records are fully decoded.
+// Use FilterFunc for custom filters, Where for FoxPro expressions and Eq, Between, Deleted, Not, And and Or to compose filters.
+type Filter interface {
+	// Match reports if rec matches the filter
+	Match(rec RawRecord) (bool, error)
+}
+
+// ErrStopScan can be returned by the function passed to Scan to stop scanning without an error
+var ErrStopScan = errors.New("stop scan")
+
+// Scan calls fn for all records matching filter f, or all records if f is nil, with the record number of every record.
+// Records that do not match the filter are not decoded. The record pointer of the table is not moved.
+// Scanning stops at the first error, which is returned, or when fn returns ErrStopScan, in which case nil is returned.
+func (dbf *DBF) Scan(f Filter, fn func(recno uint32, rec *Record) error) error {
+	c, err := dbf.Select()
+	if err != nil {
+		return err
+	}
+	if err := c.SetFilter(f); err != nil {
+		return err
+	}
+	return c.Scan(func(rec *Record) error {
+		return fn(c.RecNo(), rec)
+	})
+}
+
+// FilterFunc is a function used as Filter
+type FilterFunc func(rec RawRecord) (bool, error)
+
+// Match calls f(rec)
+func (f FilterFunc) Match(rec RawRecord) (bool, error) {
+	return f(rec)
+}
+
+// binder is implemented by filters that must be prepared for a table, like resolving field names
+type binder interface {
+	bind(dbf *DBF) (Filter, error)
+}
+
+// bindFilter prepares filter f for table dbf
+func bindFilter(f Filter, dbf *DBF) (Filter, error) {
+	if b, ok := f.(binder); ok {
+		return b.bind(dbf)
+	}
+	return f, nil
+}
+
+// Deleted returns a filter matching deleted records, use Not(Deleted()) to skip deleted records
+func Deleted() Filter {
+	return FilterFunc(func(rec RawRecord) (bool, error) {
+		return rec.IsDeleted(), nil
+	})
+}
+
+// Not returns a filter matching records that do not match f
+func Not(f Filter) Filter {
+	return notFilter{f}
+}
+
+type notFilter struct {
+	f Filter
+}
+
+func (n notFilter) Match(rec RawRecord) (bool, error) {
+	ok, err := n.f.Match(rec)
+	return !ok, err
+}
+
+func (n notFilter) bind(dbf *DBF) (Filter, error) {
+	f, err := bindFilter(n.f, dbf)
+	return notFilter{f}, err
+}
+
+// And returns a filter matching records that match all filters, filters are evaluated in order
+func And(filters ...Filter) Filter {
+	return andFilter(filters)
+}
+
+type andFilter []Filter
+
+func (a andFilter) Match(rec RawRecord) (bool, error) {
+	for _, f := range a {
+		if ok, err := f.Match(rec); !ok || err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func (a andFilter) bind(dbf *DBF) (Filter, error) {
+	bound, err := bindFilters(a, dbf)
+	return andFilter(bound), err
+}
+
+// Or returns a filter matching records that match any of the filters, filters are evaluated in order
+func Or(filters ...Filter) Filter {
+	return orFilter(filters)
+}
+
+type orFilter []Filter
+
+func (o orFilter) Match(rec RawRecord) (bool, error) {
+	for _, f := range o {
+		if ok, err := f.Match(rec); ok || err != nil {
+			return ok, err
+		}
+	}
+	return false, nil
+}
+
+func (o orFilter) bind(dbf *DBF) (Filter, error) {
+	bound, err := bindFilters(o, dbf)
+	return orFilter(bound), err
+}
+
+func bindFilters(filters []Filter, dbf *DBF) ([]Filter, error) {
+	bound := make([]Filter, len(filters))
+	for i, f := range filters {
+		var err error
+		if bound[i], err = bindFilter(f, dbf); err != nil {
+			return nil, err
+		}
+	}
+	return bound, nil
+}
+
+// Eq returns a filter matching records where field fieldname equals value.
+// Trailing spaces of C fields are ignored, so Eq("STATUS", "A") matches "A   ".
+// Values can be a string for C, M and V fields, a number for N, F, B, Y and I fields,
+// a time.Time for D and T fields (use the zero time to match empty dates) and a bool for L fields.
+// C fields compared with an ASCII value and D fields are compared without decoding the field data.
+func Eq(fieldname string, value interface{}) Filter {
+	return &fieldFilter{name: fieldname, lo: value, hi: value}
+}
+
+// Between returns a filter matching records where field fieldname is between lo and hi, inclusive.
+// The values are the same as for Eq, except for bool values.
+// C and D fields are compared as raw bytes, C fields compared with non-ASCII values are compared after decoding.
+func Between(fieldname string, lo, hi interface{}) Filter {
+	return &fieldFilter{name: fieldname, lo: lo, hi: hi, between: true}
+}
+
+// fieldFilter implements Eq and Between, it is bound to a table by converting the values for the field type
+type fieldFilter struct {
+	name    string
+	lo, hi  interface{}
+	between bool
+}
+
+// Match binds the filter to the table of rec for every call, filters set on a cursor are bound once
+func (f *fieldFilter) Match(rec RawRecord) (bool, error) {
+	bound, err := f.bind(rec.dbf)
+	if err != nil {
+		return false, err
+	}
+	return bound.Match(rec)
+}
+
+func (f *fieldFilter) bind(dbf *DBF) (Filter, error) {
+	pos := dbf.FieldPos(f.name)
+	if pos < 0 {
+		return nil, fmt.Errorf("%w: unknown field %s", ErrInvalidField, f.name)
+	}
+	field := &dbf.fields[pos]
+	b := &boundFieldFilter{pos: pos, between: f.between}
+
+	var err error
+	switch field.Type {
+	case 'C', 'M', 'V':
+		err = b.bindString(field, f.lo, f.hi)
+	case 'N', 'F', 'B', 'Y', 'I':
+		b.kind = filterNumber
+		if b.lonum, err = filterNumberValue(f.lo); err == nil {
+			b.hinum, err = filterNumberValue(f.hi)
+		}
+	case 'D':
+		b.kind = filterRawBytes
+		if b.lobytes, err = filterDateValue(f.lo); err == nil {
+			b.hibytes, err = filterDateValue(f.hi)
+		}
+	case 'T':
+		b.kind = filterTime
+		var ok bool
+		if b.lotime, ok = f.lo.(time.Time); ok {
+			b.hitime, ok = f.hi.(time.Time)
+		}
+		if !ok {
+			err = ErrFieldType
+		}
+	case 'L':
+		b.kind = filterBool
+		var ok bool
+		if b.lobool, ok = f.lo.(bool); !ok || f.between {
+			err = ErrFieldType
+		}
+	default:
+		err = ErrFieldType
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: cannot compare %T with %s field %s", err, f.lo, field.FieldType(), f.name)
+	}
+	return b, nil
+}
+
+// filter kinds, determine how the field data is compared
+const (
+	filterRawBytes = iota // compare the raw data, with trailing spaces removed, to lobytes and hibytes
+	filterString          // compare the decoded data to lostr and histr
+	filterNumber          // compare the data as float64
+	filterTime
+	filterBool
+)
+
+// boundFieldFilter is a fieldFilter bound to a table, the values are converted for the field
+type boundFieldFilter struct {
+	pos     int
+	kind    int
+	between bool
+
+	lobytes, hibytes []byte
+	lostr, histr     string
+	lonum, hinum     float64
+	lotime, hitime   time.Time
+	lobool           bool
+}
+
+func (b *boundFieldFilter) bindString(field *FieldHeader, lo, hi interface{}) error {
+	los, ok := lo.(string)
+	if !ok {
+		return ErrFieldType
+	}
+	his, ok := hi.(string)
+	if !ok {
+		return ErrFieldType
+	}
+	los, his = strings.TrimRight(los, " "), strings.TrimRight(his, " ")
+	// ASCII is encoded the same in all supported code pages, so the raw data can be compared directly
+	if field.Type == 'C' && isASCII(los) && isASCII(his) {
+		b.kind = filterRawBytes
+		b.lobytes, b.hibytes = []byte(los), []byte(his)
+		return nil
+	}
+	b.kind = filterString
+	b.lostr, b.histr = los, his
+	return nil
+}
+
+func (b *boundFieldFilter) Match(rec RawRecord) (bool, error) {
+	var lo, hi int
+	switch b.kind {
+	case filterRawBytes:
+		raw, err := rec.Bytes(b.pos)
+		if err != nil {
+			return false, err
+		}
+		raw = bytes.TrimRight(raw, " ")
+		if !b.between {
+			return bytes.Equal(raw, b.lobytes), nil
+		}
+		lo, hi = bytes.Compare(raw, b.lobytes), bytes.Compare(raw, b.hibytes)
+	case filterString:
+		s, err := rec.String(b.pos)
+		if err != nil {
+			return false, err
+		}
+		s = strings.TrimRight(s, " ")
+		lo, hi = strings.Compare(s, b.lostr), strings.Compare(s, b.histr)
+	case filterNumber:
+		v, err := rec.Float64(b.pos)
+		if err != nil {
+			return false, err
+		}
+		lo, hi = compareFloat(v, b.lonum), compareFloat(v, b.hinum)
+	case filterTime:
+		t, err := rec.Time(b.pos)
+		if err != nil {
+			return false, err
+		}
+		lo, hi = compareTime(t, b.lotime), compareTime(t, b.hitime)
+	case filterBool:
+		v, err := rec.Bool(b.pos)
+		return v == b.lobool, err
+	}
+	if !b.between {
+		return lo == 0, nil
+	}
+	return lo >= 0 && hi <= 0, nil
+}
+
+// filterNumberValue converts numeric filter value v to float64
+func filterNumberValue(v interface{}) (float64, error) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), nil
+	case int32:
+		return float64(n), nil
+	case int64:
+		return float64(n), nil
+	case uint32:
+		return float64(n), nil
+	case float32:
+		return float64(n), nil
+	case float64:
+		return n, nil
+	default:
+		return 0, ErrFieldType
+	}
+}
+
+// filterDateValue converts time filter value v to the raw data of a D field, the zero time is an empty date
+func filterDateValue(v interface{}) ([]byte, error) {
+	t, ok := v.(time.Time)
+	if !ok {
+		return nil, ErrFieldType
+	}
+	if t.IsZero() {
+		// trailing spaces are removed from the raw data before comparing
+		return []byte{}, nil
+	}
+	return []byte(t.Format("20060102")), nil
+}
+
+func compareFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func compareTime(a, b time.Time) int {
+	switch {
+	case a.Before(b):
+		return -1
+	case a.After(b):
+		return 1
+	default:
+		return 0
+	}
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,175 @@
+package dbf
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// scanIDs returns the IDs of the records in testDbf matching f
+func scanIDs(t *testing.T, f Filter) []int32 {
+	t.Helper()
+	var ids []int32
+	err := testDbf.Scan(f, func(recno uint32, rec *Record) error {
+		ids = append(ids, rec.FieldSlice()[0].(int32))
+		if int32(recno+1) != ids[len(ids)-1] {
+			t.Errorf("want record number %d for ID %d", ids[len(ids)-1]-1, ids[len(ids)-1])
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ids
+}
+
+func TestFilters(t *testing.T) {
+	feb3 := time.Date(2015, 2, 3, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		filter Filter
+		want   []int32
+	}{
+		{"none", nil, []int32{1, 2, 3, 4}},
+		{"not deleted", Not(Deleted()), []int32{1, 3, 4}},
+		{"C", Eq("COMP_NAME", "TEST2"), []int32{2, 3}},
+		{"C padded", Eq("COMP_NAME", "TEST   "), []int32{1}},
+		{"C empty", Eq("COMP_NAME", ""), []int32{4}},
+		{"C between", Between("COMP_NAME", "TEST", "TEST1"), []int32{1}},
+		{"C non-ASCII", Between("COMP_OS", "Windows 7 SP1", "Windows 8.1 Pro"), []int32{1, 3}},
+		{"M", Eq("MELDING", "Tësting wíth éncôdings!"), []int32{2, 3}},
+		{"D", Eq("DATUM", feb3), []int32{2, 3}},
+		{"D empty", Eq("DATUM", time.Time{}), []int32{4}},
+		{"D between", Between("DATUM", feb3.AddDate(0, -1, 0), feb3.AddDate(0, 0, -1)), []int32{1}},
+		{"N", Eq("NUMBER", 1.66), []int32{1}},
+		{"N between", Between("NUMBER", 1, 200000000), []int32{1, 2}},
+		{"I", Eq("ID", 3), []int32{3}},
+		{"I between", Between("USERNR", int64(-1000), int64(1)), []int32{1, 2, 4}},
+		{"L", Eq("BOOL", true), []int32{2, 4}},
+		{"and", And(Not(Deleted()), Eq("COMP_NAME", "TEST2")), []int32{3}},
+		{"or", Or(Eq("ID", 1), Eq("ID", 4)), []int32{1, 4}},
+		{"func", FilterFunc(func(rec RawRecord) (bool, error) {
+			id, err := rec.Int64(0)
+			return id%2 == 0, err
+		}), []int32{2, 4}},
+	}
+	for _, tt := range tests {
+		have := scanIDs(t, tt.filter)
+		if len(have) != len(tt.want) {
+			t.Errorf("%s: want IDs %v, have %v", tt.name, tt.want, have)
+			continue
+		}
+		for i := range have {
+			if have[i] != tt.want[i] {
+				t.Errorf("%s: want IDs %v, have %v", tt.name, tt.want, have)
+				break
+			}
+		}
+	}
+
+	// an unbound field filter can be used directly
+	rec, err := testDbf.ReadRecordInto(2, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := Eq("ID", 3).Match(rec); !ok || err != nil {
+		t.Errorf("want match, have %v (%v)", ok, err)
+	}
+}
+
+func TestFilterErrors(t *testing.T) {
+	c, err := testDbf.Select()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetFilter(Not(Eq("MISSING", 1))); !errors.Is(err, ErrInvalidField) {
+		t.Errorf("want ErrInvalidField, have %v", err)
+	}
+	for _, f := range []Filter{Eq("ID", "1"), Eq("COMP_NAME", 1), Eq("DATUM", "20150203"), Between("BOOL", false, true), Eq("TIJD", 1)} {
+		if err := c.SetFilter(f); !errors.Is(err, ErrFieldType) {
+			t.Errorf("want ErrFieldType for %+v, have %v", f, err)
+		}
+	}
+
+	stop := errors.New("stop")
+	n := 0
+	err = testDbf.Scan(nil, func(recno uint32, rec *Record) error {
+		n++
+		return stop
+	})
+	if err != stop || n != 1 {
+		t.Errorf("want error of fn after 1 record, have %v after %d", err, n)
+	}
+	n = 0
+	err = testDbf.Scan(nil, func(recno uint32, rec *Record) error {
+		n++
+		if n == 2 {
+			return ErrStopScan
+		}
+		return nil
+	})
+	if err != nil || n != 2 {
+		t.Errorf("want no error after 2 records, have %v after %d", err, n)
+	}
+}
+
+func TestCursorSkipFilter(t *testing.T) {
+	c, err := testDbf.Select("ID")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetFilter(Eq("BOOL", false)); err != nil {
+		t.Fatal(err)
+	}
+	// record 0 matches, skip to the next matching record 2
+	if err := c.Skip(1); err != nil || c.RecNo() != 2 {
+		t.Fatalf("want record 2, have %d (%v)", c.RecNo(), err)
+	}
+	if err := c.Skip(1); err != ErrEOF || !c.EOF() {
+		t.Errorf("want ErrEOF, have %v at %d", err, c.RecNo())
+	}
+	c.GoTo(3)
+	if err := c.Skip(-1); err != nil || c.RecNo() != 2 {
+		t.Errorf("want record 2, have %d (%v)", c.RecNo(), err)
+	}
+	if err := c.Skip(-2); err != ErrBOF || !c.BOF() {
+		t.Errorf("want ErrBOF, have %v at %d", err, c.RecNo())
+	}
+
+	// Scan starts at the record pointer
+	c.GoTo(1)
+	var ids []interface{}
+	err = c.Scan(func(rec *Record) error {
+		ids = append(ids, rec.FieldSlice()[0])
+		return nil
+	})
+	if err != nil || len(ids) != 1 || ids[0] != int32(3) || !c.EOF() {
+		t.Errorf("want ID 3, have %v (%v)", ids, err)
+	}
+
+	c.SetFilter(nil)
+	c.GoTo(0)
+	if err := c.Skip(1); err != nil || c.RecNo() != 1 {
+		t.Errorf("want record 1 without filter, have %d (%v)", c.RecNo(), err)
+	}
+}
+
+// Scanning with a filter on a C field, only matching records are decoded
+func BenchmarkScanFilter(b *testing.B) {
+	dbf, err := OpenFile(filepath.Join("testdata", "dbase_30.dbf"), new(Win1250Decoder))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer dbf.Close()
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		err := dbf.Scan(Eq("ACCESSNO", "1999.1"), func(recno uint32, rec *Record) error {
+			return nil
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,732 @@
+package dbf
+
+import (
+	"bufio"
+	"bytes"
+	"container/heap"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/SebastiaanKlippert/go-foxpro-dbf/expr"
+)
+
+// IndexOptions contains the optional settings used by BuildIndex and Reindex
+type IndexOptions struct {
+	Unique     bool // Only index the first record of every key, like INDEX ON ... UNIQUE
+	Descending bool // Store the keys in descending order
+	KeyLen     int  // Length of Character keys, defaults to the length of the key of the first record like FoxPro
+
+	// MaxKeysInMemory is the number of keys sorted in memory, defaults to 1000000.
+	// Tags with more keys are sorted in runs written to temporary files in TempDir, which are merged.
+	MaxKeysInMemory int
+	TempDir         string // Directory of the temporary files, defaults to os.TempDir()
+}
+
+func (o *IndexOptions) maxKeysInMemory() int {
+	if o.MaxKeysInMemory <= 0 {
+		return 1000000
+	}
+	return o.MaxKeysInMemory
+}
+
+// BuildIndex creates or replaces tag tagName of the structural CDX index of the table, like
+// INDEX ON keyExpr TAG tagName FOR forExpr in FoxPro, and sets the structural index flag in the header.
+// Leave forExpr empty to index all records, deleted records are indexed too.
+// The other tags of the index are rebuilt from their expressions, when the index can not be read it is replaced
+// by a new index with only this tag.
+// The table must be opened using OpenFileRW, the index can not be built during a transaction because it is not
+// in the journal. The new index is opened on first use, cursors ordered by a tag of the old index must call
+// SetOrder again.
+func (dbf *DBF) BuildIndex(tagName, keyExpr, forExpr string, opts *IndexOptions) error {
+	if !dbf.rw {
+		return ErrReadOnly
+	}
+	if dbf.tx != nil {
+		return ErrInTransaction
+	}
+	if opts == nil {
+		opts = &IndexOptions{}
+	}
+	name := strings.ToUpper(tagName)
+	if len(name) == 0 || len(name) > cdxTagNameLen {
+		return fmt.Errorf("invalid tag name %q, tag names must have 1 to %d characters", name, cdxTagNameLen)
+	}
+	for i, c := range name {
+		if !(c >= 'A' && c <= 'Z' || c == '_' || i > 0 && c >= '0' && c <= '9') {
+			return fmt.Errorf("invalid tag name %q, only letters, digits and underscores are allowed", name)
+		}
+	}
+	tag := IndexTag{Name: name, Key: keyExpr, For: forExpr, Unique: opts.Unique, Descending: opts.Descending}
+	key, err := dbf.CompileExpr(keyExpr)
+	if err != nil {
+		return err
+	}
+	if tag.KeyLen, err = dbf.indexKeyLen(key, opts.KeyLen); err != nil {
+		return err
+	}
+
+	tags, err := dbf.structuralTags()
+	if err != nil && err != ErrNoIndex && !errors.Is(err, ErrInvalidIndex) {
+		return err
+	}
+	for i := range tags {
+		if tags[i].Name == name {
+			tags = append(tags[:i], tags[i+1:]...)
+			break
+		}
+	}
+	return dbf.writeIndex(append(tags, tag), opts)
+}
+
+// Reindex rebuilds all tags of the structural CDX index from their expressions, like REINDEX in FoxPro.
+// Only MaxKeysInMemory and TempDir of opts are used. Returns ErrNoIndex if the table has no structural index file.
+// The table must be opened using OpenFileRW and can not be reindexed during a transaction, see BuildIndex.
+func (dbf *DBF) Reindex(opts *IndexOptions) error {
+	if !dbf.rw {
+		return ErrReadOnly
+	}
+	if dbf.tx != nil {
+		return ErrInTransaction
+	}
+	if opts == nil {
+		opts = &IndexOptions{}
+	}
+	tags, err := dbf.structuralTags()
+	if err != nil {
+		return err
+	}
+	return dbf.writeIndex(tags, opts)
+}
+
+// structuralTags returns the tags of the structural CDX file, returns ErrNoIndex if the file does not exist
+func (dbf *DBF) structuralTags() ([]IndexTag, error) {
+	f, err := os.Open(cdxFilename(dbf.f.Name()))
+	if os.IsNotExist(err) {
+		return nil, ErrNoIndex
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	idx, err := readCDX(f)
+	if err != nil {
+		return nil, err
+	}
+	tags := make([]IndexTag, len(idx.tags))
+	for i, tag := range idx.tags {
+		tags[i] = tag.IndexTag
+	}
+	return tags, nil
+}
+
+// indexKeyLen returns the key length of key expression e: 8 for Numeric, Date and DateTime keys, 1 for Logical keys
+// and keyLen or the length of the key of the first record for Character keys
+func (dbf *DBF) indexKeyLen(e *expr.Expr, keyLen int) (int, error) {
+	switch e.Type() {
+	case expr.Logical:
+		return 1, nil
+	case expr.Character:
+	default:
+		return 8, nil
+	}
+	if keyLen == 0 {
+		data := bytes.Repeat([]byte{' '}, int(dbf.header.RecLen))
+		if dbf.header.NumRec > 0 {
+			raw, err := dbf.ReadRecordInto(0, nil)
+			if err != nil {
+				return 0, err
+			}
+			data = raw.Data()
+		}
+		v, err := e.Eval(RawRecord{dbf: dbf, data: data}.Expr())
+		if err != nil {
+			return 0, err
+		}
+		b, err := dbf.keyEncoder().Encode([]byte(v.(string)))
+		if err != nil {
+			return 0, err
+		}
+		keyLen = len(b)
+	}
+	if keyLen < 1 || keyLen > cdxMaxKeyLen {
+		return 0, fmt.Errorf("invalid key length %d of key expression %q, keys must have 1 to %d bytes", keyLen, e, cdxMaxKeyLen)
+	}
+	return keyLen, nil
+}
+
+// writeIndex writes the structural CDX file with tags to a temporary file, which replaces the structural CDX
+// file when all tags are written, and sets the structural index flag in the header
+func (dbf *DBF) writeIndex(tags []IndexTag, opts *IndexOptions) error {
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Name < tags[j].Name })
+	filename := cdxFilename(dbf.f.Name())
+	ext := filepath.Ext(filename)
+	tmp, err := ioutil.TempFile(filepath.Dir(filename), strings.TrimSuffix(filepath.Base(filename), ext)+"-index-*"+ext)
+	if err != nil {
+		return err
+	}
+	err = dbf.writeCDX(tmp, tags, opts)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	// the structural index is opened again on first use, files can not be replaced while they are open on all platforms
+	dbf.cdxmu.Lock()
+	err = dbf.closeStructuralIndex()
+	dbf.cdxmu.Unlock()
+	if err == nil {
+		err = os.Rename(tmp.Name(), filename)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	dbf.reindex = false
+	if dbf.header.HasStructuralCDX() {
+		return nil
+	}
+	dbf.header.TableFlags |= 0x01
+	return dbf.writeDBF([]byte{dbf.header.TableFlags}, 28)
+}
+
+// outdateIndex is called before a record is written. The structural index is not updated by writes, so the
+// structural index flag is cleared first and the index is rebuilt by Close or Reindex. The flag is only set while
+// the index matches the table, FoxPro and other handles do not use an outdated index.
+// Returns an error, before the table is changed, when the tags can not be rebuilt from their expressions.
+func (dbf *DBF) outdateIndex() error {
+	if !dbf.header.HasStructuralCDX() || dbf.f == nil {
+		return nil
+	}
+	tags, err := dbf.structuralTags()
+	if err == ErrNoIndex {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("structural index can not be updated: %w", err)
+	}
+	for _, tag := range tags {
+		for _, src := range []string{tag.Key, tag.For} {
+			if src == "" {
+				continue
+			}
+			if _, err := dbf.CompileExpr(src); err != nil {
+				return fmt.Errorf("structural index can not be updated, tag %s: %w", tag.Name, err)
+			}
+		}
+	}
+
+	dbf.cdxmu.Lock()
+	err = dbf.closeStructuralIndex()
+	dbf.cdxmu.Unlock()
+	if err != nil {
+		return err
+	}
+	dbf.header.TableFlags &^= 0x01
+	if err := dbf.writeDBF([]byte{dbf.header.TableFlags}, 28); err != nil {
+		return err
+	}
+	dbf.reindex = true
+	return nil
+}
+
+// writeCDX writes the CDX file with tags to f: the compound header, the header and nodes of every tag
+// and the nodes of the compound tag. The headers are written last, when the offsets of the root nodes are known.
+func (dbf *DBF) writeCDX(f *os.File, tags []IndexTag, opts *IndexOptions) error {
+	w := &cdxWriter{w: bufio.NewWriter(f)}
+	headers := make(map[uint32][]byte)
+	if _, err := w.write(make([]byte, cdxHeaderSize)); err != nil {
+		return err
+	}
+	compound := &cdxBuilder{w: w, keyLen: cdxTagNameLen}
+	var names [][]byte
+	var offsets []uint32
+	for _, tag := range tags {
+		offset, err := w.write(make([]byte, cdxHeaderSize))
+		if err != nil {
+			return err
+		}
+		root, err := dbf.buildTag(w, tag, opts)
+		if err != nil {
+			return err
+		}
+		headers[offset] = cdxTagHeader(tag, root, cdxCompact)
+		name := make([]byte, cdxTagNameLen)
+		copy(name, tag.Name)
+		names = append(names, name)
+		offsets = append(offsets, offset)
+	}
+
+	// the compound tag has the tag names as keys, with the offset of the tag header as record number
+	if len(offsets) > 0 {
+		compound.setRecBits(offsets[len(offsets)-1])
+	}
+	for i, name := range names {
+		if err := compound.add(name, offsets[i]); err != nil {
+			return err
+		}
+	}
+	root, err := compound.finish()
+	if err != nil {
+		return err
+	}
+	headers[0] = cdxTagHeader(IndexTag{KeyLen: cdxTagNameLen}, root, cdxCompact|cdxCompound)
+
+	if err := w.w.Flush(); err != nil {
+		return err
+	}
+	for offset, header := range headers {
+		if _, err := f.WriteAt(header, int64(offset)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// buildTag writes the nodes of tag to w and returns the offset of its root node.
+// The keys of all records matching the FOR expression are sorted first.
+func (dbf *DBF) buildTag(w *cdxWriter, tag IndexTag, opts *IndexOptions) (uint32, error) {
+	t := &cdxTag{IndexTag: tag, trail: ' '}
+	if err := t.compile(dbf); err != nil {
+		return 0, fmt.Errorf("tag %s: %w", tag.Name, err)
+	}
+	var forExpr *expr.Expr
+	if tag.For != "" {
+		var err error
+		if forExpr, err = dbf.CompileExpr(tag.For); err != nil {
+			return 0, fmt.Errorf("tag %s: %w", tag.Name, err)
+		}
+		if forExpr.Type() != expr.Logical {
+			return 0, fmt.Errorf("%w: FOR expression %q of tag %s is not logical", ErrFieldType, tag.For, tag.Name)
+		}
+	}
+
+	s := &cdxSorter{keyLen: tag.KeyLen, descending: tag.Descending, max: opts.maxKeysInMemory(), dir: opts.TempDir}
+	defer s.close()
+	var buf []byte
+	for recno := uint32(0); recno < dbf.header.NumRec; recno++ {
+		raw, err := dbf.ReadRecordInto(recno, buf)
+		if err != nil {
+			return 0, err
+		}
+		buf = raw.Data()
+		if forExpr != nil {
+			ok, err := forExpr.EvalBool(raw.Expr())
+			if err != nil {
+				return 0, fmt.Errorf("tag %s, record %d: %w", tag.Name, recno, err)
+			}
+			if !ok {
+				continue
+			}
+		}
+		v, err := t.key.Eval(raw.Expr())
+		if err != nil {
+			return 0, fmt.Errorf("tag %s, record %d: %w", tag.Name, recno, err)
+		}
+		key, err := t.encode(dbf, v, true)
+		if err != nil {
+			return 0, fmt.Errorf("tag %s, record %d: %w", tag.Name, recno, err)
+		}
+		if err := s.add(key, recno+1); err != nil {
+			return 0, err
+		}
+	}
+
+	b := &cdxBuilder{w: w, keyLen: tag.KeyLen, trail: t.trail}
+	b.setRecBits(dbf.header.NumRec)
+	var prev []byte
+	err := s.each(func(entry []byte) error {
+		key := entry[:tag.KeyLen]
+		if tag.Unique && prev != nil && bytes.Equal(key, prev) {
+			return nil
+		}
+		prev = append(prev[:0], key...)
+		return b.add(key, binary.BigEndian.Uint32(entry[tag.KeyLen:]))
+	})
+	if err != nil {
+		return 0, err
+	}
+	return b.finish()
+}
+
+// cdxTagHeader returns the header of tag with its root node at root
+func cdxTagHeader(tag IndexTag, root uint32, options byte) []byte {
+	b := make([]byte, cdxHeaderSize)
+	binary.LittleEndian.PutUint32(b, root)
+	// the index has no free nodes, FoxPro would reuse the node at a free list pointer of 0
+	binary.LittleEndian.PutUint32(b[4:], cdxNoPage)
+	binary.LittleEndian.PutUint16(b[0x0C:], uint16(tag.KeyLen))
+	b[0x0E] = options
+	if tag.Unique {
+		b[0x0E] |= cdxUnique
+	}
+	if tag.For != "" {
+		b[0x0E] |= cdxHasFor
+	}
+	if tag.Descending {
+		binary.LittleEndian.PutUint16(b[0x1F6:], 1)
+	}
+	// the expression pool contains the key expression followed by the FOR expression, both terminated by 0
+	binary.LittleEndian.PutUint16(b[0x1F8:], uint16(len(tag.Key)+1))
+	binary.LittleEndian.PutUint16(b[0x1FA:], uint16(len(tag.For)+1))
+	binary.LittleEndian.PutUint16(b[0x1FE:], uint16(len(tag.Key)+1))
+	copy(b[cdxPageSize:], tag.Key)
+	copy(b[cdxPageSize+len(tag.Key)+1:], tag.For)
+	return b
+}
+
+// cdxWriter writes a CDX file sequentially
+type cdxWriter struct {
+	w   *bufio.Writer
+	off uint32 // offset of the next write
+}
+
+// write writes b and returns its offset
+func (w *cdxWriter) write(b []byte) (uint32, error) {
+	off := w.off
+	_, err := w.w.Write(b)
+	w.off += uint32(len(b))
+	return off, err
+}
+
+// cdxBuilder writes the nodes of a tag bottom up from its keys in index order. The leaf nodes are written
+// while the keys are added, the interior nodes above them when all keys are added.
+type cdxBuilder struct {
+	w      *cdxWriter
+	keyLen int
+	trail  byte
+
+	recBits, countBits, size int // bits of the record number, duplicate and trail counts in a leaf entry, entry size
+
+	leaf     []byte     // leaf node being filled
+	numkeys  int        // keys in leaf
+	end      int        // start of the key data in leaf
+	prev     []byte     // last key in leaf
+	recno    uint32     // record number of the last key in leaf
+	left     uint32     // offset of the previous leaf node
+	children []cdxEntry // last keys of the written nodes of the level being built
+}
+
+// cdxEntry is a key of an interior node with the record number of the key and the offset of its child node
+type cdxEntry struct {
+	key   []byte
+	recno uint32
+	child uint32
+}
+
+// setRecBits sets the sizes of the leaf entries, for record numbers up to maxRecno. The duplicate and trail
+// counts need enough bits for the key length, the entries are a whole number of bytes so the record number
+// gets the remaining bits, up to 32.
+func (b *cdxBuilder) setRecBits(maxRecno uint32) {
+	b.countBits = bits.Len(uint(b.keyLen))
+	b.size = (bits.Len32(maxRecno) + 2*b.countBits + 7) / 8
+	b.recBits = b.size*8 - 2*b.countBits
+	if b.recBits > 32 {
+		b.recBits = 32
+	}
+}
+
+// add adds key with record number recno after the keys added before, a leaf node is written when it is full
+func (b *cdxBuilder) add(key []byte, recno uint32) error {
+	if b.leaf == nil {
+		b.newLeaf()
+	}
+	trail := 0
+	for trail < b.keyLen && key[b.keyLen-1-trail] == b.trail {
+		trail++
+	}
+	dup := 0
+	if b.numkeys > 0 {
+		for dup < b.keyLen-trail && key[dup] == b.prev[dup] {
+			dup++
+		}
+	}
+	if b.numkeys > 0 && b.end-(b.keyLen-dup-trail) < 24+(b.numkeys+1)*b.size {
+		if err := b.writeLeaf(false); err != nil {
+			return err
+		}
+		b.newLeaf()
+		dup = 0
+	}
+
+	data := key[dup : b.keyLen-trail]
+	b.end -= len(data)
+	copy(b.leaf[b.end:], data)
+	v := uint64(recno) | uint64(dup)<<uint(b.recBits) | uint64(trail)<<uint(b.recBits+b.countBits)
+	for j := 0; j < b.size; j++ {
+		b.leaf[24+b.numkeys*b.size+j] = byte(v >> uint(8*j))
+	}
+	b.numkeys++
+	b.prev = append(b.prev[:0], key...)
+	b.recno = recno
+	return nil
+}
+
+// newLeaf starts a new empty leaf node
+func (b *cdxBuilder) newLeaf() {
+	b.leaf, b.numkeys, b.end = make([]byte, cdxPageSize), 0, cdxPageSize
+	if b.size == 0 {
+		b.setRecBits(0)
+	}
+}
+
+// writeLeaf writes the leaf node being filled, the next leaf node is written right after it unless it is the last
+func (b *cdxBuilder) writeLeaf(last bool) error {
+	n := b.leaf
+	attr := uint16(cdxNodeLeaf)
+	if last && len(b.children) == 0 {
+		attr |= cdxNodeRoot
+	}
+	right := b.w.off + cdxPageSize
+	if last {
+		right = cdxNoPage
+	}
+	left := uint32(cdxNoPage)
+	if len(b.children) > 0 {
+		left = b.left
+	}
+	binary.LittleEndian.PutUint16(n, attr)
+	binary.LittleEndian.PutUint16(n[2:], uint16(b.numkeys))
+	binary.LittleEndian.PutUint32(n[4:], left)
+	binary.LittleEndian.PutUint32(n[8:], right)
+	binary.LittleEndian.PutUint16(n[0x0C:], uint16(b.end-24-b.numkeys*b.size))
+	binary.LittleEndian.PutUint32(n[0x0E:], uint32(1<<uint(b.recBits)-1))
+	n[0x12] = byte(1<<uint(b.countBits) - 1)
+	n[0x13] = byte(1<<uint(b.countBits) - 1)
+	n[0x14] = byte(b.recBits)
+	n[0x15] = byte(b.countBits)
+	n[0x16] = byte(b.countBits)
+	n[0x17] = byte(b.size)
+	offset, err := b.w.write(n)
+	if err != nil {
+		return err
+	}
+	b.left = offset
+	key := make([]byte, b.keyLen)
+	copy(key, b.prev)
+	if b.numkeys == 0 {
+		// an empty root leaf, the key is not used
+		key = nil
+	}
+	b.children = append(b.children, cdxEntry{key: key, recno: b.recno, child: offset})
+	return nil
+}
+
+// finish writes the last leaf node and the interior nodes and returns the offset of the root node
+func (b *cdxBuilder) finish() (uint32, error) {
+	if b.leaf == nil {
+		b.newLeaf()
+	}
+	if err := b.writeLeaf(true); err != nil {
+		return 0, err
+	}
+	perNode := (cdxPageSize - 12) / (b.keyLen + 8)
+	for len(b.children) > 1 {
+		entries := b.children
+		b.children = nil
+		numnodes := (len(entries) + perNode - 1) / perNode
+		for i := 0; i < numnodes; i++ {
+			node := entries[i*perNode:]
+			if len(node) > perNode {
+				node = node[:perNode]
+			}
+			n := make([]byte, cdxPageSize)
+			if numnodes == 1 {
+				binary.LittleEndian.PutUint16(n, cdxNodeRoot)
+			}
+			binary.LittleEndian.PutUint16(n[2:], uint16(len(node)))
+			left, right := b.w.off-cdxPageSize, b.w.off+cdxPageSize
+			if i == 0 {
+				left = cdxNoPage
+			}
+			if i == numnodes-1 {
+				right = cdxNoPage
+			}
+			binary.LittleEndian.PutUint32(n[4:], left)
+			binary.LittleEndian.PutUint32(n[8:], right)
+			for j, e := range node {
+				entry := n[12+j*(b.keyLen+8):]
+				copy(entry, e.key)
+				binary.BigEndian.PutUint32(entry[b.keyLen:], e.recno)
+				binary.BigEndian.PutUint32(entry[b.keyLen+4:], e.child)
+			}
+			offset, err := b.w.write(n)
+			if err != nil {
+				return 0, err
+			}
+			last := node[len(node)-1]
+			b.children = append(b.children, cdxEntry{key: last.key, recno: last.recno, child: offset})
+		}
+	}
+	return b.children[0].child, nil
+}
+
+// cdxSorter sorts the keys of a tag in index order, then in record order. When there are more than max keys
+// the keys are sorted in runs that are written to temporary files and merged.
+// The entries are the key followed by the big endian record number.
+type cdxSorter struct {
+	keyLen     int
+	descending bool
+	max        int
+	dir        string
+
+	buf     []byte   // data of the entries in memory
+	entries [][]byte // entries in memory
+	runs    []*os.File
+}
+
+// add adds key with record number recno
+func (s *cdxSorter) add(key []byte, recno uint32) error {
+	if len(s.entries) == s.max {
+		if err := s.writeRun(); err != nil {
+			return err
+		}
+	}
+	if s.buf == nil {
+		s.buf = make([]byte, 0, s.max*(s.keyLen+4))
+	}
+	start := len(s.buf)
+	s.buf = append(s.buf, key...)
+	s.buf = append(s.buf, byte(recno>>24), byte(recno>>16), byte(recno>>8), byte(recno))
+	s.entries = append(s.entries, s.buf[start:len(s.buf):len(s.buf)])
+	return nil
+}
+
+func (s *cdxSorter) less(a, b []byte) bool {
+	c := bytes.Compare(a[:s.keyLen], b[:s.keyLen])
+	if s.descending {
+		c = -c
+	}
+	if c == 0 {
+		c = bytes.Compare(a[s.keyLen:], b[s.keyLen:])
+	}
+	return c < 0
+}
+
+func (s *cdxSorter) sort() {
+	sort.Slice(s.entries, func(i, j int) bool { return s.less(s.entries[i], s.entries[j]) })
+}
+
+// writeRun sorts the entries in memory and writes them to a temporary file
+func (s *cdxSorter) writeRun() error {
+	f, err := ioutil.TempFile(s.dir, "dbf-index-*")
+	if err != nil {
+		return err
+	}
+	s.runs = append(s.runs, f)
+	s.sort()
+	w := bufio.NewWriter(f)
+	for _, entry := range s.entries {
+		if _, err := w.Write(entry); err != nil {
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	s.buf, s.entries = s.buf[:0], s.entries[:0]
+	return nil
+}
+
+// each calls fn for all entries in order, entry is only valid during the call
+func (s *cdxSorter) each(fn func(entry []byte) error) error {
+	if len(s.runs) == 0 {
+		s.sort()
+		for _, entry := range s.entries {
+			if err := fn(entry); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if len(s.entries) > 0 {
+		if err := s.writeRun(); err != nil {
+			return err
+		}
+	}
+	h := &cdxMerge{less: s.less}
+	for _, f := range s.runs {
+		r := &cdxRun{r: bufio.NewReader(f), entry: make([]byte, s.keyLen+4)}
+		ok, err := r.next()
+		if err != nil {
+			return err
+		}
+		if ok {
+			h.runs = append(h.runs, r)
+		}
+	}
+	heap.Init(h)
+	for len(h.runs) > 0 {
+		r := h.runs[0]
+		if err := fn(r.entry); err != nil {
+			return err
+		}
+		ok, err := r.next()
+		if err != nil {
+			return err
+		}
+		if ok {
+			heap.Fix(h, 0)
+		} else {
+			heap.Pop(h)
+		}
+	}
+	return nil
+}
+
+// close removes the temporary files
+func (s *cdxSorter) close() {
+	for _, f := range s.runs {
+		f.Close()
+		os.Remove(f.Name())
+	}
+	s.runs = nil
+}
+
+// cdxRun reads the sorted entries of a temporary file
+type cdxRun struct {
+	r     *bufio.Reader
+	entry []byte
+}
+
+// next reads the next entry, returns false at the end of the file
+func (r *cdxRun) next() (bool, error) {
+	_, err := io.ReadFull(r.r, r.entry)
+	if err == io.EOF {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// cdxMerge is a heap of runs ordered by their current entry
+type cdxMerge struct {
+	runs []*cdxRun
+	less func(a, b []byte) bool
+}
+
+func (h *cdxMerge) Len() int           { return len(h.runs) }
+func (h *cdxMerge) Less(i, j int) bool { return h.less(h.runs[i].entry, h.runs[j].entry) }
+func (h *cdxMerge) Swap(i, j int)      { h.runs[i], h.runs[j] = h.runs[j], h.runs[i] }
+func (h *cdxMerge) Push(x interface{}) { h.runs = append(h.runs, x.(*cdxRun)) }
+func (h *cdxMerge) Pop() interface{} {
+	r := h.runs[len(h.runs)-1]
+	h.runs = h.runs[:len(h.runs)-1]
+	return r
+}
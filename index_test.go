@@ -0,0 +1,531 @@
+package dbf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// tagKeys returns the keys of tag name of the index of dbf in index order, with the record numbers as stored in the index
+func tagKeys(t *testing.T, dbf *DBF, name string) []testKey {
+	t.Helper()
+	idx, err := dbf.index()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag, err := idx.tag(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []testKey
+	err = tag.walk(func(key []byte, recno uint32) error {
+		keys = append(keys, testKey{key: append([]byte(nil), key...), recno: recno})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
+
+// uniqueKeys returns the first of every key of keys
+func uniqueKeys(keys []testKey) []testKey {
+	var unique []testKey
+	for _, k := range keys {
+		if len(unique) == 0 || !bytes.Equal(unique[len(unique)-1].key, k.key) {
+			unique = append(unique, k)
+		}
+	}
+	return unique
+}
+
+// buildDbase30Index builds the tags written by writeDbase30CDX on a copy of dbase_30.dbf and returns it opened for writing
+func buildDbase30Index(t *testing.T, opts IndexOptions) *DBF {
+	t.Helper()
+	filename := copyTestFiles(t, t.TempDir(), "dbase_30.dbf")
+	dbf, err := OpenFileRW(filename, new(Win1250Decoder), new(Win1250Encoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { dbf.Close() })
+
+	tags := []struct {
+		name, key, forExpr string
+		unique, descending bool
+	}{
+		{"ACCESSNO", "ACCESSNO", "", false, false},
+		{"ACQ", "ACQVALUE", "ACQVALUE > 0", false, false},
+		{"CATDATE", "CATDATE", "", false, false},
+		{"DESCNO", "ACCESSNO", "", true, true},
+	}
+	for _, tag := range tags {
+		opts.Unique, opts.Descending = tag.unique, tag.descending
+		if err := dbf.BuildIndex(tag.name, tag.key, tag.forExpr, &opts); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dbf
+}
+
+func TestBuildIndex(t *testing.T) {
+	for _, max := range []int{0, 5} {
+		t.Run(fmt.Sprintf("max keys %d", max), func(t *testing.T) {
+			dbf := buildDbase30Index(t, IndexOptions{MaxKeysInMemory: max, TempDir: t.TempDir()})
+
+			tags, err := dbf.Tags()
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := []IndexTag{
+				{Name: "ACCESSNO", Key: "ACCESSNO", KeyLen: 15},
+				{Name: "ACQ", Key: "ACQVALUE", For: "ACQVALUE > 0", KeyLen: 8},
+				{Name: "CATDATE", Key: "CATDATE", KeyLen: 8},
+				{Name: "DESCNO", Key: "ACCESSNO", KeyLen: 15, Unique: true, Descending: true},
+			}
+			if !reflect.DeepEqual(tags, want) {
+				t.Errorf("want tags %+v, have %+v", want, tags)
+			}
+
+			for _, tag := range []struct {
+				name, key, forExpr string
+				keyLen             int
+				unique, descending bool
+			}{
+				{"ACCESSNO", "ACCESSNO", "", 15, false, false},
+				{"ACQ", "ACQVALUE", "ACQVALUE > 0", 8, false, false},
+				{"CATDATE", "CATDATE", "", 8, false, false},
+				{"DESCNO", "ACCESSNO", "", 15, true, true},
+			} {
+				want := testIndexKeys(t, dbf, tag.key, tag.forExpr, tag.keyLen, tag.descending)
+				if tag.unique {
+					want = uniqueKeys(want)
+				}
+				if have := tagKeys(t, dbf, tag.name); !reflect.DeepEqual(have, want) {
+					t.Errorf("tag %s: want keys %v, have %v", tag.name, want, have)
+				}
+			}
+
+			// the temporary sort files are removed
+			if files, err := ioutil.ReadDir(filepath.Dir(dbf.f.Name())); err == nil && len(files) != 3 {
+				var names []string
+				for _, f := range files {
+					names = append(names, f.Name())
+				}
+				t.Errorf("want the DBF, FPT and CDX file, have %v", names)
+			}
+		})
+	}
+}
+
+func TestBuildIndexHeaders(t *testing.T) {
+	dbf := buildDbase30Index(t, IndexOptions{})
+	data, err := ioutil.ReadFile(cdxFilename(dbf.f.Name()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := bytes.NewReader(data)
+	compound, err := readCDXTag(r, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compound.trail = 0
+	offsets := []uint32{0}
+	err = compound.walk(func(key []byte, offset uint32) error {
+		offsets = append(offsets, offset)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(offsets) != 5 {
+		t.Fatalf("want the compound header and 4 tag headers, have offsets %v", offsets)
+	}
+	// without free nodes the free node list pointer is -1
+	for _, offset := range offsets {
+		if free := binary.LittleEndian.Uint32(data[offset+4:]); free != cdxNoPage {
+			t.Errorf("header at %d: want free node list pointer %x, have %x", offset, uint32(cdxNoPage), free)
+		}
+	}
+}
+
+func TestBuildIndexSetsFlag(t *testing.T) {
+	filename := copyTestFiles(t, t.TempDir(), "TEST.DBF")
+	dbf, err := OpenFileRW(filename, new(UTF8Decoder), new(UTF8Encoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbf.Close()
+	if dbf.Header().HasStructuralCDX() {
+		t.Fatal("want TEST.DBF without structural index")
+	}
+	if err := dbf.Reindex(nil); err != ErrNoIndex {
+		t.Errorf("want ErrNoIndex, have %v", err)
+	}
+	if err := dbf.BuildIndex("name", "UPPER(COMP_NAME)", "!DELETED()", nil); err != nil {
+		t.Fatal(err)
+	}
+	if !dbf.Header().HasStructuralCDX() {
+		t.Error("want structural index flag set")
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(filename), "TEST.CDX")); err != nil {
+		t.Error(err)
+	}
+
+	// the flag is written to the file, the index is opened automatically
+	ro, err := OpenFile(filename, new(UTF8Decoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ro.Close()
+	if !ro.Header().HasStructuralCDX() {
+		t.Error("want structural index flag in the file")
+	}
+	c := ro.NewCursor()
+	if err := c.SetOrder("NAME"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.GoTop(); err != nil {
+		t.Fatal(err)
+	}
+	recnos, err := skipAll(c, 1)
+	if err != ErrEOF {
+		t.Errorf("want ErrEOF, have %v", err)
+	}
+	// record 1 is deleted
+	var prev string
+	for _, recno := range recnos {
+		if recno == 1 {
+			t.Error("want deleted record 1 not in tag NAME")
+		}
+		rec, err := ro.RecordAt(recno)
+		if err != nil {
+			t.Fatal(err)
+		}
+		v, _ := rec.Field(ro.FieldPos("COMP_NAME"))
+		name := strings.ToUpper(v.(string))
+		if name < prev {
+			t.Errorf("record %d (%s) after %s", recno, name, prev)
+		}
+		prev = name
+	}
+	if len(recnos) != 3 {
+		t.Errorf("want 3 records in tag NAME, have %v", recnos)
+	}
+}
+
+func TestBuildIndexReplace(t *testing.T) {
+	dbf := buildDbase30Index(t, IndexOptions{})
+
+	// an ordered cursor of the old index must set its order again
+	c := dbf.NewCursor()
+	if err := c.SetOrder("ACCESSNO"); err != nil {
+		t.Fatal(err)
+	}
+
+	// replacing a tag keeps the other tags
+	if err := dbf.BuildIndex("accessno", "LEFT(ACCESSNO, 4)", "", nil); err != nil {
+		t.Fatal(err)
+	}
+	tags, err := dbf.Tags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) != 4 || tags[0].Key != "LEFT(ACCESSNO, 4)" || tags[0].KeyLen != 4 {
+		t.Errorf("want 4 tags with key LEFT(ACCESSNO, 4) of length 4, have %+v", tags)
+	}
+	if err := c.SetOrder("ACCESSNO"); err != nil {
+		t.Fatal(err)
+	}
+	if found, err := c.Seek("2003"); err != nil || !found || c.RecNo() != 18 {
+		t.Errorf("want 2003 found on record 18, have %v on %d (%v)", found, c.RecNo(), err)
+	}
+
+	if err := dbf.Reindex(nil); err != nil {
+		t.Fatal(err)
+	}
+	if have, err := dbf.Tags(); err != nil || !reflect.DeepEqual(have, tags) {
+		t.Errorf("want tags %+v after Reindex, have %+v (%v)", tags, have, err)
+	}
+
+	// a damaged index is replaced by an index with only the new tag
+	if err := ioutil.WriteFile(cdxFilename(dbf.f.Name()), []byte("damaged"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := dbf.Reindex(nil); !errors.Is(err, ErrInvalidIndex) {
+		t.Errorf("want ErrInvalidIndex, have %v", err)
+	}
+	if err := dbf.BuildIndex("CATDATE", "CATDATE", "", nil); err != nil {
+		t.Fatal(err)
+	}
+	if tags, err := dbf.Tags(); err != nil || len(tags) != 1 || tags[0].Name != "CATDATE" {
+		t.Errorf("want tag CATDATE, have %+v (%v)", tags, err)
+	}
+}
+
+func TestBuildIndexErrors(t *testing.T) {
+	if err := testDbf.BuildIndex("ID", "ID", "", nil); err != ErrReadOnly {
+		t.Errorf("want ErrReadOnly, have %v", err)
+	}
+
+	filename := copyTestFiles(t, t.TempDir(), "dbase_30.dbf")
+	dbf, err := OpenFileRW(filename, new(Win1250Decoder), new(Win1250Encoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbf.Close()
+	tests := []struct {
+		name, key, forExpr string
+		err                error
+	}{
+		{"", "ACCESSNO", "", nil},
+		{"TOOLONGNAME", "ACCESSNO", "", nil},
+		{"1TAG", "ACCESSNO", "", nil},
+		{"TAG", "MISSING", "", nil},
+		{"TAG", "REPLICATE('x', 300)", "", nil},
+		{"TAG", "ACCESSNO", "ACQVALUE", ErrFieldType},
+	}
+	for _, test := range tests {
+		err := dbf.BuildIndex(test.name, test.key, test.forExpr, nil)
+		if err == nil || test.err != nil && !errors.Is(err, test.err) {
+			t.Errorf("BuildIndex(%q, %q, %q): want error %v, have %v", test.name, test.key, test.forExpr, test.err, err)
+		}
+	}
+	if _, err := os.Stat(cdxFilename(filename)); !os.IsNotExist(err) {
+		t.Errorf("want no CDX file after errors, have %v", err)
+	}
+}
+
+func TestBuildIndexLarge(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "large.dbf")
+	dbf, err := CreateFile(filename, newFields(t, "ID", byte('I'), 4, 0, "NAME", byte('C'), 20, 0),
+		new(Win1250Decoder), new(Win1250Encoder), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbf.Close()
+	const numrec = 5000
+	for i := 0; i < numrec; i++ {
+		// names with a common prefix and a varying length, so keys have duplicate and trailing bytes
+		name := fmt.Sprintf("NAME%0*d", 1+i%7, (i*7919)%numrec)
+		if _, err := dbf.Append([]interface{}{int32(i), name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	opts := &IndexOptions{MaxKeysInMemory: 700, TempDir: t.TempDir()}
+	if err := dbf.BuildIndex("NAME", "NAME", "", opts); err != nil {
+		t.Fatal(err)
+	}
+	if err := dbf.BuildIndex("ID", "ID", "", opts); err != nil {
+		t.Fatal(err)
+	}
+	for _, tag := range []string{"NAME", "ID"} {
+		expr := tag
+		want := testIndexKeys(t, dbf, expr, "", map[string]int{"NAME": 20, "ID": 8}[tag], false)
+		if have := tagKeys(t, dbf, tag); !reflect.DeepEqual(have, want) {
+			t.Errorf("tag %s: keys differ, want %d keys, have %d", tag, len(want), len(have))
+		}
+	}
+
+	// the tag has leaves below interior nodes below the root
+	idx, err := dbf.index()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag, err := idx.tag("NAME")
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := tag.node(tag.root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	child, err := tag.node(root.children[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root.leaf || child.leaf {
+		t.Error("want a tag with 3 levels")
+	}
+
+	c := dbf.NewCursor()
+	if err := c.SetOrder("NAME"); err != nil {
+		t.Fatal(err)
+	}
+	for _, i := range []int{0, 1234, numrec - 1} {
+		name := fmt.Sprintf("NAME%0*d", 1+i%7, (i*7919)%numrec)
+		if found, err := c.Seek(name); err != nil || !found || c.RecNo() != uint32(i) {
+			t.Errorf("want %s found on record %d, have %v on %d (%v)", name, i, found, c.RecNo(), err)
+		}
+	}
+}
+
+// checkTagKeys checks the keys of the tags built by buildDbase30Index against the records of dbf
+func checkTagKeys(t *testing.T, dbf *DBF) {
+	t.Helper()
+	want := testIndexKeys(t, dbf, "ACCESSNO", "", 15, false)
+	if have := tagKeys(t, dbf, "ACCESSNO"); !reflect.DeepEqual(have, want) {
+		t.Errorf("want keys %v, have %v", want, have)
+	}
+}
+
+func TestAppendOutdatesIndex(t *testing.T) {
+	dbf := buildDbase30Index(t, IndexOptions{})
+	filename := dbf.f.Name()
+	values := make([]interface{}, dbf.NumFields())
+	values[dbf.FieldPos("ACCESSNO")] = "0001"
+
+	// the flag is cleared before the record is written, the outdated index is not used
+	if _, err := dbf.Append(values); err != nil {
+		t.Fatal(err)
+	}
+	if dbf.Header().HasStructuralCDX() {
+		t.Error("want structural index flag cleared by Append")
+	}
+	ro, err := OpenFile(filename, new(Win1250Decoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ro.Header().HasStructuralCDX() {
+		t.Error("want structural index flag cleared in the file")
+	}
+	if err := ro.NewCursor().SetOrder("ACCESSNO"); err != ErrNoIndex {
+		t.Errorf("want ErrNoIndex for another handle, have %v", err)
+	}
+	ro.Close()
+	if err := dbf.NewCursor().SetOrder("ACCESSNO"); err != ErrIndexOutdated {
+		t.Errorf("want ErrIndexOutdated, have %v", err)
+	}
+	if err := dbf.Reindex(nil); err != nil {
+		t.Fatal(err)
+	}
+	if !dbf.Header().HasStructuralCDX() {
+		t.Error("want structural index flag set by Reindex")
+	}
+	checkTagKeys(t, dbf)
+
+	// the index is not changed in a transaction, a rollback restores the flag
+	if err := dbf.Begin(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dbf.Append(values); err != nil {
+		t.Fatal(err)
+	}
+	if err := dbf.Reindex(nil); err != ErrInTransaction {
+		t.Errorf("want ErrInTransaction, have %v", err)
+	}
+	if err := dbf.BuildIndex("ACCESSNO", "ACCESSNO", "", nil); err != ErrInTransaction {
+		t.Errorf("want ErrInTransaction, have %v", err)
+	}
+	if err := dbf.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if !dbf.Header().HasStructuralCDX() {
+		t.Error("want structural index flag restored by Rollback")
+	}
+	if err := dbf.NewCursor().SetOrder("ACCESSNO"); err != nil {
+		t.Errorf("want the index used after Rollback, have %v", err)
+	}
+	checkTagKeys(t, dbf)
+
+	// Close rebuilds the index
+	if _, err := dbf.Append(values); err != nil {
+		t.Fatal(err)
+	}
+	if err := dbf.Close(); err != nil {
+		t.Fatal(err)
+	}
+	dbf, err = OpenFile(filename, new(Win1250Decoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbf.Close()
+	if !dbf.Header().HasStructuralCDX() {
+		t.Error("want structural index flag set by Close")
+	}
+	checkTagKeys(t, dbf)
+}
+
+func TestRollbackRestoresIndexOnError(t *testing.T) {
+	dbf := buildDbase30Index(t, IndexOptions{})
+	values := make([]interface{}, dbf.NumFields())
+	values[dbf.FieldPos("ACCESSNO")] = "0001"
+	if err := dbf.Begin(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dbf.Append(values); err != nil {
+		t.Fatal(err)
+	}
+	// the journal is replaced by a directory that can not be removed after the table is restored
+	name := journalFilename(dbf.f.Name())
+	testHookJournalEmptied = func() {
+		if err := os.Rename(name, name+"-moved"); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.MkdirAll(filepath.Join(name, "dir"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer func() { testHookJournalEmptied = func() {} }()
+	if err := dbf.Rollback(); err == nil {
+		t.Error("want error removing the journal")
+	}
+	if !dbf.Header().HasStructuralCDX() || dbf.reindex {
+		t.Error("want structural index flag restored by Rollback")
+	}
+	if err := dbf.NewCursor().SetOrder("ACCESSNO"); err != nil {
+		t.Errorf("want the index used after Rollback, have %v", err)
+	}
+}
+
+func TestCloseReindexError(t *testing.T) {
+	dbf := buildDbase30Index(t, IndexOptions{})
+	values := make([]interface{}, dbf.NumFields())
+	values[dbf.FieldPos("ACCESSNO")] = "0001"
+	if _, err := dbf.Append(values); err != nil {
+		t.Fatal(err)
+	}
+	// the tags can not be read anymore, the index can not be rebuilt
+	cdx := cdxFilename(dbf.f.Name())
+	if err := os.Remove(cdx); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(cdx, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := dbf.Close(); err == nil {
+		t.Error("want error rebuilding the index")
+	}
+	// the files are closed anyway
+	if _, err := dbf.f.Stat(); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("want DBF closed, have %v", err)
+	}
+}
+
+func TestAppendUnsupportedIndex(t *testing.T) {
+	filename := copyTestFiles(t, t.TempDir(), "dbase_30.dbf")
+	cdx := writeTestCDX(t, []testTag{{name: "UDF", key: "MYUDF(ACCESSNO)", keyLen: 15, pad: ' ', perLeaf: 4}})
+	if err := ioutil.WriteFile(cdxFilename(filename), cdx, 0644); err != nil {
+		t.Fatal(err)
+	}
+	dbf, err := OpenFileRW(filename, new(Win1250Decoder), new(Win1250Encoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbf.Close()
+
+	// the tag can not be rebuilt, so the table is not changed
+	n := dbf.NumRecords()
+	if _, err := dbf.Append(make([]interface{}, dbf.NumFields())); err == nil {
+		t.Error("want error appending to a table with an index that can not be rebuilt")
+	}
+	if dbf.NumRecords() != n || !dbf.Header().HasStructuralCDX() {
+		t.Errorf("want %d records and the structural index flag, have %d records", n, dbf.NumRecords())
+	}
+}
@@ -16,3 +16,9 @@ func J2YMD(d int) (int, int, int) {
 	i = 100*(n-49) + i + l
 	return i, j, k
 }
+
+// YMD2J converts a year, month and day to a Julian day number
+// jd.YMD2J(2006, 1, 2) == 2453738 //=> true
+func YMD2J(y, m, d int) int {
+	return d - 32075 + 1461*(y+4800+(m-14)/12)/4 + 367*(m-2-(m-14)/12*12)/12 - 3*((y+4900+(m-14)/12)/100)/4
+}
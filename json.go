@@ -0,0 +1,242 @@
+package dbf
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"math"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+// JSONOptions contains the options for WriteJSON, the zero value is a valid configuration
+type JSONOptions struct {
+	NDJSON           bool        // Write newline delimited JSON, one object per line, instead of a JSON array
+	TrimSpaces       bool        // Trim leading and trailing spaces from C and M fields
+	Deleted          DeletedMode // Handling of deleted records, defaults to SkipDeleted
+	DeletedField     bool        // Add a member _DELETED containing true or false to every object
+	SkipMemos        bool        // Do not export memo fields, this avoids reading the FPT file
+	DateFormat       string      // Time layout for D fields, defaults to time.RFC3339Nano like encoding/json
+	DateTimeFormat   string      // Time layout for T fields, defaults to time.RFC3339Nano like encoding/json
+	EmptyDatesAsNull bool        // Write empty D and T fields as null instead of the formatted zero time
+}
+
+// WriteJSON writes all records to w as a JSON array of objects, or as newline delimited JSON when opts.NDJSON is set.
+// The object members are written in field order. Binary memos are written as base64 strings.
+// Records are read one at a time and written without intermediate maps, which makes this much faster than
+// calling RecordToJSON for every record.
+// The record pointer is not moved.
+func (dbf *DBF) WriteJSON(w io.Writer, opts *JSONOptions) error {
+	if opts == nil {
+		opts = new(JSONOptions)
+	}
+	dateFormat, dateTimeFormat := opts.DateFormat, opts.DateTimeFormat
+	if dateFormat == "" {
+		dateFormat = time.RFC3339Nano
+	}
+	if dateTimeFormat == "" {
+		dateTimeFormat = time.RFC3339Nano
+	}
+
+	// the exported fields and their member names, including the colon, are determined once
+	var fieldpos []int
+	var names [][]byte
+	for i, f := range dbf.fields {
+		if opts.SkipMemos && isMemoType(f.Type) {
+			continue
+		}
+		name, err := json.Marshal(f.FieldName())
+		if err != nil {
+			return err
+		}
+		fieldpos = append(fieldpos, i)
+		names = append(names, append(name, ':'))
+	}
+
+	bw := bufio.NewWriter(w)
+	if !opts.NDJSON {
+		bw.WriteByte('[')
+	}
+	offsets := dbf.offsets
+	var buf []byte
+	first := true
+	var data []byte // reused for every record
+	for recno := uint32(0); recno < dbf.header.NumRec; recno++ {
+		var err error
+		data, err = dbf.readRecordInto(recno, data)
+		if err != nil {
+			return err
+		}
+		deleted := data[0] == 0x2A
+		if !opts.Deleted.Include(deleted) {
+			continue
+		}
+
+		buf = buf[:0]
+		if !first && !opts.NDJSON {
+			buf = append(buf, ',')
+		}
+		first = false
+		buf = append(buf, '{')
+		if opts.DeletedField {
+			buf = append(buf, `"_DELETED":`...)
+			buf = strconv.AppendBool(buf, deleted)
+		}
+		for n, i := range fieldpos {
+			if n > 0 || opts.DeletedField {
+				buf = append(buf, ',')
+			}
+			buf = append(buf, names[n]...)
+
+			f := &dbf.fields[i]
+			raw := data[offsets[i] : offsets[i]+int(f.Len)]
+			if f.Type == 'C' {
+				// C fields are decoded directly to avoid the string allocation of fieldDataToValue
+				b, err := dbf.dec.Decode(raw)
+				if err != nil {
+					return dbf.newFieldError(recno, i, dbf.recordOffset(recno)+int64(offsets[i]), raw, err)
+				}
+				if opts.TrimSpaces {
+					b = trimSpaces(b)
+				}
+				buf = appendJSONString(buf, b)
+				continue
+			}
+
+			val, err := dbf.fieldDataToValue(raw, i)
+			if err != nil {
+				return dbf.newFieldError(recno, i, dbf.recordOffset(recno)+int64(offsets[i]), raw, err)
+			}
+			switch v := val.(type) {
+			case string:
+				b := []byte(v)
+				if opts.TrimSpaces {
+					b = trimSpaces(b)
+				}
+				buf = appendJSONString(buf, b)
+			case []byte:
+				buf = append(buf, '"')
+				n := len(buf)
+				buf = append(buf, make([]byte, base64.StdEncoding.EncodedLen(len(v)))...)
+				base64.StdEncoding.Encode(buf[n:], v)
+				buf = append(buf, '"')
+			case bool:
+				buf = strconv.AppendBool(buf, v)
+			case int32:
+				buf = strconv.AppendInt(buf, int64(v), 10)
+			case int64:
+				buf = strconv.AppendInt(buf, v, 10)
+			case float64:
+				buf = appendJSONFloat(buf, v)
+			case time.Time:
+				switch {
+				case v.IsZero() && opts.EmptyDatesAsNull:
+					buf = append(buf, "null"...)
+				case f.Type == 'D':
+					buf = appendJSONString(buf, []byte(v.Format(dateFormat)))
+				default:
+					buf = appendJSONString(buf, []byte(v.Format(dateTimeFormat)))
+				}
+			default:
+				buf = append(buf, "null"...)
+			}
+		}
+		buf = append(buf, '}')
+		if opts.NDJSON {
+			buf = append(buf, '\n')
+		}
+		if _, err := bw.Write(buf); err != nil {
+			return err
+		}
+	}
+	if !opts.NDJSON {
+		bw.WriteString("]\n")
+	}
+	return bw.Flush()
+}
+
+// trimSpaces trims leading and trailing spaces from b
+func trimSpaces(b []byte) []byte {
+	for len(b) > 0 && b[0] == ' ' {
+		b = b[1:]
+	}
+	for len(b) > 0 && b[len(b)-1] == ' ' {
+		b = b[:len(b)-1]
+	}
+	return b
+}
+
+// appendJSONFloat appends f to buf in the same format as encoding/json, NaN and infinity are written as null
+func appendJSONFloat(buf []byte, f float64) []byte {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return append(buf, "null"...)
+	}
+	format := byte('f')
+	if abs := math.Abs(f); abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		format = 'e'
+	}
+	n := len(buf)
+	buf = strconv.AppendFloat(buf, f, format, -1, 64)
+	if format == 'e' {
+		// clean up e-09 to e-9
+		if l := len(buf); l-n >= 4 && buf[l-4] == 'e' && buf[l-3] == '-' && buf[l-2] == '0' {
+			buf[l-2] = buf[l-1]
+			buf = buf[:l-1]
+		}
+	}
+	return buf
+}
+
+const hexDigits = "0123456789abcdef"
+
+// appendJSONString appends the UTF8 data in s to buf as a quoted JSON string.
+// Invalid UTF8 is replaced by the Unicode replacement character, like encoding/json does.
+func appendJSONString(buf []byte, s []byte) []byte {
+	buf = append(buf, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		if c := s[i]; c < utf8.RuneSelf {
+			if c >= 0x20 && c != '"' && c != '\\' {
+				i++
+				continue
+			}
+			buf = append(buf, s[start:i]...)
+			switch c {
+			case '"', '\\':
+				buf = append(buf, '\\', c)
+			case '\n':
+				buf = append(buf, '\\', 'n')
+			case '\r':
+				buf = append(buf, '\\', 'r')
+			case '\t':
+				buf = append(buf, '\\', 't')
+			default:
+				buf = append(buf, '\\', 'u', '0', '0', hexDigits[c>>4], hexDigits[c&0xF])
+			}
+			i++
+			start = i
+			continue
+		}
+		r, size := utf8.DecodeRune(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			buf = append(buf, s[start:i]...)
+			buf = append(buf, "\ufffd"...)
+			i += size
+			start = i
+			continue
+		}
+		// U+2028 and U+2029 are valid JSON but not valid JavaScript, encoding/json escapes them as well
+		if r == '\u2028' || r == '\u2029' {
+			buf = append(buf, s[start:i]...)
+			buf = append(buf, '\\', 'u', '2', '0', '2', hexDigits[r&0xF])
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	buf = append(buf, s[start:]...)
+	return append(buf, '"')
+}
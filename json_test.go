@@ -0,0 +1,123 @@
+package dbf
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWriteJSON(t *testing.T) {
+	buf := new(bytes.Buffer)
+	if err := testDbf.WriteJSON(buf, &JSONOptions{TrimSpaces: true, Deleted: IncludeDeleted}); err != nil {
+		t.Fatal(err)
+	}
+	var have []map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &have); err != nil {
+		t.Fatalf("invalid JSON %s: %s", buf.String(), err)
+	}
+	if len(have) != int(testDbf.NumRecords()) {
+		t.Fatalf("want %d records, have %d", testDbf.NumRecords(), len(have))
+	}
+
+	// the output should be the same as RecordToJSON
+	for i := range have {
+		b, err := testDbf.RecordToJSON(uint32(i), true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var want map[string]interface{}
+		if err := json.Unmarshal(b, &want); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(want, have[i]) {
+			t.Errorf("record %d: want %v, have %v", i, want, have[i])
+		}
+	}
+	if !strings.HasPrefix(buf.String(), `[{"ID":1,"NIVEAU":0,"DATUM":"2015-01-03T00:00:00Z",`) {
+		t.Errorf("want members in field order, have %s", buf.String())
+	}
+}
+
+func TestWriteJSONOptions(t *testing.T) {
+	buf := new(bytes.Buffer)
+	opts := &JSONOptions{
+		NDJSON:           true,
+		DeletedField:     true,
+		SkipMemos:        true,
+		DateFormat:       "2006-01-02",
+		EmptyDatesAsNull: true,
+	}
+	if err := testDbf.WriteJSON(buf, opts); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("want 3 lines, have:\n%s", buf.String())
+	}
+	if !strings.HasPrefix(lines[0], `{"_DELETED":false,"ID":1,"NIVEAU":0,"DATUM":"2015-01-03","TIJD":"15:00   ",`) {
+		t.Errorf("unexpected first line %s", lines[0])
+	}
+	if strings.Contains(buf.String(), "MELDING") {
+		t.Error("want no memo fields")
+	}
+	if !strings.Contains(lines[2], `"DATUM":null`) {
+		t.Errorf("want empty date as null in %s", lines[2])
+	}
+}
+
+func TestAppendJSONString(t *testing.T) {
+	for _, s := range []string{"", "plain", `quote " and \ backslash`, "tab\tnewline\n\r\x00\x1f", "Tësting wíth éncôdings!", "  ", "invalid \xff utf8"} {
+		want, _ := json.Marshal(s)
+		if have := appendJSONString(nil, []byte(s)); !bytes.Equal(want, have) {
+			t.Errorf("want %s, have %s", want, have)
+		}
+	}
+}
+
+func TestAppendJSONFloat(t *testing.T) {
+	for _, f := range []float64{0, 1, -1.5, 123456789.99, 1e-7, 1e21, 0.000001} {
+		want, _ := json.Marshal(f)
+		if have := appendJSONFloat(nil, f); !bytes.Equal(want, have) {
+			t.Errorf("want %s, have %s", want, have)
+		}
+	}
+}
+
+func BenchmarkWriteJSON(b *testing.B) {
+	dbf, err := OpenFile(filepath.Join("testdata", "dbase_30.dbf"), new(Win1250Decoder))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer dbf.Close()
+
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		if err := dbf.WriteJSON(ioutil.Discard, &JSONOptions{TrimSpaces: true}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// Benchmark for the same output as BenchmarkWriteJSON using RecordToJSON
+func BenchmarkRecordToJSONAllRecords(b *testing.B) {
+	dbf, err := OpenFile(filepath.Join("testdata", "dbase_30.dbf"), new(Win1250Decoder))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer dbf.Close()
+
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		for i := uint32(0); i < dbf.NumRecords(); i++ {
+			if _, err := dbf.RecordToJSON(i, true); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
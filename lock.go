@@ -0,0 +1,156 @@
+package dbf
+
+import (
+	"errors"
+	"os"
+)
+
+// ErrLocked is returned when a record or the table is locked by another process
+var ErrLocked = errors.New("locked by another process")
+
+// Visual FoxPro locks byte ranges far beyond the end of the file, counting down from lockBase.
+// Using the same offsets makes the locks visible to VFP applications using the same files.
+const (
+	lockBase     = 0x7FFFFFFE // header lock, used while appending records
+	fileLockSize = 0x3FFFFFFD // size of the file lock, which covers the record locks below lockBase
+)
+
+// recordLockOffset returns the offset of the lock of record recno (zero based), VFP record numbers start at 1
+func recordLockOffset(recno uint32) int64 {
+	return lockBase - int64(recno) - 1
+}
+
+// OpenFileShared opens a DBF file (and FPT if needed) from disk for reading while other processes write to it.
+// Reading a record that is locked by another process, or while the table is locked using LockFile,
+// returns a *RecordError or *FieldError with ErrLocked.
+// Locks are only checked on Linux, on other platforms this is the same as OpenFile.
+// After a successful call the caller should call DBF.Close() to close the file handle(s).
+func OpenFileShared(filename string, dec Decoder) (*DBF, error) {
+	dbf, err := openFile(filename, dec, os.O_RDONLY, true)
+	if err != nil {
+		return nil, err
+	}
+	dbf.shared = true
+	return dbf, nil
+}
+
+// Shared returns true if the table is opened with OpenFileShared
+func (dbf *DBF) Shared() bool {
+	return dbf.shared
+}
+
+// LockRecord locks record recno (zero based) using the same lock as VFP's RLOCK(), it does not wait for the lock.
+// Returns ErrLocked when the record or the table is locked by another process.
+// The table must be opened for writing, locks are released by Unlock, UnlockRecord or Close.
+//
+// Locks are fcntl locks on Linux which belong to the process, they do not prevent other goroutines or
+// other handles of the same table in this process from writing, and closing any handle of the table
+// in this process releases all its locks. On other platforms no locks are set.
+func (dbf *DBF) LockRecord(recno uint32) error {
+	if err := dbf.checkLockable(); err != nil {
+		return err
+	}
+	if recno >= dbf.header.NumRec {
+		return ErrEOF
+	}
+	if err := lockRange(dbf.f, recordLockOffset(recno), 1, true, false); err != nil {
+		return err
+	}
+	if dbf.locks == nil {
+		dbf.locks = make(map[uint32]bool)
+	}
+	dbf.locks[recno] = true
+	return nil
+}
+
+// LockFile locks the table using the same lock as VFP's FLOCK(), it does not wait for the lock.
+// Returns ErrLocked when the table or one of its records is locked by another process.
+// Other processes can not lock records while the table is locked.
+func (dbf *DBF) LockFile() error {
+	if err := dbf.checkLockable(); err != nil {
+		return err
+	}
+	if err := lockRange(dbf.f, lockBase-fileLockSize, fileLockSize, true, false); err != nil {
+		return err
+	}
+	dbf.filelocked = true
+	return nil
+}
+
+// IsLocked returns if record recno is locked by this table handle, or if the table is locked when using LockFile
+func (dbf *DBF) IsLocked(recno uint32) bool {
+	return dbf.filelocked || dbf.locks[recno]
+}
+
+// UnlockRecord releases the lock on record recno, the record stays locked while the table is locked using LockFile
+func (dbf *DBF) UnlockRecord(recno uint32) error {
+	if !dbf.locks[recno] {
+		return nil
+	}
+	delete(dbf.locks, recno)
+	if dbf.filelocked {
+		// releasing the byte would leave a hole in the file lock
+		return nil
+	}
+	return unlockRange(dbf.f, recordLockOffset(recno), 1)
+}
+
+// Unlock releases all record locks and the file lock held by this table handle, like VFP's UNLOCK
+func (dbf *DBF) Unlock() error {
+	if dbf.filelocked {
+		// the file lock range covers all record locks
+		dbf.filelocked = false
+		dbf.locks = nil
+		return unlockRange(dbf.f, lockBase-fileLockSize, fileLockSize)
+	}
+	for recno := range dbf.locks {
+		if err := unlockRange(dbf.f, recordLockOffset(recno), 1); err != nil {
+			return err
+		}
+		delete(dbf.locks, recno)
+	}
+	return nil
+}
+
+// checkLockable returns an error if the table can not be locked
+func (dbf *DBF) checkLockable() error {
+	if dbf.f == nil {
+		return ErrNoDBFFile
+	}
+	if !dbf.rw {
+		return ErrReadOnly
+	}
+	return nil
+}
+
+// checkRecordLock returns ErrLocked for shared tables when record recno is locked by another process
+func (dbf *DBF) checkRecordLock(recno uint32) error {
+	if !dbf.shared {
+		return nil
+	}
+	locked, err := testRange(dbf.f, recordLockOffset(recno), 1)
+	if err != nil {
+		return err
+	}
+	if locked {
+		return ErrLocked
+	}
+	return nil
+}
+
+// lockHeader locks the header of the table, processes appending records wait for each other.
+// Tables not opened from disk are not locked.
+func (dbf *DBF) lockHeader() error {
+	if dbf.f == nil {
+		return nil
+	}
+	return lockRange(dbf.f, lockBase, 1, true, true)
+}
+
+// unlockHeader releases the lock set by lockHeader
+func (dbf *DBF) unlockHeader() error {
+	if dbf.f == nil {
+		return nil
+	}
+	return unlockRange(dbf.f, lockBase, 1)
+}
@@ -0,0 +1,48 @@
+//go:build linux
+// +build linux
+
+package dbf
+
+import (
+	"io"
+	"os"
+	"syscall"
+)
+
+// lockRange sets an fcntl lock on length bytes at offset of f, an exclusive (write) or shared (read) lock.
+// If wait is true it waits until the lock is available, otherwise ErrLocked is returned when the range is locked.
+func lockRange(f *os.File, offset, length int64, exclusive, wait bool) error {
+	lk := syscall.Flock_t{Type: syscall.F_RDLCK, Whence: io.SeekStart, Start: offset, Len: length}
+	if exclusive {
+		lk.Type = syscall.F_WRLCK
+	}
+	cmd := syscall.F_SETLK
+	if wait {
+		cmd = syscall.F_SETLKW
+	}
+	for {
+		err := syscall.FcntlFlock(f.Fd(), cmd, &lk)
+		switch err {
+		case syscall.EINTR:
+			continue
+		case syscall.EAGAIN, syscall.EACCES:
+			return ErrLocked
+		}
+		return err
+	}
+}
+
+// unlockRange releases the lock on length bytes at offset of f
+func unlockRange(f *os.File, offset, length int64) error {
+	lk := syscall.Flock_t{Type: syscall.F_UNLCK, Whence: io.SeekStart, Start: offset, Len: length}
+	return syscall.FcntlFlock(f.Fd(), syscall.F_SETLK, &lk)
+}
+
+// testRange returns if any of the length bytes at offset of f is write locked by another process
+func testRange(f *os.File, offset, length int64) (bool, error) {
+	lk := syscall.Flock_t{Type: syscall.F_RDLCK, Whence: io.SeekStart, Start: offset, Len: length}
+	if err := syscall.FcntlFlock(f.Fd(), syscall.F_GETLK, &lk); err != nil {
+		return false, err
+	}
+	return lk.Type != syscall.F_UNLCK, nil
+}
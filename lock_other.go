@@ -0,0 +1,21 @@
+//go:build !linux
+// +build !linux
+
+package dbf
+
+import "os"
+
+// lockRange is not supported on this platform, tables are not locked
+func lockRange(f *os.File, offset, length int64, exclusive, wait bool) error {
+	return nil
+}
+
+// unlockRange is not supported on this platform
+func unlockRange(f *os.File, offset, length int64) error {
+	return nil
+}
+
+// testRange is not supported on this platform, ranges are never locked
+func testRange(f *os.File, offset, length int64) (bool, error) {
+	return false, nil
+}
@@ -0,0 +1,340 @@
+package dbf
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// lockHelperEnv is set for the test binary started by startLockHelper
+const lockHelperEnv = "DBF_LOCK_HELPER"
+
+// TestLockHelperProcess is not a real test, it is run by startLockHelper in another process.
+// The action is one of record:<file>:<recno>, file:<file>, append:<file>:<count>, transaction:<file> or commit:<file>.
+// After locking "locked" is written to stdout and the lock is held until stdin is closed.
+// The transaction action appends a record in a transaction and exits without committing, like a crash.
+// The commit action appends a record in a transaction and commits it, it holds the lock while the journal is
+// emptied but not yet removed.
+func TestLockHelperProcess(t *testing.T) {
+	action := os.Getenv(lockHelperEnv)
+	if action == "" {
+		return
+	}
+	args := strings.Split(action, ":")
+	dbf, err := OpenFileRW(args[1], new(Win1250Decoder), new(Win1250Encoder))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	switch args[0] {
+	case "record":
+		recno, _ := strconv.Atoi(args[2])
+		err = dbf.LockRecord(uint32(recno))
+	case "file":
+		err = dbf.LockFile()
+	case "append":
+		n, _ := strconv.Atoi(args[2])
+		for i := 0; i < n && err == nil; i++ {
+			_, err = dbf.Append([]interface{}{nil, fmt.Sprintf("pid %d", os.Getpid())})
+		}
+		dbf.Close()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		os.Exit(0)
+	case "commit":
+		if err = dbf.Begin(); err == nil {
+			values := make([]interface{}, dbf.NumFields())
+			values[9] = "committed"
+			_, err = dbf.Append(values)
+		}
+		testHookJournalEmptied = func() {
+			fmt.Println("locked")
+			io.Copy(ioutil.Discard, os.Stdin)
+		}
+		if err == nil {
+			err = dbf.Commit()
+		}
+		if err == nil {
+			err = dbf.Close()
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		os.Exit(0)
+	case "transaction":
+		if err = dbf.Begin(); err == nil {
+			values := make([]interface{}, dbf.NumFields())
+			values[9] = "uncommitted"
+			_, err = dbf.Append(values)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		fmt.Println("locked")
+		io.Copy(ioutil.Discard, os.Stdin)
+		os.Exit(0)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	fmt.Println("locked")
+	io.Copy(ioutil.Discard, os.Stdin)
+	dbf.Close()
+	os.Exit(0)
+}
+
+// startLockHelper runs TestLockHelperProcess in another process and waits until it holds the lock.
+// The returned function releases the lock and waits for the process to exit.
+func startLockHelper(t *testing.T, action string) func() {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], "-test.run=^TestLockHelperProcess$")
+	cmd.Env = append(os.Environ(), lockHelperEnv+"="+action)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() && scanner.Text() != "locked" {
+	}
+	if scanner.Text() != "locked" {
+		cmd.Wait()
+		t.Fatalf("helper process %s did not lock", action)
+	}
+	return func() {
+		stdin.Close()
+		io.Copy(ioutil.Discard, stdout)
+		if err := cmd.Wait(); err != nil {
+			t.Errorf("helper process %s: %s", action, err)
+		}
+	}
+}
+
+func skipLockTests(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("locks are only supported on Linux")
+	}
+}
+
+func TestLockRecordOtherProcess(t *testing.T) {
+	skipLockTests(t)
+	filename := copyTestFiles(t, t.TempDir(), "TEST.DBF")
+	release := startLockHelper(t, "record:"+filename+":1")
+
+	dbf, err := OpenFileRW(filename, new(Win1250Decoder), new(Win1250Encoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbf.Close()
+	if err := dbf.LockRecord(1); err != ErrLocked {
+		t.Errorf("want ErrLocked for a record locked by another process, have %v", err)
+	}
+	if err := dbf.LockRecord(2); err != nil {
+		t.Errorf("want lock on another record, have %v", err)
+	}
+	if err := dbf.LockFile(); err != ErrLocked {
+		t.Errorf("want ErrLocked for a file lock while a record is locked, have %v", err)
+	}
+
+	shared, err := OpenFileShared(filename, new(Win1250Decoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer shared.Close()
+	if !shared.Shared() || dbf.Shared() {
+		t.Error("want only the table opened with OpenFileShared to be shared")
+	}
+	_, err = shared.RecordAt(1)
+	var recErr *RecordError
+	if !errors.As(err, &recErr) || !errors.Is(err, ErrLocked) || recErr.RecNo != 1 {
+		t.Errorf("want *RecordError with ErrLocked for record 1, have %v", err)
+	}
+	shared.GoTo(1)
+	if _, err := shared.Field(0); !errors.Is(err, ErrLocked) {
+		t.Errorf("want ErrLocked reading a field of a locked record, have %v", err)
+	}
+	// records locked by this process can be read
+	if _, err := shared.RecordAt(2); err != nil {
+		t.Errorf("want record 2 to be readable, have %v", err)
+	}
+
+	release()
+	if err := dbf.LockRecord(1); err != nil {
+		t.Errorf("want lock after the other process released it, have %v", err)
+	}
+	if _, err := shared.RecordAt(1); err != nil {
+		t.Errorf("want record 1 to be readable after the lock is released, have %v", err)
+	}
+}
+
+func TestLockFileOtherProcess(t *testing.T) {
+	skipLockTests(t)
+	filename := copyTestFiles(t, t.TempDir(), "TEST.DBF")
+	release := startLockHelper(t, "file:"+filename)
+	defer release()
+
+	dbf, err := OpenFileRW(filename, new(Win1250Decoder), new(Win1250Encoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbf.Close()
+	if err := dbf.LockRecord(3); err != ErrLocked {
+		t.Errorf("want ErrLocked for a record of a locked table, have %v", err)
+	}
+	if err := dbf.LockFile(); err != ErrLocked {
+		t.Errorf("want ErrLocked for a locked table, have %v", err)
+	}
+
+	shared, err := OpenFileShared(filename, new(Win1250Decoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer shared.Close()
+	if _, err := shared.RecordAt(0); !errors.Is(err, ErrLocked) {
+		t.Errorf("want ErrLocked reading a locked table, have %v", err)
+	}
+}
+
+func TestAppendOtherProcesses(t *testing.T) {
+	skipLockTests(t)
+	id, err := NewField("ID", 'I', 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id.SetAutoIncrement(1, 1)
+	name, err := NewField("NAME", 'C', 20, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(t.TempDir(), "APPEND.DBF")
+	dbf, err := CreateFile(filename, []FieldHeader{id, name}, new(Win1250Decoder), new(Win1250Encoder), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbf.Close()
+
+	const processes, appends = 4, 50
+	var wg sync.WaitGroup
+	for i := 0; i < processes; i++ {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestLockHelperProcess$")
+		cmd.Env = append(os.Environ(), fmt.Sprintf("%s=append:%s:%d", lockHelperEnv, filename, appends))
+		cmd.Stderr = os.Stderr
+		if err := cmd.Start(); err != nil {
+			t.Fatal(err)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := cmd.Wait(); err != nil {
+				t.Errorf("append process: %s", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	dbf, err = OpenFile(filename, new(Win1250Decoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbf.Close()
+	if dbf.NumRecords() != processes*appends {
+		t.Fatalf("want %d records, have %d", processes*appends, dbf.NumRecords())
+	}
+	var ids []int
+	for recno := uint32(0); recno < dbf.NumRecords(); recno++ {
+		rec, err := dbf.RecordAt(recno)
+		if err != nil {
+			t.Fatal(err)
+		}
+		v, _ := rec.Field(0)
+		ids = append(ids, int(v.(int32)))
+	}
+	sort.Ints(ids)
+	for i, id := range ids {
+		if id != i+1 {
+			t.Fatalf("want unique IDs 1 to %d, have %v", processes*appends, ids)
+		}
+	}
+}
+
+func TestLockState(t *testing.T) {
+	filename := copyTestFiles(t, t.TempDir(), "TEST.DBF")
+	dbf, err := OpenFileRW(filename, new(Win1250Decoder), new(Win1250Encoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbf.Close()
+
+	if err := dbf.LockRecord(4); err != ErrEOF {
+		t.Errorf("want ErrEOF, have %v", err)
+	}
+	if err := dbf.LockRecord(1); err != nil {
+		t.Fatal(err)
+	}
+	if !dbf.IsLocked(1) || dbf.IsLocked(2) {
+		t.Error("want only record 1 to be locked")
+	}
+	if err := dbf.UnlockRecord(1); err != nil || dbf.IsLocked(1) {
+		t.Errorf("want record 1 to be unlocked, have %v", err)
+	}
+	if err := dbf.LockFile(); err != nil {
+		t.Fatal(err)
+	}
+	if err := dbf.LockRecord(2); err != nil {
+		t.Fatal(err)
+	}
+	if !dbf.IsLocked(0) || !dbf.IsLocked(2) {
+		t.Error("want all records to be locked")
+	}
+	if err := dbf.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if dbf.IsLocked(0) || dbf.IsLocked(2) {
+		t.Error("want no records to be locked")
+	}
+	// appending with a locked record
+	if err := dbf.LockRecord(0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dbf.Append(make([]interface{}, dbf.NumFields())); err != nil {
+		t.Fatal(err)
+	}
+	if err := dbf.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+
+	ro, err := OpenFile(filename, new(Win1250Decoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ro.Close()
+	if err := ro.LockRecord(0); err != ErrReadOnly {
+		t.Errorf("want ErrReadOnly, have %v", err)
+	}
+	if err := ro.LockFile(); err != ErrReadOnly {
+		t.Errorf("want ErrReadOnly, have %v", err)
+	}
+}
@@ -0,0 +1,79 @@
+package dbf
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// OpenFileMmap opens a DBF file (and FPT if needed) read-only using memory-mapped IO.
+// Records and memos are read from the mapping without system calls. ReadRecordInto does not copy the
+// record data but returns a slice of the mapping, this data must not be modified and is only valid until Close is called.
+// Memory mapping is only supported on Linux, on other platforms or when mapping the file fails the file is
+// read using the file handle, exactly like OpenFile.
+// The mapping shares the pages of the file: when another process truncates the file while it is mapped, reading
+// a record or memo beyond the new end raises SIGBUS, which crashes the program unless debug.SetPanicOnFault is used.
+// Only map files which are not truncated while they are open, for example by packing or zapping the table.
+// The caller should call DBF.Close() to unmap and close the file(s).
+func OpenFileMmap(filename string, dec Decoder) (*DBF, error) {
+	dbf, err := OpenFile(filename, dec)
+	if err != nil {
+		return nil, err
+	}
+	mapped, err := mmapFile(dbf.f)
+	if err != nil {
+		// fall back to reading using the file handle
+		return dbf, nil
+	}
+	dbf.mapped = mapped
+	dbf.r = bytes.NewReader(mapped)
+
+	if dbf.fptf != nil {
+		if mapped, err := mmapFile(dbf.fptf); err == nil {
+			dbf.fptmapped = mapped
+			dbf.fptr = bytes.NewReader(mapped)
+		}
+	}
+	return dbf, nil
+}
+
+// IsMapped returns if the DBF file is read using memory-mapped IO, see OpenFileMmap
+func (dbf *DBF) IsMapped() bool {
+	return dbf.mapped != nil
+}
+
+// unmap removes the memory mappings of the DBF and FPT file
+func (dbf *DBF) unmap() error {
+	var dbferr, fpterr error
+	if dbf.mapped != nil {
+		dbferr = munmap(dbf.mapped)
+		dbf.mapped = nil
+	}
+	if dbf.fptmapped != nil {
+		fpterr = munmap(dbf.fptmapped)
+		dbf.fptmapped = nil
+	}
+	switch {
+	case dbferr != nil:
+		return fmt.Errorf("error unmapping DBF: %s", dbferr)
+	case fpterr != nil:
+		return fmt.Errorf("error unmapping FPT: %s", fpterr)
+	default:
+		return nil
+	}
+}
+
+// mappedRecord returns the data of record recordpos as a slice of the mapped DBF file.
+// It returns nil when the file is not mapped or the record is incomplete, reading the record
+// using ReadAt then returns the correct error.
+// The capacity of the slice is limited to the record length so appending to it never overwrites the mapping.
+func (dbf *DBF) mappedRecord(recordpos uint32) []byte {
+	if dbf.mapped == nil {
+		return nil
+	}
+	pos := dbf.recordOffset(recordpos)
+	end := pos + int64(dbf.header.RecLen)
+	if end > int64(len(dbf.mapped)) {
+		return nil
+	}
+	return dbf.mapped[pos:end:end]
+}
@@ -0,0 +1,28 @@
+//go:build linux
+// +build linux
+
+package dbf
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// mmapFile maps file f read-only into memory
+func mmapFile(f *os.File) ([]byte, error) {
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := stat.Size()
+	if size <= 0 || int64(int(size)) != size {
+		return nil, errors.New("file size cannot be mapped")
+	}
+	return syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+}
+
+// munmap removes a mapping created by mmapFile
+func munmap(b []byte) error {
+	return syscall.Munmap(b)
+}
@@ -0,0 +1,18 @@
+//go:build !linux
+// +build !linux
+
+package dbf
+
+import (
+	"errors"
+	"os"
+)
+
+// mmapFile is only supported on Linux, OpenFileMmap falls back to reading with the file handle
+func mmapFile(f *os.File) ([]byte, error) {
+	return nil, errors.New("memory-mapped files are not supported on this platform")
+}
+
+func munmap(b []byte) error {
+	return nil
+}
@@ -0,0 +1,179 @@
+package dbf
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestOpenFileMmap(t *testing.T) {
+	filename := filepath.Join("testdata", "dbase_30.dbf")
+	mapped, err := OpenFileMmap(filename, new(Win1250Decoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mapped.Close()
+	if runtime.GOOS == "linux" && !mapped.IsMapped() {
+		t.Error("want mapped file on linux")
+	}
+
+	dbf, err := OpenFile(filename, new(Win1250Decoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbf.Close()
+	if dbf.IsMapped() {
+		t.Error("want OpenFile not mapped")
+	}
+
+	for recno := uint32(0); recno < dbf.NumRecords(); recno++ {
+		want, err := dbf.RecordAt(recno)
+		if err != nil {
+			t.Fatal(err)
+		}
+		have, err := mapped.RecordAt(recno)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(want, have) {
+			t.Fatalf("record %d: want %v, have %v", recno, want.FieldSlice(), have.FieldSlice())
+		}
+	}
+
+	if err := mapped.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if mapped.IsMapped() {
+		t.Error("want file unmapped after Close")
+	}
+}
+
+func TestOpenFileMmapIncomplete(t *testing.T) {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", "dbase_31.dbf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// cut the file halfway the last record
+	dbf, err := OpenFile(filepath.Join("testdata", "dbase_31.dbf"), new(UTF8Decoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reclen := int(dbf.Header().RecLen)
+	last := dbf.NumRecords() - 1
+	remaining := int(dbf.recordOffset(last)) + reclen/2
+	dbf.Close()
+	filename := filepath.Join(t.TempDir(), "incomplete.dbf")
+	if err := ioutil.WriteFile(filename, data[:remaining], 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	dbf, err = OpenFileMmap(filename, new(UTF8Decoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbf.Close()
+
+	rec, err := dbf.ReadRecordInto(last-1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var recErr *RecordError
+	if _, err := dbf.ReadRecordInto(last, rec.Data()); !errors.As(err, &recErr) || !errors.Is(err, ErrIncomplete) {
+		t.Fatalf("want incomplete RecordError, have %v", err)
+	}
+	if len(recErr.Raw) != reclen/2 {
+		t.Errorf("want %d bytes of raw data, have %d", reclen/2, len(recErr.Raw))
+	}
+	if _, err := dbf.RecordAt(last); !errors.Is(err, ErrIncomplete) {
+		t.Errorf("want ErrIncomplete, have %v", err)
+	}
+}
+
+func TestCloseUnmapError(t *testing.T) {
+	dbf, err := OpenFileMmap(filepath.Join("testdata", "dbase_30.dbf"), new(Win1250Decoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !dbf.IsMapped() {
+		dbf.Close()
+		t.Skip("memory mapping is not supported")
+	}
+	// replace the mapping by memory that is not page aligned, unmapping it fails
+	if err := munmap(dbf.mapped); err != nil {
+		t.Fatal(err)
+	}
+	dbf.mapped = make([]byte, 8192)[1:]
+	if err := dbf.Close(); err == nil {
+		t.Error("want unmap error")
+	}
+	// the files are closed anyway
+	if _, err := dbf.f.Stat(); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("want DBF closed, have %v", err)
+	}
+	if _, err := dbf.fptf.Stat(); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("want FPT closed, have %v", err)
+	}
+}
+
+func TestOpenFileMmapNotExist(t *testing.T) {
+	if _, err := OpenFileMmap(filepath.Join("testdata", "missing.dbf"), new(UTF8Decoder)); !os.IsNotExist(err) {
+		t.Errorf("want not exist error, have %v", err)
+	}
+}
+
+// Same as BenchmarkReadRecords using a memory-mapped file
+func BenchmarkReadRecordsMmap(b *testing.B) {
+	for n := 0; n < b.N; n++ {
+		err := func() error {
+			dbf, err := OpenFileMmap(filepath.Join("testdata", "dbase_30.dbf"), new(Win1250Decoder))
+			if err != nil {
+				return err
+			}
+			defer dbf.Close()
+			for i := uint32(0); i < dbf.NumRecords(); i++ {
+				_, err := dbf.Record()
+				if err != nil {
+					return err
+				}
+				dbf.Skip(1)
+			}
+			return nil
+		}()
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// Reading raw records without conversion, with and without memory mapping
+func BenchmarkReadRecordInto(b *testing.B) {
+	for _, bm := range []struct {
+		name string
+		open func(string, Decoder) (*DBF, error)
+	}{
+		{"file", OpenFile},
+		{"mmap", OpenFileMmap},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			dbf, err := bm.open(filepath.Join("testdata", "dbase_30.dbf"), new(Win1250Decoder))
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer dbf.Close()
+			b.ReportAllocs()
+			b.ResetTimer()
+			var buf []byte
+			for n := 0; n < b.N; n++ {
+				rec, err := dbf.ReadRecordInto(uint32(n)%dbf.NumRecords(), buf)
+				if err != nil {
+					b.Fatal(err)
+				}
+				buf = rec.Data()
+			}
+		})
+	}
+}
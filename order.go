@@ -0,0 +1,369 @@
+package dbf
+
+import "fmt"
+
+// SetOrder sets the index order of the cursor to tag name of the index of the table, like SET ORDER TO TAG in FoxPro.
+// Skip, GoTop, GoBottom and Scan follow the index order and Seek searches the index.
+// An empty name restores the record order. The record pointer is not moved and the scope is cleared.
+// Returns ErrNoIndex if the table has no index and ErrUnknownTag if the tag does not exist.
+func (c *Cursor) SetOrder(tag string) error {
+	c.leaf, c.top, c.bottom, c.found = nil, nil, nil, false
+	if tag == "" {
+		c.order = nil
+		return nil
+	}
+	idx, err := c.dbf.index()
+	if err != nil {
+		return err
+	}
+	order, err := idx.tag(tag)
+	if err != nil {
+		return err
+	}
+	c.order = order
+	return nil
+}
+
+// Order returns the tag name of the index order of the cursor, or an empty string in record order
+func (c *Cursor) Order() string {
+	if c.order == nil {
+		return ""
+	}
+	return c.order.Name
+}
+
+// SetScope restricts the records visited in index order to the keys from top up to and including bottom,
+// like SET SCOPE in FoxPro. Character keys match all keys starting with top or bottom.
+// A nil top or bottom leaves that side open, SetScope(nil, nil) clears the scope.
+// In a descending order top is the largest key. The record pointer is not moved, use GoTop to move to the first
+// record in scope. Returns ErrNoOrder if no index order is set.
+func (c *Cursor) SetScope(top, bottom interface{}) error {
+	if c.order == nil {
+		return ErrNoOrder
+	}
+	var err error
+	c.top, c.bottom = nil, nil
+	if top != nil {
+		if c.top, err = c.order.encode(c.dbf, top, false); err != nil {
+			return err
+		}
+	}
+	if bottom != nil {
+		if c.bottom, err = c.order.encode(c.dbf, bottom, false); err != nil {
+			c.top = nil
+			return err
+		}
+	}
+	return nil
+}
+
+// Seek positions the cursor on the first record in index order with key value key, like SEEK in FoxPro.
+// Character keys match all keys starting with key, like SET EXACT OFF. Records outside the scope or not matching
+// the filter are skipped. If no record is found the cursor is positioned at EOF.
+// Returns if a record was found, see Found. Returns ErrNoOrder if no index order is set.
+func (c *Cursor) Seek(key interface{}) (bool, error) {
+	c.found = false
+	if c.order == nil {
+		return false, ErrNoOrder
+	}
+	s, err := c.order.encode(c.dbf, key, false)
+	if err != nil {
+		return false, err
+	}
+	return c.seek(s)
+}
+
+// seek positions the cursor on the first record in index order with a key starting with s, in scope and matching
+// the filter, or at EOF if there is no such record. Found is set to the result.
+func (c *Cursor) seek(s []byte) (bool, error) {
+	c.found = false
+	n, i, err := c.order.search(s, false)
+	if err != nil {
+		return false, err
+	}
+	if err := c.position(n, i); err != nil {
+		return false, err
+	}
+	for !c.EOF() && c.order.compare(c.key(), s) == 0 {
+		if c.inScope() {
+			ok, err := c.match()
+			if err != nil {
+				return false, err
+			}
+			if ok {
+				c.found = true
+				return true, nil
+			}
+		}
+		if err := c.next(); err != nil {
+			return false, err
+		}
+	}
+	c.setEOF()
+	return false, nil
+}
+
+// Found returns if the last Seek found a record
+func (c *Cursor) Found() bool {
+	return c.found
+}
+
+// GoTop positions the cursor on the first record, in index order and within the scope when an order is set.
+// Records that do not match the filter are skipped.
+// Returns ErrEOF and positions the cursor at EOF if there is no such record.
+func (c *Cursor) GoTop() error {
+	if c.order == nil {
+		for c.recpointer = 0; !c.EOF(); c.recpointer++ {
+			ok, err := c.match()
+			if err != nil || ok {
+				return err
+			}
+		}
+		return ErrEOF
+	}
+
+	var n *cdxNode
+	var i int
+	var err error
+	if c.top != nil {
+		n, i, err = c.order.search(c.top, false)
+	} else {
+		n, err = c.order.first()
+	}
+	if err == nil {
+		err = c.position(n, i)
+	}
+	if err != nil {
+		return err
+	}
+	return c.settle(1)
+}
+
+// GoBottom positions the cursor on the last record, in index order and within the scope when an order is set.
+// Records that do not match the filter are skipped.
+// Returns ErrEOF and positions the cursor at EOF if there is no such record.
+func (c *Cursor) GoBottom() error {
+	if c.order == nil {
+		for recno := int64(c.dbf.header.NumRec) - 1; recno >= 0; recno-- {
+			c.recpointer = uint32(recno)
+			ok, err := c.match()
+			if err != nil || ok {
+				return err
+			}
+		}
+		c.recpointer = c.dbf.header.NumRec
+		return ErrEOF
+	}
+
+	// the key before the first key after the bottom of the scope, or the last key
+	var n *cdxNode
+	var i int
+	var err error
+	if c.bottom != nil {
+		n, i, err = c.order.search(c.bottom, true)
+	}
+	if err != nil {
+		return err
+	}
+	if n == nil {
+		if n, err = c.order.last(); err != nil {
+			return err
+		}
+		i = len(n.keys)
+	}
+	c.leaf, c.leafpos = n, i
+	ok, err := c.move(-1)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		c.setEOF()
+		return ErrEOF
+	}
+	return c.settle(-1)
+}
+
+// skipOrdered moves the cursor offset records in index order, within the scope and matching the filter
+func (c *Cursor) skipOrdered(offset int64) error {
+	if c.EOF() {
+		if offset >= 0 {
+			return ErrEOF
+		}
+		// like FoxPro, skipping back from EOF moves to the last record
+		if err := c.GoBottom(); err != nil {
+			c.setEOF()
+			return ErrBOF
+		}
+		offset++
+	} else if err := c.locate(); err != nil {
+		return err
+	}
+
+	dir := 1
+	if offset < 0 {
+		dir, offset = -1, -offset
+	}
+	for ; offset > 0; offset-- {
+		for {
+			ok, err := c.move(dir)
+			if err != nil {
+				return err
+			}
+			if !ok || !c.inScope() {
+				if dir > 0 {
+					c.setEOF()
+					return ErrEOF
+				}
+				if err := c.GoTop(); err != nil && err != ErrEOF {
+					return err
+				}
+				return ErrBOF
+			}
+			ok, err = c.match()
+			if err != nil {
+				return err
+			}
+			if ok {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// settle moves the cursor in direction dir until a key in scope matching the filter is found,
+// starting at the current key. Positions the cursor at EOF and returns ErrEOF if there is no such key.
+func (c *Cursor) settle(dir int) error {
+	for !c.EOF() && c.inScope() {
+		ok, err := c.match()
+		if err != nil || ok {
+			return err
+		}
+		if ok, err = c.move(dir); err != nil {
+			return err
+		}
+		if !ok {
+			break
+		}
+	}
+	c.setEOF()
+	return ErrEOF
+}
+
+// next moves the cursor to the next key in index order, or to EOF after the last key or the end of the scope
+func (c *Cursor) next() error {
+	ok, err := c.move(1)
+	if err != nil {
+		return err
+	}
+	if !ok || !c.inScope() {
+		c.setEOF()
+	}
+	return nil
+}
+
+// move moves the cursor one key in direction dir, crossing to the sibling leaf nodes.
+// Returns false without moving if there is no such key. The cursor must be located.
+func (c *Cursor) move(dir int) (bool, error) {
+	n, i := c.leaf, c.leafpos+dir
+	for i < 0 || i >= len(n.keys) {
+		sibling, err := c.order.sibling(n, dir)
+		if err != nil || sibling == nil {
+			return false, err
+		}
+		n, i = sibling, 0
+		if dir < 0 {
+			i = len(n.keys) - 1
+		}
+	}
+	c.leaf, c.leafpos, c.recpointer = n, i, n.recnos[i]
+	return true, nil
+}
+
+// position positions the cursor on key i of leaf node n, or the first key after it when n has no more keys.
+// The cursor is positioned at EOF if n is nil or there are no more keys.
+func (c *Cursor) position(n *cdxNode, i int) error {
+	if n == nil {
+		c.setEOF()
+		return nil
+	}
+	if i < len(n.keys) {
+		c.leaf, c.leafpos, c.recpointer = n, i, n.recnos[i]
+		return nil
+	}
+	c.leaf, c.leafpos = n, i-1
+	ok, err := c.move(1)
+	if err == nil && !ok {
+		c.setEOF()
+	}
+	return err
+}
+
+// setEOF positions the cursor at EOF
+func (c *Cursor) setEOF() {
+	c.leaf, c.leafpos, c.recpointer = nil, 0, c.dbf.header.NumRec
+}
+
+// key returns the index key of the current record, the cursor must be located
+func (c *Cursor) key() []byte {
+	return c.leaf.keys[c.leafpos]
+}
+
+// inScope returns if the key of the current record is within the scope
+func (c *Cursor) inScope() bool {
+	key := c.key()
+	return (c.top == nil || c.order.compare(key, c.top) >= 0) && (c.bottom == nil || c.order.compare(key, c.bottom) <= 0)
+}
+
+// locate finds the key of the current record in the index after the record pointer was set by GoTo.
+// The key is calculated using the key expression, if the key expression is not supported the whole index is searched.
+func (c *Cursor) locate() error {
+	if c.leaf != nil || c.EOF() {
+		return nil
+	}
+	recno := c.recpointer
+	if c.order.key != nil {
+		raw, err := c.Raw()
+		if err != nil {
+			return err
+		}
+		v, err := c.order.key.Eval(raw.Expr())
+		if err != nil {
+			return err
+		}
+		s, err := c.order.encode(c.dbf, v, true)
+		if err != nil {
+			return err
+		}
+		n, i, err := c.order.search(s, false)
+		if err != nil {
+			return err
+		}
+		if err := c.position(n, i); err != nil {
+			return err
+		}
+		for !c.EOF() && c.order.compare(c.key(), s) == 0 {
+			if c.recpointer == recno {
+				return nil
+			}
+			if ok, err := c.move(1); err != nil || !ok {
+				break
+			}
+		}
+	} else {
+		n, err := c.order.first()
+		for ; err == nil && n != nil; n, err = c.order.sibling(n, 1) {
+			for i, r := range n.recnos {
+				if r == recno {
+					c.leaf, c.leafpos, c.recpointer = n, i, r
+					return nil
+				}
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	c.leaf, c.recpointer = nil, recno
+	return fmt.Errorf("%w: record %d is not in tag %s", ErrInvalidIndex, recno, c.order.Name)
+}
@@ -0,0 +1,387 @@
+package dbf
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// openDbase30Indexed returns dbase_30.dbf with the structural index written by writeDbase30CDX
+func openDbase30Indexed(t *testing.T) *DBF {
+	t.Helper()
+	filename, _ := writeDbase30CDX(t, t.TempDir())
+	dbf, err := OpenFile(filename, new(Win1250Decoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { dbf.Close() })
+	return dbf
+}
+
+// accessnoOrder returns the record numbers of dbf in ACCESSNO order, ties in record order,
+// for the records for which keep returns true
+func accessnoOrder(t *testing.T, dbf *DBF, keep func(accessno string, acqvalue float64) bool) []uint32 {
+	t.Helper()
+	type entry struct {
+		accessno string
+		recno    uint32
+	}
+	var entries []entry
+	for recno := uint32(0); recno < dbf.NumRecords(); recno++ {
+		rec, err := dbf.RecordAt(recno)
+		if err != nil {
+			t.Fatal(err)
+		}
+		accessno, _ := rec.Field(dbf.FieldPos("ACCESSNO"))
+		acqvalue, _ := rec.Field(dbf.FieldPos("ACQVALUE"))
+		if keep == nil || keep(accessno.(string), acqvalue.(float64)) {
+			entries = append(entries, entry{accessno.(string), recno})
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].accessno < entries[j].accessno })
+	recnos := make([]uint32, len(entries))
+	for i, e := range entries {
+		recnos[i] = e.recno
+	}
+	return recnos
+}
+
+// skipAll returns the record numbers visited by skipping from the current record in direction dir
+// and the error that stopped it
+func skipAll(c *Cursor, dir int64) ([]uint32, error) {
+	var recnos []uint32
+	for {
+		recnos = append(recnos, c.RecNo())
+		if err := c.Skip(dir); err != nil {
+			return recnos, err
+		}
+	}
+}
+
+func TestOrderSkip(t *testing.T) {
+	dbf := openDbase30Indexed(t)
+	want := accessnoOrder(t, dbf, nil)
+
+	c := dbf.NewCursor()
+	if err := c.SetOrder("ACCESSNO"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.GoTop(); err != nil {
+		t.Fatal(err)
+	}
+	have, err := skipAll(c, 1)
+	if err != ErrEOF || !c.EOF() {
+		t.Errorf("want ErrEOF at the end, have %v", err)
+	}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("want order %v, have %v", want, have)
+	}
+
+	// skipping back from EOF moves to the last record
+	if err := c.Skip(-1); err != nil || c.RecNo() != want[len(want)-1] {
+		t.Errorf("want record %d after skipping back from EOF, have %d (%v)", want[len(want)-1], c.RecNo(), err)
+	}
+	if err := c.GoBottom(); err != nil {
+		t.Fatal(err)
+	}
+	have, err = skipAll(c, -1)
+	if err != ErrBOF || !c.BOF() || c.RecNo() != want[0] {
+		t.Errorf("want ErrBOF on record %d, have %v on %d", want[0], err, c.RecNo())
+	}
+	for i, j := 0, len(have)-1; i < j; i, j = i+1, j-1 {
+		have[i], have[j] = have[j], have[i]
+	}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("want reverse order %v, have %v", want, have)
+	}
+
+	// skipping from a record positioned with GoTo
+	pos := 12
+	if err := c.GoTo(want[pos]); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Skip(1); err != nil || c.RecNo() != want[pos+1] {
+		t.Errorf("want record %d, have %d (%v)", want[pos+1], c.RecNo(), err)
+	}
+	if err := c.Skip(-3); err != nil || c.RecNo() != want[pos-2] {
+		t.Errorf("want record %d, have %d (%v)", want[pos-2], c.RecNo(), err)
+	}
+
+	// the default cursor and other cursors keep record order
+	if err := dbf.GoTo(0); err != nil {
+		t.Fatal(err)
+	}
+	if err := dbf.Skip(1); err != nil || dbf.cursor.recpointer != 1 {
+		t.Errorf("want record 1 on the default cursor, have %d (%v)", dbf.cursor.recpointer, err)
+	}
+
+	// restoring the record order
+	if err := c.SetOrder(""); err != nil || c.Order() != "" {
+		t.Fatalf("want record order, have %q (%v)", c.Order(), err)
+	}
+	if err := c.GoTop(); err != nil || c.RecNo() != 0 {
+		t.Errorf("want record 0, have %d (%v)", c.RecNo(), err)
+	}
+	if err := c.GoBottom(); err != nil || c.RecNo() != dbf.NumRecords()-1 {
+		t.Errorf("want record %d, have %d (%v)", dbf.NumRecords()-1, c.RecNo(), err)
+	}
+}
+
+func TestOrderDescending(t *testing.T) {
+	dbf := openDbase30Indexed(t)
+	asc := accessnoOrder(t, dbf, nil)
+
+	c := dbf.NewCursor()
+	if err := c.SetOrder("DESCNO"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.GoTop(); err != nil {
+		t.Fatal(err)
+	}
+	have, err := skipAll(c, 1)
+	if err != ErrEOF {
+		t.Errorf("want ErrEOF, have %v", err)
+	}
+	if len(have) != len(asc) {
+		t.Fatalf("want %d records, have %d", len(asc), len(have))
+	}
+	for i := 1; i < len(have); i++ {
+		prev, _ := dbf.RecordAt(have[i-1])
+		rec, _ := dbf.RecordAt(have[i])
+		a, _ := prev.Field(dbf.FieldPos("ACCESSNO"))
+		b, _ := rec.Field(dbf.FieldPos("ACCESSNO"))
+		if a.(string) < b.(string) {
+			t.Errorf("record %d (%s) before %d (%s) in descending order", have[i-1], a, have[i], b)
+		}
+	}
+
+	// the first key starting with 2003 in descending order is the largest one
+	found, err := c.Seek("2003")
+	if err != nil || !found {
+		t.Fatalf("want 2003 found, have %v (%v)", found, err)
+	}
+	rec, _ := c.Record()
+	if v, _ := rec.Field(dbf.FieldPos("ACCESSNO")); strings.TrimSpace(v.(string)) != "2003.4" {
+		t.Errorf("want 2003.4, have %q", v)
+	}
+
+	// in a descending order top is the largest key
+	if err := c.SetScope("2003.3", "2003.1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.GoTop(); err != nil {
+		t.Fatal(err)
+	}
+	have, _ = skipAll(c, 1)
+	want := accessnoOrder(t, dbf, func(accessno string, _ float64) bool {
+		accessno = strings.TrimSpace(accessno)
+		return accessno == "2003.1" || accessno == "2003.3"
+	})
+	if len(have) != len(want) {
+		t.Errorf("want %d records in scope, have %v", len(want), have)
+	}
+}
+
+func TestSeek(t *testing.T) {
+	dbf := openDbase30Indexed(t)
+	c := dbf.NewCursor()
+	if err := c.SetOrder("ACCESSNO"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		key   interface{}
+		found bool
+		recno uint32
+	}{
+		{"2000.3", true, 10},
+		{"2000", true, 8},
+		{"2003.1   ", true, 18},
+		{"1999.5", false, 0},
+		{"2005", false, 0},
+		{"", true, 33},
+	}
+	for _, test := range tests {
+		found, err := c.Seek(test.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found != test.found || c.Found() != test.found {
+			t.Errorf("Seek(%q): want found %v, have %v", test.key, test.found, found)
+			continue
+		}
+		if found && c.RecNo() != test.recno {
+			t.Errorf("Seek(%q): want record %d, have %d", test.key, test.recno, c.RecNo())
+		}
+		if !found && !c.EOF() {
+			t.Errorf("Seek(%q): want EOF, have record %d", test.key, c.RecNo())
+		}
+	}
+
+	// date keys
+	if err := c.SetOrder("CATDATE"); err != nil {
+		t.Fatal(err)
+	}
+	if c.Found() {
+		t.Error("want Found cleared by SetOrder")
+	}
+	rec, err := dbf.RecordAt(23)
+	if err != nil {
+		t.Fatal(err)
+	}
+	catdate, _ := rec.Field(dbf.FieldPos("CATDATE"))
+	found, err := c.Seek(catdate)
+	if err != nil || !found {
+		t.Fatalf("want %v found, have %v (%v)", catdate, found, err)
+	}
+	rec, _ = c.Record()
+	if v, _ := rec.Field(dbf.FieldPos("CATDATE")); !v.(time.Time).Equal(catdate.(time.Time)) {
+		t.Errorf("want CATDATE %v, have %v", catdate, v)
+	}
+	if found, err := c.Seek(time.Date(1800, 1, 1, 0, 0, 0, 0, time.UTC)); err != nil || found {
+		t.Errorf("want 1800-01-01 not found, have %v (%v)", found, err)
+	}
+
+	// numeric keys in a tag with a FOR expression
+	if err := c.SetOrder("ACQ"); err != nil {
+		t.Fatal(err)
+	}
+	if found, err := c.Seek(50); err != nil || !found || c.RecNo() != 10 {
+		t.Errorf("want 50 found on record 10, have %v on %d (%v)", found, c.RecNo(), err)
+	}
+	if found, err := c.Seek(0); err != nil || found {
+		t.Errorf("want 0 not found, have %v (%v)", found, err)
+	}
+	// record 0 is not in the tag
+	if err := c.GoTo(0); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Skip(1); err == nil || !strings.Contains(err.Error(), "not in tag ACQ") {
+		t.Errorf("want record not in tag error, have %v", err)
+	}
+}
+
+func TestSetScope(t *testing.T) {
+	dbf := openDbase30Indexed(t)
+	want := accessnoOrder(t, dbf, func(accessno string, _ float64) bool { return strings.HasPrefix(accessno, "2000") })
+
+	c := dbf.NewCursor()
+	if err := c.SetScope("2000", "2000"); err != ErrNoOrder {
+		t.Errorf("want ErrNoOrder, have %v", err)
+	}
+	if err := c.SetOrder("ACCESSNO"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetScope("2000", "2000"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.GoTop(); err != nil {
+		t.Fatal(err)
+	}
+	have, err := skipAll(c, 1)
+	if err != ErrEOF {
+		t.Errorf("want ErrEOF, have %v", err)
+	}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("want %v in scope, have %v", want, have)
+	}
+	if err := c.GoBottom(); err != nil || c.RecNo() != want[len(want)-1] {
+		t.Errorf("want record %d, have %d (%v)", want[len(want)-1], c.RecNo(), err)
+	}
+	if err := c.GoTop(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Skip(-1); err != ErrBOF || c.RecNo() != want[0] {
+		t.Errorf("want ErrBOF on record %d, have %v on %d", want[0], err, c.RecNo())
+	}
+	if found, err := c.Seek("2003"); err != nil || found || !c.EOF() {
+		t.Errorf("want 2003 outside the scope not found, have %v (%v)", found, err)
+	}
+
+	// open ended scopes
+	if err := c.SetScope("2004", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.GoTop(); err != nil || c.RecNo() != 31 {
+		t.Errorf("want record 31, have %d (%v)", c.RecNo(), err)
+	}
+	if err := c.SetScope(nil, "1998"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.GoBottom(); err != nil || c.RecNo() != 17 {
+		t.Errorf("want record 17, have %d (%v)", c.RecNo(), err)
+	}
+	if err := c.SetScope("2005", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.GoTop(); err != ErrEOF || !c.EOF() {
+		t.Errorf("want ErrEOF for an empty scope, have %v", err)
+	}
+	if err := c.GoBottom(); err != ErrEOF || !c.EOF() {
+		t.Errorf("want ErrEOF for an empty scope, have %v", err)
+	}
+}
+
+func TestScanOrder(t *testing.T) {
+	dbf := openDbase30Indexed(t)
+	want := accessnoOrder(t, dbf, func(_ string, acqvalue float64) bool { return acqvalue > 0 })
+
+	c, err := dbf.Select("ACCESSNO", "ACQVALUE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetOrder("ACCESSNO"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetFilter(Where("ACQVALUE > 0")); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.GoTop(); err != nil {
+		t.Fatal(err)
+	}
+	var have []uint32
+	err = c.Scan(func(rec *Record) error {
+		have = append(have, c.RecNo())
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("want %v, have %v", want, have)
+	}
+
+	// GoTop and Skip skip records not matching the filter
+	if err := c.GoTop(); err != nil || c.RecNo() != want[0] {
+		t.Errorf("want record %d, have %d (%v)", want[0], c.RecNo(), err)
+	}
+	if err := c.Skip(2); err != nil || c.RecNo() != want[2] {
+		t.Errorf("want record %d, have %d (%v)", want[2], c.RecNo(), err)
+	}
+}
+
+func TestOrderStream(t *testing.T) {
+	dbfdata, fptdata := readTestFiles(t, filepath.Join("testdata", "dbase_30.dbf"))
+	dbf, err := OpenStream(bytes.NewReader(dbfdata), bytes.NewReader(fptdata), new(Win1250Decoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dbf.Tags(); err != ErrNoIndex {
+		t.Errorf("want ErrNoIndex for a stream without index, have %v", err)
+	}
+	_, cdx := writeDbase30CDX(t, t.TempDir())
+	if err := dbf.OpenIndexStream(bytes.NewReader(cdx)); err != nil {
+		t.Fatal(err)
+	}
+	c := dbf.NewCursor()
+	if err := c.SetOrder("ACCESSNO"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.GoTop(); err != nil || c.RecNo() != 33 {
+		t.Errorf("want record 33, have %d (%v)", c.RecNo(), err)
+	}
+}
@@ -0,0 +1,239 @@
+package dbf
+
+import (
+	"encoding/binary"
+	"math"
+	"time"
+)
+
+// RawRecord is a view on the raw data of one record.
+// It is only valid until the buffer it was read into is reused, or for tables opened with OpenFileMmap,
+// until the table is closed. The data must not be modified.
+type RawRecord struct {
+	dbf   *DBF
+	recno uint32
+	data  []byte
+}
+
+// ReadRecordInto reads the raw data of record recno into buf and returns it as a RawRecord.
+// When buf is too small a new buffer is allocated, pass RawRecord.Data() of the previous call
+// to reuse the same buffer for reading a sequence of records.
+// For tables opened with OpenFileMmap buf is not used, the data is not copied but a slice of the mapped file.
+// Read errors are returned as *RecordError.
+func (dbf *DBF) ReadRecordInto(recno uint32, buf []byte) (RawRecord, error) {
+	data, err := dbf.readRecordInto(recno, buf)
+	if err != nil {
+		return RawRecord{}, err
+	}
+	return RawRecord{dbf: dbf, recno: recno, data: data}, nil
+}
+
+// RecNo returns the record number
+func (r RawRecord) RecNo() uint32 {
+	return r.recno
+}
+
+// Data returns the complete raw record data, starting with the deleted flag
+func (r RawRecord) Data() []byte {
+	return r.data
+}
+
+// IsDeleted returns if the record is marked as deleted
+func (r RawRecord) IsDeleted() bool {
+	return len(r.data) > 0 && r.data[0] == 0x2A
+}
+
+// Bytes returns the raw data of field fieldpos, without any conversion.
+// The returned slice shares memory with the record buffer.
+func (r RawRecord) Bytes(fieldpos int) ([]byte, error) {
+	if fieldpos < 0 || fieldpos >= len(r.dbf.fields) {
+		return nil, ErrInvalidField
+	}
+	offset := r.dbf.offsets[fieldpos]
+	end := offset + int(r.dbf.fields[fieldpos].Len)
+	if end > len(r.data) {
+		return nil, r.fieldError(fieldpos, nil, ErrIncomplete)
+	}
+	return r.data[offset:end], nil
+}
+
+// Value returns the Go value of field fieldpos, like Record.Field.
+// Errors converting the field data are returned as *FieldError.
+func (r RawRecord) Value(fieldpos int) (interface{}, error) {
+	raw, err := r.Bytes(fieldpos)
+	if err != nil {
+		return nil, err
+	}
+	val, err := r.dbf.fieldDataToValue(raw, fieldpos)
+	if err != nil {
+		return val, r.fieldError(fieldpos, raw, err)
+	}
+	return val, nil
+}
+
+// String returns the value of C, M and V fields as a string, like Value but without boxing the value.
+// C fields are converted to UTF8 using the Decoder and are not trimmed, M fields are read from the FPT file.
+// Other field types return ErrFieldType.
+func (r RawRecord) String(fieldpos int) (string, error) {
+	raw, err := r.Bytes(fieldpos)
+	if err != nil {
+		return "", err
+	}
+	var s string
+	switch r.dbf.fields[fieldpos].Type {
+	case 'C':
+		s, err = r.dbf.toUTF8String(raw)
+	case 'M':
+		var memo []byte
+		memo, _, err = r.dbf.parseMemo(raw)
+		s = string(memo)
+	case 'V':
+		s = string(raw)
+	default:
+		err = ErrFieldType
+	}
+	if err != nil {
+		return s, r.fieldError(fieldpos, raw, err)
+	}
+	return s, nil
+}
+
+// Memo returns the data of M, G, P and W fields read from the FPT file.
+// M fields are converted to UTF8 using the Decoder unless the field has the binary flag,
+// the other field types are returned without conversion. Other field types return ErrFieldType.
+func (r RawRecord) Memo(fieldpos int) ([]byte, error) {
+	raw, err := r.Bytes(fieldpos)
+	if err != nil {
+		return nil, err
+	}
+	var memo []byte
+	f := &r.dbf.fields[fieldpos]
+	switch f.Type {
+	case 'M', 'G', 'P', 'W':
+		memo, _, err = r.dbf.readFPT(raw)
+		if err == nil && f.Type == 'M' && f.Flags&0x04 == 0 {
+			memo, err = r.dbf.dec.Decode(memo)
+		}
+	default:
+		err = ErrFieldType
+	}
+	if err != nil {
+		return nil, r.fieldError(fieldpos, raw, err)
+	}
+	return memo, nil
+}
+
+// Int64 returns the value of I fields and N fields without decimals as an int64, without allocating.
+// Other field types, including N fields with decimals, return ErrFieldType.
+func (r RawRecord) Int64(fieldpos int) (int64, error) {
+	raw, err := r.Bytes(fieldpos)
+	if err != nil {
+		return 0, err
+	}
+	var n int64
+	f := &r.dbf.fields[fieldpos]
+	switch {
+	case f.Type == 'I':
+		n = int64(int32(binary.LittleEndian.Uint32(raw)))
+	case f.Type == 'N' && f.Decimals == 0:
+		n, err = r.dbf.parseNumericInt(raw)
+	default:
+		err = ErrFieldType
+	}
+	if err != nil {
+		return n, r.fieldError(fieldpos, raw, err)
+	}
+	return n, nil
+}
+
+// Float64 returns the value of N, F, B, Y and I fields as a float64, without allocating.
+// Other field types return ErrFieldType.
+func (r RawRecord) Float64(fieldpos int) (float64, error) {
+	raw, err := r.Bytes(fieldpos)
+	if err != nil {
+		return 0, err
+	}
+	var v float64
+	switch r.dbf.fields[fieldpos].Type {
+	case 'N', 'F':
+		v, err = r.dbf.parseFloat(raw)
+	case 'B':
+		v = math.Float64frombits(binary.LittleEndian.Uint64(raw))
+	case 'Y':
+		v = float64(int64(binary.LittleEndian.Uint64(raw))) / 10000
+	case 'I':
+		v = float64(int32(binary.LittleEndian.Uint32(raw)))
+	default:
+		err = ErrFieldType
+	}
+	if err != nil {
+		return v, r.fieldError(fieldpos, raw, err)
+	}
+	return v, nil
+}
+
+// Time returns the value of D and T fields as a time.Time in UTC, without allocating.
+// Empty dates return the zero time. Other field types return ErrFieldType.
+func (r RawRecord) Time(fieldpos int) (time.Time, error) {
+	raw, err := r.Bytes(fieldpos)
+	if err != nil {
+		return time.Time{}, err
+	}
+	var t time.Time
+	switch r.dbf.fields[fieldpos].Type {
+	case 'D':
+		t, err = r.dbf.parseDate(raw)
+	case 'T':
+		t, err = r.dbf.parseDateTime(raw)
+	default:
+		err = ErrFieldType
+	}
+	if err != nil {
+		return t, r.fieldError(fieldpos, raw, err)
+	}
+	return t, nil
+}
+
+// Bool returns the value of L fields, without allocating. Other field types return ErrFieldType.
+func (r RawRecord) Bool(fieldpos int) (bool, error) {
+	raw, err := r.Bytes(fieldpos)
+	if err != nil {
+		return false, err
+	}
+	if r.dbf.fields[fieldpos].Type != 'L' {
+		return false, r.fieldError(fieldpos, raw, ErrFieldType)
+	}
+	if r.dbf.strict && !validLogical(raw) {
+		return false, r.fieldError(fieldpos, raw, ErrInvalidLogical)
+	}
+	return string(raw) == "T", nil
+}
+
+// IsNull returns if field fieldpos is null.
+// Only nullable fields in Visual FoxPro tables can be null, this is stored in the _NullFlags system field.
+func (r RawRecord) IsNull(fieldpos int) bool {
+	bit, nullpos := r.dbf.nullBit(fieldpos)
+	if bit < 0 {
+		return false
+	}
+	flags, err := r.Bytes(nullpos)
+	if err != nil || bit/8 >= len(flags) {
+		return false
+	}
+	return flags[bit/8]&(1<<uint(bit%8)) != 0
+}
+
+// nullBit returns the bit in the _NullFlags field for field fieldpos and the position of the _NullFlags field.
+// The bit is -1 when the field is not nullable or the table has no _NullFlags field.
+func (dbf *DBF) nullBit(fieldpos int) (int, int) {
+	if fieldpos < 0 || fieldpos >= len(dbf.fields) {
+		return -1, -1
+	}
+	return dbf.nullbits[fieldpos], dbf.nullbits[len(dbf.fields)]
+}
+
+// fieldError returns err for field fieldpos as *FieldError
+func (r RawRecord) fieldError(fieldpos int, raw []byte, err error) error {
+	offset := r.dbf.recordOffset(r.recno) + int64(r.dbf.offsets[fieldpos])
+	return r.dbf.newFieldError(r.recno, fieldpos, offset, raw, err)
+}
@@ -0,0 +1,250 @@
+package dbf
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReadRecordInto(t *testing.T) {
+	buf := make([]byte, 0, testDbf.Header().RecLen)
+	rec, err := testDbf.ReadRecordInto(1, buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// mapped files do not use the buffer
+	if &rec.Data()[0] != &buf[:1][0] && !testDbf.IsMapped() {
+		t.Error("want record read into the provided buffer")
+	}
+	if rec.RecNo() != 1 || !rec.IsDeleted() {
+		t.Errorf("want deleted record 1, have record %d, deleted %v", rec.RecNo(), rec.IsDeleted())
+	}
+	raw, err := rec.Bytes(7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(raw[:5]) != "TEST2" || len(raw) != 40 {
+		t.Errorf("unexpected raw COMP_NAME %q", raw)
+	}
+	val, err := rec.Value(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val != 123456789.99 {
+		t.Errorf("want NUMBER 123456789.99, have %v", val)
+	}
+	if _, err := rec.Bytes(13); err != ErrInvalidField {
+		t.Errorf("want ErrInvalidField, have %v", err)
+	}
+
+	// a small buffer is replaced
+	rec, err = testDbf.ReadRecordInto(0, make([]byte, 1))
+	if err != nil || len(rec.Data()) != int(testDbf.Header().RecLen) || rec.IsDeleted() {
+		t.Errorf("unexpected record 0 (%v): %q", err, rec.Data())
+	}
+
+	if _, err := testDbf.ReadRecordInto(testDbf.NumRecords(), nil); !errors.Is(err, ErrEOF) {
+		t.Errorf("want ErrEOF, have %v", err)
+	}
+}
+
+func TestRawRecordIsNull(t *testing.T) {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", "dbase_31.dbf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbf, err := OpenStream(bytes.NewReader(data), nil, new(UTF8Decoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// set the null flags of SUPPLIERID (bit 0) and QUANTITYPE (bit 2) of the first record
+	nullpos := dbf.FieldPos("_NullFlags")
+	data[int(dbf.Header().FirstRec)+int(dbf.Fields()[nullpos].Pos)] = 0x05
+
+	rec, err := dbf.ReadRecordInto(0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, f := range dbf.Fields() {
+		want := f.FieldName() == "SUPPLIERID" || f.FieldName() == "QUANTITYPE"
+		if rec.IsNull(i) != want {
+			t.Errorf("field %s: want null %v, have %v", f.FieldName(), want, rec.IsNull(i))
+		}
+	}
+	if dbf.Fields()[0].IsNullable() || !dbf.Fields()[2].IsNullable() {
+		t.Error("want PRODUCTID not nullable and SUPPLIERID nullable")
+	}
+
+	// the null bits are assigned when the table is opened, cursors can read them concurrently
+	dbf, err = OpenStream(bytes.NewReader(data), nil, new(UTF8Decoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for n := 0; n < 4; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rec, err := dbf.NewCursor().Raw()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if !rec.IsNull(dbf.FieldPos("SUPPLIERID")) {
+				t.Error("want SUPPLIERID null")
+			}
+		}()
+	}
+	wg.Wait()
+
+	// tables without _NullFlags field have no null values
+	rec, err = testDbf.ReadRecordInto(0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.IsNull(0) {
+		t.Error("want no null values in TEST.DBF")
+	}
+}
+
+func TestRawRecordTyped(t *testing.T) {
+	rec, err := testDbf.ReadRecordInto(1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, err := rec.String(7); err != nil || strings.TrimSpace(s) != "TEST2" || len(s) != 40 {
+		t.Errorf("want COMP_NAME TEST2, have %q (%v)", s, err)
+	}
+	if s, err := rec.String(9); err != nil || s != "Tësting wíth éncôdings!" {
+		t.Errorf("want MELDING memo, have %q (%v)", s, err)
+	}
+	if n, err := rec.Int64(0); err != nil || n != 2 {
+		t.Errorf("want ID 2, have %d (%v)", n, err)
+	}
+	if n, err := rec.Int64(6); err != nil || n != -600 {
+		t.Errorf("want USERNR -600, have %d (%v)", n, err)
+	}
+	if f, err := rec.Float64(10); err != nil || f != 123456789.99 {
+		t.Errorf("want NUMBER 123456789.99, have %f (%v)", f, err)
+	}
+	if f, err := rec.Float64(0); err != nil || f != 2 {
+		t.Errorf("want ID 2 as float, have %f (%v)", f, err)
+	}
+	if d, err := rec.Time(2); err != nil || !d.Equal(time.Date(2015, 2, 3, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("want DATUM 2015-02-03, have %s (%v)", d, err)
+	}
+	if b, err := rec.Bool(12); err != nil || !b {
+		t.Errorf("want BOOL true, have %v (%v)", b, err)
+	}
+	if m, err := rec.Memo(9); err != nil || string(m) != "Tësting wíth éncôdings!" {
+		t.Errorf("want MELDING memo, have %q (%v)", m, err)
+	}
+
+	// conversions that are not supported
+	var fieldErr *FieldError
+	if _, err := rec.Int64(10); !errors.As(err, &fieldErr) || fieldErr.Name != "NUMBER" || !errors.Is(err, ErrFieldType) {
+		t.Errorf("want ErrFieldType for N field with decimals, have %v", err)
+	}
+	if _, err := rec.Time(7); !errors.Is(err, ErrFieldType) {
+		t.Errorf("want ErrFieldType for C field, have %v", err)
+	}
+	if _, err := rec.String(0); !errors.Is(err, ErrFieldType) {
+		t.Errorf("want ErrFieldType for I field, have %v", err)
+	}
+	if _, err := rec.Bool(0); !errors.Is(err, ErrFieldType) {
+		t.Errorf("want ErrFieldType for I field, have %v", err)
+	}
+	if _, err := rec.Memo(7); !errors.Is(err, ErrFieldType) {
+		t.Errorf("want ErrFieldType for C field, have %v", err)
+	}
+	if _, err := rec.Float64(13); err != ErrInvalidField {
+		t.Errorf("want ErrInvalidField, have %v", err)
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		rec.Int64(0)
+		rec.Int64(6)
+		rec.Float64(10)
+		rec.Time(2)
+		rec.Bool(12)
+	})
+	if allocs != 0 {
+		t.Errorf("want no allocations, have %.0f", allocs)
+	}
+}
+
+func TestParseDate(t *testing.T) {
+	dbf := &DBF{}
+	tests := []struct {
+		raw  string
+		want time.Time
+		err  bool
+	}{
+		{"20150203", time.Date(2015, 2, 3, 0, 0, 0, 0, time.UTC), false},
+		{"20000229", time.Date(2000, 2, 29, 0, 0, 0, 0, time.UTC), false},
+		{"        ", time.Time{}, false},
+		{"19000229", time.Time{}, true},
+		{"20151301", time.Time{}, true},
+		{"2015 2 3", time.Time{}, true},
+	}
+	for _, tt := range tests {
+		have, err := dbf.parseDate([]byte(tt.raw))
+		if (err != nil) != tt.err || !have.Equal(tt.want) {
+			t.Errorf("%q: want %s (error %v), have %s (%v)", tt.raw, tt.want, tt.err, have, err)
+		}
+	}
+}
+
+func TestZeroDisplacement(t *testing.T) {
+	// dBase III files often have no field displacements, the fields follow each other
+	filename := copyTestFiles(t, t.TempDir(), "dbase_30.dbf")
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for offset := 32; data[offset] != 0x0D; offset += 32 {
+		copy(data[offset+12:offset+16], []byte{0, 0, 0, 0})
+	}
+	if err := ioutil.WriteFile(filename, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	want, err := OpenFile(filepath.Join("testdata", "dbase_30.dbf"), new(Win1250Decoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer want.Close()
+	for _, open := range []func(string, Decoder) (*DBF, error){OpenFile, OpenFileMmap} {
+		dbf, err := open(filename, new(Win1250Decoder))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer dbf.Close()
+		for recno := uint32(0); recno < want.NumRecords(); recno++ {
+			wantRec, err := want.RecordAt(recno)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rec, err := dbf.RecordAt(recno)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(rec.FieldSlice(), wantRec.FieldSlice()) {
+				t.Fatalf("record %d (mapped %v): want %v, have %v", recno, dbf.IsMapped(), wantRec.FieldSlice(), rec.FieldSlice())
+			}
+			if err := dbf.GoTo(recno); err != nil {
+				t.Fatal(err)
+			}
+			v, err := dbf.Field(0)
+			if err != nil || v != wantRec.FieldSlice()[0] {
+				t.Fatalf("record %d (mapped %v): want field 0 %v, have %v (%v)", recno, dbf.IsMapped(), wantRec.FieldSlice()[0], v, err)
+			}
+		}
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/SebastiaanKlippert/go-foxpro-dbf/jd"
@@ -39,6 +40,11 @@ var (
 
 	// ValidFileVersionFunc can be used to override file version checks to open untested files
 	ValidFileVersionFunc = validFileVersion
+
+	// CenturyRollover is used by DBFHeader.Modified for the century of the 2 digit last update year, like
+	// SET CENTURY ROLLOVER in FoxPro. Years below CenturyRollover are in the 2000s, other years in the 1900s.
+	// The default -1 uses the current year, so years up to the current year are in the 2000s.
+	CenturyRollover = -1
 )
 
 // ReaderAtSeeker is used when opening files from memory
@@ -59,31 +65,80 @@ type DBF struct {
 	f    *os.File
 	fptf *os.File
 
+	// memory-mapped DBF and FPT files, only used with OpenFileMmap
+	mapped    []byte
+	fptmapped []byte
+
+	recbufs sync.Pool // record buffers for Record and RecordAt, not used for mapped files
+
 	dec Decoder
+	enc Encoder // only used when the table is writable
+
+	fields  []FieldHeader
+	offsets []int // offset of every field in the record data, see prepareFields()
+
+	cursor *Cursor // default cursor with the internal record pointer, moved using Skip() and GoTo()
+
+	nullbits []int // bit in the _NullFlags field for every field or -1, see prepareFields()
+	varbits  []int // bit in the _NullFlags field of varchar and varbinary fields that are not full or -1
+
+	strict bool // strict mode, see SetStrict()
+	rw     bool // the table is opened for writing, see CreateFile() and OpenFileRW()
+	shared bool // locks of other processes are checked when reading, see OpenFileShared()
+
+	locks      map[uint32]bool // records locked by this handle, see LockRecord()
+	filelocked bool            // the table is locked by this handle, see LockFile()
+
+	tx *journal // rollback journal of the active transaction, see Begin()
 
-	fields []FieldHeader
+	backlink string // path of the database container, see Backlink()
 
-	recpointer uint32 // internal record pointer, can be moved using Skip() and GoTo()
+	cdx       *cdxIndex  // index used for ordered navigation, see OpenIndex()
+	cdxopened bool       // the structural index has been opened or replaced, see index()
+	cdxmu     sync.Mutex // protects cdx and cdxopened
+	reindex   bool       // records were written after the structural index was built, see outdateIndex()
 }
 
-// Close closes the file handlers to the disk files.
+// Close closes the file handlers to the disk files, an active transaction is rolled back.
+// The structural index is rebuilt when records were written, see Append.
 // The caller is responsible for calling Close to close the file handle(s)!
 func (dbf *DBF) Close() error {
-	var dbferr, fpterr error
+	// the files are closed even when the rollback, rebuilding the index or unmapping fails, all errors are returned
+	var errs []string
+	if dbf.tx != nil {
+		if err := dbf.Rollback(); err != nil {
+			errs = append(errs, fmt.Sprintf("error rolling back transaction: %s", err))
+		}
+	}
+	// after a failed rollback the journal is applied when the table is opened again, which restores the index flag
+	if dbf.reindex && len(errs) == 0 {
+		if err := dbf.Reindex(nil); err != nil {
+			errs = append(errs, fmt.Sprintf("error rebuilding index: %s", err))
+		}
+	}
+	if err := dbf.unmap(); err != nil {
+		errs = append(errs, err.Error())
+	}
+	dbf.cdxmu.Lock()
+	if err := dbf.cdx.close(); err != nil {
+		errs = append(errs, fmt.Sprintf("error closing CDX: %s", err))
+	}
+	dbf.cdx = nil
+	dbf.cdxmu.Unlock()
 	if dbf.f != nil {
-		dbferr = dbf.f.Close()
+		if err := dbf.f.Close(); err != nil {
+			errs = append(errs, fmt.Sprintf("error closing DBF: %s", err))
+		}
 	}
 	if dbf.fptf != nil {
-		fpterr = dbf.fptf.Close()
+		if err := dbf.fptf.Close(); err != nil {
+			errs = append(errs, fmt.Sprintf("error closing FPT: %s", err))
+		}
 	}
-	switch {
-	case dbferr != nil:
-		return fmt.Errorf("error closing DBF: %s", dbferr)
-	case fpterr != nil:
-		return fmt.Errorf("error closing FPT: %s", fpterr)
-	default:
-		return nil
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
 	}
+	return nil
 }
 
 func (dbf *DBF) prepareFPT(fptfile ReaderAtSeeker) error {
@@ -103,6 +158,12 @@ func (dbf *DBF) Header() *DBFHeader {
 	return dbf.header
 }
 
+// Backlink returns the relative path of the database container (DBC) the table belongs to, stored in the
+// header of Visual FoxPro tables. Returns an empty string for free tables and other file versions.
+func (dbf *DBF) Backlink() string {
+	return dbf.backlink
+}
+
 // Stat returns the os.FileInfo for the DBF file
 func (dbf *DBF) Stat() (os.FileInfo, error) {
 	if dbf.f == nil {
@@ -134,6 +195,11 @@ func (dbf *DBF) NumFields() uint16 {
 	return uint16(len(dbf.fields))
 }
 
+// HeaderTerminator returns the position of the 0x0D header record terminator which follows the field definitions
+func (dbf *DBF) HeaderTerminator() int64 {
+	return 32 + 32*int64(len(dbf.fields))
+}
+
 // FieldNames returnes a slice of all the fieldnames
 func (dbf *DBF) FieldNames() []string {
 	num := len(dbf.fields)
@@ -158,65 +224,64 @@ func (dbf *DBF) FieldPos(fieldname string) int {
 // GoTo sets the internal record pointer to record recno (zero based).
 // Returns ErrEOF if at EOF and positions the pointer at lastRec+1.
 func (dbf *DBF) GoTo(recno uint32) error {
-	if recno >= dbf.header.NumRec {
-		dbf.recpointer = dbf.header.NumRec
-		return ErrEOF
-	}
-	dbf.recpointer = recno
-	return nil
+	return dbf.cursor.GoTo(recno)
 }
 
 // Skip adds offset to the internal record pointer.
 // Returns ErrEOF if at EOF and positions the pointer at lastRec+1.
-// Returns ErrBOF is recpointer would be become negative and positions the pointer at 0.
+// Returns ErrBOF is the pointer would be become negative and positions the pointer at 0.
 // Does not skip deleted records.
 func (dbf *DBF) Skip(offset int64) error {
-	newval := int64(dbf.recpointer) + offset
-	if newval >= int64(dbf.header.NumRec) {
-		dbf.recpointer = dbf.header.NumRec
-		return ErrEOF
-	}
-	if newval < 0 {
-		dbf.recpointer = 0
-		return ErrBOF
-	}
-	dbf.recpointer = uint32(newval)
-	return nil
+	return dbf.cursor.Skip(offset)
 }
 
 // Record reads the complete record the internal record pointer is pointing to
 func (dbf *DBF) Record() (*Record, error) {
-	data, err := dbf.readRecord(dbf.recpointer)
-	if err != nil {
-		return nil, err
-	}
-	return dbf.bytesToRecord(data)
+	return dbf.RecordAt(dbf.cursor.recpointer)
 }
 
 // RecordAt reads the complete record number nrec
 func (dbf *DBF) RecordAt(nrec uint32) (*Record, error) {
-	data, err := dbf.readRecord(nrec)
+	data, err := dbf.readRecordInto(nrec, dbf.recordBuffer())
 	if err != nil {
 		return nil, err
 	}
-	return dbf.bytesToRecord(data)
+	// errors and record values do not reference the buffer
+	rec, err := dbf.bytesToRecord(data, nrec)
+	dbf.putRecordBuffer(data)
+	return rec, err
+}
+
+// recordBuffer returns a record buffer from the pool or nil, in which case readRecordInto allocates one
+func (dbf *DBF) recordBuffer() []byte {
+	if buf, ok := dbf.recbufs.Get().(*[]byte); ok {
+		return *buf
+	}
+	return nil
+}
+
+// putRecordBuffer returns buf to the pool, buf must not be referenced anymore.
+// Slices of a mapped file are not pooled.
+func (dbf *DBF) putRecordBuffer(buf []byte) {
+	if dbf.mapped != nil {
+		return
+	}
+	dbf.recbufs.Put(&buf)
 }
 
 // RecordToMap returns a complete record as a map.
-// If nrec > 0 it returns the record at nrec, if nrec <= 0 it returns the record at dbf.recpointer
+// If nrec > 0 it returns the record at nrec, if nrec <= 0 it returns the record at the internal record pointer.
+// The internal record pointer is not moved.
 func (dbf *DBF) RecordToMap(nrec uint32) (map[string]interface{}, error) {
 	if nrec <= 0 {
-		nrec = dbf.recpointer
-	} else if nrec != dbf.recpointer {
-		if err := dbf.GoTo(nrec); err != nil {
-			return nil, err
-		}
+		nrec = dbf.cursor.recpointer
 	}
 	out := make(map[string]interface{})
 	for i, fn := range dbf.FieldNames() {
-		val, err := dbf.Field(i)
+		val, err := dbf.fieldAt(nrec, i)
 		if err != nil {
-			return out, fmt.Errorf("error on field %s (column %d): %s", fn, i, err)
+			// errors from fieldAt are FieldErrors which already contain the field name and column
+			return out, err
 		}
 		out[fn] = val
 	}
@@ -224,7 +289,7 @@ func (dbf *DBF) RecordToMap(nrec uint32) (map[string]interface{}, error) {
 }
 
 // RecordToJSON returns a complete record as a JSON object.
-// If nrec > 0 it returns the record at nrec, if nrec <= 0 it returns the record at dbf.recpointer.
+// If nrec > 0 it returns the record at nrec, if nrec <= 0 it returns the record at the internal record pointer.
 // If trimspaces is true we trim spaces from string values (this is slower because of an extra reflect operation and all strings in the record map are re-assigned)
 func (dbf *DBF) RecordToJSON(nrec uint32, trimspaces bool) ([]byte, error) {
 	m, err := dbf.RecordToMap(nrec)
@@ -241,58 +306,104 @@ func (dbf *DBF) RecordToJSON(nrec uint32, trimspaces bool) ([]byte, error) {
 	return json.Marshal(m)
 }
 
-// Field reads field number fieldpos at the record number the internal pointer is pointing to and returns its Go value
+// Field reads field number fieldpos at the record number the internal pointer is pointing to and returns its Go value.
+// Errors reading or converting the field data are returned as *FieldError.
 func (dbf *DBF) Field(fieldpos int) (interface{}, error) {
-	data, err := dbf.readField(dbf.recpointer, fieldpos)
+	return dbf.fieldAt(dbf.cursor.recpointer, fieldpos)
+}
+
+// fieldAt reads field number fieldpos of record recno and returns its Go value
+func (dbf *DBF) fieldAt(recno uint32, fieldpos int) (interface{}, error) {
+	data, err := dbf.readField(recno, fieldpos)
 	if err != nil {
 		return nil, err
 	}
 	// fieldpos is valid or readField would have returned an error
-	return dbf.fieldDataToValue(data, fieldpos)
+	val, err := dbf.fieldDataToValue(data, fieldpos)
+	if err != nil {
+		offset := dbf.recordOffset(recno) + int64(dbf.offsets[fieldpos])
+		return val, dbf.newFieldError(recno, fieldpos, offset, data, err)
+	}
+	return val, nil
 }
 
 // EOF returns if the internal recordpointer is at EoF
 func (dbf *DBF) EOF() bool {
-	return dbf.recpointer >= dbf.header.NumRec
+	return dbf.cursor.EOF()
 }
 
 // BOF returns if the internal recordpointer is at BoF (first record)
 func (dbf *DBF) BOF() bool {
-	return dbf.recpointer == 0
+	return dbf.cursor.BOF()
 }
 
-// Reads raw field data of one field at fieldpos at recordpos
+// Reads raw field data of one field at fieldpos at recordpos.
+// Read errors are returned as *FieldError.
 func (dbf *DBF) readField(recordpos uint32, fieldpos int) ([]byte, error) {
 	if recordpos >= dbf.header.NumRec {
 		return nil, ErrEOF
 	}
-	if fieldpos < 0 || fieldpos > int(dbf.NumFields()) {
+	if fieldpos < 0 || fieldpos >= int(dbf.NumFields()) {
 		return nil, ErrInvalidField
 	}
+	if err := dbf.checkRecordLock(recordpos); err != nil {
+		return nil, dbf.newFieldError(recordpos, fieldpos, dbf.recordOffset(recordpos)+int64(dbf.offsets[fieldpos]), nil, err)
+	}
+	if data := dbf.mappedRecord(recordpos); data != nil {
+		offset := dbf.offsets[fieldpos]
+		return data[offset : offset+int(dbf.fields[fieldpos].Len)], nil
+	}
 	buf := make([]byte, dbf.fields[fieldpos].Len)
-	pos := int64(dbf.header.FirstRec) + (int64(recordpos) * int64(dbf.header.RecLen)) + int64(dbf.fields[fieldpos].Pos)
+	pos := dbf.recordOffset(recordpos) + int64(dbf.offsets[fieldpos])
 	read, err := dbf.r.ReadAt(buf, pos)
-	if err != nil {
-		return buf, err
+	if err == io.EOF && read < len(buf) {
+		err = ErrIncomplete
+	}
+	if err != nil && err != io.EOF {
+		return buf, dbf.newFieldError(recordpos, fieldpos, pos, buf[:read], err)
 	}
 	if read != int(dbf.fields[fieldpos].Len) {
-		return buf, ErrIncomplete
+		return buf, dbf.newFieldError(recordpos, fieldpos, pos, buf[:read], ErrIncomplete)
 	}
 	return buf, nil
 }
 
-// Reads raw record data of one record at recordpos
+// Reads raw record data of one record at recordpos.
+// Read errors are returned as *RecordError.
 func (dbf *DBF) readRecord(recordpos uint32) ([]byte, error) {
+	return dbf.readRecordInto(recordpos, nil)
+}
+
+// readRecordInto reads the raw record data at recordpos into buf, buf is grown if it is too small.
+// For mapped files buf is not used and a slice of the mapping is returned.
+func (dbf *DBF) readRecordInto(recordpos uint32, buf []byte) ([]byte, error) {
 	if recordpos >= dbf.header.NumRec {
 		return nil, ErrEOF
 	}
-	buf := make([]byte, dbf.header.RecLen)
-	read, err := dbf.r.ReadAt(buf, int64(dbf.header.FirstRec)+(int64(recordpos)*int64(dbf.header.RecLen)))
-	if err != nil {
-		return buf, err
+	if err := dbf.checkRecordLock(recordpos); err != nil {
+		return buf, &RecordError{RecNo: recordpos, Offset: dbf.recordOffset(recordpos), Err: err}
+	}
+	if dbf.mapped != nil {
+		if data := dbf.mappedRecord(recordpos); data != nil {
+			return data, nil
+		}
+		// buf may be a slice of the read-only mapping
+		buf = nil
+	}
+	if cap(buf) < int(dbf.header.RecLen) {
+		buf = make([]byte, dbf.header.RecLen)
+	}
+	buf = buf[:dbf.header.RecLen]
+	pos := dbf.recordOffset(recordpos)
+	read, err := dbf.r.ReadAt(buf, pos)
+	if err == io.EOF && read < len(buf) {
+		err = ErrIncomplete
+	}
+	if err != nil && err != io.EOF {
+		return buf, &RecordError{RecNo: recordpos, Offset: pos, Raw: buf[:read], Err: err}
 	}
 	if read != int(dbf.header.RecLen) {
-		return buf, ErrIncomplete
+		return buf, &RecordError{RecNo: recordpos, Offset: pos, Raw: buf[:read], Err: ErrIncomplete}
 	}
 	return buf, nil
 }
@@ -315,35 +426,44 @@ func (dbf *DBF) DeletedAt(recordpos uint32) (bool, error) {
 
 // Deleted returns if the record at the internal record pos is deleted
 func (dbf *DBF) Deleted() (bool, error) {
-	return dbf.DeletedAt(dbf.recpointer)
+	return dbf.DeletedAt(dbf.cursor.recpointer)
 }
 
-// Converts raw recorddata to a Record struct.
+// Converts raw recorddata of record recno to a Record struct.
 // If the data points to a memo (FPT) file this file is also read.
-func (dbf *DBF) bytesToRecord(data []byte) (*Record, error) {
+// Errors are returned as *RecordError or *FieldError.
+func (dbf *DBF) bytesToRecord(data []byte, recno uint32) (*Record, error) {
+	return dbf.rawToRecord(RawRecord{dbf: dbf, recno: recno, data: data}, nil)
+}
 
+// rawToRecord converts raw record data to a Record struct containing the fields at fieldpos, or all fields if fieldpos is nil.
+// Only memos of the converted fields are read.
+func (dbf *DBF) rawToRecord(raw RawRecord, fieldpos []int) (*Record, error) {
 	rec := new(Record)
 
 	// a record should start with te delete flag, a space (0x20) or * (0x2A)
-	rec.Deleted = data[0] == 0x2A
-	if !rec.Deleted && data[0] != 0x20 {
-		return nil, errors.New("invalid record data, no delete flag found at beginning of record")
+	rec.Deleted = raw.IsDeleted()
+	if !rec.Deleted && raw.data[0] != 0x20 {
+		// the data is copied, it may be a reused buffer
+		return nil, &RecordError{RecNo: raw.recno, Offset: dbf.recordOffset(raw.recno), Raw: append([]byte(nil), raw.data...), Err: ErrNoDeleteFlag}
 	}
 
-	rec.data = make([]interface{}, dbf.NumFields())
-
-	offset := uint16(1) // deleted flag already read
-	for i := 0; i < len(rec.data); i++ {
-		fieldinfo := dbf.fields[i]
-		val, err := dbf.fieldDataToValue(data[offset:offset+uint16(fieldinfo.Len)], i)
+	n := len(fieldpos)
+	if fieldpos == nil {
+		n = len(dbf.fields)
+	}
+	rec.data = make([]interface{}, n)
+	for i := range rec.data {
+		pos := i
+		if fieldpos != nil {
+			pos = fieldpos[i]
+		}
+		val, err := raw.Value(pos)
 		if err != nil {
 			return rec, err
 		}
 		rec.data[i] = val
-
-		offset += uint16(fieldinfo.Len)
 	}
-
 	return rec, nil
 }
 
@@ -387,13 +507,17 @@ func (dbf *DBF) fieldDataToValue(raw []byte, fieldpos int) (interface{}, error)
 		return dbf.parseDateTime(raw)
 	case "L":
 		// L values are stored as strings T or F, we only check for T, the rest is false...
+		// In strict mode values other than T, F, Y, N, ? or a space are an error
+		if dbf.strict && !validLogical(raw) {
+			return false, ErrInvalidLogical
+		}
 		return string(raw) == "T", nil
 	case "V":
-		// V values just return the raw value
-		return raw, nil
+		// V values just return a copy of the raw value, raw may be a pooled buffer or a slice of a mapped file
+		return append([]byte(nil), raw...), nil
 	case "Y":
-		// Y values are currency values stored as ints with 4 decimal places
-		return float64(float64(binary.LittleEndian.Uint64(raw)) / 10000), nil
+		// Y values are currency values stored as signed ints with 4 decimal places
+		return float64(int64(binary.LittleEndian.Uint64(raw))) / 10000, nil
 	case "N":
 		// N values are stored as string values, if no decimals return as int64, if decimals treat as float64
 		if dbf.fields[fieldpos].Decimals == 0 {
@@ -430,10 +554,18 @@ func (dbf *DBF) parseMemo(raw []byte) ([]byte, bool, error) {
 }
 
 func (dbf *DBF) parseDate(raw []byte) (time.Time, error) {
-	if string(raw) == strings.Repeat(" ", 8) {
+	if string(raw) == "        " {
 		return time.Time{}, nil
 	}
-	return time.Parse("20060102", string(raw))
+	// valid dates are converted without time.Parse, which allocates
+	if y, m, d, ok := parseYYYYMMDD(raw); ok {
+		return time.Date(y, time.Month(m), d, 0, 0, 0, 0, time.UTC), nil
+	}
+	t, err := time.Parse("20060102", string(raw))
+	if err != nil && dbf.strict {
+		return t, ErrInvalidDate
+	}
+	return t, err
 }
 
 func (dbf *DBF) parseDateTime(raw []byte) (time.Time, error) {
@@ -442,12 +574,23 @@ func (dbf *DBF) parseDateTime(raw []byte) (time.Time, error) {
 	}
 	julDat := int(binary.LittleEndian.Uint32(raw[:4]))
 	mSec := int(binary.LittleEndian.Uint32(raw[4:]))
+	if julDat == 0 && mSec == 0 {
+		// empty datetime
+		return time.Time{}, nil
+	}
 	// determine year, month, day
 	y, m, d := jd.J2YMD(julDat)
 	if y < 0 || y > 9999 {
-		// TODO some dbf files seem to contain invalid dates, not sure if we want treat this an error until I know what is going on
+		// some dbf files seem to contain invalid dates, these are only treated as an error in strict mode
+		if dbf.strict {
+			return time.Time{}, ErrInvalidDate
+		}
 		return time.Time{}, nil
 	}
+	if mSec >= 86400000 && dbf.strict {
+		// without strict mode times of a day or more are normalized into the next days by time.Date
+		return time.Time{}, ErrInvalidDate
+	}
 	// calculate whole seconds and use the remainder as nanosecond resolution
 	nSec := mSec / 1000
 	mSec = mSec - (nSec * 1000)
@@ -455,20 +598,62 @@ func (dbf *DBF) parseDateTime(raw []byte) (time.Time, error) {
 	return time.Date(y, time.Month(m), d, 0, 0, nSec, mSec*int(time.Millisecond), time.UTC), nil
 }
 
+// parseNumericInt and parseFloat trim the raw data as bytes and convert it to a string only for strconv,
+// the compiler does not allocate for this conversion because the string does not escape
 func (dbf *DBF) parseNumericInt(raw []byte) (int64, error) {
-	trimmed := strings.TrimSpace(string(raw))
+	trimmed := bytes.TrimSpace(raw)
 	if len(trimmed) == 0 {
 		return int64(0), nil
 	}
-	return strconv.ParseInt(trimmed, 10, 64)
+	if dbf.strict && !validNumeric(raw) {
+		return int64(0), ErrInvalidNumeric
+	}
+	return strconv.ParseInt(string(trimmed), 10, 64)
 }
 
 func (dbf *DBF) parseFloat(raw []byte) (float64, error) {
-	trimmed := strings.TrimSpace(string(raw))
+	trimmed := bytes.TrimSpace(raw)
 	if len(trimmed) == 0 {
 		return float64(0.0), nil
 	}
-	return strconv.ParseFloat(strings.TrimSpace(string(trimmed)), 64)
+	if dbf.strict && !validNumeric(raw) {
+		return float64(0.0), ErrInvalidNumeric
+	}
+	return strconv.ParseFloat(string(trimmed), 64)
+}
+
+// parseYYYYMMDD parses a date in YYYYMMDD format, ok is false when raw is not a valid date
+func parseYYYYMMDD(raw []byte) (y, m, d int, ok bool) {
+	if len(raw) != 8 {
+		return 0, 0, 0, false
+	}
+	n := 0
+	for _, c := range raw {
+		if c < '0' || c > '9' {
+			return 0, 0, 0, false
+		}
+		n = n*10 + int(c-'0')
+	}
+	y, m, d = n/10000, n/100%100, n%100
+	if m < 1 || m > 12 || d < 1 || d > daysIn(y, m) {
+		return 0, 0, 0, false
+	}
+	return y, m, d, true
+}
+
+// daysIn returns the number of days in month m of year y
+func daysIn(y, m int) int {
+	switch m {
+	case 2:
+		if y%4 == 0 && (y%100 != 0 || y%400 == 0) {
+			return 29
+		}
+		return 28
+	case 4, 6, 9, 11:
+		return 30
+	default:
+		return 31
+	}
 }
 
 // Reads one or more blocks from the FPT file, called for each memo field.
@@ -479,19 +664,21 @@ func (dbf *DBF) readFPT(blockdata []byte) ([]byte, bool, error) {
 		return nil, false, ErrNoFPTFile
 	}
 
-	// Determine the block number
+	// Determine the block number, block 0 is the FPT header and is used for empty memos
 	block := binary.LittleEndian.Uint32(blockdata)
-	// The position in the file is blocknumber*blocksize
-	if _, err := dbf.fptr.Seek(int64(dbf.fptheader.BlockSize)*int64(block), 0); err != nil {
-		return nil, false, err
+	if block == 0 {
+		return []byte{}, true, nil
 	}
+	// The position in the file is blocknumber*blocksize
+	// ReadAt is used instead of Seek and Read so multiple cursors can read memos at the same time
+	pos := int64(dbf.fptheader.BlockSize) * int64(block)
 
 	// Read the memo block header, instead of reading into a struct using binary.Read we just read the two
 	// uints in one buffer and then convert, this saves seconds for large DBF files with many memo fields
 	// as it avoids using the reflection in binary.Read
 	hbuf := make([]byte, 8)
-	_, err := dbf.fptr.Read(hbuf)
-	if err != nil {
+	read, err := dbf.fptr.ReadAt(hbuf, pos)
+	if err != nil && !(err == io.EOF && read == len(hbuf)) {
 		return nil, false, err
 	}
 	sign := binary.BigEndian.Uint32(hbuf[:4])
@@ -503,8 +690,8 @@ func (dbf *DBF) readFPT(blockdata []byte) ([]byte, bool, error) {
 	}
 	// Now read the actual data
 	buf := make([]byte, leng)
-	read, err := dbf.fptr.Read(buf)
-	if err != nil {
+	read, err = dbf.fptr.ReadAt(buf, pos+8)
+	if err != nil && err != io.EOF {
 		return buf, false, err
 	}
 	if read != int(leng) {
@@ -529,22 +716,58 @@ type DBFHeader struct {
 }
 
 // Modified parses the ModYear, ModMonth and ModDay to time.Time.
-// Note: The year is stored in 2 digits, 15 is 2015, we assume here that all files
-// were modified after the year 2000 and always add 2000.
+// Note: FoxPro stores the year in 2 digits, 15 is 2015 and 98 is 1998 by default, see CenturyRollover.
+// Years of 100 and up are stored by dBase as the number of years since 1900.
 func (h *DBFHeader) Modified() time.Time {
-	return time.Date(2000+int(h.ModYear), time.Month(h.ModMonth), int(h.ModDay), 0, 0, 0, 0, time.Local)
+	year := 1900 + int(h.ModYear)
+	if h.ModYear < 100 {
+		rollover := CenturyRollover
+		if rollover < 0 {
+			rollover = time.Now().Year()%100 + 1
+		}
+		if int(h.ModYear) < rollover {
+			year += 100
+		}
+	}
+	return time.Date(year, time.Month(h.ModMonth), int(h.ModDay), 0, 0, 0, 0, time.Local)
+}
+
+// HasStructuralCDX returns true if the table has a structural CDX index file (table flag 0x01)
+func (h *DBFHeader) HasStructuralCDX() bool {
+	return h.TableFlags&0x01 != 0
+}
+
+// HasMemo returns true if the table has an FPT memo file (table flag 0x02)
+func (h *DBFHeader) HasMemo() bool {
+	return h.TableFlags&0x02 != 0
+}
+
+// IsDatabaseContainer returns true if the table is a database container (table flag 0x04).
+// Tables that belong to a database container have a Backlink instead.
+func (h *DBFHeader) IsDatabaseContainer() bool {
+	return h.TableFlags&0x04 != 0
 }
 
 // NumFields returns the calculated number of fields from the header info alone (without the need to read the fieldinfo from the header).
-// This is the fastest way to determine the number of records in the file.
-// Note: when OpenFile is used the fields have already been parsed so it is better to call DBF.NumFields in that case.
+// This is the fastest way to determine the number of fields in the file. The header ends with the header record terminator,
+// followed by the 263 byte backlink in Visual FoxPro tables.
+// Note: files with extra padding after the header record terminator report too many fields,
+// when OpenFile is used the fields have already been parsed so it is better to call DBF.NumFields in that case.
 func (h *DBFHeader) NumFields() uint16 {
-	return uint16((h.FirstRec - 296) / 32)
+	size := int(h.FirstRec) - 32 - 1
+	if hasBacklink(h.FileVersion) {
+		size -= backlinkSize
+	}
+	if size < 0 {
+		return 0
+	}
+	return uint16(size / 32)
 }
 
-// FileSize eturns the calculated file size based on the header info
+// FileSize returns the calculated file size based on the header info, including the 0x1A EOF marker.
+// A file smaller than FileSize is truncated or was written without EOF marker.
 func (h *DBFHeader) FileSize() int64 {
-	return 296 + int64(h.NumFields()*32) + int64(h.NumRec*uint32(h.RecLen))
+	return int64(h.FirstRec) + int64(h.NumRec)*int64(h.RecLen) + 1
 }
 
 // FieldHeader contains the raw field info structure from the DBF header.
@@ -571,6 +794,16 @@ func (f *FieldHeader) FieldType() string {
 	return string(f.Type)
 }
 
+// IsNullable returns if the field can contain null values, these are stored in the _NullFlags field
+func (f *FieldHeader) IsNullable() bool {
+	return f.Flags&0x02 != 0
+}
+
+// IsAutoIncrement returns if the field is an autoincrement field, see DBF.NextAutoIncrement
+func (f *FieldHeader) IsAutoIncrement() bool {
+	return f.Flags&0x0C == 0x0C
+}
+
 // Record contains the raw record data and a deleted flag
 type Record struct {
 	Deleted bool
@@ -585,6 +818,11 @@ func (r *Record) Field(pos int) (interface{}, error) {
 	return r.data[pos], nil
 }
 
+// IsDeleted returns if the record is marked as deleted, it implements expr.Record together with Field
+func (r *Record) IsDeleted() bool {
+	return r.Deleted
+}
+
 // FieldSlice gets all fields as a slice
 func (r *Record) FieldSlice() []interface{} {
 	return r.data
@@ -594,17 +832,38 @@ func (r *Record) FieldSlice() []interface{} {
 // After a successful call to this method (no error is returned), the caller
 // should call DBF.Close() to close the embedded file handle(s).
 // The Decoder is used for charset translation to UTF8, see decoder.go
+// OpenFile does not write to the table, ErrRecoveryNeeded is returned when a transaction or an Alter
+// of a process that crashed has to be recovered first, see OpenFileRW.
 func OpenFile(filename string, dec Decoder) (*DBF, error) {
+	return openFile(filename, dec, os.O_RDONLY, false)
+}
+
+// openFile opens the DBF file (and FPT if needed) using flag, which must be os.O_RDONLY or os.O_RDWR.
+// With recovery an interrupted Alter or transaction is recovered, otherwise ErrRecoveryNeeded is returned for it.
+func openFile(filename string, dec Decoder, flag int, recovery bool) (*DBF, error) {
 
 	filename = filepath.Clean(filename)
 
-	dbffile, err := os.Open(filename)
+	// complete the Alter and roll back the transaction of a process that crashed
+	if recovery {
+		if err := recoverAlter(filename); err != nil {
+			return nil, err
+		}
+		if err := recoverJournal(filename); err != nil {
+			return nil, err
+		}
+	} else if err := checkRecovery(filename); err != nil {
+		return nil, err
+	}
+
+	dbffile, err := os.OpenFile(filename, flag, 0)
 	if err != nil {
 		return nil, err
 	}
 
 	dbf, err := prepareDBF(dbffile, dec)
 	if err != nil {
+		dbffile.Close()
 		return nil, err
 	}
 
@@ -613,19 +872,17 @@ func OpenFile(filename string, dec Decoder) (*DBF, error) {
 	// Check if there is an FPT according to the header
 	// If there is we will try to open it in the same dir (using the same filename and case)
 	// If the FPT file does not exist an error is returned
-	if (dbf.header.TableFlags & 0x02) != 0 {
-		ext := filepath.Ext(filename)
-		fptext := ".fpt"
-		if strings.ToUpper(ext) == ext {
-			fptext = ".FPT"
-		}
-		fptfile, err := os.Open(strings.TrimSuffix(filename, ext) + fptext)
+	if dbf.header.HasMemo() {
+		fptfile, err := os.OpenFile(fptFilename(filename), flag, 0)
 		if err != nil {
+			dbffile.Close()
 			return nil, err
 		}
 
 		err = dbf.prepareFPT(fptfile)
 		if err != nil {
+			dbffile.Close()
+			fptfile.Close()
 			return nil, err
 		}
 
@@ -635,6 +892,16 @@ func OpenFile(filename string, dec Decoder) (*DBF, error) {
 	return dbf, nil
 }
 
+// fptFilename returns the FPT filename for DBF file filename, using the same case for the extension
+func fptFilename(filename string) string {
+	ext := filepath.Ext(filename)
+	fptext := ".fpt"
+	if strings.ToUpper(ext) == ext {
+		fptext = ".FPT"
+	}
+	return strings.TrimSuffix(filename, ext) + fptext
+}
+
 // OpenStream creates a new DBF struct from a bytes stream, for example a bytes.Reader
 // The fptfile parameter is optional, but if the DBF header has the FPT flag set, the fptfile must be provided.
 // The Decoder is used for charset translation to UTF8, see decoder.go
@@ -645,7 +912,7 @@ func OpenStream(dbffile, fptfile ReaderAtSeeker, dec Decoder) (*DBF, error) {
 		return nil, err
 	}
 
-	if (dbf.header.TableFlags & 0x02) != 0 {
+	if dbf.header.HasMemo() {
 		if fptfile == nil {
 			return nil, ErrNoFPTFile
 		}
@@ -682,10 +949,56 @@ func prepareDBF(dbffile ReaderAtSeeker, dec Decoder) (*DBF, error) {
 		fields: fields,
 		dec:    dec,
 	}
+	dbf.prepareFields()
+	dbf.cursor = dbf.NewCursor()
+
+	if hasBacklink(header.FileVersion) {
+		if dbf.backlink, err = readBacklink(dbffile, dbf.HeaderTerminator()+1, header.FirstRec); err != nil {
+			return nil, err
+		}
+	}
 
 	return dbf, nil
 }
 
+// prepareFields computes the offset of every field in the record data from the field lengths, like FoxPro does.
+// The displacement in the field descriptors is not used, it is 0 in many dBase III files.
+// It also assigns the bits in the _NullFlags field, once so the table can be read by concurrent cursors:
+// bits are assigned in field order to nullable fields, varchar and varbinary fields use an extra bit
+// after their null bit which is set when the value does not use the full field length.
+func (dbf *DBF) prepareFields() {
+	dbf.offsets = make([]int, len(dbf.fields))
+	offset := 1 // deleted flag
+	nullpos := -1
+	for i, f := range dbf.fields {
+		dbf.offsets[i] = offset
+		offset += int(f.Len)
+		if f.Type == '0' && f.Flags&0x01 != 0 {
+			nullpos = i
+		}
+	}
+
+	// the last element is the position of the _NullFlags field
+	dbf.nullbits = make([]int, len(dbf.fields)+1)
+	dbf.nullbits[len(dbf.fields)] = nullpos
+	dbf.varbits = make([]int, len(dbf.fields))
+	bit := 0
+	for i, f := range dbf.fields {
+		dbf.nullbits[i], dbf.varbits[i] = -1, -1
+		if nullpos < 0 {
+			continue
+		}
+		if f.IsNullable() {
+			dbf.nullbits[i] = bit
+			bit++
+		}
+		if f.Type == 'V' || f.Type == 'Q' {
+			dbf.varbits[i] = bit
+			bit++
+		}
+	}
+}
+
 func readDBFHeader(r io.ReadSeeker) (*DBFHeader, error) {
 	h := new(DBFHeader)
 	if _, err := r.Seek(0, 0); err != nil {
@@ -742,6 +1055,22 @@ func readHeaderFields(r io.ReadSeeker) ([]FieldHeader, error) {
 	return fields, nil
 }
 
+// readBacklink reads the backlink of a Visual FoxPro table, the 263 bytes at offset after the header record terminator.
+// Returns an empty string if the header is too short to contain a backlink.
+func readBacklink(r io.ReaderAt, offset int64, firstRec uint16) (string, error) {
+	if offset+backlinkSize > int64(firstRec) {
+		return "", nil
+	}
+	b := make([]byte, backlinkSize)
+	if _, err := r.ReadAt(b, offset); err != nil {
+		return "", err
+	}
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b), nil
+}
+
 // FPTHeader is the raw header of the Memo file.
 // Header info from https://docs.microsoft.com/en-us/previous-versions/visualstudio/foxpro/8599s21w(v=vs.80)
 type FPTHeader struct {
@@ -763,6 +1092,12 @@ func readFPTHeader(r io.ReadSeeker) (*FPTHeader, error) {
 	return h, nil
 }
 
+// SetCenturyRollover sets variable CenturyRollover to the 2 digit year from which the last update year
+// in the header is in the 1900s, or -1 to use the current year.
+func SetCenturyRollover(year int) {
+	CenturyRollover = year
+}
+
 // SetValidFileVersionFunc sets variable ValidFileVersionFunc to a new function used to verify if the opened
 // file has a valid version flag.
 func SetValidFileVersionFunc(f func(version byte) error) {
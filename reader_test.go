@@ -2,6 +2,7 @@ package dbf
 
 import (
 	"bytes"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"io/ioutil"
@@ -16,8 +17,8 @@ import (
 var testDbf *DBF
 var usingFile bool
 
-// use testmain to run all the tests twice
-// one time with a file opened from disk and one time with a stream
+// use testmain to run all the tests three times
+// one time with a file opened from disk, one time with a stream and one time with a memory-mapped file
 func TestMain(m *testing.M) {
 
 	fmt.Println("Running tests with file from disk...")
@@ -37,6 +38,16 @@ func TestMain(m *testing.M) {
 
 	result = m.Run()
 
+	if result != 0 {
+		os.Exit(result)
+	}
+
+	fmt.Println("Running tests with memory-mapped file from disk...")
+	usingFile = true
+	testOpenFileMmap()
+
+	result = m.Run()
+
 	os.Exit(result)
 }
 
@@ -49,6 +60,15 @@ func testOpenFile() {
 	}
 }
 
+func testOpenFileMmap() {
+	var err error
+
+	testDbf, err = OpenFileMmap(filepath.Join("testdata", "TEST.DBF"), new(Win1250Decoder))
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
 func testOpenStream() {
 
 	dbfbytes, err := ioutil.ReadFile(filepath.Join("testdata", "TEST.DBF"))
@@ -87,9 +107,10 @@ func TestStatAndFileSize(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
+	// TEST.DBF was written without an EOF marker, FileSize includes it
 	statSize := stat.Size()
 	hdrSize := testDbf.header.FileSize()
-	if statSize != hdrSize {
+	if statSize+1 != hdrSize {
 		t.Errorf("Calculated header size: %d, stat size: %d", hdrSize, statSize)
 	}
 	stat, err = testDbf.StatFPT()
@@ -134,6 +155,61 @@ func TestNumFields(t *testing.T) {
 	}
 }
 
+func TestHeaderNumFieldsAndFileSize(t *testing.T) {
+	tests := []struct {
+		header   DBFHeader
+		fields   uint16
+		fileSize int64
+	}{
+		// Visual FoxPro with backlink
+		{DBFHeader{FileVersion: 0x30, FirstRec: 32 + 13*32 + 1 + 263, NumRec: 4, RecLen: 100}, 13, 32 + 13*32 + 1 + 263 + 400 + 1},
+		// dBase III without backlink
+		{DBFHeader{FileVersion: 0x03, FirstRec: 32 + 5*32 + 1, NumRec: 2, RecLen: 10}, 5, 32 + 5*32 + 1 + 20 + 1},
+		// first record before the end of a VFP header
+		{DBFHeader{FileVersion: 0x30, FirstRec: 65, NumRec: 0, RecLen: 10}, 0, 66},
+		// large files do not overflow
+		{DBFHeader{FileVersion: 0x03, FirstRec: 65, NumRec: 1 << 30, RecLen: 4000}, 1, 65 + 4000<<30 + 1},
+	}
+	for i, test := range tests {
+		if have := test.header.NumFields(); have != test.fields {
+			t.Errorf("%d: want %d fields, have %d", i, test.fields, have)
+		}
+		if have := test.header.FileSize(); have != test.fileSize {
+			t.Errorf("%d: want file size %d, have %d", i, test.fileSize, have)
+		}
+	}
+}
+
+func TestHeaderTerminator(t *testing.T) {
+	if have := testDbf.HeaderTerminator(); have != 32+13*32 {
+		t.Errorf("want header terminator at %d, have %d", 32+13*32, have)
+	}
+	if !usingFile {
+		return
+	}
+
+	// dbase_30.dbf ends with an EOF marker, so the file size matches the calculated size
+	dbf, err := OpenFile(filepath.Join("testdata", "dbase_30.dbf"), new(Win1250Decoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbf.Close()
+	stat, err := dbf.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stat.Size() != dbf.Header().FileSize() {
+		t.Errorf("Calculated header size: %d, stat size: %d", dbf.Header().FileSize(), stat.Size())
+	}
+	if dbf.Header().NumFields() != dbf.NumFields() {
+		t.Errorf("NumFields not equal. DBF NumFields: %d, DBF Header NumField: %d", dbf.NumFields(), dbf.Header().NumFields())
+	}
+	b := make([]byte, 1)
+	if _, err := dbf.f.ReadAt(b, dbf.HeaderTerminator()); err != nil || b[0] != 0x0D {
+		t.Errorf("want 0x0D at the header terminator, have %X (%v)", b, err)
+	}
+}
+
 func TestGoTo(t *testing.T) {
 	err := testDbf.GoTo(0)
 	if err != nil {
@@ -277,7 +353,8 @@ func TestRecordToJson(t *testing.T) {
 	want1 := `{"BOOL":true,"COMP_NAME":"TEST2","COMP_OS":"Windows XP","DATUM":"2015-02-03T00:00:00Z","FLOAT":1.23456789e+08,"ID":2,"ID_NR":6425886,"MELDING":"Tësting wíth éncôdings!","NIVEAU":1,"NUMBER":1.2345678999e+08,"SOORT":12345678,"TIJD":"12:00","USERNR":-600}`
 	want12 := `{"BOOL":true,"COMP_NAME":"TEST2","COMP_OS":"Windows XP","DATUM":"2015-02-03T00:00:00Z","FLOAT":123456789,"ID":2,"ID_NR":6425886,"MELDING":"Tësting wíth éncôdings!","NIVEAU":1,"NUMBER":123456789.99,"SOORT":12345678,"TIJD":"12:00","USERNR":-600}`
 
-	want2 := `{"BOOL":true,"COMP_NAME":"                                        ","COMP_OS":"                    ","DATUM":"0001-01-01T00:00:00Z","FLOAT":0,"ID":4,"ID_NR":0,"MELDING":"AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA==","NIVEAU":0,"NUMBER":0,"SOORT":0,"TIJD":"        ","USERNR":0}`
+	// the memo of this record points to block 0, which is an empty memo
+	want2 := `{"BOOL":true,"COMP_NAME":"                                        ","COMP_OS":"                    ","DATUM":"0001-01-01T00:00:00Z","FLOAT":0,"ID":4,"ID_NR":0,"MELDING":"","NIVEAU":0,"NUMBER":0,"SOORT":0,"TIJD":"        ","USERNR":0}`
 
 	err := testDbf.GoTo(3)
 	if err != nil {
@@ -307,6 +384,23 @@ func TestRecordToJson(t *testing.T) {
 
 }
 
+func TestEmptyMemoAndNegativeCurrency(t *testing.T) {
+	// FoxPro and CreateFile store empty memos as block 0, which holds the FPT header and no memo data
+	memo, isText, err := testDbf.readFPT([]byte{0, 0, 0, 0})
+	if err != nil || len(memo) != 0 || !isText {
+		t.Errorf("want empty text memo for block 0, have %q text %v (%v)", memo, isText, err)
+	}
+
+	// Y values are signed integers with 4 decimal places
+	dbf := &DBF{fields: []FieldHeader{{Type: 'Y', Len: 8, Decimals: 4}}}
+	raw := make([]byte, 8)
+	n := int64(-32500)
+	binary.LittleEndian.PutUint64(raw, uint64(n))
+	if val, err := dbf.fieldDataToValue(raw, 0); err != nil || val != -3.25 {
+		t.Errorf("want currency -3.25, have %v (%v)", val, err)
+	}
+}
+
 // Close file handles
 func TestClose(t *testing.T) {
 	err := testDbf.Close()
@@ -516,6 +610,75 @@ func TestDkeza(t *testing.T) {
 	t.Logf("DTIME: %s", dtime)
 }
 
+func TestHeaderFlags(t *testing.T) {
+	h := testDbf.Header()
+	if h.HasStructuralCDX() || !h.HasMemo() || h.IsDatabaseContainer() {
+		t.Errorf("want only the memo flag for table flags 0x%02X", h.TableFlags)
+	}
+	h = &DBFHeader{TableFlags: 0x05}
+	if !h.HasStructuralCDX() || h.HasMemo() || !h.IsDatabaseContainer() {
+		t.Errorf("want structural CDX and database container for table flags 0x%02X", h.TableFlags)
+	}
+}
+
+func TestModifiedCenturyRollover(t *testing.T) {
+	defer SetCenturyRollover(-1)
+
+	tests := []struct {
+		rollover int
+		year     uint8
+		want     int
+	}{
+		{-1, 15, 2015},
+		{-1, 98, 1998},
+		{-1, uint8(time.Now().Year() % 100), time.Now().Year()},
+		{50, 49, 2049},
+		{50, 50, 1950},
+		{0, 15, 1915},
+		{100, 98, 2098},
+		{-1, 115, 2015},
+	}
+	for _, test := range tests {
+		SetCenturyRollover(test.rollover)
+		h := &DBFHeader{ModYear: test.year, ModMonth: 3, ModDay: 1}
+		if have := h.Modified().Year(); have != test.want {
+			t.Errorf("rollover %d year %d: want %d, have %d", test.rollover, test.year, test.want, have)
+		}
+	}
+}
+
+func TestBacklink(t *testing.T) {
+	if testDbf.Backlink() != "" {
+		t.Errorf("want no backlink in a free table, have %q", testDbf.Backlink())
+	}
+
+	filename := filepath.Join(t.TempDir(), "BACKLINK.DBF")
+	id, err := NewField("ID", 'I', 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbf, err := CreateFile(filename, []FieldHeader{id}, new(Win1250Decoder), new(Win1250Encoder), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the backlink starts after the field definition and the terminator
+	if _, err := dbf.f.WriteAt([]byte(`..\data\sales.dbc`), 32+32+1); err != nil {
+		t.Fatal(err)
+	}
+	if err := dbf.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	dbf, err = OpenFile(filename, new(Win1250Decoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbf.Close()
+	if want := `..\data\sales.dbc`; dbf.Backlink() != want {
+		t.Errorf("want backlink %q, have %q", want, dbf.Backlink())
+	}
+}
+
 func TestSetValidFileVersionFunc(t *testing.T) {
 
 	// open the file without overriding the validation function
@@ -602,3 +765,45 @@ func BenchmarkRecordToJSONWithTrim(b *testing.B) {
 		}
 	}
 }
+
+// Same as BenchmarkReadRecords using ReadRecordInto and the typed RawRecord accessors
+func BenchmarkReadRecordsRaw(b *testing.B) {
+	for n := 0; n < b.N; n++ {
+		err := func() error {
+			dbf, err := OpenFile(filepath.Join("testdata", "dbase_30.dbf"), new(Win1250Decoder))
+			if err != nil {
+				return err
+			}
+			defer dbf.Close()
+			var buf []byte
+			for i := uint32(0); i < dbf.NumRecords(); i++ {
+				rec, err := dbf.ReadRecordInto(i, buf)
+				if err != nil {
+					return err
+				}
+				buf = rec.Data()
+				for pos, f := range dbf.Fields() {
+					switch f.Type {
+					case 'C', 'M':
+						_, err = rec.String(pos)
+					case 'N', 'F', 'B', 'Y', 'I':
+						_, err = rec.Float64(pos)
+					case 'D', 'T':
+						_, err = rec.Time(pos)
+					case 'L':
+						_, err = rec.Bool(pos)
+					default:
+						_, err = rec.Bytes(pos)
+					}
+					if err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		}()
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
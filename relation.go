@@ -0,0 +1,262 @@
+package dbf
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SebastiaanKlippert/go-foxpro-dbf/expr"
+)
+
+// RelationOptions contains the optional settings used by NewRelation
+type RelationOptions struct {
+	// Tag is the index tag of the child table the parent key is searched in. By default a tag without FOR expression
+	// with ChildKey as key expression is used when the child table has one, otherwise the child records are read into
+	// a hash table on first use.
+	Tag string
+
+	ChildKey string   // Key expression of the child records, defaults to the key expression of the parent records
+	Fields   []string // Names of the child fields to decode in this order, defaults to all fields
+	Filter   Filter   // Only child records matching the filter are related
+	Outer    bool     // Join also passes parent records without child records, with a nil child, like a LEFT JOIN
+}
+
+// Relation relates the records of a parent table to the records of a child table with the same key, like
+// SET RELATION in FoxPro. A Relation has its own cursor on the child table and can not be used concurrently.
+type Relation struct {
+	parent, child *DBF
+	key           *expr.Expr // key expression of the parent records
+	outer         bool
+
+	cursor *Cursor // cursor on the child table, ordered by the tag when an index is used
+
+	// without index the record numbers of the child records are hashed by key on first use
+	childKey *expr.Expr
+	hash     map[string][]uint32
+
+	buf []byte // buffer for reading parent records
+}
+
+// NewRelation returns a relation from table parent to table child. Key is the expression of the parent records,
+// usually a field name, that is matched to the child key expression or the key of the child index tag, see RelationOptions.
+// Keys match when they are equal, trailing spaces of Character keys are ignored.
+// Returns ErrFieldType when the parent and child keys have a different type.
+func NewRelation(parent *DBF, key string, child *DBF, opts *RelationOptions) (*Relation, error) {
+	if opts == nil {
+		opts = &RelationOptions{}
+	}
+	r := &Relation{parent: parent, child: child, outer: opts.Outer}
+	var err error
+	if r.key, err = parent.CompileExpr(key); err != nil {
+		return nil, err
+	}
+	if r.cursor, err = child.Select(opts.Fields...); err != nil {
+		return nil, err
+	}
+	if err := r.cursor.SetFilter(opts.Filter); err != nil {
+		return nil, err
+	}
+	childKey := opts.ChildKey
+	if childKey == "" {
+		childKey = key
+	}
+
+	tag := opts.Tag
+	if tag == "" {
+		tags, err := child.Tags()
+		if err != nil && err != ErrNoIndex && err != ErrIndexOutdated {
+			return nil, err
+		}
+		for _, t := range tags {
+			if t.For == "" && normalizeExpr(t.Key) == normalizeExpr(childKey) {
+				tag = t.Name
+				break
+			}
+		}
+	}
+	if tag != "" {
+		if err := r.cursor.SetOrder(tag); err != nil {
+			return nil, err
+		}
+		if typ := r.cursor.order.typ; typ >= 0 && typ != r.key.Type() {
+			return nil, fmt.Errorf("%w: key %s of type %s does not match tag %s of type %s", ErrFieldType, key, r.key.Type(), tag, typ)
+		}
+		return r, nil
+	}
+
+	if r.childKey, err = child.CompileExpr(childKey); err != nil {
+		return nil, err
+	}
+	if r.childKey.Type() != r.key.Type() {
+		return nil, fmt.Errorf("%w: key %s of type %s does not match child key %s of type %s", ErrFieldType, key, r.key.Type(), childKey, r.childKey.Type())
+	}
+	return r, nil
+}
+
+// Tag returns the index tag of the child table used by the relation, or an empty string if the child records are hashed
+func (r *Relation) Tag() string {
+	return r.cursor.Order()
+}
+
+// Children calls fn for the child records of parent record recno, in index order or in record order without index.
+// Stops at the first error, which is returned, or when fn returns ErrStopScan, in which case nil is returned.
+func (r *Relation) Children(recno uint32, fn func(recno uint32, rec *Record) error) error {
+	_, err := r.children(recno, fn)
+	if err == ErrStopScan {
+		return nil
+	}
+	return err
+}
+
+// Join calls fn for every record of cursor parent with each of its child records, like an inner join in SQL.
+// With RelationOptions.Outer parent records without child records are passed once with a nil child.
+// The parent records are scanned from the current record of the cursor, following its filter and order,
+// and only contain its selected fields. Use nil to join all parent records in record order.
+// Stops at the first error, which is returned, or when fn returns ErrStopScan, in which case nil is returned.
+func (r *Relation) Join(parent *Cursor, fn func(parent, child *Record) error) error {
+	if parent == nil {
+		parent = r.parent.NewCursor()
+	} else if parent.dbf != r.parent {
+		return fmt.Errorf("cursor is not on the parent table of the relation")
+	}
+	err := parent.Scan(func(rec *Record) error {
+		found, err := r.children(parent.RecNo(), func(recno uint32, child *Record) error {
+			return fn(rec, child)
+		})
+		if err == nil && !found && r.outer {
+			err = fn(rec, nil)
+		}
+		return err
+	})
+	if err == ErrStopScan {
+		return nil
+	}
+	return err
+}
+
+// children calls fn for the child records of parent record recno and returns if there are any.
+// ErrStopScan returned by fn is returned.
+func (r *Relation) children(recno uint32, fn func(recno uint32, rec *Record) error) (bool, error) {
+	raw, err := r.parent.ReadRecordInto(recno, r.buf)
+	if err != nil {
+		return false, err
+	}
+	if !r.parent.IsMapped() {
+		r.buf = raw.Data()
+	}
+	v, err := r.key.Eval(raw.Expr())
+	if err != nil {
+		return false, err
+	}
+
+	c := r.cursor
+	if c.order != nil {
+		if s, ok := v.(string); ok {
+			// encode truncates longer keys to the key length, so they would match the keys they start with
+			b, err := c.dbf.keyEncoder().Encode([]byte(strings.TrimRight(s, " ")))
+			if err != nil {
+				return false, err
+			}
+			if len(b) > c.order.KeyLen {
+				return false, nil
+			}
+		}
+		// the key is padded so only equal keys match, unlike Seek
+		s, err := c.order.encode(c.dbf, v, true)
+		if err != nil {
+			return false, err
+		}
+		found, err := c.seek(s)
+		if err != nil || !found {
+			return false, err
+		}
+		for {
+			rec, err := c.Record()
+			if err != nil {
+				return true, err
+			}
+			if err := fn(c.RecNo(), rec); err != nil {
+				return true, err
+			}
+			if err := c.Skip(1); err == ErrEOF {
+				return true, nil
+			} else if err != nil {
+				return true, err
+			}
+			if c.order.compare(c.key(), s) != 0 {
+				return true, nil
+			}
+		}
+	}
+
+	if r.hash == nil {
+		if err := r.buildHash(); err != nil {
+			return false, err
+		}
+	}
+	recnos := r.hash[relationKey(v)]
+	for _, recno := range recnos {
+		c.GoTo(recno)
+		rec, err := c.Record()
+		if err != nil {
+			return true, err
+		}
+		if err := fn(recno, rec); err != nil {
+			return true, err
+		}
+	}
+	return len(recnos) > 0, nil
+}
+
+// buildHash reads the keys of all child records matching the filter into the hash table
+func (r *Relation) buildHash() error {
+	hash := make(map[string][]uint32)
+	var buf []byte
+	for recno := uint32(0); recno < r.child.header.NumRec; recno++ {
+		raw, err := r.child.ReadRecordInto(recno, buf)
+		if err != nil {
+			return err
+		}
+		if !r.child.IsMapped() {
+			buf = raw.Data()
+		}
+		if r.cursor.filter != nil {
+			ok, err := r.cursor.filter.Match(raw)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+		}
+		v, err := r.childKey.Eval(raw.Expr())
+		if err != nil {
+			return err
+		}
+		k := relationKey(v)
+		hash[k] = append(hash[k], recno)
+	}
+	r.hash = hash
+	return nil
+}
+
+// relationKey returns the hash key of key value v, Character values without trailing spaces
+func relationKey(v interface{}) string {
+	switch val := v.(type) {
+	case string:
+		return strings.TrimRight(val, " ")
+	case float64:
+		return strconv.FormatFloat(val, 'g', -1, 64)
+	case time.Time:
+		return val.Format(time.RFC3339Nano)
+	case bool:
+		return strconv.FormatBool(val)
+	}
+	return fmt.Sprint(v)
+}
+
+// normalizeExpr returns expression src in upper case without spaces, to compare key expressions
+func normalizeExpr(src string) string {
+	return strings.ToUpper(strings.Join(strings.Fields(src), ""))
+}
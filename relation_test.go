@@ -0,0 +1,242 @@
+package dbf
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// createRelationTables creates tables ORDERS, LINES and CUSTOMERS in dir, opened for writing.
+// Order 4 has no lines and customer C9 does not exist, line G belongs to order 5 that does not exist.
+func createRelationTables(t *testing.T, dir string) (orders, lines, customers *DBF) {
+	t.Helper()
+	create := func(name string, fields []FieldHeader, records ...[]interface{}) *DBF {
+		dbf, err := CreateFile(filepath.Join(dir, name+".DBF"), fields, new(Win1250Decoder), new(Win1250Encoder), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { dbf.Close() })
+		for _, rec := range records {
+			if _, err := dbf.Append(rec); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return dbf
+	}
+	orders = create("ORDERS", newFields(t, "ORDERNR", byte('N'), 6, 0, "CUSTNR", byte('C'), 6, 0),
+		[]interface{}{1, "C1"}, []interface{}{2, "C2"}, []interface{}{3, "C1"}, []interface{}{4, "C9"})
+	lines = create("LINES", newFields(t, "ORDERNR", byte('N'), 6, 0, "ITEM", byte('C'), 10, 0, "QTY", byte('N'), 4, 0),
+		[]interface{}{2, "B", 1}, []interface{}{1, "A", 2}, []interface{}{3, "C", 3}, []interface{}{1, "D", 4},
+		[]interface{}{2, "E", 5}, []interface{}{1, "F", 6}, []interface{}{5, "G", 7})
+	customers = create("CUSTOMERS", newFields(t, "CUSTNR", byte('C'), 8, 0, "NAME", byte('C'), 20, 0),
+		[]interface{}{"C2", "Second"}, []interface{}{"C1", "First"})
+	return orders, lines, customers
+}
+
+// children returns the record numbers of the child records of all records of the parent table
+func children(t *testing.T, r *Relation) [][]uint32 {
+	t.Helper()
+	var all [][]uint32
+	for recno := uint32(0); recno < r.parent.NumRecords(); recno++ {
+		var recnos []uint32
+		err := r.Children(recno, func(recno uint32, rec *Record) error {
+			recnos = append(recnos, recno)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		all = append(all, recnos)
+	}
+	return all
+}
+
+// joined returns the joined records as ORDERNR and the first child field, or - for a nil child
+func joined(t *testing.T, r *Relation, parent *Cursor) []string {
+	t.Helper()
+	var have []string
+	err := r.Join(parent, func(parent, child *Record) error {
+		ordernr, _ := parent.Field(0)
+		s := "-"
+		if child != nil {
+			v, _ := child.Field(0)
+			s = strings.TrimSpace(fmt.Sprint(v))
+		}
+		have = append(have, fmt.Sprintf("%v:%s", ordernr, s))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return have
+}
+
+func TestRelation(t *testing.T) {
+	orders, lines, _ := createRelationTables(t, t.TempDir())
+	want := [][]uint32{{1, 3, 5}, {0, 4}, {2}, nil}
+
+	hashed, err := NewRelation(orders, "ORDERNR", lines, &RelationOptions{Fields: []string{"ITEM"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hashed.Tag() != "" {
+		t.Errorf("want no tag, have %s", hashed.Tag())
+	}
+	if have := children(t, hashed); !reflect.DeepEqual(have, want) {
+		t.Errorf("want children %v, have %v", want, have)
+	}
+	wantJoin := []string{"1:A", "1:D", "1:F", "2:B", "2:E", "3:C"}
+	if have := joined(t, hashed, nil); !reflect.DeepEqual(have, wantJoin) {
+		t.Errorf("want join %v, have %v", wantJoin, have)
+	}
+
+	// with an index on the child key the index is used
+	if err := lines.BuildIndex("ORDERNR", "ORDERNR", "", nil); err != nil {
+		t.Fatal(err)
+	}
+	indexed, err := NewRelation(orders, "ORDERNR", lines, &RelationOptions{Fields: []string{"ITEM"}, Outer: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if indexed.Tag() != "ORDERNR" {
+		t.Errorf("want tag ORDERNR, have %q", indexed.Tag())
+	}
+	if have := children(t, indexed); !reflect.DeepEqual(have, want) {
+		t.Errorf("want children %v using the index, have %v", want, have)
+	}
+	wantJoin = append(wantJoin, "4:-")
+	if have := joined(t, indexed, nil); !reflect.DeepEqual(have, wantJoin) {
+		t.Errorf("want outer join %v, have %v", wantJoin, have)
+	}
+
+	// the parent cursor sets the order, filter and fields of the parent records
+	if err := orders.BuildIndex("DESC", "ORDERNR", "", &IndexOptions{Descending: true}); err != nil {
+		t.Fatal(err)
+	}
+	parent, err := orders.Select("ORDERNR")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := parent.SetOrder("DESC"); err != nil {
+		t.Fatal(err)
+	}
+	if err := parent.SetFilter(Where("ORDERNR <> 2")); err != nil {
+		t.Fatal(err)
+	}
+	if err := parent.GoTop(); err != nil {
+		t.Fatal(err)
+	}
+	wantJoin = []string{"4:-", "3:C", "1:A", "1:D", "1:F"}
+	if have := joined(t, indexed, parent); !reflect.DeepEqual(have, wantJoin) {
+		t.Errorf("want join %v, have %v", wantJoin, have)
+	}
+	if err := indexed.Join(lines.NewCursor(), nil); err == nil {
+		t.Error("want error for a cursor on the child table")
+	}
+}
+
+func TestRelationFilter(t *testing.T) {
+	orders, lines, _ := createRelationTables(t, t.TempDir())
+	want := [][]uint32{{3, 5}, {4}, {2}, nil}
+	for _, index := range []bool{false, true} {
+		if index {
+			if err := lines.BuildIndex("ORDER", "ORDERNR", "", nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+		r, err := NewRelation(orders, "ORDERNR", lines, &RelationOptions{Filter: Where("QTY > 2")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have := children(t, r); !reflect.DeepEqual(have, want) {
+			t.Errorf("index %v: want children %v, have %v", index, want, have)
+		}
+
+		// ErrStopScan stops the join
+		n := 0
+		err = r.Join(nil, func(parent, child *Record) error {
+			n++
+			return ErrStopScan
+		})
+		if err != nil || n != 1 {
+			t.Errorf("index %v: want the join stopped after 1 record, have %d (%v)", index, n, err)
+		}
+	}
+}
+
+func TestRelationCharacterKey(t *testing.T) {
+	orders, _, customers := createRelationTables(t, t.TempDir())
+	want := [][]uint32{{1}, {0}, {1}, nil}
+	for _, tag := range []string{"", "CUSTNR"} {
+		if tag != "" {
+			// the tag has a different key expression, so it is passed explicitly
+			if err := customers.BuildIndex(tag, "UPPER(CUSTNR)", "", nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+		r, err := NewRelation(orders, "CUSTNR", customers, &RelationOptions{Tag: tag})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Tag() != tag {
+			t.Errorf("want tag %q, have %q", tag, r.Tag())
+		}
+		if have := children(t, r); !reflect.DeepEqual(have, want) {
+			t.Errorf("tag %q: want children %v, have %v", tag, want, have)
+		}
+	}
+
+	// C1 does not match C10 in the index, unlike Seek
+	if _, err := customers.Append([]interface{}{"C10", "Tenth"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := customers.Reindex(nil); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewRelation(orders, "CUSTNR", customers, &RelationOptions{Tag: "CUSTNR"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have := children(t, r); !reflect.DeepEqual(have, want) {
+		t.Errorf("want children %v, have %v", want, have)
+	}
+
+	// a parent key longer than the keys of the tag does not match the key it starts with
+	for _, tag := range []string{"", "CUSTNR"} {
+		r, err := NewRelation(orders, "CUSTNR+'   X'", customers, &RelationOptions{Tag: tag, ChildKey: "CUSTNR"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have := children(t, r); !reflect.DeepEqual(have, [][]uint32{nil, nil, nil, nil}) {
+			t.Errorf("tag %q: want no children for longer keys, have %v", tag, have)
+		}
+	}
+}
+
+func TestRelationErrors(t *testing.T) {
+	orders, lines, customers := createRelationTables(t, t.TempDir())
+	if _, err := NewRelation(orders, "ORDERNR", customers, &RelationOptions{ChildKey: "CUSTNR"}); !errors.Is(err, ErrFieldType) {
+		t.Errorf("want ErrFieldType for different key types, have %v", err)
+	}
+	if _, err := NewRelation(orders, "ORDERNR", lines, &RelationOptions{Tag: "ORDERNR"}); err != ErrNoIndex {
+		t.Errorf("want ErrNoIndex, have %v", err)
+	}
+	if err := lines.BuildIndex("ITEM", "ITEM", "", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewRelation(orders, "ORDERNR", lines, &RelationOptions{Tag: "ORDERNR"}); !errors.Is(err, ErrUnknownTag) {
+		t.Errorf("want ErrUnknownTag, have %v", err)
+	}
+	if _, err := NewRelation(orders, "ORDERNR", lines, &RelationOptions{Tag: "ITEM"}); !errors.Is(err, ErrFieldType) {
+		t.Errorf("want ErrFieldType for a tag of another type, have %v", err)
+	}
+	if _, err := NewRelation(orders, "MISSING", lines, nil); err == nil {
+		t.Error("want error for an unknown parent field")
+	}
+	if _, err := NewRelation(orders, "ORDERNR", lines, &RelationOptions{Fields: []string{"MISSING"}}); err == nil {
+		t.Error("want error for an unknown child field")
+	}
+}
@@ -0,0 +1,474 @@
+package dbf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+var (
+	// ErrInTransaction is returned by Begin when a transaction is already in progress
+	ErrInTransaction = errors.New("transaction already in progress")
+
+	// ErrNoTransaction is returned by Commit and Rollback when no transaction is in progress
+	ErrNoTransaction = errors.New("no transaction in progress")
+
+	// ErrRecoveryNeeded is returned by OpenFile when a transaction or an Alter of the table was interrupted,
+	// opening the table with OpenFileRW or OpenFileShared recovers it
+	ErrRecoveryNeeded = errors.New("table needs recovery, open it with OpenFileRW or OpenFileShared")
+)
+
+// journalMagic starts every journal file
+const journalMagic = "DBFJRNL1"
+
+// journal file ids, every journal entry contains the before-image of a range of the DBF or the FPT file
+const (
+	journalDBF = 0
+	journalFPT = 1
+)
+
+// journal is the rollback journal of a transaction.
+// Before a range of the DBF or FPT file that existed when the transaction started is overwritten,
+// its before-image is appended to the journal and the journal is synced.
+// Data written beyond the original file sizes is removed on rollback by truncating the files.
+type journal struct {
+	f       *os.File
+	dbfSize int64 // DBF file size when the transaction started
+	fptSize int64 // FPT file size when the transaction started, or -1 without FPT file
+	reindex bool  // the structural index was outdated when the transaction started, see outdateIndex()
+
+	saved map[journalKey]int // length of the saved before-images per offset
+}
+
+type journalKey struct {
+	file   byte
+	offset int64
+}
+
+// activeJournals contains the journal filenames of the transactions of this process.
+// fcntl locks do not conflict within a process, so the journal lock does not protect them from recoverJournal.
+var activeJournals = struct {
+	sync.Mutex
+	names map[string]bool
+}{names: make(map[string]bool)}
+
+// setJournalActive marks journal name as used by a transaction of this process, or removes the mark
+func setJournalActive(name string, active bool) {
+	name, _ = filepath.Abs(name)
+	activeJournals.Lock()
+	defer activeJournals.Unlock()
+	if active {
+		activeJournals.names[name] = true
+	} else {
+		delete(activeJournals.names, name)
+	}
+}
+
+// isJournalActive returns if journal name is used by a transaction of this process
+func isJournalActive(name string) bool {
+	name, _ = filepath.Abs(name)
+	activeJournals.Lock()
+	defer activeJournals.Unlock()
+	return activeJournals.names[name]
+}
+
+// journalFilename returns the journal filename for DBF file filename
+func journalFilename(filename string) string {
+	return filename + "-journal"
+}
+
+// InTransaction returns true if a transaction is in progress, see Begin
+func (dbf *DBF) InTransaction() bool {
+	return dbf.tx != nil
+}
+
+// Begin starts a transaction, all changes made to the DBF and FPT file until Commit can be undone with Rollback.
+// The before-images of the changed parts of the files are written to a journal file next to the DBF file,
+// named like the DBF file with -journal appended. When the process crashes during the transaction
+// the changes are rolled back automatically the next time the table is opened.
+// The journal is locked during the transaction on Linux, so an active transaction of another process
+// is not rolled back by opening the table, Begin returns ErrLocked while another transaction is active. Other processes do see the changes before they are committed,
+// use LockFile to keep other processes from writing during the transaction.
+// Closing the table during a transaction rolls back the transaction.
+// The structural CDX index is not in the journal, it can not be rebuilt during a transaction. Records written
+// during the transaction only clear the structural index flag, which is restored by a rollback, see Append.
+func (dbf *DBF) Begin() error {
+	if !dbf.rw {
+		return ErrReadOnly
+	}
+	if dbf.f == nil {
+		return ErrNoDBFFile
+	}
+	if dbf.tx != nil {
+		return ErrInTransaction
+	}
+
+	name := journalFilename(dbf.f.Name())
+	if isJournalActive(name) {
+		return ErrLocked
+	}
+	jf, err := openJournal(name, os.O_RDWR|os.O_CREATE)
+	if err != nil {
+		return err
+	}
+	// a journal left by a crashed process that wrote to the table after it was opened
+	if err := applyJournal(jf, dbf.f, dbf.fptf); err != nil {
+		jf.Close()
+		return err
+	}
+	if err := dbf.refreshHeader(); err != nil {
+		jf.Close()
+		return err
+	}
+
+	tx := &journal{f: jf, fptSize: -1, reindex: dbf.reindex, saved: make(map[journalKey]int)}
+	if tx.dbfSize, err = fileSize(dbf.f); err != nil {
+		jf.Close()
+		return err
+	}
+	if dbf.fptf != nil {
+		if tx.fptSize, err = fileSize(dbf.fptf); err != nil {
+			jf.Close()
+			return err
+		}
+	}
+	head := make([]byte, len(journalMagic)+16)
+	copy(head, journalMagic)
+	binary.LittleEndian.PutUint64(head[8:], uint64(tx.dbfSize))
+	binary.LittleEndian.PutUint64(head[16:], uint64(tx.fptSize))
+	if err := jf.Truncate(0); err != nil {
+		jf.Close()
+		return err
+	}
+	if _, err := jf.WriteAt(head, 0); err != nil {
+		jf.Close()
+		return err
+	}
+	if err := jf.Sync(); err != nil {
+		jf.Close()
+		return err
+	}
+	dbf.tx = tx
+	setJournalActive(name, true)
+	return nil
+}
+
+// Commit ends the transaction, the DBF and FPT file are synced to disk and the journal is removed
+func (dbf *DBF) Commit() error {
+	tx := dbf.tx
+	if tx == nil {
+		return ErrNoTransaction
+	}
+	if err := dbf.f.Sync(); err != nil {
+		return err
+	}
+	if dbf.fptf != nil {
+		if err := dbf.fptf.Sync(); err != nil {
+			return err
+		}
+	}
+	dbf.tx = nil
+	return closeJournal(tx.f)
+}
+
+// Rollback ends the transaction and undoes all changes made to the DBF and FPT file since Begin
+func (dbf *DBF) Rollback() error {
+	tx := dbf.tx
+	if tx == nil {
+		return ErrNoTransaction
+	}
+	dbf.tx = nil
+	if err := applyJournal(tx.f, dbf.f, dbf.fptf); err != nil {
+		setJournalActive(tx.f.Name(), false)
+		tx.f.Close()
+		return err
+	}
+	// the structural index is not changed during a transaction, the journal restored its flag so it matches the
+	// table again, also when removing the journal or reading the header fails
+	if dbf.reindex && !tx.reindex {
+		dbf.reindex = false
+		dbf.header.TableFlags |= 0x01
+		dbf.cdxmu.Lock()
+		dbf.cdxopened = dbf.cdx != nil
+		dbf.cdxmu.Unlock()
+	}
+	err := closeJournal(tx.f)
+	if refreshErr := dbf.refreshHeader(); err == nil {
+		err = refreshErr
+	}
+	return err
+}
+
+// writeDBF writes b at offset off of the DBF file, the before-image is saved when in a transaction
+func (dbf *DBF) writeDBF(b []byte, off int64) error {
+	if err := dbf.saveBeforeImage(journalDBF, off, len(b)); err != nil {
+		return err
+	}
+	_, err := dbf.f.WriteAt(b, off)
+	return err
+}
+
+// writeFPT writes b at offset off of the FPT file, the before-image is saved when in a transaction
+func (dbf *DBF) writeFPT(b []byte, off int64) error {
+	if err := dbf.saveBeforeImage(journalFPT, off, len(b)); err != nil {
+		return err
+	}
+	_, err := dbf.fptf.WriteAt(b, off)
+	return err
+}
+
+// saveBeforeImage appends the current data of n bytes at offset off of the DBF or FPT file to the journal.
+// Only data that existed when the transaction started is saved, and only once per offset.
+func (dbf *DBF) saveBeforeImage(file byte, off int64, n int) error {
+	tx := dbf.tx
+	if tx == nil {
+		return nil
+	}
+	f, size := dbf.f, tx.dbfSize
+	if file == journalFPT {
+		f, size = dbf.fptf, tx.fptSize
+	}
+	if off >= size {
+		return nil
+	}
+	if off+int64(n) > size {
+		n = int(size - off)
+	}
+	key := journalKey{file: file, offset: off}
+	if tx.saved[key] >= n {
+		return nil
+	}
+
+	// entry: file id, offset, length and the before-image
+	entry := make([]byte, 13+n)
+	entry[0] = file
+	binary.LittleEndian.PutUint64(entry[1:], uint64(off))
+	binary.LittleEndian.PutUint32(entry[9:], uint32(n))
+	if _, err := f.ReadAt(entry[13:], off); err != nil {
+		return err
+	}
+	end, err := fileSize(tx.f)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.f.WriteAt(entry, end); err != nil {
+		return err
+	}
+	// the before-image must be on disk before the table is changed
+	if err := tx.f.Sync(); err != nil {
+		return err
+	}
+	tx.saved[key] = n
+	return nil
+}
+
+// applyJournal restores the before-images in journal jf in reverse order and truncates the files to their
+// original sizes. An empty or invalid journal is ignored, an incomplete last entry is ignored because the
+// table was not changed before the entry was synced.
+func applyJournal(jf, dbffile, fptfile *os.File) error {
+	if _, err := jf.Seek(0, 0); err != nil {
+		return err
+	}
+	data, err := ioutil.ReadAll(jf)
+	if err != nil {
+		return err
+	}
+	if len(data) < len(journalMagic)+16 || !bytes.Equal(data[:len(journalMagic)], []byte(journalMagic)) {
+		return nil
+	}
+	dbfSize := int64(binary.LittleEndian.Uint64(data[8:]))
+	fptSize := int64(binary.LittleEndian.Uint64(data[16:]))
+
+	type entry struct {
+		file byte
+		off  int64
+		data []byte
+	}
+	var entries []entry
+	for rest := data[24:]; len(rest) >= 13; {
+		n := int(binary.LittleEndian.Uint32(rest[9:]))
+		if len(rest) < 13+n {
+			break
+		}
+		entries = append(entries, entry{file: rest[0], off: int64(binary.LittleEndian.Uint64(rest[1:])), data: rest[13 : 13+n]})
+		rest = rest[13+n:]
+	}
+
+	for i := len(entries) - 1; i >= 0; i-- {
+		f := dbffile
+		if entries[i].file == journalFPT {
+			f = fptfile
+		}
+		if f == nil {
+			continue
+		}
+		if _, err := f.WriteAt(entries[i].data, entries[i].off); err != nil {
+			return err
+		}
+	}
+	if err := dbffile.Truncate(dbfSize); err != nil {
+		return err
+	}
+	if err := dbffile.Sync(); err != nil {
+		return err
+	}
+	if fptfile != nil && fptSize >= 0 {
+		if err := fptfile.Truncate(fptSize); err != nil {
+			return err
+		}
+		if err := fptfile.Sync(); err != nil {
+			return err
+		}
+	}
+	// the journal is emptied so it is not applied again if removing it fails
+	return jf.Truncate(0)
+}
+
+// testHookJournalEmptied is called by closeJournal after the journal is emptied and before it is removed
+var testHookJournalEmptied = func() {}
+
+// closeJournal empties, removes and closes journal file jf. The journal stays locked and marked active until
+// it is removed, and it is emptied first, so recoverJournal never applies the journal of a committed transaction.
+func closeJournal(jf *os.File) error {
+	name := jf.Name()
+	defer setJournalActive(name, false)
+	err := jf.Truncate(0)
+	if err == nil {
+		err = jf.Sync()
+	}
+	if err != nil {
+		jf.Close()
+		return err
+	}
+	testHookJournalEmptied()
+	// files can not be removed while they are open on all platforms, an empty journal is ignored when it is left
+	removeErr := os.Remove(name)
+	err = jf.Close()
+	if removeErr != nil && !os.IsNotExist(removeErr) {
+		if removeErr = os.Remove(name); removeErr != nil && !os.IsNotExist(removeErr) {
+			return removeErr
+		}
+	}
+	return err
+}
+
+// openJournal opens and locks journal file name with flag. A journal that was removed by closeJournal of another
+// process after it was opened here is opened again, so the lock is always held on the journal at name.
+func openJournal(name string, flag int) (*os.File, error) {
+	for {
+		jf, err := os.OpenFile(name, flag, 0666)
+		if err != nil {
+			return nil, err
+		}
+		if err := lockRange(jf, 0, 1, true, false); err != nil {
+			jf.Close()
+			return nil, err
+		}
+		fi, err := jf.Stat()
+		if err != nil {
+			jf.Close()
+			return nil, err
+		}
+		current, err := os.Stat(name)
+		if err == nil && os.SameFile(fi, current) {
+			return jf, nil
+		}
+		jf.Close()
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+}
+
+// recoverJournal rolls back an incomplete transaction of table filename, left by a process that crashed.
+// Journals locked by another process belong to an active transaction and are not rolled back.
+func recoverJournal(filename string) error {
+	name := journalFilename(filename)
+	if isJournalActive(name) {
+		return nil
+	}
+	jf, err := openJournal(name, os.O_RDWR)
+	if os.IsNotExist(err) || err == ErrLocked {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	dbffile, err := os.OpenFile(filename, os.O_RDWR, 0)
+	if err != nil {
+		jf.Close()
+		return err
+	}
+	defer dbffile.Close()
+	fptfile, err := os.OpenFile(fptFilename(filename), os.O_RDWR, 0)
+	if err == nil {
+		defer fptfile.Close()
+	} else if !os.IsNotExist(err) {
+		jf.Close()
+		return err
+	}
+	if err := applyJournal(jf, dbffile, fptfile); err != nil {
+		jf.Close()
+		return err
+	}
+	return closeJournal(jf)
+}
+
+// checkRecovery returns ErrRecoveryNeeded when recoverAlter or recoverJournal would change table filename.
+// Nothing is written, so it is used for tables opened read-only.
+func checkRecovery(filename string) error {
+	pending, err := pendingJournal(alterFilename(filename), func(data []byte) bool {
+		_, _, ok := parseAlterMarker(data)
+		return ok
+	})
+	if err == nil && !pending {
+		pending, err = pendingJournal(journalFilename(filename), func(data []byte) bool {
+			return len(data) >= len(journalMagic)+16 && bytes.Equal(data[:len(journalMagic)], []byte(journalMagic))
+		})
+	}
+	if err != nil {
+		return err
+	}
+	if pending {
+		return ErrRecoveryNeeded
+	}
+	return nil
+}
+
+// pendingJournal returns true if journal or marker file name was left by a process that crashed and valid
+// reports that it is applied on recovery. Files of transactions in progress in any process are skipped.
+func pendingJournal(name string, valid func(data []byte) bool) (bool, error) {
+	// closing a file releases the fcntl locks of this process on it, so files active here are not opened
+	if isJournalActive(name) {
+		return false, nil
+	}
+	jf, err := os.Open(name)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer jf.Close()
+	if locked, err := testRange(jf, 0, 1); err != nil || locked {
+		return false, err
+	}
+	data, err := ioutil.ReadAll(jf)
+	if err != nil {
+		return false, err
+	}
+	return valid(data), nil
+}
+
+func fileSize(f *os.File) (int64, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return fi.Size(), nil
+}
@@ -0,0 +1,317 @@
+package dbf
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// readTestFiles returns the contents of the DBF and FPT file of table filename
+func readTestFiles(t *testing.T, filename string) ([]byte, []byte) {
+	t.Helper()
+	dbfdata, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fptdata, err := ioutil.ReadFile(fptFilename(filename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dbfdata, fptdata
+}
+
+// checkUnchanged fails if the DBF or FPT file of table filename differs from dbfdata and fptdata
+func checkUnchanged(t *testing.T, filename string, dbfdata, fptdata []byte) {
+	t.Helper()
+	newdbf, newfpt := readTestFiles(t, filename)
+	if !bytes.Equal(newdbf, dbfdata) {
+		t.Errorf("want DBF file to be restored, have %d bytes instead of %d", len(newdbf), len(dbfdata))
+	}
+	if !bytes.Equal(newfpt, fptdata) {
+		t.Errorf("want FPT file to be restored, have %d bytes instead of %d", len(newfpt), len(fptdata))
+	}
+	if _, err := os.Stat(journalFilename(filename)); !os.IsNotExist(err) {
+		t.Errorf("want journal to be removed, have %v", err)
+	}
+}
+
+func appendMemo(t *testing.T, dbf *DBF, memo string) {
+	t.Helper()
+	values := make([]interface{}, dbf.NumFields())
+	values[9] = memo
+	if _, err := dbf.Append(values); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRollback(t *testing.T) {
+	filename := copyTestFiles(t, t.TempDir(), "TEST.DBF")
+	dbfdata, fptdata := readTestFiles(t, filename)
+
+	dbf, err := OpenFileRW(filename, new(Win1250Decoder), new(Win1250Encoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbf.Close()
+
+	if err := dbf.Begin(); err != nil {
+		t.Fatal(err)
+	}
+	if !dbf.InTransaction() {
+		t.Error("want InTransaction to be true after Begin")
+	}
+	if err := dbf.Begin(); err != ErrInTransaction {
+		t.Errorf("want ErrInTransaction, have %v", err)
+	}
+	appendMemo(t, dbf, "first")
+	appendMemo(t, dbf, "second")
+	if dbf.NumRecords() != 6 {
+		t.Fatalf("want 6 records in the transaction, have %d", dbf.NumRecords())
+	}
+	if _, err := os.Stat(journalFilename(filename)); err != nil {
+		t.Errorf("want journal during the transaction, have %v", err)
+	}
+	if err := dbf.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if dbf.InTransaction() {
+		t.Error("want InTransaction to be false after Rollback")
+	}
+	if dbf.NumRecords() != 4 {
+		t.Errorf("want 4 records after Rollback, have %d", dbf.NumRecords())
+	}
+	checkUnchanged(t, filename, dbfdata, fptdata)
+
+	// the table can be used after a rollback, memos are written to the same blocks again
+	appendMemo(t, dbf, "after rollback")
+	rec, err := dbf.RecordAt(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := rec.Field(9); v != "after rollback" {
+		t.Errorf("unexpected MELDING %q", v)
+	}
+	if err := dbf.Rollback(); err != ErrNoTransaction {
+		t.Errorf("want ErrNoTransaction, have %v", err)
+	}
+}
+
+func TestCloseRollbackError(t *testing.T) {
+	filename := copyTestFiles(t, t.TempDir(), "TEST.DBF")
+	dbf, err := OpenFileRW(filename, new(Win1250Decoder), new(Win1250Encoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dbf.Begin(); err != nil {
+		t.Fatal(err)
+	}
+	appendMemo(t, dbf, "rolled back")
+
+	// the journal can not be read, the rollback fails
+	dbf.tx.f.Close()
+	if err := dbf.Close(); err == nil {
+		t.Error("want rollback error")
+	}
+	// the files are closed anyway
+	if _, err := dbf.f.Stat(); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("want DBF closed, have %v", err)
+	}
+	if _, err := dbf.fptf.Stat(); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("want FPT closed, have %v", err)
+	}
+}
+
+func TestCommit(t *testing.T) {
+	filename := copyTestFiles(t, t.TempDir(), "TEST.DBF")
+	dbf, err := OpenFileRW(filename, new(Win1250Decoder), new(Win1250Encoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dbf.Commit(); err != ErrNoTransaction {
+		t.Errorf("want ErrNoTransaction, have %v", err)
+	}
+	if err := dbf.Begin(); err != nil {
+		t.Fatal(err)
+	}
+	appendMemo(t, dbf, "committed")
+	if err := dbf.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(journalFilename(filename)); !os.IsNotExist(err) {
+		t.Errorf("want journal to be removed after Commit, have %v", err)
+	}
+	dbfdata, fptdata := readTestFiles(t, filename)
+
+	// closing the table rolls back an active transaction
+	if err := dbf.Begin(); err != nil {
+		t.Fatal(err)
+	}
+	appendMemo(t, dbf, "rolled back")
+	if err := dbf.Close(); err != nil {
+		t.Fatal(err)
+	}
+	checkUnchanged(t, filename, dbfdata, fptdata)
+
+	dbf, err = OpenFile(filename, new(Win1250Decoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbf.Close()
+	if dbf.NumRecords() != 5 {
+		t.Fatalf("want 5 records, have %d", dbf.NumRecords())
+	}
+	if err := dbf.Begin(); err != ErrReadOnly {
+		t.Errorf("want ErrReadOnly, have %v", err)
+	}
+}
+
+func TestCommitOpenedBeforeRemoval(t *testing.T) {
+	filename := copyTestFiles(t, t.TempDir(), "TEST.DBF")
+	dbf, err := OpenFileRW(filename, new(Win1250Decoder), new(Win1250Encoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbf.Close()
+	if err := dbf.Begin(); err != nil {
+		t.Fatal(err)
+	}
+	appendMemo(t, dbf, "committed")
+
+	// the table is opened after the journal is emptied but before it is removed, the commit is kept
+	opened := false
+	testHookJournalEmptied = func() {
+		opened = true
+		other, err := OpenFile(filename, new(Win1250Decoder))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer other.Close()
+		if other.NumRecords() != 5 {
+			t.Errorf("want 5 records while committing, have %d", other.NumRecords())
+		}
+	}
+	defer func() { testHookJournalEmptied = func() {} }()
+	if err := dbf.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if !opened {
+		t.Fatal("want the table opened during Commit")
+	}
+	if _, err := os.Stat(journalFilename(filename)); !os.IsNotExist(err) {
+		t.Errorf("want journal to be removed after Commit, have %v", err)
+	}
+}
+
+func TestCommitOtherProcessOpenedBeforeRemoval(t *testing.T) {
+	skipLockTests(t)
+	filename := copyTestFiles(t, t.TempDir(), "TEST.DBF")
+
+	// the other process has emptied the journal of its commit but not yet removed it
+	release := startLockHelper(t, "commit:"+filename)
+	dbf, err := OpenFile(filename, new(Win1250Decoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dbf.NumRecords() != 5 {
+		t.Errorf("want 5 records while the other process commits, have %d", dbf.NumRecords())
+	}
+	dbf.Close()
+	release()
+
+	if _, err := os.Stat(journalFilename(filename)); !os.IsNotExist(err) {
+		t.Errorf("want journal to be removed after Commit, have %v", err)
+	}
+	dbf, err = OpenFile(filename, new(Win1250Decoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbf.Close()
+	if dbf.NumRecords() != 5 {
+		t.Errorf("want 5 committed records, have %d", dbf.NumRecords())
+	}
+}
+
+func TestTransactionOtherTable(t *testing.T) {
+	filename := copyTestFiles(t, t.TempDir(), "TEST.DBF")
+	dbf, err := OpenFileRW(filename, new(Win1250Decoder), new(Win1250Encoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbf.Close()
+	if err := dbf.Begin(); err != nil {
+		t.Fatal(err)
+	}
+	appendMemo(t, dbf, "uncommitted")
+
+	// opening the table again in this process does not roll back the active transaction
+	other, err := OpenFileRW(filename, new(Win1250Decoder), new(Win1250Encoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	if other.NumRecords() != 5 {
+		t.Errorf("want 5 records, have %d", other.NumRecords())
+	}
+	if err := other.Begin(); err != ErrLocked {
+		t.Errorf("want ErrLocked while another transaction is active, have %v", err)
+	}
+	if err := dbf.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.Begin(); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTransactionRecovery(t *testing.T) {
+	skipLockTests(t)
+	filename := copyTestFiles(t, t.TempDir(), "TEST.DBF")
+	dbfdata, fptdata := readTestFiles(t, filename)
+
+	release := startLockHelper(t, "transaction:"+filename)
+
+	// the transaction of the other process is active, so it is not rolled back
+	dbf, err := OpenFile(filename, new(Win1250Decoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dbf.NumRecords() != 5 {
+		t.Errorf("want 5 records while the other process is in a transaction, have %d", dbf.NumRecords())
+	}
+	dbf.Close()
+	rw, err := OpenFileRW(filename, new(Win1250Decoder), new(Win1250Encoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rw.Begin(); err != ErrLocked {
+		t.Errorf("want ErrLocked while the other process is in a transaction, have %v", err)
+	}
+	rw.Close()
+
+	// the other process exits without committing, opening the table read-only does not roll it back
+	release()
+	before, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenFile(filename, new(Win1250Decoder)); err != ErrRecoveryNeeded {
+		t.Errorf("want ErrRecoveryNeeded opening read-only, have %v", err)
+	}
+	if after, _ := ioutil.ReadFile(filename); !bytes.Equal(after, before) {
+		t.Error("want the DBF file unchanged by OpenFile")
+	}
+	dbf, err = OpenFileShared(filename, new(Win1250Decoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbf.Close()
+	if dbf.NumRecords() != 4 {
+		t.Errorf("want 4 records after recovery, have %d", dbf.NumRecords())
+	}
+	checkUnchanged(t, filename, dbfdata, fptdata)
+}
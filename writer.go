@@ -0,0 +1,747 @@
+package dbf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SebastiaanKlippert/go-foxpro-dbf/jd"
+)
+
+var (
+	// ErrReadOnly is returned when a write operation is attempted on a table that is not opened for writing
+	ErrReadOnly = errors.New("table is not opened for writing")
+
+	// ErrFieldOverflow is returned when a value does not fit in its field
+	ErrFieldOverflow = errors.New("value does not fit in field")
+
+	// ErrUnsupportedValue is returned when a Go value can not be stored in a field of a certain type
+	ErrUnsupportedValue = errors.New("unsupported value for field type")
+)
+
+// backlinkSize is the size of the database container backlink which follows the field terminator in VFP tables
+const backlinkSize = 263
+
+// CreateOptions contains the optional settings used by CreateFile.
+// The zero value creates a Visual FoxPro table without a code page mark.
+type CreateOptions struct {
+	FileVersion byte   // File type flag, defaults to 0x30, or 0x31 when a field has autoincrement enabled
+	CodePage    byte   // Code page mark
+	TableFlags  byte   // Table flags, the memo flag (0x02) is set automatically when there are memo fields
+	BlockSize   uint16 // FPT block size, defaults to 64
+}
+
+// NewField returns a FieldHeader for a new field to be used with CreateFile.
+// For field types with a fixed length (I, B, D, T, Y, L and M) length can be 0.
+// The name is converted to upper case and can have a maximum length of 10 characters.
+func NewField(name string, fieldType byte, length, decimals uint8) (FieldHeader, error) {
+	f := FieldHeader{Type: fieldType, Len: length, Decimals: decimals}
+	name = strings.ToUpper(name)
+	if len(name) == 0 || len(name) > 10 {
+		return f, fmt.Errorf("invalid field name %q, field names must have 1 to 10 characters", name)
+	}
+	for i, c := range name {
+		if !(c >= 'A' && c <= 'Z' || c == '_' || i > 0 && c >= '0' && c <= '9') {
+			return f, fmt.Errorf("invalid field name %q, only letters, digits and underscores are allowed", name)
+		}
+	}
+	copy(f.Name[:], name)
+
+	switch fieldType {
+	case 'I', 'M':
+		f.Len = 4
+	case 'B', 'D', 'T':
+		f.Len = 8
+	case 'Y':
+		f.Len, f.Decimals = 8, 4
+	case 'L':
+		f.Len = 1
+	case 'N', 'F':
+		if length == 0 || length > 20 || decimals > 0 && decimals >= length-1 {
+			return f, fmt.Errorf("invalid length %d and decimals %d for numeric field %s", length, decimals, name)
+		}
+	case 'C', 'V', '0':
+		if length == 0 {
+			return f, fmt.Errorf("invalid length 0 for field %s", name)
+		}
+	default:
+		return f, fmt.Errorf("unsupported field type %q for field %s", fieldType, name)
+	}
+	if fieldType == 'B' {
+		f.Decimals = decimals
+	}
+	return f, nil
+}
+
+// CreateFile creates a new empty table filename (and an FPT file when there are memo fields)
+// and returns it opened for reading and writing. Existing files are truncated.
+// The field positions and record length are calculated from the fields, see NewField to create fields.
+// The Decoder is used for charset translation to UTF8 when reading, the Encoder is used for translation
+// from UTF8 to the charset of the table when writing, see decoder.go.
+// After a successful call the caller should call DBF.Close() to close the file handle(s).
+func CreateFile(filename string, fields []FieldHeader, dec Decoder, enc Encoder, opts *CreateOptions) (*DBF, error) {
+	if opts == nil {
+		opts = new(CreateOptions)
+	}
+	if len(fields) == 0 {
+		return nil, errors.New("a table must have at least one field")
+	}
+
+	header := &DBFHeader{
+		FileVersion: opts.FileVersion,
+		CodePage:    opts.CodePage,
+		TableFlags:  opts.TableFlags &^ 0x02,
+	}
+	fields = append([]FieldHeader(nil), fields...)
+	names := make(map[string]bool, len(fields))
+	pos := uint32(1)
+	for i := range fields {
+		name := fields[i].FieldName()
+		if names[name] {
+			return nil, fmt.Errorf("duplicate field name %s", name)
+		}
+		names[name] = true
+		if fields[i].Len == 0 {
+			return nil, fmt.Errorf("invalid length 0 for field %s", name)
+		}
+		if isMemoType(fields[i].Type) {
+			header.TableFlags |= 0x02
+		}
+		if fields[i].IsAutoIncrement() && header.FileVersion == 0 {
+			header.FileVersion = 0x31
+		}
+		fields[i].Pos = pos
+		pos += uint32(fields[i].Len)
+	}
+	if pos > math.MaxUint16 {
+		return nil, fmt.Errorf("record length %d is too large", pos)
+	}
+	if header.FileVersion == 0 {
+		header.FileVersion = 0x30
+	}
+	header.RecLen = uint16(pos)
+	header.FirstRec = uint16(32 + 32*len(fields) + 1)
+	if hasBacklink(header.FileVersion) {
+		header.FirstRec += backlinkSize
+	}
+	header.setModified(time.Now())
+
+	filename = filepath.Clean(filename)
+	dbffile, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return nil, err
+	}
+	dbf := &DBF{
+		header: header,
+		r:      dbffile,
+		f:      dbffile,
+		fields: fields,
+		dec:    dec,
+		enc:    enc,
+		rw:     true,
+	}
+	dbf.prepareFields()
+	dbf.cursor = dbf.NewCursor()
+
+	// header, fields, terminator and backlink followed by the EOF marker
+	buf := new(bytes.Buffer)
+	if err := binary.Write(buf, binary.LittleEndian, header); err != nil {
+		dbf.Close()
+		return nil, err
+	}
+	// DBFHeader does not include the last 2 reserved bytes of the 32 byte header
+	buf.Write(make([]byte, 32-buf.Len()))
+	for i := range fields {
+		buf.Write(fields[i].bytes())
+	}
+	buf.WriteByte(0x0D)
+	buf.Write(make([]byte, int(header.FirstRec)-buf.Len()))
+	buf.WriteByte(0x1A)
+	if _, err := dbffile.WriteAt(buf.Bytes(), 0); err != nil {
+		dbf.Close()
+		return nil, err
+	}
+
+	if header.HasMemo() {
+		blockSize := opts.BlockSize
+		if blockSize == 0 {
+			blockSize = 64
+		}
+		if err := dbf.createFPT(fptFilename(filename), blockSize); err != nil {
+			dbf.Close()
+			return nil, err
+		}
+	}
+
+	return dbf, nil
+}
+
+// createFPT creates a new empty FPT file with a 512 byte header
+func (dbf *DBF) createFPT(filename string, blockSize uint16) error {
+	fptfile, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	dbf.fptf = fptfile
+	dbf.fptr = fptfile
+	dbf.fptheader = &FPTHeader{
+		NextFree:  uint32((512 + int(blockSize) - 1) / int(blockSize)),
+		BlockSize: blockSize,
+	}
+	buf := new(bytes.Buffer)
+	// Integers in memo files are stored with the most significant byte first
+	if err := binary.Write(buf, binary.BigEndian, dbf.fptheader); err != nil {
+		return err
+	}
+	buf.Write(make([]byte, int(dbf.fptheader.NextFree)*int(blockSize)-buf.Len()))
+	_, err = fptfile.WriteAt(buf.Bytes(), 0)
+	return err
+}
+
+// OpenFileRW opens a DBF file (and FPT if needed) from disk for reading and writing.
+// The Decoder is used for charset translation to UTF8 when reading, the Encoder is used for translation
+// from UTF8 to the charset of the table when writing, see decoder.go.
+// After a successful call the caller should call DBF.Close() to close the file handle(s).
+func OpenFileRW(filename string, dec Decoder, enc Encoder) (*DBF, error) {
+	dbf, err := openFile(filename, dec, os.O_RDWR, true)
+	if err != nil {
+		return nil, err
+	}
+	dbf.enc = enc
+	dbf.rw = true
+	return dbf, nil
+}
+
+// Writable returns true if the table is opened for writing
+func (dbf *DBF) Writable() bool {
+	return dbf.rw
+}
+
+// Append adds a new record with the values in field order to the end of the table and returns its record number.
+// The values should have the Go types as returned when reading the fields, but all integer and float types are
+// accepted for numeric fields. A nil value writes an empty field, nullable fields in Visual FoxPro tables are
+// null unless a value for the _NullFlags field is passed.
+// Errors converting the values are returned as *FieldError, nothing is written when a value can not be converted.
+//
+// Autoincrement fields with a nil value are assigned the next value of the field, other values are written as is
+// without changing the next value, like SET AUTOINCERROR OFF in VFP.
+// Like VFP the header is locked while appending, the record count and next values are read again
+// after locking so records appended by other processes are not overwritten.
+//
+// The structural CDX index is not updated. When the table has one, the structural index flag is cleared before
+// the first record is written, so FoxPro and Seek never use an index that misses records, and the index is
+// rebuilt by Close or Reindex. Until then ordered cursors of this table return ErrIndexOutdated.
+// Append returns an error without writing when a tag can not be rebuilt from its expressions.
+func (dbf *DBF) Append(values []interface{}) (uint32, error) {
+	if !dbf.rw {
+		return 0, ErrReadOnly
+	}
+	if err := dbf.lockHeader(); err != nil {
+		return 0, err
+	}
+	defer dbf.unlockHeader()
+	if err := dbf.refreshHeader(); err != nil {
+		return 0, err
+	}
+	if err := dbf.outdateIndex(); err != nil {
+		return 0, err
+	}
+
+	recno := dbf.header.NumRec
+	values, autoinc := dbf.assignAutoIncrement(values)
+	data, memos, err := dbf.valuesToRecordData(values, recno)
+	if err != nil {
+		return recno, err
+	}
+	// the memos are written after all values are converted, their blocks are freed again when writing fails
+	var nextFree uint32
+	if dbf.fptheader != nil {
+		nextFree = dbf.fptheader.NextFree
+	}
+	err = dbf.writeMemos(data, memos, recno)
+	if err == nil {
+		// write the record followed by the EOF marker
+		data = append(data, 0x1A)
+		if err = dbf.writeDBF(data, dbf.recordOffset(recno)); err != nil {
+			err = &RecordError{RecNo: recno, Offset: dbf.recordOffset(recno), Raw: data, Err: err}
+		}
+	}
+	if err != nil {
+		if len(memos) > 0 {
+			dbf.setNextFree(nextFree)
+		}
+		return recno, err
+	}
+	for _, pos := range autoinc {
+		if err := dbf.writeAutoIncrement(pos); err != nil {
+			return recno, err
+		}
+	}
+	dbf.header.NumRec++
+	return recno, dbf.writeHeader()
+}
+
+// refreshHeader reads the header, the next values of autoincrement fields and the FPT header again from disk,
+// other processes may have appended records
+func (dbf *DBF) refreshHeader() error {
+	if dbf.f == nil {
+		return nil
+	}
+	buf := make([]byte, 32)
+	if _, err := dbf.f.ReadAt(buf, 0); err != nil {
+		return err
+	}
+	if err := binary.Read(bytes.NewReader(buf), binary.LittleEndian, dbf.header); err != nil {
+		return err
+	}
+	for i := range dbf.fields {
+		if dbf.fields[i].IsAutoIncrement() {
+			if _, err := dbf.readAutoIncrement(i); err != nil {
+				return err
+			}
+		}
+	}
+	if dbf.fptf != nil {
+		fptheader, err := readFPTHeader(dbf.fptf)
+		if err != nil {
+			return err
+		}
+		dbf.fptheader = fptheader
+	}
+	return nil
+}
+
+// assignAutoIncrement returns values with the next value assigned to autoincrement fields with a nil value,
+// the next values of these fields are advanced in memory and their positions are returned.
+// The values passed in are not modified.
+func (dbf *DBF) assignAutoIncrement(values []interface{}) ([]interface{}, []int) {
+	var autoinc []int
+	for i := range dbf.fields {
+		f := &dbf.fields[i]
+		if !f.IsAutoIncrement() || i >= len(values) || values[i] != nil {
+			continue
+		}
+		if autoinc == nil {
+			values = append([]interface{}(nil), values...)
+		}
+		values[i] = int32(f.Next)
+		f.Next += uint32(f.autoIncrementStep())
+		autoinc = append(autoinc, i)
+	}
+	return values, autoinc
+}
+
+// fieldOffset returns the offset of the field descriptor of field fieldpos in the file
+func fieldOffset(fieldpos int) int64 {
+	return 32 + 32*int64(fieldpos)
+}
+
+// readAutoIncrement reads the next value of autoincrement field fieldpos from disk into the field header
+func (dbf *DBF) readAutoIncrement(fieldpos int) (uint32, error) {
+	b := make([]byte, 4)
+	// Next is stored at byte 19 of the field descriptor
+	if _, err := dbf.r.ReadAt(b, fieldOffset(fieldpos)+19); err != nil {
+		return 0, err
+	}
+	dbf.fields[fieldpos].Next = binary.LittleEndian.Uint32(b)
+	return dbf.fields[fieldpos].Next, nil
+}
+
+// writeAutoIncrement writes the next value of autoincrement field fieldpos to its field descriptor
+func (dbf *DBF) writeAutoIncrement(fieldpos int) error {
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, dbf.fields[fieldpos].Next)
+	return dbf.writeDBF(b, fieldOffset(fieldpos)+19)
+}
+
+// NextAutoIncrement returns the value the next record appended to the table gets for autoincrement field fieldpos.
+// For tables opened from disk the value is read from the file, so values used by other processes are seen.
+// Returns ErrInvalidField if the field is not an autoincrement field.
+func (dbf *DBF) NextAutoIncrement(fieldpos int) (int32, error) {
+	if fieldpos < 0 || fieldpos >= len(dbf.fields) {
+		return 0, ErrInvalidField
+	}
+	f := &dbf.fields[fieldpos]
+	if !f.IsAutoIncrement() {
+		return 0, fmt.Errorf("%w: field %s is not an autoincrement field", ErrInvalidField, f.FieldName())
+	}
+	if dbf.f == nil {
+		return int32(f.Next), nil
+	}
+	next, err := dbf.readAutoIncrement(fieldpos)
+	return int32(next), err
+}
+
+// SetAutoIncrement enables autoincrement for a new I field to be used with CreateFile,
+// the first record gets value next and the value is incremented by step for every record
+func (f *FieldHeader) SetAutoIncrement(next int32, step uint8) {
+	f.Flags |= 0x0C
+	f.Next = uint32(next)
+	f.Step = uint16(step)
+}
+
+// autoIncrementStep returns the step of an autoincrement field, the step is stored in one byte
+func (f *FieldHeader) autoIncrementStep() uint8 {
+	if step := uint8(f.Step); step > 0 {
+		return step
+	}
+	return 1
+}
+
+// writeHeader writes the first 32 bytes of the header with the current record count and modified date
+func (dbf *DBF) writeHeader() error {
+	dbf.header.setModified(time.Now())
+	buf := new(bytes.Buffer)
+	if err := binary.Write(buf, binary.LittleEndian, dbf.header); err != nil {
+		return err
+	}
+	return dbf.writeDBF(buf.Bytes(), 0)
+}
+
+// setModified sets the last update date in the header
+func (h *DBFHeader) setModified(t time.Time) {
+	h.ModYear = uint8(t.Year() % 100)
+	h.ModMonth = uint8(t.Month())
+	h.ModDay = uint8(t.Day())
+}
+
+// bytes returns the 32 byte field descriptor.
+// The struct is one byte larger than the descriptor since Step is read as uint16, its high byte is
+// the first reserved byte which is always 0.
+func (f *FieldHeader) bytes() []byte {
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.LittleEndian, f)
+	return buf.Bytes()[:32]
+}
+
+// hasBacklink returns true if the file version has a database container backlink after the field terminator
+func hasBacklink(version byte) bool {
+	return version == 0x30 || version == 0x31 || version == 0x32
+}
+
+// memoValue is a memo of a record that is written to the FPT file by writeMemos
+type memoValue struct {
+	fieldpos int
+	data     []byte
+	text     bool
+}
+
+// valuesToRecordData converts the values for record recno to raw record data.
+// Nothing is written, the memos are returned to be written by writeMemos once all values are converted.
+// Nil values of nullable fields are null when the _NullFlags value is nil.
+func (dbf *DBF) valuesToRecordData(values []interface{}, recno uint32) ([]byte, []memoValue, error) {
+	if len(values) != len(dbf.fields) {
+		return nil, nil, &RecordError{RecNo: recno, Offset: dbf.recordOffset(recno), Err: fmt.Errorf("want %d values, have %d", len(dbf.fields), len(values))}
+	}
+	data := make([]byte, dbf.header.RecLen, int(dbf.header.RecLen)+1)
+	data[0] = 0x20
+	var memos []memoValue
+	for i, f := range dbf.fields {
+		offset := dbf.offsets[i]
+		raw := data[offset : offset+int(f.Len)]
+		var err error
+		if f.Type == 'M' && values[i] != nil {
+			var memo []byte
+			var text bool
+			if memo, text, err = dbf.memoData(values[i], f); err == nil {
+				err = dbf.emptyFieldData(f.Type, raw)
+			}
+			if len(memo) > 0 {
+				memos = append(memos, memoValue{fieldpos: i, data: memo, text: text})
+			}
+		} else {
+			err = dbf.valueToFieldData(values[i], i, raw)
+		}
+		if err != nil {
+			return nil, nil, dbf.newFieldError(recno, i, dbf.recordOffset(recno)+int64(offset), nil, err)
+		}
+	}
+	if nullpos := dbf.nullbits[len(dbf.fields)]; nullpos >= 0 && values[nullpos] == nil {
+		flags := data[dbf.offsets[nullpos] : dbf.offsets[nullpos]+int(dbf.fields[nullpos].Len)]
+		for i, val := range values {
+			if bit := dbf.nullbits[i]; val == nil && bit >= 0 && bit/8 < len(flags) {
+				flags[bit/8] |= 1 << uint(bit%8)
+			}
+		}
+	}
+	return data, memos, nil
+}
+
+// writeMemos writes the memos returned by valuesToRecordData to the FPT file and their blocks to record data
+func (dbf *DBF) writeMemos(data []byte, memos []memoValue, recno uint32) error {
+	for _, m := range memos {
+		offset := dbf.offsets[m.fieldpos]
+		block, err := dbf.writeMemo(m.data, m.text)
+		if err != nil {
+			return dbf.newFieldError(recno, m.fieldpos, dbf.recordOffset(recno)+int64(offset), nil, err)
+		}
+		binary.LittleEndian.PutUint32(data[offset:], block)
+	}
+	return nil
+}
+
+// valueToFieldData converts a Go value to the raw field data for field fieldpos, raw must have the field length.
+// This is the reverse of fieldDataToValue.
+// For C and M fields a charset conversion is done.
+// For M fields the data is written to the FPT file.
+func (dbf *DBF) valueToFieldData(val interface{}, fieldpos int, raw []byte) error {
+	f := dbf.fields[fieldpos]
+	if val == nil {
+		return dbf.emptyFieldData(f.Type, raw)
+	}
+
+	switch f.Type {
+	default:
+		return fmt.Errorf("unsupported fieldtype: %s", f.FieldType())
+	case 'M':
+		data, text, err := dbf.memoData(val, f)
+		if err != nil {
+			return err
+		}
+		if len(data) == 0 {
+			return dbf.emptyFieldData(f.Type, raw)
+		}
+		block, err := dbf.writeMemo(data, text)
+		if err != nil {
+			return err
+		}
+		binary.LittleEndian.PutUint32(raw, block)
+	case 'C':
+		var data []byte
+		switch v := val.(type) {
+		case string:
+			enc, err := dbf.fromUTF8String(v)
+			if err != nil {
+				return err
+			}
+			data = enc
+		case []byte:
+			data = v
+		default:
+			return unsupportedValue(val, f)
+		}
+		// C values are padded with spaces
+		if len(data) > len(raw) {
+			return ErrFieldOverflow
+		}
+		n := copy(raw, data)
+		for i := n; i < len(raw); i++ {
+			raw[i] = ' '
+		}
+	case 'I':
+		i, ok := asInt64(val)
+		if !ok {
+			return unsupportedValue(val, f)
+		}
+		if i < math.MinInt32 || i > math.MaxInt32 {
+			return ErrFieldOverflow
+		}
+		binary.LittleEndian.PutUint32(raw, uint32(int32(i)))
+	case 'B':
+		fl, ok := asFloat64(val)
+		if !ok {
+			return unsupportedValue(val, f)
+		}
+		binary.LittleEndian.PutUint64(raw, math.Float64bits(fl))
+	case 'Y':
+		// Y values are currency values stored as ints with 4 decimal places
+		fl, ok := asFloat64(val)
+		if !ok {
+			return unsupportedValue(val, f)
+		}
+		binary.LittleEndian.PutUint64(raw, uint64(int64(math.Round(fl*10000))))
+	case 'D':
+		t, ok := val.(time.Time)
+		if !ok {
+			return unsupportedValue(val, f)
+		}
+		if t.IsZero() {
+			return dbf.emptyFieldData(f.Type, raw)
+		}
+		copy(raw, t.Format("20060102"))
+	case 'T':
+		t, ok := val.(time.Time)
+		if !ok {
+			return unsupportedValue(val, f)
+		}
+		if t.IsZero() {
+			return dbf.emptyFieldData(f.Type, raw)
+		}
+		// T values are stored as the Julian day and the number of milliseconds since midnight
+		y, m, d := t.Date()
+		h, min, s := t.Clock()
+		ms := ((h*60+min)*60+s)*1000 + t.Nanosecond()/int(time.Millisecond)
+		binary.LittleEndian.PutUint32(raw[:4], uint32(jd.YMD2J(y, int(m), d)))
+		binary.LittleEndian.PutUint32(raw[4:], uint32(ms))
+	case 'L':
+		b, ok := val.(bool)
+		if !ok {
+			return unsupportedValue(val, f)
+		}
+		raw[0] = 'F'
+		if b {
+			raw[0] = 'T'
+		}
+	case 'N', 'F':
+		var s string
+		if i, ok := asInt64(val); ok {
+			s = strconv.FormatInt(i, 10)
+			if f.Decimals > 0 {
+				s += "." + strings.Repeat("0", int(f.Decimals))
+			}
+		} else if fl, ok := asFloat64(val); ok {
+			if math.IsNaN(fl) || math.IsInf(fl, 0) {
+				return unsupportedValue(val, f)
+			}
+			s = strconv.FormatFloat(fl, 'f', int(f.Decimals), 64)
+		} else {
+			return unsupportedValue(val, f)
+		}
+		// N and F values are right aligned and padded with spaces
+		if len(s) > len(raw) {
+			return ErrFieldOverflow
+		}
+		pad := len(raw) - len(s)
+		for i := 0; i < pad; i++ {
+			raw[i] = ' '
+		}
+		copy(raw[pad:], s)
+	case 'V', '0':
+		// V and 0 (null flags) values are written raw
+		b, ok := val.([]byte)
+		if !ok || len(b) > len(raw) {
+			return unsupportedValue(val, f)
+		}
+		n := copy(raw, b)
+		for i := n; i < len(raw); i++ {
+			raw[i] = 0
+		}
+	}
+	return nil
+}
+
+// emptyFieldData writes the empty value for field type t into raw
+func (dbf *DBF) emptyFieldData(t byte, raw []byte) error {
+	fill := byte(' ')
+	switch t {
+	case 'I', 'B', 'Y', 'T', 'M', 'V', '0':
+		fill = 0
+	}
+	for i := range raw {
+		raw[i] = fill
+	}
+	return nil
+}
+
+// fromUTF8String converts a UTF8 string to the charset of the table using the encoder in dbf
+func (dbf *DBF) fromUTF8String(s string) ([]byte, error) {
+	if dbf.enc == nil {
+		return []byte(s), nil
+	}
+	return dbf.enc.Encode([]byte(s))
+}
+
+// memoData converts a Go value to the data of a memo of field f and returns if it is a text memo.
+// Empty strings return no data, they are written as an empty memo.
+func (dbf *DBF) memoData(val interface{}, f FieldHeader) ([]byte, bool, error) {
+	switch v := val.(type) {
+	case string:
+		if v == "" {
+			return nil, true, nil
+		}
+		data, err := dbf.fromUTF8String(v)
+		return data, true, err
+	case []byte:
+		return v, false, nil
+	default:
+		return nil, false, unsupportedValue(val, f)
+	}
+}
+
+// writeMemo writes data to the next free block(s) in the FPT file and returns the block number
+func (dbf *DBF) writeMemo(data []byte, text bool) (uint32, error) {
+	if dbf.fptf == nil {
+		return 0, ErrNoFPTFile
+	}
+	blockSize := int(dbf.fptheader.BlockSize)
+	block := dbf.fptheader.NextFree
+
+	// the block header contains the type (1 is text, 0 is binary) and the length
+	// the data is padded to a multiple of the block size
+	buf := make([]byte, (8+len(data)+blockSize-1)/blockSize*blockSize)
+	if text {
+		binary.BigEndian.PutUint32(buf[:4], 1)
+	}
+	binary.BigEndian.PutUint32(buf[4:8], uint32(len(data)))
+	copy(buf[8:], data)
+	if err := dbf.writeFPT(buf, int64(block)*int64(blockSize)); err != nil {
+		return 0, err
+	}
+
+	dbf.fptheader.NextFree += uint32(len(buf) / blockSize)
+	next := make([]byte, 4)
+	binary.BigEndian.PutUint32(next, dbf.fptheader.NextFree)
+	if err := dbf.writeFPT(next, 0); err != nil {
+		return 0, err
+	}
+	return block, nil
+}
+
+// setNextFree sets the next free block of the FPT file, it is used to free blocks written for a record that
+// could not be written
+func (dbf *DBF) setNextFree(next uint32) error {
+	dbf.fptheader.NextFree = next
+	buf := make([]byte, 4)
+	binary.BigEndian.PutUint32(buf, next)
+	return dbf.writeFPT(buf, 0)
+}
+
+func unsupportedValue(val interface{}, f FieldHeader) error {
+	return fmt.Errorf("%w: %T in %s field", ErrUnsupportedValue, val, f.FieldType())
+}
+
+// asInt64 returns the value of all integer types as int64
+func asInt64(val interface{}) (int64, bool) {
+	switch v := val.(type) {
+	case int:
+		return int64(v), true
+	case int8:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint:
+		return int64(v), uint64(v) <= math.MaxInt64
+	case uint8:
+		return int64(v), true
+	case uint16:
+		return int64(v), true
+	case uint32:
+		return int64(v), true
+	case uint64:
+		return int64(v), v <= math.MaxInt64
+	}
+	return 0, false
+}
+
+// asFloat64 returns the value of all integer and float types as float64
+func asFloat64(val interface{}) (float64, bool) {
+	switch v := val.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	}
+	i, ok := asInt64(val)
+	return float64(i), ok
+}
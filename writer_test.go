@@ -0,0 +1,377 @@
+package dbf
+
+import (
+	"encoding/binary"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testFields returns fields of all types supported by CreateFile
+func testFields(t *testing.T) []FieldHeader {
+	t.Helper()
+	var fields []FieldHeader
+	for _, def := range []struct {
+		name     string
+		typ      byte
+		len, dec uint8
+	}{
+		{"ID", 'I', 0, 0},
+		{"NAME", 'C', 20, 0},
+		{"AMOUNT", 'N', 10, 2},
+		{"COUNT", 'N', 5, 0},
+		{"PRICE", 'Y', 0, 0},
+		{"RATE", 'B', 0, 0},
+		{"DAY", 'D', 0, 0},
+		{"STAMP", 'T', 0, 0},
+		{"ACTIVE", 'L', 0, 0},
+		{"NOTES", 'M', 0, 0},
+	} {
+		f, err := NewField(def.name, def.typ, def.len, def.dec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+func TestNewField(t *testing.T) {
+	f, err := NewField("naam", 'C', 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.FieldName() != "NAAM" || f.Len != 10 {
+		t.Errorf("unexpected field %+v", f)
+	}
+	if f, _ = NewField("DATUM", 'D', 0, 0); f.Len != 8 {
+		t.Errorf("want length 8 for a D field, have %d", f.Len)
+	}
+	for _, name := range []string{"", "TOOLONGNAME", "1ST", "A-B"} {
+		if _, err := NewField(name, 'C', 1, 0); err == nil {
+			t.Errorf("want error for field name %q", name)
+		}
+	}
+	if _, err := NewField("N", 'N', 4, 3); err == nil {
+		t.Error("want error for too many decimals")
+	}
+	if _, err := NewField("X", 'X', 1, 0); err == nil {
+		t.Error("want error for unsupported field type")
+	}
+}
+
+func TestCreateFileAppend(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "CREATED.DBF")
+	dbf, err := CreateFile(filename, testFields(t), new(UTF8Decoder), new(UTF8Encoder), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	day := time.Date(2021, 3, 4, 0, 0, 0, 0, time.UTC)
+	stamp := time.Date(2021, 3, 4, 13, 14, 15, 0, time.UTC)
+	if _, err := dbf.Append([]interface{}{1, "Jan", 12.5, 42, -3.25, 0.5, day, stamp, true, "first\r\nmemo"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dbf.Append([]interface{}{2, "Piet", nil, nil, nil, nil, nil, nil, false, nil}); err != nil {
+		t.Fatal(err)
+	}
+	if err := dbf.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	dbf, err = OpenFile(filename, new(UTF8Decoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbf.Close()
+
+	if dbf.NumRecords() != 2 || dbf.Header().FileVersion != 0x30 || dbf.Header().TableFlags != 0x02 {
+		t.Fatalf("unexpected header %+v", dbf.Header())
+	}
+	rec, err := dbf.RecordAt(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []interface{}{int32(1), "Jan                 ", 12.5, int64(42), -3.25, 0.5, day, stamp, true, "first\r\nmemo"}
+	for i, val := range rec.FieldSlice() {
+		if val != want[i] {
+			t.Errorf("field %s: want %#v, have %#v", dbf.Fields()[i].FieldName(), want[i], val)
+		}
+	}
+
+	rec, err = dbf.RecordAt(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := rec.Field(6); !v.(time.Time).IsZero() {
+		t.Errorf("want empty date, have %v", v)
+	}
+	if v, _ := rec.Field(9); v != "" {
+		t.Errorf("want empty memo, have %q", v)
+	}
+
+	report, err := dbf.Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() {
+		t.Errorf("want no issues in created file, have %v", report.Issues)
+	}
+}
+
+func TestAppendErrors(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "ERRORS.DBF")
+	dbf, err := CreateFile(filename, testFields(t), new(UTF8Decoder), new(UTF8Encoder), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbf.Close()
+
+	_, err = dbf.Append([]interface{}{1, "Jan", 123456789.5, 1, 0, 0, nil, nil, nil, nil})
+	var fieldErr *FieldError
+	if !errors.As(err, &fieldErr) || fieldErr.Name != "AMOUNT" || !errors.Is(err, ErrFieldOverflow) {
+		t.Errorf("want overflow FieldError for AMOUNT, have %v", err)
+	}
+	_, err = dbf.Append([]interface{}{1, "Jan Jansen van der Meer", 1, 1, 0, 0, nil, nil, nil, nil})
+	if !errors.As(err, &fieldErr) || fieldErr.Name != "NAME" || !errors.Is(err, ErrFieldOverflow) {
+		t.Errorf("want overflow FieldError for NAME, have %v", err)
+	}
+	_, err = dbf.Append([]interface{}{1, 2, 0, 1, 0, 0, nil, nil, nil, nil})
+	if !errors.Is(err, ErrUnsupportedValue) {
+		t.Errorf("want ErrUnsupportedValue, have %v", err)
+	}
+	if _, err = dbf.Append([]interface{}{1}); err == nil {
+		t.Error("want error for wrong number of values")
+	}
+	if dbf.NumRecords() != 0 {
+		t.Errorf("want no records after errors, have %d", dbf.NumRecords())
+	}
+
+	ro, err := OpenFile(filepath.Join("testdata", "TEST.DBF"), new(Win1250Decoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ro.Close()
+	if _, err := ro.Append(make([]interface{}, ro.NumFields())); err != ErrReadOnly {
+		t.Errorf("want ErrReadOnly, have %v", err)
+	}
+}
+
+func TestOpenFileRW(t *testing.T) {
+	filename := copyTestFiles(t, t.TempDir(), "TEST.DBF")
+	dbf, err := OpenFileRW(filename, new(Win1250Decoder), new(Win1250Encoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbf.Close()
+
+	values := make([]interface{}, dbf.NumFields())
+	values[7] = "ČESKÝ"
+	values[9] = "nový memo"
+	recno, err := dbf.Append(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recno != 4 || dbf.NumRecords() != 5 {
+		t.Fatalf("want record 4 of 5, have %d of %d", recno, dbf.NumRecords())
+	}
+	rec, err := dbf.RecordAt(recno)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := rec.Field(7); v != "ČESKÝ"+strings.Repeat(" ", 35) {
+		t.Errorf("unexpected COMP_NAME %q", v)
+	}
+	if v, _ := rec.Field(9); v != "nový memo" {
+		t.Errorf("unexpected MELDING %q", v)
+	}
+}
+
+// productID reads the first field of record recno in dbase_31.dbf, the _NullFlags field can not be read using RecordAt
+func productID(t *testing.T, dbf *DBF, recno uint32) int64 {
+	t.Helper()
+	rec, err := dbf.ReadRecordInto(recno, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := rec.Int64(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func TestAutoIncrement(t *testing.T) {
+	filename := copyTestFiles(t, t.TempDir(), "dbase_31.dbf")
+	dbf, err := OpenFileRW(filename, new(Win1250Decoder), new(Win1250Encoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbf.Close()
+
+	if !dbf.fields[0].IsAutoIncrement() || dbf.fields[1].IsAutoIncrement() {
+		t.Fatal("want only PRODUCTID to be an autoincrement field")
+	}
+	if next, err := dbf.NextAutoIncrement(0); err != nil || next != 78 {
+		t.Fatalf("want next value 78, have %d, %v", next, err)
+	}
+	if _, err := dbf.NextAutoIncrement(1); !errors.Is(err, ErrInvalidField) {
+		t.Errorf("want ErrInvalidField for a field without autoincrement, have %v", err)
+	}
+	if _, err := dbf.NextAutoIncrement(-1); err != ErrInvalidField {
+		t.Errorf("want ErrInvalidField for an invalid field, have %v", err)
+	}
+
+	// a second handle appending to the same file, the values and record count are read again from disk
+	other, err := OpenFileRW(filename, new(Win1250Decoder), new(Win1250Encoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+
+	values := make([]interface{}, dbf.NumFields())
+	for i, table := range []*DBF{dbf, other, dbf} {
+		recno, err := table.Append(values)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if recno != uint32(77+i) {
+			t.Errorf("want record number %d, have %d", 77+i, recno)
+		}
+		if id := productID(t, table, recno); id != int64(78+i) {
+			t.Errorf("want PRODUCTID %d, have %d", 78+i, id)
+		}
+	}
+	if values[0] != nil {
+		t.Error("the values passed to Append must not be modified")
+	}
+
+	// explicit values are written without changing the next value
+	values[0] = int32(500)
+	recno, err := other.Append(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id := productID(t, other, recno); id != 500 {
+		t.Errorf("want PRODUCTID 500, have %d", id)
+	}
+	if next, err := dbf.NextAutoIncrement(0); err != nil || next != 81 {
+		t.Errorf("want next value 81, have %d, %v", next, err)
+	}
+
+	ro, err := OpenFile(filename, new(Win1250Decoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ro.Close()
+	if ro.NumRecords() != 81 || ro.Fields()[0].Next != 81 {
+		t.Errorf("want 81 records and next value 81, have %d and %d", ro.NumRecords(), ro.Fields()[0].Next)
+	}
+}
+
+func TestCreateFileAutoIncrement(t *testing.T) {
+	id, err := NewField("ID", 'I', 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id.SetAutoIncrement(10, 5)
+	name, err := NewField("NAME", 'C', 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbf, err := CreateFile(filepath.Join(t.TempDir(), "AUTOINC.DBF"), []FieldHeader{id, name}, new(Win1250Decoder), new(Win1250Encoder), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbf.Close()
+	if dbf.Header().FileVersion != 0x31 {
+		t.Errorf("want file version 0x31, have %#x", dbf.Header().FileVersion)
+	}
+	for _, want := range []int32{10, 15, 20} {
+		recno, err := dbf.Append([]interface{}{nil, "x"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		rec, err := dbf.RecordAt(recno)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v, _ := rec.Field(0); v != want {
+			t.Errorf("want ID %d, have %v", want, v)
+		}
+	}
+}
+
+func TestAppendMemoNotWrittenOnError(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "MEMO.DBF")
+	fields := newFields(t, "NOTES", byte('M'), 0, 0, "NAME", byte('C'), 3, 0)
+	dbf, err := CreateFile(filename, fields, new(UTF8Decoder), new(UTF8Encoder), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbf.Close()
+
+	next := dbf.fptheader.NextFree
+	if _, err := dbf.Append([]interface{}{"memo", "too long"}); !errors.Is(err, ErrFieldOverflow) {
+		t.Errorf("want ErrFieldOverflow, have %v", err)
+	}
+	if err := dbf.refreshHeader(); err != nil {
+		t.Fatal(err)
+	}
+	if dbf.fptheader.NextFree != next {
+		t.Errorf("want next free block %d after a failed Append, have %d", next, dbf.fptheader.NextFree)
+	}
+	recno, err := dbf.Append([]interface{}{"memo", "ok"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec, err := dbf.ReadRecordInto(recno, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block, _ := rec.Bytes(0); binary.LittleEndian.Uint32(block) != next {
+		t.Errorf("want the memo in block %d, have %d", next, binary.LittleEndian.Uint32(block))
+	}
+}
+
+func TestAppendNull(t *testing.T) {
+	filename := copyTestFiles(t, t.TempDir(), "dbase_31.dbf")
+	dbf, err := OpenFileRW(filename, new(Win1250Decoder), new(Win1250Encoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbf.Close()
+
+	values := make([]interface{}, dbf.NumFields())
+	values[1] = "Null"
+	recno, err := dbf.Append(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec, err := dbf.ReadRecordInto(recno, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// SUPPLIERID to REORDERLEV are nullable, PRODUCTID is assigned the next autoincrement value
+	for i, f := range dbf.Fields() {
+		want := f.IsNullable() && values[i] == nil && !f.IsAutoIncrement()
+		if null := rec.IsNull(i); null != want {
+			t.Errorf("field %s: want null %t, have %t", f.FieldName(), want, null)
+		}
+	}
+
+	// the null flags passed are written as is
+	values[dbf.FieldPos("_NullFlags")] = []byte{0}
+	if recno, err = dbf.Append(values); err != nil {
+		t.Fatal(err)
+	}
+	if rec, err = dbf.ReadRecordInto(recno, nil); err != nil {
+		t.Fatal(err)
+	}
+	for i, f := range dbf.Fields() {
+		if rec.IsNull(i) {
+			t.Errorf("field %s: want not null with the null flags passed", f.FieldName())
+		}
+	}
+}